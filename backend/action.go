@@ -0,0 +1,144 @@
+package backend
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/fberrez/samantha/capsule"
+	"github.com/juju/errors"
+)
+
+type (
+	// Action is a function triggered when its intent is recognized by the
+	// backend provider. The returned strings replace the provider responses.
+	Action func(ctx context.Context, capsule *capsule.Capsule) ([]string, error)
+
+	// ComposableAction is an action which chooses how its responses are
+	// combined with the provider responses.
+	ComposableAction func(ctx context.Context, capsule *capsule.Capsule) (*ActionResult, error)
+
+	// ActionResult is the result of a composable action.
+	ActionResult struct {
+		// Responses is a slice containing the responses of the action.
+		Responses []string
+
+		// Mode is the way the responses are combined with the provider
+		// responses. They replace them when it is empty.
+		Mode ResponseMode
+	}
+
+	// ResponseMode is the way the responses of an action are combined with
+	// the provider responses.
+	ResponseMode string
+
+	// ActionRegistry maps intent names to actions.
+	ActionRegistry struct {
+		// mutex protects the actions map.
+		mutex sync.RWMutex
+
+		// actions indexes the registered actions by intent name.
+		actions map[string]ComposableAction
+	}
+)
+
+const (
+	// ModeReplace replaces the provider responses by the action responses.
+	ModeReplace ResponseMode = "replace"
+
+	// ModePrepend sends the action responses before the provider responses.
+	ModePrepend ResponseMode = "prepend"
+
+	// ModeAppend sends the action responses after the provider responses.
+	ModeAppend ResponseMode = "append"
+)
+
+var (
+	// actions is the registry containing all the actions registered with
+	// RegisterAction.
+	actions = NewActionRegistry()
+)
+
+// NewActionRegistry initializes a new empty action registry.
+func NewActionRegistry() *ActionRegistry {
+	return &ActionRegistry{
+		actions: map[string]ComposableAction{},
+	}
+}
+
+// Register registers an action for the given intent. Its responses replace
+// the provider responses.
+func (r *ActionRegistry) Register(intent string, action Action) error {
+	if action == nil {
+		return errors.NotValidf("nil action for intent %s", intent)
+	}
+
+	return r.RegisterComposable(intent, func(ctx context.Context, capsule *capsule.Capsule) (*ActionResult, error) {
+		responses, err := action(ctx, capsule)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ActionResult{Responses: responses, Mode: ModeReplace}, nil
+	})
+}
+
+// RegisterComposable registers a composable action for the given intent.
+func (r *ActionRegistry) RegisterComposable(intent string, action ComposableAction) error {
+	if action == nil {
+		return errors.NotValidf("nil action for intent %s", intent)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.actions[intent]; ok {
+		return errors.AlreadyExistsf("action for intent %s", intent)
+	}
+
+	r.actions[intent] = action
+	return nil
+}
+
+// Find returns the action registered for the given intent.
+func (r *ActionRegistry) Find(intent string) (ComposableAction, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	action, ok := r.actions[intent]
+	return action, ok
+}
+
+// RegisterAction registers an action which will be triggered when the given
+// intent is recognized by the backend provider.
+func RegisterAction(intent string, action Action) error {
+	return actions.Register(intent, action)
+}
+
+// RegisterComposableAction registers a composable action which will be
+// triggered when the given intent is recognized by the backend provider. Its
+// result chooses whether its responses replace the provider responses or are
+// sent before or after them.
+func RegisterComposableAction(intent string, action ComposableAction) error {
+	return actions.RegisterComposable(intent, action)
+}
+
+// CurrentTime is a sample action which responds with the current time in the
+// user timezone.
+func CurrentTime(ctx context.Context, capsule *capsule.Capsule) ([]string, error) {
+	return []string{"It is " + time.Now().In(UserLocation(capsule)).Format("15:04 MST")}, nil
+}
+
+// topIntent returns the intent with the highest confidence or nil if there is
+// no intent.
+func topIntent(intents []*provider.Intent) *provider.Intent {
+	var top *provider.Intent
+	for _, intent := range intents {
+		if top == nil || intent.Confidence > top.Confidence {
+			top = intent
+		}
+	}
+
+	return top
+}
@@ -0,0 +1,170 @@
+package backend
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/fberrez/samantha/capsule"
+	"github.com/juju/errors"
+)
+
+func TestActionRegistry(t *testing.T) {
+	registry := NewActionRegistry()
+	action := func(ctx context.Context, c *capsule.Capsule) ([]string, error) {
+		return []string{"sunny"}, nil
+	}
+
+	if err := registry.Register("get_weather", action); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	if err := registry.Register("get_weather", action); !errors.IsAlreadyExists(err) {
+		t.Errorf("Register() twice error = %v, want already exists", err)
+	}
+
+	if err := registry.Register("nil_action", nil); !errors.IsNotValid(err) {
+		t.Errorf("Register(nil) error = %v, want not valid", err)
+	}
+
+	found, ok := registry.Find("get_weather")
+	if !ok {
+		t.Fatal("Find() did not find the registered action")
+	}
+
+	result, err := found(context.Background(), &capsule.Capsule{})
+	if err != nil {
+		t.Fatalf("action error = %v", err)
+	}
+
+	if !reflect.DeepEqual(result.Responses, []string{"sunny"}) || result.Mode != ModeReplace {
+		t.Errorf("action result = %+v, want the responses in replace mode", result)
+	}
+
+	if _, ok := registry.Find("unknown"); ok {
+		t.Error("Find() found an action for an unregistered intent")
+	}
+}
+
+func TestActionDispatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		intent     string
+		confidence float32
+		want       []string
+	}{
+		{"registered intent", "get_weather", 0.9, []string{"It is sunny"}},
+		{"low confidence", "get_weather", 0.2, []string{"provider text"}},
+		{"unregistered intent", "greetings", 0.9, []string{"provider text"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &fakeProvider{}
+			b, toBackend, toFrontend := newTestBackend(t, p, "minConfidence: 0.5\n")
+			b.actions = NewActionRegistry()
+			b.actions.Register("get_weather", func(ctx context.Context, c *capsule.Capsule) ([]string, error) {
+				return []string{"It is sunny"}, nil
+			})
+			p.answer = func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+				return intentResponse(tt.intent, tt.confidence, "provider text"), nil
+			}
+			start(t, b, toBackend)
+
+			c := exchange(t, toBackend, toFrontend, newCapsule("alice", "weather?"))
+			if c.Error != nil {
+				t.Fatalf("capsule error = %v", c.Error)
+			}
+
+			if !reflect.DeepEqual(c.Responses, tt.want) {
+				t.Errorf("responses = %v, want %v", c.Responses, tt.want)
+			}
+		})
+	}
+}
+
+func TestActionError(t *testing.T) {
+	p := &fakeProvider{}
+	b, toBackend, toFrontend := newTestBackend(t, p, "")
+	b.actions = NewActionRegistry()
+	b.actions.Register("get_weather", func(ctx context.Context, c *capsule.Capsule) ([]string, error) {
+		return nil, errors.New("weather service down")
+	})
+	p.answer = func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+		return intentResponse("get_weather", 1, "provider text"), nil
+	}
+	start(t, b, toBackend)
+
+	c := exchange(t, toBackend, toFrontend, newCapsule("alice", "weather?"))
+	if c.Error == nil || !strings.Contains(c.Error.Error(), "weather service down") {
+		t.Errorf("capsule error = %v, want the action error", c.Error)
+	}
+}
+
+func TestComposableAction(t *testing.T) {
+	tests := []struct {
+		name string
+		mode ResponseMode
+		want []string
+	}{
+		{"prepend", ModePrepend, []string{"It is sunny", "provider text"}},
+		{"append", ModeAppend, []string{"provider text", "It is sunny"}},
+		{"replace", ModeReplace, []string{"It is sunny"}},
+		{"default mode", "", []string{"It is sunny"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &fakeProvider{}
+			b, toBackend, toFrontend := newTestBackend(t, p, "")
+			b.actions = NewActionRegistry()
+			b.actions.RegisterComposable("get_weather", func(ctx context.Context, c *capsule.Capsule) (*ActionResult, error) {
+				return &ActionResult{Responses: []string{"It is sunny"}, Mode: tt.mode}, nil
+			})
+			p.answer = func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+				return intentResponse("get_weather", 1, "provider text"), nil
+			}
+			start(t, b, toBackend)
+
+			c := exchange(t, toBackend, toFrontend, newCapsule("alice", "weather?"))
+			if c.Error != nil {
+				t.Fatalf("capsule error = %v", c.Error)
+			}
+
+			if !reflect.DeepEqual(c.Responses, tt.want) {
+				t.Errorf("responses = %v, want %v", c.Responses, tt.want)
+			}
+		})
+	}
+}
+
+func TestComposableActionInvalidMode(t *testing.T) {
+	p := &fakeProvider{}
+	b, toBackend, toFrontend := newTestBackend(t, p, "")
+	b.actions = NewActionRegistry()
+	b.actions.RegisterComposable("get_weather", func(ctx context.Context, c *capsule.Capsule) (*ActionResult, error) {
+		return &ActionResult{Responses: []string{"It is sunny"}, Mode: "shuffle"}, nil
+	})
+	p.answer = func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+		return intentResponse("get_weather", 1, "provider text"), nil
+	}
+	start(t, b, toBackend)
+
+	c := exchange(t, toBackend, toFrontend, newCapsule("alice", "weather?"))
+	if c.Error == nil || !strings.Contains(c.Error.Error(), "shuffle") {
+		t.Errorf("capsule error = %v, want the invalid mode", c.Error)
+	}
+}
+
+func TestCurrentTime(t *testing.T) {
+	responses, err := CurrentTime(context.Background(), &capsule.Capsule{Timezone: "Europe/Paris"})
+	if err != nil {
+		t.Fatalf("CurrentTime() error = %v", err)
+	}
+
+	if len(responses) != 1 || !strings.HasPrefix(responses[0], "It is ") {
+		t.Errorf("CurrentTime() = %v, want the current time", responses)
+	}
+}
@@ -1,18 +1,30 @@
 package backend
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
+	"hash/fnv"
 	"os"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
 
 	"github.com/fberrez/samantha/backend/provider"
+	"github.com/fberrez/samantha/backend/provider/botpress"
+	"github.com/fberrez/samantha/backend/provider/echo"
+	"github.com/fberrez/samantha/backend/provider/keyword"
+	"github.com/fberrez/samantha/backend/provider/menu"
+	"github.com/fberrez/samantha/backend/provider/openai"
 	"github.com/fberrez/samantha/backend/provider/watson"
+	"github.com/fberrez/samantha/backend/provider/watsonv1"
 	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/config"
+	"github.com/fberrez/samantha/deadletter"
 	"github.com/juju/errors"
 	log "github.com/sirupsen/logrus"
-	yaml "gopkg.in/yaml.v2"
 )
 
 type (
@@ -23,10 +35,280 @@ type (
 		// activatedProvider is the running backend provider.
 		activatedProvider provider.Provider
 
-		capsule chan *capsule.Capsule
+		// hintedProviders indexes by label the additional providers which are
+		// called only for the capsules whose backend hint is their label.
+		hintedProviders map[string]provider.Provider
+
+		// mainHistory keeps the last turns of the conversations with the main
+		// provider.
+		mainHistory *provider.History
+
+		// hintedHistories indexes by label the histories of the conversations
+		// with the hinted providers.
+		hintedHistories map[string]*provider.History
+
+		// toBackend is the channel receiving the capsules sent by the frontend.
+		toBackend <-chan *capsule.Capsule
+
+		// toFrontend is the channel on which the processed capsules are sent
+		// back to the frontend.
+		toFrontend chan<- *capsule.Capsule
+
+		// actions is the registry of the actions triggered by intents.
+		actions *ActionRegistry
+
+		// minConfidence is the minimum confidence an intent must have to trigger
+		// its action.
+		minConfidence float32
+
+		// sentimentAnalyzer analyzes the sentiment of the capsules content. The
+		// analysis is disabled when it is nil.
+		sentimentAnalyzer SentimentAnalyzer
+
+		// negativeSentimentThreshold is the sentiment under which a capsule
+		// content is considered as very negative.
+		negativeSentimentThreshold float32
+
+		// negativeSentimentResponse is the response sent instead of the provider
+		// response when a capsule content is very negative.
+		negativeSentimentResponse string
+
+		// sessionResetNotice is the notice sent to the user when its
+		// conversation has been reset.
+		sessionResetNotice string
+
+		// unsupportedAttachmentResponse is the response sent when the provider
+		// cannot process the files sent by the user.
+		unsupportedAttachmentResponse string
+
+		// escalation decides when a conversation is escalated to a human operator.
+		escalation *escalation
+
+		// summarizer summarizes the conversations for the operators. The
+		// summaries are disabled when it is nil.
+		summarizer Summarizer
+
+		// clarification asks the user to confirm the intents whose confidence
+		// is uncertain.
+		clarification *clarification
+
+		// intentFilter rejects the outputs of the intents which are blocked or
+		// not allowed.
+		intentFilter *intentFilter
+
+		// variants replaces the provider output of the intents which have
+		// response variants.
+		variants *responseVariants
+
+		// responseTemplate is the template applied to each response. Responses
+		// are not modified when it is nil.
+		responseTemplate *template.Template
+
+		// notifier posts the processed conversations to an outbound webhook. It
+		// is nil when no webhook is configured.
+		notifier *webhookNotifier
+
+		// processAttempts is the number of attempts of the provider call of a
+		// capsule.
+		processAttempts int
+
+		// maxResponses is the maximum number of responses of a capsule sent to
+		// the frontend.
+		maxResponses int
+
+		// idle prompts the idle users and closes their conversation. It is nil
+		// when the idle timeouts are disabled.
+		idle *idleSweeper
+
+		// clock gives the time to the idle sweeper.
+		clock Clock
+
+		// statusUpdates enables the interim statuses sent to the frontend
+		// while the capsules are processed.
+		statusUpdates bool
+
+		// deadLetter stores the capsules whose processing failed. They are
+		// discarded when it is nil.
+		deadLetter deadletter.Sink
+
+		// handler processes the capsules. It is the chain of the registered
+		// middlewares and the backend middlewares ending in the provider call.
+		handler Handler
+
+		// workers is the number of workers processing capsules concurrently.
+		workers int
+
+		// inFlight is the number of capsules received and not yet sent back to
+		// the frontend. It is accessed atomically.
+		inFlight int64
+
+		// ctx is the context of the backend. It is canceled on shutdown to
+		// abort the capsules being processed.
+		ctx context.Context
+
+		// cancel cancels the backend context.
+		cancel context.CancelFunc
 
 		// wg is local wait group which handles all providers routines.
 		wg *sync.WaitGroup
+
+		// shutdownErr aggregates the errors returned by the providers on
+		// shutdown. It is nil when they stopped cleanly.
+		shutdownErr error
+	}
+
+	// Config is the structured backend configuration.
+	Config struct {
+		// Config is the configuration of the backend provider.
+		provider.Config `yaml:",inline"`
+
+		// Providers is a slice containing the configurations of the additional
+		// providers. They are called instead of the main provider for the
+		// messages whose backend hint is their label.
+		Providers []*provider.Config `json:"providers" yaml:"providers"`
+
+		// MinConfidence is the minimum confidence an intent must have to trigger
+		// its action.
+		MinConfidence float32 `json:"minConfidence" yaml:"minConfidence"`
+
+		// BackendWorkers is the number of workers processing capsules
+		// concurrently. It defaults to 1.
+		BackendWorkers int `json:"backendWorkers" yaml:"backendWorkers"`
+
+		// SentimentAnalysis enables the sentiment analysis of user messages.
+		SentimentAnalysis bool `json:"sentimentAnalysis" yaml:"sentimentAnalysis"`
+
+		// NegativeSentimentThreshold is the sentiment under which a user message
+		// is considered as very negative. It defaults to -0.5 when it is not
+		// set, zero being a valid threshold.
+		NegativeSentimentThreshold *float32 `json:"negativeSentimentThreshold" yaml:"negativeSentimentThreshold"`
+
+		// NegativeSentimentResponse is the response sent instead of the provider
+		// response when a user message is very negative. It is disabled when
+		// it is empty.
+		NegativeSentimentResponse string `json:"negativeSentimentResponse" yaml:"negativeSentimentResponse"`
+
+		// EscalationIntents are the intents triggering an escalation to a human
+		// operator (ex: talk_to_human).
+		EscalationIntents []string `json:"escalationIntents" yaml:"escalationIntents"`
+
+		// EscalationCommand is the user command triggering an escalation. It
+		// defaults to /human.
+		EscalationCommand string `json:"escalationCommand" yaml:"escalationCommand"`
+
+		// EscalationLowConfidence is the number of consecutive responses with a
+		// top intent confidence lower than MinConfidence triggering an
+		// escalation. It is disabled when it is zero.
+		EscalationLowConfidence int `json:"escalationLowConfidence" yaml:"escalationLowConfidence"`
+
+		// EscalationResponse is the response sent to the user when the
+		// conversation is escalated.
+		EscalationResponse string `json:"escalationResponse" yaml:"escalationResponse"`
+
+		// ClarifyLow and ClarifyHigh bound the confidence band of the top
+		// intents which must be confirmed by the user ("Did you mean X?").
+		// A top intent under ClarifyLow is answered with ClarifyFallback. The
+		// clarification is disabled when ClarifyHigh is zero.
+		ClarifyLow  float32 `json:"clarifyLow" yaml:"clarifyLow"`
+		ClarifyHigh float32 `json:"clarifyHigh" yaml:"clarifyHigh"`
+
+		// ClarifyFallback is the response sent when the top intent confidence
+		// is under ClarifyLow or when the user rejects the intent.
+		ClarifyFallback string `json:"clarifyFallback" yaml:"clarifyFallback"`
+
+		// AllowedIntents are the only intents whose output or action is sent to
+		// the user. Every intent is allowed when it is empty.
+		AllowedIntents []string `json:"allowedIntents" yaml:"allowedIntents"`
+
+		// BlockedIntents are the intents whose output or action is never sent
+		// to the user.
+		BlockedIntents []string `json:"blockedIntents" yaml:"blockedIntents"`
+
+		// BlockedIntentResponse is the response sent instead of the output of
+		// a blocked or not allowed intent.
+		BlockedIntentResponse string `json:"blockedIntentResponse" yaml:"blockedIntentResponse"`
+
+		// SessionResetNotice is the notice sent to the user when its
+		// conversation has been reset after MaxTurns messages. No notice is sent
+		// when it is empty.
+		SessionResetNotice string `json:"sessionResetNotice" yaml:"sessionResetNotice"`
+
+		// IdlePromptAfter is the idle duration after which IdlePrompt is sent
+		// to a user gone silent. No prompt is sent when it is zero.
+		IdlePromptAfter time.Duration `json:"idlePromptAfter" yaml:"idlePromptAfter"`
+
+		// IdlePrompt is the message sent to the idle users.
+		IdlePrompt string `json:"idlePrompt" yaml:"idlePrompt"`
+
+		// IdleCloseAfter is the idle duration after which the conversation of
+		// a user is reset and IdleGoodbye is sent. Idle conversations are never
+		// closed when it is zero.
+		IdleCloseAfter time.Duration `json:"idleCloseAfter" yaml:"idleCloseAfter"`
+
+		// IdleGoodbye is the message sent when an idle conversation is closed.
+		IdleGoodbye string `json:"idleGoodbye" yaml:"idleGoodbye"`
+
+		// UnsupportedAttachmentResponse is the response sent when the provider
+		// cannot process the files sent by the user.
+		UnsupportedAttachmentResponse string `json:"unsupportedAttachmentResponse" yaml:"unsupportedAttachmentResponse"`
+
+		// CircuitBreakerThreshold is the number of consecutive provider failures
+		// after which the provider is not called anymore during a cooldown. The
+		// circuit breaker is disabled when it is zero.
+		CircuitBreakerThreshold int `json:"circuitBreakerThreshold" yaml:"circuitBreakerThreshold"`
+
+		// CircuitBreakerCooldown is the duration during which the provider is
+		// not called once the circuit breaker opened. It defaults to 30s.
+		CircuitBreakerCooldown time.Duration `json:"circuitBreakerCooldown" yaml:"circuitBreakerCooldown"`
+
+		// CircuitBreakerFallback is the response sent while the circuit breaker
+		// is open.
+		CircuitBreakerFallback string `json:"circuitBreakerFallback" yaml:"circuitBreakerFallback"`
+
+		// NotifyWebhookURL is the URL of the outbound webhook to which each
+		// processed conversation is posted. It is disabled when it is empty.
+		NotifyWebhookURL string `json:"notifyWebhookURL" yaml:"notifyWebhookURL"`
+
+		// NotifyWebhookSecret is the shared secret signing the webhook requests
+		// with HMAC-SHA256.
+		NotifyWebhookSecret string `json:"notifyWebhookSecret" yaml:"notifyWebhookSecret"`
+
+		// ResponseVariants indexes by intent the responses sent instead of the
+		// provider output. One of them is picked at random each time the intent
+		// is recognized with a confidence higher than MinConfidence.
+		ResponseVariants map[string][]string `json:"responseVariants" yaml:"responseVariants"`
+
+		// ProcessAttempts is the number of attempts of the provider call of a
+		// capsule, when the call fails. It defaults to 1.
+		ProcessAttempts int `json:"processAttempts" yaml:"processAttempts"`
+
+		// DeadLetterFile is the path of the file to which the capsules whose
+		// processing failed are appended. They are discarded when it is empty.
+		DeadLetterFile string `json:"deadLetterFile" yaml:"deadLetterFile"`
+
+		// MaxResponses is the maximum number of responses of a capsule sent to
+		// the frontend, protecting the users from a misconfigured provider
+		// flooding them. The extra responses are dropped. It defaults to 50.
+		MaxResponses int `json:"maxResponses" yaml:"maxResponses"`
+
+		// StatusUpdates sends interim statuses to the frontend while a capsule
+		// is processed: typing when the processing starts, then the statuses
+		// reported by the actions with ReportStatus.
+		StatusUpdates bool `json:"statusUpdates" yaml:"statusUpdates"`
+
+		// SummaryProvider is the label of the provider summarizing the
+		// conversations for the operators: the main provider or one of the
+		// additional providers. The summaries are disabled when it is empty.
+		SummaryProvider string `json:"summaryProvider" yaml:"summaryProvider"`
+
+		// SummaryPrompt is the instruction sent to the summary provider before
+		// the transcript of the conversation.
+		SummaryPrompt string `json:"summaryPrompt" yaml:"summaryPrompt"`
+
+		// ResponseTemplate is a text/template applied to each response, with the
+		// fields .Text, .User, .Intent, .Locale, .Timezone and .Now. Responses
+		// are not modified when it is empty.
+		ResponseTemplate string `json:"responseTemplate" yaml:"responseTemplate"`
 	}
 )
 
@@ -38,6 +320,21 @@ const (
 	// defaultConfigFilePath is the default path of the configuration file
 	// when the environment variable has not been initialized.
 	defaultConfigFilePath = "backend/config.yaml"
+
+	// defaultWorkers is the default number of workers.
+	defaultWorkers = 1
+
+	// defaultMaxResponses is the default maximum number of responses of a
+	// capsule. It is far above the responses of a normal answer.
+	defaultMaxResponses = 50
+
+	// defaultNegativeSentimentThreshold is the default sentiment under which a
+	// user message is considered as very negative.
+	defaultNegativeSentimentThreshold = -0.5
+
+	// defaultUnsupportedAttachmentResponse is the default response sent when
+	// the provider cannot process files.
+	defaultUnsupportedAttachmentResponse = "Sorry, I cannot read files yet."
 )
 
 var (
@@ -46,33 +343,158 @@ var (
 
 	// providerCollection indexes all implemented providers.
 	providerCollection map[string]provider.Provider = map[string]provider.Provider{
-		"watson": &watson.Watson{},
+		"watson":   &watson.Watson{},
+		"watsonv1": &watsonv1.WatsonV1{},
+		"openai":   &openai.OpenAI{},
+		"botpress": &botpress.Botpress{},
+		"keyword":  &keyword.Keyword{},
+		"menu":     &menu.Menu{},
+		"echo":     &echo.Echo{},
 	}
 )
 
-// New initiliazes a new backend providers manager.
-func New(capsuleChan chan *capsule.Capsule) (*Backend, error) {
+// New initiliazes a new backend providers manager. The capsules are received
+// on toBackend and sent back processed on toFrontend.
+func New(toBackend <-chan *capsule.Capsule, toFrontend chan<- *capsule.Capsule) (*Backend, error) {
 	// Loads a new structured configuration with the informations of a given
 	// configuration file.
-	providerConfig, err := loadConfig()
+	config, err := loadConfig()
 	if err != nil {
 		return nil, errors.Annotate(err, "initiliazing backend")
 	}
 
 	// Loads backend providers defined as activated.
-	p, err := loadProvider(providerConfig)
+	p, err := loadProvider(&config.Config)
+	if err != nil {
+		return nil, errors.Annotate(err, "initiliazing backend")
+	}
+
+	if config.CircuitBreakerThreshold > 0 {
+		p = newCircuitBreaker(p, config.CircuitBreakerThreshold, config.CircuitBreakerCooldown, config.CircuitBreakerFallback)
+	}
+
+	// Loads the additional providers selected by the backend hints.
+	hinted := map[string]provider.Provider{}
+	hintedHistories := map[string]*provider.History{}
+	for _, providerConfig := range config.Providers {
+		if providerConfig.Label == config.Label {
+			return nil, errors.AlreadyExistsf("provider %s", providerConfig.Label)
+		}
+
+		hp, err := loadProvider(providerConfig)
+		if err != nil {
+			return nil, errors.Annotate(err, "initiliazing backend")
+		}
+
+		hinted[providerConfig.Label] = hp
+		hintedHistories[providerConfig.Label] = provider.NewHistory(2 * providerConfig.HistoryTurns)
+	}
+
+	workers := config.BackendWorkers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+
+	responseTemplate, err := newResponseTemplate(config.ResponseTemplate)
+	if err != nil {
+		return nil, errors.Annotate(err, "initiliazing backend")
+	}
+
+	var threshold float32 = defaultNegativeSentimentThreshold
+	if config.NegativeSentimentThreshold != nil {
+		threshold = *config.NegativeSentimentThreshold
+	}
+
+	unsupportedAttachmentResponse := config.UnsupportedAttachmentResponse
+	if len(unsupportedAttachmentResponse) == 0 {
+		unsupportedAttachmentResponse = defaultUnsupportedAttachmentResponse
+	}
+
+	attempts := config.ProcessAttempts
+	if attempts <= 0 {
+		attempts = defaultProcessAttempts
+	}
+
+	maxResponses := config.MaxResponses
+	if maxResponses <= 0 {
+		maxResponses = defaultMaxResponses
+	}
+
+	var deadLetter deadletter.Sink
+	if len(config.DeadLetterFile) > 0 {
+		deadLetter = deadletter.NewFile(config.DeadLetterFile)
+	}
+
+	summarizer, err := newSummarizer(config, p, hinted)
 	if err != nil {
 		return nil, errors.Annotate(err, "initiliazing backend")
 	}
 
-	return &Backend{
-		activatedProvider: p,
-		capsule:           capsuleChan,
-		wg:                &sync.WaitGroup{},
-	}, nil
+	var analyzer SentimentAnalyzer
+	if config.SentimentAnalysis {
+		analyzer = NewLexiconAnalyzer()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Backend{
+		activatedProvider:             p,
+		hintedProviders:               hinted,
+		mainHistory:                   provider.NewHistory(2 * config.HistoryTurns),
+		hintedHistories:               hintedHistories,
+		toBackend:                     toBackend,
+		toFrontend:                    toFrontend,
+		actions:                       actions,
+		minConfidence:                 config.MinConfidence,
+		sentimentAnalyzer:             analyzer,
+		negativeSentimentThreshold:    threshold,
+		negativeSentimentResponse:     config.NegativeSentimentResponse,
+		sessionResetNotice:            config.SessionResetNotice,
+		unsupportedAttachmentResponse: unsupportedAttachmentResponse,
+		escalation:                    newEscalation(config),
+		summarizer:                    summarizer,
+		clarification:                 newClarification(config),
+		intentFilter:                  newIntentFilter(config),
+		variants:                      newResponseVariants(config),
+		responseTemplate:              responseTemplate,
+		notifier:                      newWebhookNotifier(config.NotifyWebhookURL, config.NotifyWebhookSecret),
+		processAttempts:               attempts,
+		maxResponses:                  maxResponses,
+		statusUpdates:                 config.StatusUpdates,
+		idle:                          newIdleSweeper(config),
+		clock:                         SystemClock{},
+		deadLetter:                    deadLetter,
+		workers:                       workers,
+		ctx:                           ctx,
+		cancel:                        cancel,
+		wg:                            &sync.WaitGroup{},
+	}
+
+	backendMiddlewares := registeredMiddlewares()
+	if b.notifier != nil {
+		backendMiddlewares = append(backendMiddlewares, b.notifyMiddleware)
+	}
+
+	b.handler = chain(b.process, append(backendMiddlewares,
+		b.capabilitiesMiddleware,
+		b.renderMiddleware,
+		b.controlMiddleware,
+		b.escalationMiddleware,
+		b.sentimentMiddleware,
+	)...)
+
+	return b, nil
+}
+
+// SetSentimentAnalyzer replaces the sentiment analyzer of the backend. A nil
+// analyzer disables the sentiment analysis. It must be called before Start.
+func (b *Backend) SetSentimentAnalyzer(analyzer SentimentAnalyzer) {
+	b.sentimentAnalyzer = analyzer
 }
 
 // Start starts backend providers and user inputs listening.
+// Capsules are dispatched to the workers according to their user, so the
+// capsules of a same user are processed in order while the capsules of
+// different users are processed concurrently.
 func (b *Backend) Start(wg *sync.WaitGroup) {
 	defer wg.Done()
 	localLogger := logger.WithField("action", "listening")
@@ -85,40 +507,519 @@ func (b *Backend) Start(wg *sync.WaitGroup) {
 		b.wg.Wait()
 	}
 
+	// Starts the workers.
+	workersWg := &sync.WaitGroup{}
+	workers := make([]chan *capsule.Capsule, b.workers)
+	for i := range workers {
+		workers[i] = make(chan *capsule.Capsule)
+		workersWg.Add(1)
+		go b.work(workers[i], workersWg)
+	}
+
+	if b.idle != nil {
+		b.wg.Add(1)
+		go b.sweepIdle()
+	}
+
 	b.wg.Add(1)
 	localLogger.Info("Starting listening loop")
 listeningLoop:
 	for {
 		select {
-		case capsule, ok := <-b.capsule:
+		case capsule, ok := <-b.toBackend:
 			if !ok {
+				// The capsules being processed are aborted.
+				b.cancel()
+				for _, worker := range workers {
+					close(worker)
+				}
+
+				workersWg.Wait()
 				stop(b)
 				break listeningLoop
 			}
 
 			localLogger.Debugf("Capsule received from %s: %s", capsule.FrontendProvider, capsule.Content)
-			response, err := b.activatedProvider.Message(capsule.Content)
-			if err != nil {
-				if err = b.errorHandler(capsule, err); err != nil {
-					localLogger.WithError(err).Error("Error occurred while sending capsule content to the backend provider")
-				}
+			if b.idle != nil && len(capsule.Control) == 0 {
+				b.idle.touch(capsule, b.clock.Now())
+			}
+			atomic.AddInt64(&b.inFlight, 1)
+			workers[b.workerIndex(capsule)] <- capsule
+		}
+	}
+}
+
+// work processes the capsules received from the given channel and sends them
+// back to the frontend. A capsule waiting for the retry of its provider call
+// releases the worker, so the capsules of the other users go on. The next
+// capsules of its user are parked until it is processed, so the user is
+// answered in order.
+func (b *Backend) work(capsules <-chan *capsule.Capsule, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// parked indexes by user key the capsules waiting for a capsule of their
+	// user to be retried. A user waiting for a retry without parked capsules
+	// has an empty slice.
+	parked := map[string][]*capsule.Capsule{}
+
+	// resumed receives the user keys of the retried capsules once processed.
+	resumed := make(chan string)
+
+	for capsules != nil || len(parked) > 0 {
+		select {
+		case c, ok := <-capsules:
+			if !ok {
+				capsules = nil
 				break
 			}
 
-			localLogger.Debugf("Response received from %s: %s", b.activatedProvider.GetLabel(), response.String())
+			key := userKey(c)
+			if waiting, ok := parked[key]; ok {
+				parked[key] = append(waiting, c)
+				break
+			}
+
+			if b.run(c, key, resumed, wg) {
+				parked[key] = []*capsule.Capsule{}
+			}
+		case key := <-resumed:
+			waiting := parked[key]
+			delete(parked, key)
+
+			for i, c := range waiting {
+				if b.run(c, key, resumed, wg) {
+					parked[key] = waiting[i+1:]
+					break
+				}
+			}
+		}
+	}
+}
+
+// run processes the capsule in its own routine and waits for it. It returns
+// true when the capsule waits for a retry instead: the user key is sent on
+// resumed once it is processed.
+func (b *Backend) run(c *capsule.Capsule, key string, resumed chan<- string, wg *sync.WaitGroup) bool {
+	release := b.bindContext(c)
+	b.bindStatus(c)
+	r := bindRetry(c)
+
+	processed := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		b.finish(c, release, r, b.handler(c))
+		close(processed)
+		if r.isDetached() {
+			resumed <- key
+		}
+	}()
+
+	select {
+	case <-processed:
+	case <-r.detached:
+	}
+
+	// A capsule is detached before being processed, so both routines agree.
+	return r.isDetached()
+}
+
+// finish sends the processed capsule, or its error, back to the frontend.
+func (b *Backend) finish(c *capsule.Capsule, release context.CancelFunc, r *retry, err error) {
+	defer atomic.AddInt64(&b.inFlight, -1)
+
+	if err != nil {
+		release()
+		if err = b.errorHandler(c, err, r.attempts()); err != nil {
+			logger.WithError(err).Error("Error occurred while sending capsule content to the backend provider")
+		}
+		return
+	}
+
+	b.capResponses(c)
+	measureResponses(c)
+
+	// A streamed response is still generated once the capsule is sent: its
+	// context is released at the end of the stream.
+	if c.Stream != nil {
+		c.Stream = releaseOnClose(c.Stream, release)
+	} else {
+		release()
+	}
+
+	b.toFrontend <- c
+}
+
+// capResponses drops the responses of the capsule exceeding the maximum
+// number of responses, with the pauses preceding them.
+func (b *Backend) capResponses(c *capsule.Capsule) {
+	if len(c.Responses) <= b.maxResponses {
+		return
+	}
+
+	logger.WithFields(log.Fields{
+		"provider":  c.FrontendProvider,
+		"intent":    c.Intent,
+		"responses": len(c.Responses),
+	}).Warnf("Too many responses, truncating them to %d", b.maxResponses)
+
+	c.Responses = c.Responses[:b.maxResponses]
+
+	pauses := []*capsule.Pause{}
+	for _, pause := range c.Pauses {
+		if pause.Index < b.maxResponses {
+			pauses = append(pauses, pause)
+		}
+	}
+	c.Pauses = pauses
+}
+
+// bindContext sets on the capsule a context canceled when either the capsule
+// context or the backend context is canceled. The capsules received from a
+// serializing transport have no context of their own. The returned function
+// releases the context once the capsule is processed.
+func (b *Backend) bindContext(c *capsule.Capsule) context.CancelFunc {
+	ctx, cancel := context.WithCancel(c.Context())
+	go func() {
+		select {
+		case <-b.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	c.SetContext(ctx)
+	return cancel
+}
+
+// releaseOnClose forwards the chunks of the stream and calls release once the
+// stream is closed.
+func releaseOnClose(stream <-chan string, release context.CancelFunc) <-chan string {
+	forwarded := make(chan string)
+	go func() {
+		defer release()
+		defer close(forwarded)
+
+		for chunk := range stream {
+			forwarded <- chunk
+		}
+	}()
+
+	return forwarded
+}
+
+// workerIndex returns the index of the worker processing the capsules of the
+// capsule user.
+func (b *Backend) workerIndex(capsule *capsule.Capsule) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(userKey(capsule)))
+	return int(hash.Sum32() % uint32(b.workers))
+}
+
+// process sends the capsule content to the activated provider and fills the
+// capsule responses. It is the last handler of the middleware chain. If the
+// top intent has a registered action and a confidence higher than the minimum
+// confidence, the action output is used instead of the provider outputs. The
+// capsule is escalated to a human operator when an escalation is triggered.
+// The response of a streaming provider is sent as a capsule stream instead.
+func (b *Backend) process(capsule *capsule.Capsule) error {
+	if answered, err := b.clarify(capsule); answered {
+		return err
+	}
+
+	p, err := b.provider(capsule)
+	if err != nil {
+		return err
+	}
+
+	// The message and its answer are added to the history of the
+	// conversation, sent to the provider with the next messages.
+	history, input := b.history(capsule), b.input(capsule)
+
+	var response *provider.Response
+	if len(capsule.Attachments) > 0 {
+		// The files are only sent to the providers able to process them.
+		receiver, ok := p.(provider.AttachmentReceiver)
+		if !ok {
+			capsule.Responses = append(capsule.Responses, b.unsupportedAttachmentResponse)
+			return nil
+		}
+
+		response, err = b.call(capsule, func() (*provider.Response, error) {
+			return receiver.MessageAttachments(capsule.Context(), input)
+		})
+	} else if streamer, ok := p.(provider.Streamer); ok {
+		var stream <-chan string
+		_, err := b.call(capsule, func() (*provider.Response, error) {
+			var streamErr error
+			stream, streamErr = streamer.MessageStream(capsule.Context(), input)
+			return nil, streamErr
+		})
+		if err != nil {
+			return err
+		}
+
+		capsule.Stream = rememberOnClose(stream, history, input)
+		return nil
+	} else {
+		response, err = b.call(capsule, func() (*provider.Response, error) {
+			return p.Message(capsule.Context(), input)
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	// A fallback response is not an answer of the provider: it is not kept in
+	// the history.
+	capsule.ErrorCode = response.ErrorCode
+	if len(response.ErrorCode) == 0 {
+		remember(history, input, responseText(response))
+	}
+
+	logger.Debugf("Response received from %s: %s", p.GetLabel(), response.String())
+
+	if response.SessionReset && len(b.sessionResetNotice) > 0 {
+		capsule.Responses = append(capsule.Responses, b.sessionResetNotice)
+	}
+
+	intent := topIntent(response.Intents)
+	if intent != nil {
+		capsule.Intent = intent.Intent
+	}
+
+	addEntities(capsule, response.Entities)
+
+	if b.escalation.byIntent(userKey(capsule), intent, b.minConfidence) {
+		return b.Escalate(capsule)
+	}
+
+	intentName := ""
+	if intent != nil {
+		intentName = intent.Intent
+	}
+
+	if !b.intentFilter.allows(intentName) {
+		logger.Debugf("Output of intent %q rejected", intentName)
+		capsule.Responses = append(capsule.Responses, b.intentFilter.response)
+		return nil
+	}
+
+	if b.clarification.enabled() && intent != nil {
+		if intent.Confidence < b.clarification.low {
+			capsule.Responses = append(capsule.Responses, b.clarification.fallback)
+			return nil
+		}
+
+		if intent.Confidence < b.clarification.high {
+			capsule.Responses = append(capsule.Responses, b.clarification.ask(userKey(capsule), intent, response))
+			capsule.Suggestions = []string{clarifyYes, clarifyNo}
+			return nil
+		}
+	}
+
+	return b.answer(capsule, intent, response)
+}
+
+// answer fills the capsule responses with the output of the action of the
+// top intent when its confidence is higher than the minimum confidence,
+// combined with the provider outputs according to its mode, or a variant of
+// its responses if it has no action, or with the provider outputs otherwise.
+func (b *Backend) answer(capsule *capsule.Capsule, intent *provider.Intent, response *provider.Response) error {
+	if intent != nil && intent.Confidence >= b.minConfidence {
+		if action, ok := b.actions.Find(intent.Intent); ok {
+			logger.Debugf("Running action of intent %s", intent.Intent)
+			result, err := action(capsule.Context(), capsule)
+			if err != nil {
+				return errors.Annotatef(err, "running action of intent %s", intent.Intent)
+			}
+
+			if result == nil {
+				result = &ActionResult{}
+			}
 
-			for _, output := range response.Outputs {
-				capsule.Responses = append(capsule.Responses, output.Text)
+			switch result.Mode {
+			case ModePrepend:
+				capsule.Responses = append(capsule.Responses, result.Responses...)
+				addOutputs(capsule, response)
+			case ModeAppend:
+				addOutputs(capsule, response)
+				capsule.Responses = append(capsule.Responses, result.Responses...)
+			case ModeReplace, "":
+				capsule.Responses = append(capsule.Responses, result.Responses...)
+			default:
+				return errors.NotValidf("response mode %q of the action of intent %s", result.Mode, intent.Intent)
 			}
 
-			b.capsule <- capsule
+			return nil
+		}
+
+		if variant, ok := b.variants.pick(intent.Intent); ok {
+			capsule.Responses = append(capsule.Responses, variant)
+			capsule.Suggestions = response.Suggestions
+			return nil
 		}
 	}
+
+	addOutputs(capsule, response)
+	return nil
+}
+
+// addOutputs adds the provider outputs and suggestions to the capsule.
+func addOutputs(capsule *capsule.Capsule, response *provider.Response) {
+	capsule.Suggestions = response.Suggestions
+	for _, output := range response.Outputs {
+		addOutput(capsule, output)
+	}
+}
+
+// attachments converts the capsule attachments to provider attachments.
+func attachments(c *capsule.Capsule) []*provider.Attachment {
+	converted := make([]*provider.Attachment, 0, len(c.Attachments))
+	for _, attachment := range c.Attachments {
+		converted = append(converted, &provider.Attachment{
+			Name: attachment.Name,
+			MIME: attachment.MIME,
+			Data: attachment.Data,
+		})
+	}
+
+	return converted
+}
+
+// addEntities adds the provider entities to the capsule entities.
+func addEntities(c *capsule.Capsule, entities []*provider.Entity) {
+	for _, entity := range entities {
+		c.Entities = append(c.Entities, &capsule.Entity{
+			Entity:     entity.Entity,
+			Value:      entity.Value,
+			Confidence: entity.Confidence,
+		})
+	}
+}
+
+// addOutput adds a provider output to the capsule responses.
+func addOutput(c *capsule.Capsule, output *provider.Output) {
+	if output.Card != nil {
+		c.Cards = append(c.Cards, output.Card)
+		return
+	}
+
+	if output.Pause > 0 {
+		c.Pauses = append(c.Pauses, &capsule.Pause{
+			Index:    len(c.Responses),
+			Duration: output.Pause,
+			Typing:   output.Typing,
+		})
+		return
+	}
+
+	if len(output.Text) > 0 {
+		c.Responses = append(c.Responses, output.Text)
+	}
+
+	c.Suggestions = append(c.Suggestions, output.Options...)
+}
+
+// control executes the control of a control capsule.
+func (b *Backend) control(c *capsule.Capsule) error {
+	switch c.Control {
+	case capsule.ControlReset:
+		if err := b.resetSessions(userKey(c)); err != nil {
+			return errors.Annotate(err, "resetting conversation")
+		}
+
+		b.escalation.reset(userKey(c))
+		b.clarification.reset(userKey(c))
+		if b.idle != nil {
+			b.idle.forget(userKey(c))
+		}
+		c.Responses = []string{"Conversation reset."}
+		return nil
+	case capsule.ControlForget:
+		if err := b.resetSessions(userKey(c)); err != nil {
+			return errors.Annotate(err, "deleting user data")
+		}
+
+		b.escalation.reset(userKey(c))
+		b.clarification.reset(userKey(c))
+		if b.idle != nil {
+			b.idle.forget(userKey(c))
+		}
+		logger.WithField("provider", c.FrontendProvider).Info("User data deleted")
+		c.Responses = []string{"Your data has been deleted."}
+		return nil
+	case capsule.ControlSummary:
+		return b.summarize(c)
+	default:
+		return errors.NotSupportedf("control %s", c.Control)
+	}
+}
+
+// resetSessions deletes the sessions and the histories of the given user on
+// the main provider and on the hinted providers.
+func (b *Backend) resetSessions(user string) error {
+	b.mainHistory.Reset(user)
+	for _, h := range b.hintedHistories {
+		h.Reset(user)
+	}
+
+	if err := b.activatedProvider.ResetSession(user); err != nil {
+		return err
+	}
+
+	for _, p := range b.hintedProviders {
+		if err := p.ResetSession(user); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// provider returns the provider processing the capsule: the provider whose
+// label is the capsule backend hint, or the main provider when there is no
+// hint.
+func (b *Backend) provider(c *capsule.Capsule) (provider.Provider, error) {
+	if len(c.BackendHint) == 0 || c.BackendHint == b.activatedProvider.GetLabel() {
+		return b.activatedProvider, nil
+	}
+
+	p, ok := b.hintedProviders[c.BackendHint]
+	if !ok {
+		return nil, errors.NotFoundf("activated backend provider %s", c.BackendHint)
+	}
+
+	return p, nil
+}
+
+// userKey returns the key identifying the user of the capsule across the
+// frontend providers.
+func userKey(capsule *capsule.Capsule) string {
+	return capsule.FrontendProvider + "/" + capsule.User
+}
+
+// analyzeSentiment sets the capsule sentiment. An analysis failure is not
+// fatal: it is logged and the sentiment is left to zero.
+func (b *Backend) analyzeSentiment(capsule *capsule.Capsule) {
+	if b.sentimentAnalyzer == nil {
+		return
+	}
+
+	sentiment, err := b.sentimentAnalyzer.Analyze(capsule.Content)
+	if err != nil {
+		logger.WithError(err).Warn("Cannot analyze the sentiment of the capsule content")
+		return
+	}
+
+	capsule.Sentiment = sentiment
 }
 
 // loadConfig loads the providers configuration from file defined in a environment variable.
-// It returns an array of structured providers configuration.
-func loadConfig() (*provider.Config, error) {
+// The file format is detected from its extension (YAML, JSON or TOML).
+// It returns a structured backend configuration.
+func loadConfig() (*Config, error) {
 	// Gets the config file path.
 	path := os.Getenv(configFile)
 	if path == "" {
@@ -127,17 +1028,11 @@ func loadConfig() (*provider.Config, error) {
 
 	logger.WithField("filename", path).Info("Parsing config file")
 
-	// Reads config file.
-	data, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, errors.Annotate(err, "cannot read config file")
-	}
-
-	var c *provider.Config
+	c := &Config{}
 
-	// Unmarshals the read bytes.
-	if err = yaml.Unmarshal(data, &c); err != nil {
-		return nil, errors.Annotate(err, "cannot unmarshal config file")
+	// Reads and unmarshals the config file.
+	if err := config.Decode(path, c); err != nil {
+		return nil, err
 	}
 
 	c.Label = strings.ToLower(c.Label)
@@ -152,6 +1047,11 @@ func loadProvider(providerConfig *provider.Config) (provider.Provider, error) {
 		return nil, errors.NotFoundf("provider called `%s`", providerConfig.Label)
 	}
 
+	// In dry-run mode, the provider is decorated so its API is never called.
+	if os.Getenv(dryRunEnv) != "" {
+		p = &dryRunProvider{provider: p}
+	}
+
 	var err error
 	p, err = p.Initialize(providerConfig)
 	if err != nil {
@@ -163,16 +1063,48 @@ func loadProvider(providerConfig *provider.Config) (provider.Provider, error) {
 }
 
 // errorHandler handles error that can occurred on sending message to backend
-// providers. It marshal a CapsuleOut and sends it on the backend error channel.
-func (b *Backend) errorHandler(original *capsule.Capsule, err error) error {
+// providers. The capsule is stored in the dead letter, then sent back with its
+// error to the frontend.
+func (b *Backend) errorHandler(original *capsule.Capsule, err error, attempts int) error {
+	b.storeDeadLetter(original, err, attempts)
 	original.Error = err
+	original.ErrorCode = provider.ErrorCode(err)
 
-	b.capsule <- original
+	b.toFrontend <- original
 
 	return nil
 }
 
+// stopProvider stops the activated provider and the hinted providers. The
+// errors they return are aggregated in the shutdown error.
 func (b *Backend) stopProvider() {
-	b.activatedProvider.Stop()
+	if b.notifier != nil {
+		b.notifier.stop(notifyTimeout)
+	}
+
+	failures := []string{}
+	if err := b.activatedProvider.Stop(); err != nil {
+		logger.WithError(err).Error("Cannot stop activated provider")
+		failures = append(failures, err.Error())
+	}
+
+	for label, p := range b.hintedProviders {
+		if err := p.Stop(); err != nil {
+			logger.WithError(err).Errorf("Cannot stop provider %s", label)
+			failures = append(failures, fmt.Sprintf("provider %s: %s", label, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		b.shutdownErr = errors.Errorf("stopping backend: %s", strings.Join(failures, "; "))
+	}
+
 	b.wg.Done()
 }
+
+// ShutdownError returns the errors returned by the providers on shutdown, or
+// nil if they stopped cleanly. It must be called once Start has returned.
+func (b *Backend) ShutdownError() error {
+	return b.shutdownErr
+}
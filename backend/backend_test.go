@@ -0,0 +1,308 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/fberrez/samantha/capsule"
+	"github.com/google/uuid"
+)
+
+type (
+	// fakeProvider is a backend provider answering with a configurable
+	// function and recording its calls.
+	fakeProvider struct {
+		// label is the label of the provider.
+		label string
+
+		// answer returns the response to the input. The provider echoes the
+		// input when it is nil.
+		answer func(ctx context.Context, input *provider.Input) (*provider.Response, error)
+
+		// mutex protects the recorded calls.
+		mutex sync.Mutex
+
+		// inputs is a slice containing the inputs received by Message.
+		inputs []*provider.Input
+
+		// resets is a slice containing the users whose session was reset.
+		resets []string
+
+		// stopErr is the error returned by Stop.
+		stopErr error
+	}
+)
+
+const (
+	// fakeLabel is the label of the fake provider in the test configurations.
+	fakeLabel = "fake"
+
+	// testTimeout is the maximum duration to wait for a capsule in the tests.
+	testTimeout = 5 * time.Second
+)
+
+func (p *fakeProvider) Initialize(config *provider.Config) (provider.Provider, error) {
+	if len(p.label) == 0 {
+		p.label = config.Label
+	}
+
+	return p, nil
+}
+
+func (p *fakeProvider) Message(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+	p.mutex.Lock()
+	p.inputs = append(p.inputs, input)
+	p.mutex.Unlock()
+
+	if p.answer != nil {
+		return p.answer(ctx, input)
+	}
+
+	return textResponse(input.Text), nil
+}
+
+func (p *fakeProvider) ResetSession(user string) error {
+	p.mutex.Lock()
+	p.resets = append(p.resets, user)
+	p.mutex.Unlock()
+	return nil
+}
+
+func (p *fakeProvider) GetLabel() string {
+	return p.label
+}
+
+func (p *fakeProvider) Stop() error {
+	return p.stopErr
+}
+
+// calls returns the number of calls to Message.
+func (p *fakeProvider) calls() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return len(p.inputs)
+}
+
+// textResponse returns a response with the given text outputs.
+func textResponse(texts ...string) *provider.Response {
+	response := &provider.Response{}
+	for _, text := range texts {
+		response.Outputs = append(response.Outputs, &provider.Output{ResponseType: "text", Text: text})
+	}
+
+	return response
+}
+
+// intentResponse returns a response with the given intent and text output.
+func intentResponse(intent string, confidence float32, text string) *provider.Response {
+	response := textResponse(text)
+	response.Intents = []*provider.Intent{{Intent: intent, Confidence: confidence}}
+	return response
+}
+
+// newTestBackend initializes a backend whose main provider is the fake
+// provider, with the given YAML configuration in addition to its label.
+func newTestBackend(t *testing.T, p provider.Provider, config string) (*Backend, chan *capsule.Capsule, chan *capsule.Capsule) {
+	t.Helper()
+
+	previous, registered := providerCollection[fakeLabel]
+	providerCollection[fakeLabel] = p
+	t.Cleanup(func() {
+		if registered {
+			providerCollection[fakeLabel] = previous
+		} else {
+			delete(providerCollection, fakeLabel)
+		}
+	})
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(path, []byte("label: "+fakeLabel+"\n"+config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(configFile, path)
+
+	toBackend := make(chan *capsule.Capsule)
+	toFrontend := make(chan *capsule.Capsule, 100)
+	b, err := New(toBackend, toFrontend)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	return b, toBackend, toFrontend
+}
+
+// start starts the backend and stops it at the end of the test.
+func start(t *testing.T, b *Backend, toBackend chan *capsule.Capsule) {
+	t.Helper()
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go b.Start(wg)
+
+	t.Cleanup(func() {
+		close(toBackend)
+		wg.Wait()
+	})
+}
+
+// newCapsule returns a capsule of the given user with the content.
+func newCapsule(user, content string) *capsule.Capsule {
+	return &capsule.Capsule{
+		OriginalMessage:  uuid.New(),
+		FrontendProvider: "test",
+		User:             user,
+		Content:          content,
+	}
+}
+
+// receive returns the next capsule sent to the frontend.
+func receive(t *testing.T, toFrontend <-chan *capsule.Capsule) *capsule.Capsule {
+	t.Helper()
+
+	select {
+	case c := <-toFrontend:
+		return c
+	case <-time.After(testTimeout):
+		t.Fatal("no capsule sent to the frontend")
+		return nil
+	}
+}
+
+// exchange sends the capsule to the backend and returns its answer.
+func exchange(t *testing.T, toBackend chan<- *capsule.Capsule, toFrontend <-chan *capsule.Capsule, c *capsule.Capsule) *capsule.Capsule {
+	t.Helper()
+
+	toBackend <- c
+	return receive(t, toFrontend)
+}
+
+func TestMain(m *testing.M) {
+	os.Unsetenv(dryRunEnv)
+	os.Exit(m.Run())
+}
+
+func TestNoSelfConsumption(t *testing.T) {
+	p := &fakeProvider{}
+	b, toBackend, toFrontend := newTestBackend(t, p, "")
+	start(t, b, toBackend)
+
+	sent := newCapsule("alice", "hello")
+	c := exchange(t, toBackend, toFrontend, sent)
+	if c.OriginalMessage != sent.OriginalMessage {
+		t.Errorf("response of %s, want the response of %s", c.OriginalMessage, sent.OriginalMessage)
+	}
+
+	// The response is only sent to the frontend: the backend never processes
+	// it as a new message.
+	select {
+	case c := <-toFrontend:
+		t.Errorf("unexpected capsule sent to the frontend: %+v", c)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if calls := p.calls(); calls != 1 {
+		t.Errorf("provider calls = %d, want 1", calls)
+	}
+}
+
+func TestEntities(t *testing.T) {
+	p := &fakeProvider{
+		answer: func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+			response := textResponse("The weather in Paris")
+			response.Entities = []*provider.Entity{{Entity: "city", Value: "Paris", Confidence: 0.9}}
+			return response, nil
+		},
+	}
+
+	b, toBackend, toFrontend := newTestBackend(t, p, "")
+	start(t, b, toBackend)
+
+	c := exchange(t, toBackend, toFrontend, newCapsule("alice", "weather in Paris"))
+	if len(c.Entities) != 1 || c.Entities[0].Entity != "city" || c.Entities[0].Value != "Paris" || c.Entities[0].Confidence != 0.9 {
+		t.Errorf("entities = %v, want the city entity", c.Entities)
+	}
+}
+
+func TestShutdownError(t *testing.T) {
+	tests := []struct {
+		name    string
+		stopErr error
+		failed  bool
+	}{
+		{"clean", nil, false},
+		{"failing provider", errors.New("session still open"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, toBackend, _ := newTestBackend(t, &fakeProvider{stopErr: tt.stopErr}, "")
+
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+			go b.Start(wg)
+			close(toBackend)
+			wg.Wait()
+
+			err := b.ShutdownError()
+			if (err != nil) != tt.failed {
+				t.Fatalf("shutdown error = %v, want a failure: %t", err, tt.failed)
+			}
+
+			if tt.failed && !strings.Contains(err.Error(), "session still open") {
+				t.Errorf("shutdown error = %q, want the provider error", err)
+			}
+		})
+	}
+}
+
+func TestMaxResponses(t *testing.T) {
+	p := &fakeProvider{answer: func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+		return &provider.Response{Outputs: []*provider.Output{
+			{Pause: time.Second},
+			{ResponseType: "text", Text: "1"},
+			{ResponseType: "text", Text: "2"},
+			{ResponseType: "text", Text: "3"},
+			{Pause: time.Second},
+			{ResponseType: "text", Text: "4"},
+			{ResponseType: "text", Text: "5"},
+		}}, nil
+	}}
+	b, toBackend, toFrontend := newTestBackend(t, p, "maxResponses: 3\n")
+	start(t, b, toBackend)
+
+	c := exchange(t, toBackend, toFrontend, newCapsule("alice", "hello"))
+	if strings.Join(c.Responses, ",") != "1,2,3" {
+		t.Errorf("responses = %q, want the first 3 responses", c.Responses)
+	}
+
+	// The pause preceding a dropped response is dropped too.
+	if len(c.Pauses) != 1 || c.Pauses[0].Index != 0 {
+		t.Errorf("pauses = %+v, want the pause before the first response", c.Pauses)
+	}
+}
+
+func TestMaxResponsesDefault(t *testing.T) {
+	texts := []string{}
+	for i := 0; i < defaultMaxResponses; i++ {
+		texts = append(texts, "text")
+	}
+
+	p := &fakeProvider{answer: func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+		return textResponse(texts...), nil
+	}}
+	b, toBackend, toFrontend := newTestBackend(t, p, "")
+	start(t, b, toBackend)
+
+	if c := exchange(t, toBackend, toFrontend, newCapsule("alice", "hello")); len(c.Responses) != defaultMaxResponses {
+		t.Errorf("responses = %d, want %d", len(c.Responses), defaultMaxResponses)
+	}
+}
@@ -0,0 +1,208 @@
+package backend
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fberrez/samantha/backend/provider"
+)
+
+type (
+	// circuitBreaker is a decorator of a backend provider which stops calling
+	// the provider after consecutive failures. While it is open, a fallback
+	// response is returned. Once the cooldown is over, it half-opens and lets
+	// one message test the provider recovery.
+	circuitBreaker struct {
+		// provider is the decorated provider.
+		provider provider.Provider
+
+		// threshold is the number of consecutive failures opening the breaker.
+		threshold int
+
+		// cooldown is the duration during which the breaker stays open.
+		cooldown time.Duration
+
+		// fallback is the response returned while the breaker is open.
+		fallback string
+
+		// mutex protects the breaker state.
+		mutex sync.Mutex
+
+		// state is the breaker state.
+		state breakerState
+
+		// failures is the number of consecutive failures.
+		failures int
+
+		// openedAt is the time at which the breaker opened.
+		openedAt time.Time
+
+		// probing is true while a half-open breaker tests the provider.
+		probing bool
+	}
+
+	// breakerState is the state of a circuit breaker.
+	breakerState string
+)
+
+const (
+	// breakerClosed is the state of a breaker calling the provider.
+	breakerClosed breakerState = "closed"
+
+	// breakerOpen is the state of a breaker returning the fallback response.
+	breakerOpen breakerState = "open"
+
+	// breakerHalfOpen is the state of a breaker testing the provider recovery.
+	breakerHalfOpen breakerState = "half-open"
+
+	// defaultBreakerCooldown is the default duration during which a breaker
+	// stays open.
+	defaultBreakerCooldown = 30 * time.Second
+
+	// defaultBreakerFallback is the default response returned while a breaker
+	// is open.
+	defaultBreakerFallback = "I am temporarily unavailable, please try again later."
+)
+
+var (
+	// breakerStateMetric exposes the breaker state on /debug/vars.
+	breakerStateMetric = expvar.NewString("backendCircuitBreakerState")
+)
+
+// newCircuitBreaker decorates the given provider with a circuit breaker.
+func newCircuitBreaker(p provider.Provider, threshold int, cooldown time.Duration, fallback string) *circuitBreaker {
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+
+	if len(fallback) == 0 {
+		fallback = defaultBreakerFallback
+	}
+
+	breakerStateMetric.Set(string(breakerClosed))
+
+	return &circuitBreaker{
+		provider:  p,
+		threshold: threshold,
+		cooldown:  cooldown,
+		fallback:  fallback,
+		state:     breakerClosed,
+	}
+}
+
+// Initialize initializes the decorated provider.
+func (c *circuitBreaker) Initialize(config *provider.Config) (provider.Provider, error) {
+	p, err := c.provider.Initialize(config)
+	if err != nil {
+		return nil, err
+	}
+
+	c.provider = p
+	return c, nil
+}
+
+// Message sends the message to the decorated provider unless the breaker is
+// open, in which case the fallback response is returned.
+func (c *circuitBreaker) Message(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+	if !c.allow() {
+		return &provider.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			ErrorCode:  provider.ErrorUpstream,
+			Outputs: []*provider.Output{
+				{
+					ResponseType: "text",
+					Text:         c.fallback,
+				},
+			},
+			Intents: []*provider.Intent{},
+		}, nil
+	}
+
+	response, err := c.provider.Message(ctx, input)
+	c.record(err)
+	return response, err
+}
+
+// ResetSession resets the session of the user on the decorated provider.
+func (c *circuitBreaker) ResetSession(user string) error {
+	return c.provider.ResetSession(user)
+}
+
+// GetLabel returns the label of the decorated provider.
+func (c *circuitBreaker) GetLabel() string {
+	return c.provider.GetLabel()
+}
+
+// Stop stops the decorated provider.
+func (c *circuitBreaker) Stop() error {
+	return c.provider.Stop()
+}
+
+// State returns the breaker state.
+func (c *circuitBreaker) State() breakerState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.state
+}
+
+// allow verifies if a message can be sent to the provider. An open breaker
+// half-opens once its cooldown is over.
+func (c *circuitBreaker) allow() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	switch c.state {
+	case breakerOpen:
+		if time.Since(c.openedAt) < c.cooldown {
+			return false
+		}
+
+		c.setState(breakerHalfOpen)
+		c.probing = true
+		return true
+	case breakerHalfOpen:
+		// Only one message tests the provider at a time.
+		if c.probing {
+			return false
+		}
+
+		c.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record records the result of a provider call.
+func (c *circuitBreaker) record(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.probing = false
+	if err == nil {
+		c.failures = 0
+		c.setState(breakerClosed)
+		return
+	}
+
+	c.failures++
+	if c.state == breakerHalfOpen || c.failures >= c.threshold {
+		c.openedAt = time.Now()
+		c.setState(breakerOpen)
+	}
+}
+
+// setState sets the breaker state. The mutex must be held.
+func (c *circuitBreaker) setState(state breakerState) {
+	if c.state == state {
+		return
+	}
+
+	logger.WithField("provider", c.provider.GetLabel()).Warnf("Circuit breaker %s", state)
+	c.state = state
+	breakerStateMetric.Set(string(state))
+}
@@ -0,0 +1,100 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/backend/provider"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var failing int32 = 1
+	p := &fakeProvider{
+		label: fakeLabel,
+		answer: func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+			if atomic.LoadInt32(&failing) == 1 {
+				return nil, errors.New("provider down")
+			}
+			return textResponse(input.Text), nil
+		},
+	}
+
+	const cooldown = 50 * time.Millisecond
+	breaker := newCircuitBreaker(p, 2, cooldown, "")
+	message := func() (*provider.Response, error) {
+		return breaker.Message(context.Background(), &provider.Input{User: "alice", Text: "hello"})
+	}
+
+	// The breaker opens after the threshold of consecutive failures.
+	for i := 0; i < 2; i++ {
+		if _, err := message(); err == nil {
+			t.Fatalf("call %d: expected the provider error", i)
+		}
+	}
+
+	if state := breaker.State(); state != breakerOpen {
+		t.Fatalf("state = %s, want %s", state, breakerOpen)
+	}
+
+	if state := breakerStateMetric.Value(); state != string(breakerOpen) {
+		t.Errorf("metric = %s, want %s", state, breakerOpen)
+	}
+
+	// While open, the fallback is returned without calling the provider.
+	response, err := message()
+	if err != nil || len(response.Outputs) != 1 || response.Outputs[0].Text != defaultBreakerFallback {
+		t.Errorf("open breaker response = %v, %v, want the fallback", response, err)
+	}
+
+	if calls := p.calls(); calls != 2 {
+		t.Errorf("provider called %d times, want 2", calls)
+	}
+
+	// A failing probe opens the breaker again.
+	time.Sleep(cooldown)
+	if _, err := message(); err == nil {
+		t.Fatal("expected the probe to fail")
+	}
+
+	if state := breaker.State(); state != breakerOpen {
+		t.Fatalf("state = %s, want %s", state, breakerOpen)
+	}
+
+	// A successful probe closes the breaker.
+	atomic.StoreInt32(&failing, 0)
+	time.Sleep(cooldown)
+	if _, err := message(); err != nil {
+		t.Fatalf("probe error = %v", err)
+	}
+
+	if state := breaker.State(); state != breakerClosed {
+		t.Errorf("state = %s, want %s", state, breakerClosed)
+	}
+}
+
+func TestCircuitBreakerResetsFailures(t *testing.T) {
+	var failing int32
+	p := &fakeProvider{
+		label: fakeLabel,
+		answer: func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+			if atomic.LoadInt32(&failing) == 1 {
+				return nil, errors.New("provider down")
+			}
+			return textResponse(input.Text), nil
+		},
+	}
+
+	breaker := newCircuitBreaker(p, 2, time.Minute, "")
+	for _, fail := range []int32{1, 0, 1, 0} {
+		atomic.StoreInt32(&failing, fail)
+		breaker.Message(context.Background(), &provider.Input{User: "alice", Text: "hello"})
+	}
+
+	// The failures are not consecutive.
+	if state := breaker.State(); state != breakerClosed {
+		t.Errorf("state = %s, want %s", state, breakerClosed)
+	}
+}
@@ -0,0 +1,71 @@
+package backend
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fberrez/samantha/capsule"
+)
+
+// capabilitiesMiddleware shapes the responses of the processed capsule
+// according to the capabilities of its frontend provider.
+func (b *Backend) capabilitiesMiddleware(next Handler) Handler {
+	return func(capsule *capsule.Capsule) error {
+		if err := next(capsule); err != nil {
+			return err
+		}
+
+		shape(capsule)
+		return nil
+	}
+}
+
+// shape adapts the capsule responses to the frontend capabilities. The
+// suggestions of a provider without buttons are flattened to a numbered text
+// list. The cards of a provider which cannot display them, or which does not
+// declare its capabilities, are converted to text responses.
+func shape(c *capsule.Capsule) {
+	if len(c.Cards) > 0 && (c.FrontendCapabilities == nil || !c.FrontendCapabilities.Cards) {
+		for _, card := range c.Cards {
+			c.Responses = append(c.Responses, cardText(card))
+		}
+
+		c.Cards = nil
+	}
+
+	if c.FrontendCapabilities == nil || c.FrontendCapabilities.Buttons || len(c.Suggestions) == 0 {
+		return
+	}
+
+	lines := make([]string, 0, len(c.Suggestions))
+	for i, suggestion := range c.Suggestions {
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, suggestion))
+	}
+
+	c.Responses = append(c.Responses, strings.Join(lines, "\n"))
+	c.Suggestions = nil
+}
+
+// cardText returns the text version of a card: its title, its subtitle, its
+// image URL and a line per button.
+func cardText(card *capsule.Card) string {
+	lines := []string{card.Title}
+	if len(card.Subtitle) > 0 {
+		lines = append(lines, card.Subtitle)
+	}
+
+	if len(card.ImageURL) > 0 {
+		lines = append(lines, card.ImageURL)
+	}
+
+	for _, button := range card.Buttons {
+		if len(button.URL) > 0 {
+			lines = append(lines, fmt.Sprintf("- %s: %s", button.Label, button.URL))
+			continue
+		}
+
+		lines = append(lines, "- "+button.Label)
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,103 @@
+package backend
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/fberrez/samantha/capsule"
+)
+
+func TestCapabilities(t *testing.T) {
+	tests := []struct {
+		name         string
+		capabilities *capsule.Capabilities
+		responses    []string
+		suggestions  []string
+	}{
+		{"no capabilities", nil, []string{"Which city?"}, []string{"Paris", "London"}},
+		{"buttons", &capsule.Capabilities{Buttons: true}, []string{"Which city?"}, []string{"Paris", "London"}},
+		{"text only", &capsule.Capabilities{}, []string{"Which city?", "1. Paris\n2. London"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &fakeProvider{
+				answer: func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+					response := textResponse("Which city?")
+					response.Suggestions = []string{"Paris", "London"}
+					return response, nil
+				},
+			}
+
+			b, toBackend, toFrontend := newTestBackend(t, p, "")
+			start(t, b, toBackend)
+
+			c := newCapsule("alice", "weather")
+			c.FrontendCapabilities = tt.capabilities
+			c = exchange(t, toBackend, toFrontend, c)
+
+			if !reflect.DeepEqual(c.Responses, tt.responses) {
+				t.Errorf("responses = %q, want %q", c.Responses, tt.responses)
+			}
+
+			if !reflect.DeepEqual(c.Suggestions, tt.suggestions) {
+				t.Errorf("suggestions = %v, want %v", c.Suggestions, tt.suggestions)
+			}
+		})
+	}
+}
+
+func TestShapeWithoutSuggestions(t *testing.T) {
+	c := &capsule.Capsule{Responses: []string{"Hello"}, FrontendCapabilities: &capsule.Capabilities{}}
+	shape(c)
+
+	if !reflect.DeepEqual(c.Responses, []string{"Hello"}) {
+		t.Errorf("responses = %q, want them unchanged", c.Responses)
+	}
+}
+
+func TestShapeCards(t *testing.T) {
+	card := &capsule.Card{
+		Title:    "Blue shirt",
+		Subtitle: "20 EUR",
+		ImageURL: "https://example.com/shirt.png",
+		Buttons: []*capsule.CardButton{
+			{Label: "Buy", URL: "https://example.com/buy"},
+			{Label: "More", Value: "more shirts"},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		capabilities *capsule.Capabilities
+		responses    []string
+		cards        int
+	}{
+		{"no capabilities", nil, []string{"Our shirts", "Blue shirt\n20 EUR\nhttps://example.com/shirt.png\n- Buy: https://example.com/buy\n- More"}, 0},
+		{"text only", &capsule.Capabilities{Buttons: true}, []string{"Our shirts", "Blue shirt\n20 EUR\nhttps://example.com/shirt.png\n- Buy: https://example.com/buy\n- More"}, 0},
+		{"cards", &capsule.Capabilities{Buttons: true, Cards: true}, []string{"Our shirts"}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &capsule.Capsule{Responses: []string{"Our shirts"}, Cards: []*capsule.Card{card}, FrontendCapabilities: tt.capabilities}
+			shape(c)
+
+			if !reflect.DeepEqual(c.Responses, tt.responses) {
+				t.Errorf("responses = %q, want %q", c.Responses, tt.responses)
+			}
+
+			if len(c.Cards) != tt.cards {
+				t.Errorf("cards = %d, want %d", len(c.Cards), tt.cards)
+			}
+		})
+	}
+}
+
+func TestCardTextMinimal(t *testing.T) {
+	if text := cardText(&capsule.Card{Title: "Blue shirt"}); text != "Blue shirt" {
+		t.Errorf("cardText() = %q, want the title only", text)
+	}
+}
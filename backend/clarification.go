@@ -0,0 +1,143 @@
+package backend
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/fberrez/samantha/capsule"
+)
+
+type (
+	// clarification asks the user to confirm the top intent when its
+	// confidence is neither low enough to be rejected nor high enough to be
+	// trusted.
+	clarification struct {
+		// low and high bound the confidence band in which the intent must be
+		// confirmed. Clarification is disabled when high is zero.
+		low  float32
+		high float32
+
+		// fallback is the response sent when the intent confidence is under
+		// the band or when the user rejects the intent.
+		fallback string
+
+		// mutex protects the pending clarifications.
+		mutex sync.Mutex
+
+		// pending indexes the clarifications awaiting an answer by user.
+		pending map[string]*pendingClarification
+	}
+
+	// pendingClarification is a clarification awaiting the answer of the
+	// user.
+	pendingClarification struct {
+		// intent is the intent to confirm.
+		intent *provider.Intent
+
+		// response is the provider response of the clarified message. It is
+		// used once the intent is confirmed.
+		response *provider.Response
+	}
+)
+
+const (
+	// defaultClarifyFallback is the default response sent when an intent is
+	// rejected.
+	defaultClarifyFallback = "Sorry, I did not understand. Could you rephrase?"
+
+	// clarifyYes and clarifyNo are the answers suggested to the user.
+	clarifyYes = "Yes"
+	clarifyNo  = "No"
+)
+
+// newClarification initializes a clarification with the given configuration.
+func newClarification(config *Config) *clarification {
+	fallback := config.ClarifyFallback
+	if len(fallback) == 0 {
+		fallback = defaultClarifyFallback
+	}
+
+	return &clarification{
+		low:      config.ClarifyLow,
+		high:     config.ClarifyHigh,
+		fallback: fallback,
+		pending:  map[string]*pendingClarification{},
+	}
+}
+
+// enabled verifies if the clarification is configured.
+func (c *clarification) enabled() bool {
+	return c.high > 0
+}
+
+// ask registers a clarification of the given intent for the user and returns
+// the question asking to confirm it.
+func (c *clarification) ask(user string, intent *provider.Intent, response *provider.Response) string {
+	c.mutex.Lock()
+	c.pending[user] = &pendingClarification{
+		intent:   intent,
+		response: response,
+	}
+	c.mutex.Unlock()
+
+	return "Did you mean " + strings.Replace(intent.Intent, "_", " ", -1) + "?"
+}
+
+// answer returns the pending clarification of the user and whether the given
+// content confirms it. The clarification is removed: an answer which is not
+// yes or no is a new message, and the clarification is returned nil.
+func (c *clarification) answer(user, content string) (*pendingClarification, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	pending, ok := c.pending[user]
+	if !ok {
+		return nil, false
+	}
+
+	delete(c.pending, user)
+
+	switch strings.ToLower(strings.TrimSpace(content)) {
+	case "yes", "y":
+		return pending, true
+	case "no", "n":
+		return pending, false
+	default:
+		return nil, false
+	}
+}
+
+// reset removes the pending clarification of the given user.
+func (c *clarification) reset(user string) {
+	c.mutex.Lock()
+	delete(c.pending, user)
+	c.mutex.Unlock()
+}
+
+// clarify handles the answer of the user to a pending clarification. It
+// returns false when the capsule is not an answer and must be processed.
+func (b *Backend) clarify(capsule *capsule.Capsule) (bool, error) {
+	if !b.clarification.enabled() {
+		return false, nil
+	}
+
+	pending, confirmed := b.clarification.answer(userKey(capsule), capsule.Content)
+	if pending == nil {
+		return false, nil
+	}
+
+	if !confirmed {
+		capsule.Responses = append(capsule.Responses, b.clarification.fallback)
+		return true, nil
+	}
+
+	// The confirmed intent is trusted as if its confidence was maximal.
+	intent := &provider.Intent{
+		Intent:     pending.intent.Intent,
+		Confidence: 1,
+	}
+
+	capsule.Intent = intent.Intent
+	return true, b.answer(capsule, intent, pending.response)
+}
@@ -0,0 +1,103 @@
+package backend
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/fberrez/samantha/backend/provider"
+)
+
+// clarifyConfig is the configuration of the clarification tests.
+const clarifyConfig = "clarifyLow: 0.3\nclarifyHigh: 0.6\n"
+
+// confidenceProvider returns a fake provider answering with the weather
+// forecast intent with the given confidence.
+func confidenceProvider(confidence float32) *fakeProvider {
+	return &fakeProvider{
+		answer: func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+			return intentResponse("weather_forecast", confidence, "Sunny"), nil
+		},
+	}
+}
+
+func TestClarificationBands(t *testing.T) {
+	tests := []struct {
+		name        string
+		confidence  float32
+		responses   []string
+		suggestions []string
+	}{
+		{"above the band", 0.9, []string{"Sunny"}, nil},
+		{"upper bound", 0.6, []string{"Sunny"}, nil},
+		{"in the band", 0.5, []string{"Did you mean weather forecast?"}, []string{clarifyYes, clarifyNo}},
+		{"lower bound", 0.3, []string{"Did you mean weather forecast?"}, []string{clarifyYes, clarifyNo}},
+		{"under the band", 0.1, []string{defaultClarifyFallback}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, toBackend, toFrontend := newTestBackend(t, confidenceProvider(tt.confidence), clarifyConfig)
+			start(t, b, toBackend)
+
+			c := exchange(t, toBackend, toFrontend, newCapsule("alice", "weather?"))
+			if !reflect.DeepEqual(c.Responses, tt.responses) {
+				t.Errorf("responses = %q, want %q", c.Responses, tt.responses)
+			}
+
+			if len(c.Suggestions) > 0 || len(tt.suggestions) > 0 {
+				if !reflect.DeepEqual(c.Suggestions, tt.suggestions) {
+					t.Errorf("suggestions = %v, want %v", c.Suggestions, tt.suggestions)
+				}
+			}
+		})
+	}
+}
+
+func TestClarificationAnswer(t *testing.T) {
+	tests := []struct {
+		name      string
+		answer    string
+		responses []string
+		calls     int
+	}{
+		{"confirmed", "yes", []string{"Sunny"}, 1},
+		{"rejected", "No", []string{defaultClarifyFallback}, 1},
+		{"new message", "what time is it?", []string{"Did you mean weather forecast?"}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := confidenceProvider(0.5)
+			b, toBackend, toFrontend := newTestBackend(t, p, clarifyConfig)
+			start(t, b, toBackend)
+
+			exchange(t, toBackend, toFrontend, newCapsule("alice", "weather?"))
+
+			// The pending clarification belongs to its user only.
+			other := exchange(t, toBackend, toFrontend, newCapsule("bob", "yes"))
+			if want := []string{"Did you mean weather forecast?"}; !reflect.DeepEqual(other.Responses, want) {
+				t.Errorf("responses to bob = %q, want %q", other.Responses, want)
+			}
+
+			c := exchange(t, toBackend, toFrontend, newCapsule("alice", tt.answer))
+			if !reflect.DeepEqual(c.Responses, tt.responses) {
+				t.Errorf("responses = %q, want %q", c.Responses, tt.responses)
+			}
+
+			if calls := p.calls() - 1; calls != tt.calls {
+				t.Errorf("provider calls of alice = %d, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestClarificationDisabled(t *testing.T) {
+	b, toBackend, toFrontend := newTestBackend(t, confidenceProvider(0.1), "")
+	start(t, b, toBackend)
+
+	c := exchange(t, toBackend, toFrontend, newCapsule("alice", "weather?"))
+	if want := []string{"Sunny"}; !reflect.DeepEqual(c.Responses, want) {
+		t.Errorf("responses = %q, want %q", c.Responses, want)
+	}
+}
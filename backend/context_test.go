@@ -0,0 +1,59 @@
+package backend
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/juju/errors"
+)
+
+// blockingProvider returns a provider blocking until the context of the call
+// is canceled, and the channel receiving each call.
+func blockingProvider() (*fakeProvider, chan struct{}) {
+	called := make(chan struct{}, 10)
+	return &fakeProvider{answer: func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+		called <- struct{}{}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}}, called
+}
+
+func TestCapsuleCancellation(t *testing.T) {
+	p, called := blockingProvider()
+	b, toBackend, toFrontend := newTestBackend(t, p, "")
+	start(t, b, toBackend)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := newCapsule("alice", "hello")
+	c.SetContext(ctx)
+
+	toBackend <- c
+	<-called
+	cancel()
+
+	if answer := receive(t, toFrontend); errors.Cause(answer.Error) != context.Canceled {
+		t.Errorf("error = %v, want the cancellation of the capsule", answer.Error)
+	}
+}
+
+func TestShutdownCancellation(t *testing.T) {
+	p, called := blockingProvider()
+	b, toBackend, toFrontend := newTestBackend(t, p, "")
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go b.Start(wg)
+
+	// The capsule has no context of its own: it is aborted by the shutdown of
+	// the backend.
+	toBackend <- newCapsule("alice", "hello")
+	<-called
+	close(toBackend)
+	wg.Wait()
+
+	if answer := receive(t, toFrontend); errors.Cause(answer.Error) != context.Canceled {
+		t.Errorf("error = %v, want the cancellation of the shutdown", answer.Error)
+	}
+}
@@ -0,0 +1,58 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fberrez/samantha/capsule"
+)
+
+func TestControl(t *testing.T) {
+	tests := []struct {
+		control  string
+		response string
+	}{
+		{capsule.ControlReset, "Conversation reset."},
+		{capsule.ControlForget, "Your data has been deleted."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.control, func(t *testing.T) {
+			p := &fakeProvider{}
+			b, toBackend, toFrontend := newTestBackend(t, p, "historyTurns: 2\n")
+			start(t, b, toBackend)
+
+			exchange(t, toBackend, toFrontend, newCapsule("alice", "hello"))
+			exchange(t, toBackend, toFrontend, newCapsule("bob", "hello"))
+
+			c := newCapsule("alice", "/"+tt.control)
+			c.Control = tt.control
+			c = exchange(t, toBackend, toFrontend, c)
+
+			if !reflect.DeepEqual(c.Responses, []string{tt.response}) {
+				t.Errorf("responses = %q, want %q", c.Responses, tt.response)
+			}
+
+			// Only the sessions and the history of the user are deleted.
+			p.mutex.Lock()
+			resets := append([]string{}, p.resets...)
+			p.mutex.Unlock()
+			if !reflect.DeepEqual(resets, []string{"test/alice"}) {
+				t.Errorf("reset sessions = %v, want the session of alice", resets)
+			}
+
+			if turns := b.mainHistory.Turns("test/alice"); len(turns) != 0 {
+				t.Errorf("history of alice = %v, want none", turns)
+			}
+
+			if turns := b.mainHistory.Turns("test/bob"); len(turns) == 0 {
+				t.Error("history of bob deleted")
+			}
+
+			// The control is not sent to the provider as a message.
+			if calls := p.calls(); calls != 2 {
+				t.Errorf("provider calls = %d, want 2", calls)
+			}
+		})
+	}
+}
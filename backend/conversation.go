@@ -0,0 +1,108 @@
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fberrez/samantha/backend/provider"
+)
+
+type (
+	// ConversationInfo describes an active conversation.
+	ConversationInfo struct {
+		// User is the name of the user.
+		User string `json:"user"`
+
+		// Provider is the label of the frontend provider of the user.
+		Provider string `json:"provider"`
+
+		// Backend is the label of the backend provider holding the
+		// conversation.
+		Backend string `json:"backend"`
+
+		// SessionID is the ID of the session of the conversation.
+		SessionID string `json:"sessionID"`
+
+		// LastActivity is the time of the last message of the conversation.
+		LastActivity time.Time `json:"lastActivity"`
+
+		// Turns is the number of messages of the conversation.
+		Turns int `json:"turns"`
+	}
+)
+
+// ActiveConversations returns the conversations held by the main provider and
+// the hinted providers, the most recently active first. The providers which
+// do not keep conversations are skipped.
+func (b *Backend) ActiveConversations() []ConversationInfo {
+	providers := []provider.Provider{b.activatedProvider}
+	for _, p := range b.hintedProviders {
+		providers = append(providers, p)
+	}
+
+	conversations := []ConversationInfo{}
+	for _, p := range providers {
+		lister, ok := unwrap(p).(provider.ConversationLister)
+		if !ok {
+			continue
+		}
+
+		for _, c := range lister.Conversations() {
+			// The user of a provider conversation is the user key.
+			frontendProvider, user := "", c.User
+			if parts := strings.SplitN(c.User, "/", 2); len(parts) == 2 {
+				frontendProvider, user = parts[0], parts[1]
+			}
+
+			conversations = append(conversations, ConversationInfo{
+				User:         user,
+				Provider:     frontendProvider,
+				Backend:      p.GetLabel(),
+				SessionID:    c.SessionID,
+				LastActivity: c.LastActivity,
+				Turns:        c.Turns,
+			})
+		}
+	}
+
+	sort.Slice(conversations, func(i, j int) bool {
+		return conversations[i].LastActivity.After(conversations[j].LastActivity)
+	})
+
+	return conversations
+}
+
+// AdminHandler returns the handler of the admin HTTP API. It serves the
+// active conversations as JSON on GET /conversations. It exposes user data:
+// it must only be reachable by the operators.
+func (b *Backend) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/conversations", b.conversationsHandler)
+	return mux
+}
+
+// conversationsHandler serves the active conversations.
+func (b *Backend) conversationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(b.ActiveConversations()); err != nil {
+		logger.WithError(err).Error("Cannot encode active conversations")
+	}
+}
+
+// unwrap returns the provider decorated by the circuit breaker, or the given
+// provider if it is not decorated.
+func unwrap(p provider.Provider) provider.Provider {
+	if breaker, ok := p.(*circuitBreaker); ok {
+		return breaker.provider
+	}
+
+	return p
+}
@@ -0,0 +1,99 @@
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/backend/provider"
+)
+
+type (
+	// listingProvider is a fake provider listing fixed conversations.
+	listingProvider struct {
+		*fakeProvider
+
+		// conversations is the slice returned by Conversations.
+		conversations []*provider.Conversation
+	}
+)
+
+func (p *listingProvider) Initialize(config *provider.Config) (provider.Provider, error) {
+	if _, err := p.fakeProvider.Initialize(config); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *listingProvider) Conversations() []*provider.Conversation {
+	return p.conversations
+}
+
+// newListingBackend initializes a backend whose provider holds the
+// conversations of alice and bob, bob being the most recently active.
+func newListingBackend(t *testing.T) (*Backend, time.Time) {
+	t.Helper()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	p := &listingProvider{
+		fakeProvider: &fakeProvider{},
+		conversations: []*provider.Conversation{
+			{User: "telegram/alice", SessionID: "session-alice", LastActivity: now.Add(-time.Minute), Turns: 3},
+			{User: "telegram/bob", SessionID: "session-bob", LastActivity: now, Turns: 1},
+		},
+	}
+
+	b, _, _ := newTestBackend(t, p, "")
+	return b, now
+}
+
+func TestActiveConversations(t *testing.T) {
+	b, now := newListingBackend(t)
+
+	want := []ConversationInfo{
+		{User: "bob", Provider: "telegram", Backend: fakeLabel, SessionID: "session-bob", LastActivity: now, Turns: 1},
+		{User: "alice", Provider: "telegram", Backend: fakeLabel, SessionID: "session-alice", LastActivity: now.Add(-time.Minute), Turns: 3},
+	}
+
+	if got := b.ActiveConversations(); !reflect.DeepEqual(got, want) {
+		t.Errorf("conversations = %+v, want %+v", got, want)
+	}
+}
+
+func TestActiveConversationsNotListed(t *testing.T) {
+	b, _, _ := newTestBackend(t, &fakeProvider{}, "")
+
+	if got := b.ActiveConversations(); len(got) != 0 {
+		t.Errorf("conversations = %+v, want none", got)
+	}
+}
+
+func TestConversationsHandler(t *testing.T) {
+	b, _ := newListingBackend(t)
+	handler := b.AdminHandler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/conversations", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	conversations := []ConversationInfo{}
+	if err := json.Unmarshal(w.Body.Bytes(), &conversations); err != nil {
+		t.Fatalf("body %s: %v", w.Body, err)
+	}
+
+	if len(conversations) != 2 || conversations[0].User != "bob" {
+		t.Errorf("conversations = %+v, want bob then alice", conversations)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/conversations", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
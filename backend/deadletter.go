@@ -0,0 +1,156 @@
+package backend
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/deadletter"
+	"github.com/juju/errors"
+)
+
+type (
+	// retryKey is the context key of the retries of the provider call of a
+	// capsule.
+	retryKey struct{}
+
+	// retry is the state of the retries of the provider call of a capsule.
+	retry struct {
+		// mutex protects the number of calls.
+		mutex sync.Mutex
+
+		// made is the number of provider calls made.
+		made int
+
+		// detached is closed when the capsule waits for a retry, so its
+		// worker does not wait for it.
+		detached chan struct{}
+
+		// once closes detached once.
+		once sync.Once
+	}
+)
+
+const (
+	// defaultProcessAttempts is the default number of attempts of the
+	// provider call of a capsule.
+	defaultProcessAttempts = 1
+
+	// processRetryDelay is the delay before the first retry of a provider
+	// call. It doubles after each attempt.
+	processRetryDelay = 500 * time.Millisecond
+)
+
+var (
+	// deadLetterMetric counts the capsules stored in the dead letter.
+	deadLetterMetric = expvar.NewInt("backendDeadLetters")
+)
+
+// SetDeadLetter replaces the dead letter of the backend. A nil dead letter
+// discards the failed capsules. It must be called before Start.
+func (b *Backend) SetDeadLetter(deadLetter deadletter.Sink) {
+	b.deadLetter = deadLetter
+}
+
+// bindRetry sets on the capsule context the state of the retries of its
+// provider call.
+func bindRetry(c *capsule.Capsule) *retry {
+	r := &retry{detached: make(chan struct{})}
+	c.SetContext(context.WithValue(c.Context(), retryKey{}, r))
+	return r
+}
+
+// attempts returns the number of provider calls made for the capsule.
+func (r *retry) attempts() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.made == 0 {
+		return 1
+	}
+
+	return r.made
+}
+
+// detach releases the worker waiting for the capsule.
+func (r *retry) detach() {
+	r.once.Do(func() {
+		close(r.detached)
+	})
+}
+
+// isDetached verifies if the capsule released its worker.
+func (r *retry) isDetached() bool {
+	select {
+	case <-r.detached:
+		return true
+	default:
+		return false
+	}
+}
+
+// call calls the provider for the capsule, retrying up to the configured
+// number of attempts. Only the provider call is retried: the capsule is not
+// processed again. While it waits for a retry, the capsule releases its
+// worker, so the worker goes on with the capsules of the other users. The
+// invalid capsules are not retried.
+func (b *Backend) call(c *capsule.Capsule, send func() (*provider.Response, error)) (*provider.Response, error) {
+	r, _ := c.Context().Value(retryKey{}).(*retry)
+
+	delay := processRetryDelay
+	for attempt := 1; ; attempt++ {
+		if r != nil {
+			r.mutex.Lock()
+			r.made = attempt
+			r.mutex.Unlock()
+		}
+
+		response, err := send()
+		if err == nil || attempt >= b.processAttempts || !retryable(err) {
+			return response, err
+		}
+
+		logger.WithError(err).Debugf("Retrying provider call of capsule %s", c.OriginalMessage)
+		if r != nil {
+			r.detach()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-c.Context().Done():
+			timer.Stop()
+			return nil, errors.Annotate(c.Context().Err(), "waiting for the retry of the provider call")
+		}
+
+		delay *= 2
+	}
+}
+
+// retryable verifies if the processing failing with the given error can be
+// attempted again. The invalid or unsupported capsules and the authentication
+// failures fail the same way on each attempt.
+func retryable(err error) bool {
+	if errors.IsNotValid(err) || errors.IsNotFound(err) || errors.IsNotSupported(err) {
+		return false
+	}
+
+	return provider.ErrorCode(err) != provider.ErrorAuth
+}
+
+// storeDeadLetter stores the failed capsule in the dead letter, if any.
+func (b *Backend) storeDeadLetter(c *capsule.Capsule, err error, attempts int) {
+	if b.deadLetter == nil {
+		return
+	}
+
+	if err := b.deadLetter.Store(deadletter.NewEntry(c, err, attempts)); err != nil {
+		logger.WithError(err).Error("Cannot store dead letter")
+		return
+	}
+
+	deadLetterMetric.Add(1)
+}
@@ -0,0 +1,134 @@
+package backend
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/deadletter"
+	"github.com/juju/errors"
+)
+
+// failingProvider returns a provider failing with the given error on the
+// messages with the given content, and echoing the other messages.
+func failingProvider(content string, err error) *fakeProvider {
+	return &fakeProvider{answer: func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+		if input.Text == content {
+			return nil, err
+		}
+
+		return textResponse(input.Text), nil
+	}}
+}
+
+// newDeadLetterBackend starts a backend with the given provider and number of
+// attempts, storing its dead letters on the returned channel.
+func newDeadLetterBackend(t *testing.T, p *fakeProvider, attempts string) (chan *capsule.Capsule, chan *capsule.Capsule, chan *deadletter.Entry) {
+	t.Helper()
+
+	b, toBackend, toFrontend := newTestBackend(t, p, "processAttempts: "+attempts+"\n")
+	deadLetters := make(chan *deadletter.Entry, 10)
+	b.SetDeadLetter(deadletter.Channel(deadLetters))
+	start(t, b, toBackend)
+
+	return toBackend, toFrontend, deadLetters
+}
+
+func TestDeadLetter(t *testing.T) {
+	p := failingProvider("hello", errors.New("provider unavailable"))
+	toBackend, toFrontend, deadLetters := newDeadLetterBackend(t, p, "2")
+
+	c := newCapsule("alice", "hello")
+	if answer := exchange(t, toBackend, toFrontend, c); answer.Error == nil {
+		t.Errorf("capsule = %+v, want an error", answer)
+	}
+
+	select {
+	case entry := <-deadLetters:
+		if entry.Capsule.OriginalMessage != c.OriginalMessage || entry.Attempts != 2 || !strings.Contains(entry.Error, "provider unavailable") {
+			t.Errorf("dead letter = %+v, want the capsule after 2 attempts", entry)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("failed capsule not stored in the dead letter")
+	}
+
+	if calls := p.calls(); calls != 2 {
+		t.Errorf("provider calls = %d, want 2", calls)
+	}
+}
+
+func TestDeadLetterNotRetryable(t *testing.T) {
+	p := failingProvider("hello", errors.NotValidf("message"))
+	toBackend, toFrontend, deadLetters := newDeadLetterBackend(t, p, "3")
+
+	exchange(t, toBackend, toFrontend, newCapsule("alice", "hello"))
+	if entry := <-deadLetters; entry.Attempts != 1 {
+		t.Errorf("attempts = %d, want 1 for an invalid message", entry.Attempts)
+	}
+}
+
+func TestRetrySucceeds(t *testing.T) {
+	failed := false
+	p := &fakeProvider{answer: func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+		if !failed {
+			failed = true
+			return nil, errors.New("provider unavailable")
+		}
+
+		return textResponse("Hello alice"), nil
+	}}
+	toBackend, toFrontend, deadLetters := newDeadLetterBackend(t, p, "2")
+
+	answer := exchange(t, toBackend, toFrontend, newCapsule("alice", "hello"))
+	if answer.Error != nil || len(answer.Responses) != 1 || answer.Responses[0] != "Hello alice" {
+		t.Errorf("capsule = %+v, want the answer of the second call", answer)
+	}
+
+	if len(deadLetters) != 0 {
+		t.Errorf("dead letters = %d, want none", len(deadLetters))
+	}
+}
+
+func TestRetryReleasesWorker(t *testing.T) {
+	p := failingProvider("fail", errors.New("provider unavailable"))
+	toBackend, toFrontend, _ := newDeadLetterBackend(t, p, "2")
+
+	// The backend has one worker: the capsule of bob is answered while the
+	// capsule of alice waits for its retry.
+	toBackend <- newCapsule("alice", "fail")
+	toBackend <- newCapsule("bob", "hello")
+
+	if first := receive(t, toFrontend); first.User != "bob" || first.Error != nil {
+		t.Errorf("first capsule = %+v, want the answer to bob", first)
+	}
+
+	if second := receive(t, toFrontend); second.User != "alice" || second.Error == nil {
+		t.Errorf("second capsule = %+v, want the failure of alice", second)
+	}
+}
+
+func TestRetryKeepsUserOrder(t *testing.T) {
+	p := failingProvider("fail", errors.New("provider unavailable"))
+	toBackend, toFrontend, _ := newDeadLetterBackend(t, p, "2")
+
+	// The next capsule of alice waits for her retried capsule, while the
+	// capsule of bob is answered.
+	toBackend <- newCapsule("alice", "fail")
+	toBackend <- newCapsule("alice", "hello")
+	toBackend <- newCapsule("bob", "hello")
+
+	if first := receive(t, toFrontend); first.User != "bob" {
+		t.Errorf("first capsule = %+v, want the answer to bob", first)
+	}
+
+	if second := receive(t, toFrontend); second.User != "alice" || second.Error == nil {
+		t.Errorf("second capsule = %+v, want the failure of alice", second)
+	}
+
+	if third := receive(t, toFrontend); third.User != "alice" || len(third.Responses) != 1 || third.Responses[0] != "hello" {
+		t.Errorf("third capsule = %+v, want the answer to alice", third)
+	}
+}
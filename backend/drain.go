@@ -0,0 +1,38 @@
+package backend
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// drainPollInterval is the interval at which Drain verifies if capsules
+	// are still being processed.
+	drainPollInterval = 100 * time.Millisecond
+)
+
+// Drain waits until the capsules received by the backend have been processed
+// and sent back to the frontend, or until the context is done. It returns the
+// error of the context if capsules are still being processed: they are
+// aborted once the transport is closed.
+func (b *Backend) Drain(ctx context.Context) error {
+	logger.Info("Draining backend")
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		inFlight := atomic.LoadInt64(&b.inFlight)
+		if inFlight == 0 {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			logger.Warnf("Backend drained with %d capsules being processed", inFlight)
+			return ctx.Err()
+		}
+	}
+}
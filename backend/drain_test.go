@@ -0,0 +1,75 @@
+package backend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/backend/provider"
+)
+
+func TestDrain(t *testing.T) {
+	release := make(chan struct{})
+	p := &fakeProvider{answer: func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+		<-release
+		return textResponse("Hello alice"), nil
+	}}
+	b, toBackend, toFrontend := newTestBackend(t, p, "")
+	start(t, b, toBackend)
+
+	toBackend <- newCapsule("alice", "hello")
+	deadline := time.Now().Add(testTimeout)
+	for p.calls() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("capsule not processed")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	drained := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+
+		drained <- b.Drain(ctx)
+	}()
+
+	select {
+	case err := <-drained:
+		t.Fatalf("Drain() returned %v with a capsule being processed", err)
+	case <-time.After(2 * drainPollInterval):
+	}
+
+	close(release)
+	if c := receive(t, toFrontend); len(c.Responses) != 1 || c.Responses[0] != "Hello alice" {
+		t.Errorf("responses = %q, want the response of the capsule", c.Responses)
+	}
+
+	select {
+	case err := <-drained:
+		if err != nil {
+			t.Errorf("Drain() error = %v", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("backend not drained")
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	p := &fakeProvider{answer: func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+		<-release
+		return textResponse("Hello alice"), nil
+	}}
+	b, toBackend, _ := newTestBackend(t, p, "")
+	start(t, b, toBackend)
+
+	toBackend <- newCapsule("alice", "hello")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := b.Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Drain() error = %v, want the deadline exceeded", err)
+	}
+}
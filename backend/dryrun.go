@@ -0,0 +1,102 @@
+package backend
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fberrez/samantha/backend/provider"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// dryRunProvider is a decorator of a backend provider which never calls the
+	// provider API. It responds to every message by echoing it.
+	dryRunProvider struct {
+		// provider is the decorated provider.
+		provider provider.Provider
+	}
+)
+
+const (
+	// dryRunEnv is the name of the environment variable enabling the dry-run
+	// mode when it is set.
+	dryRunEnv = "DRY_RUN"
+
+	// dryRunPrefix is the prefix of the dry-run responses.
+	dryRunPrefix = "[DRY RUN] "
+
+	// dryRunStreamDelay is the delay between two streamed words.
+	dryRunStreamDelay = 100 * time.Millisecond
+)
+
+// Initialize returns the dry-run provider without initializing the decorated
+// provider, so no session is created.
+func (d *dryRunProvider) Initialize(config *provider.Config) (provider.Provider, error) {
+	logger.WithField("provider", d.provider.GetLabel()).Warn("Dry-run mode enabled")
+	return d, nil
+}
+
+// Message logs the message and returns a canned response echoing it.
+func (d *dryRunProvider) Message(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+	logger.WithFields(log.Fields{
+		"provider": d.provider.GetLabel(),
+		"user":     input.User,
+		"message":  input.Text,
+	}).Info("Dry-run: message not sent to the provider")
+
+	return &provider.Response{
+		StatusCode: http.StatusOK,
+		Outputs: []*provider.Output{
+			{
+				ResponseType: "text",
+				Text:         dryRunPrefix + input.Text,
+			},
+		},
+		Intents: []*provider.Intent{},
+	}, nil
+}
+
+// MessageStream logs the message and streams the canned response word by
+// word. It is a simple streamer for testing the streaming frontends.
+func (d *dryRunProvider) MessageStream(ctx context.Context, input *provider.Input) (<-chan string, error) {
+	response, err := d.Message(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make(chan string)
+	go func() {
+		defer close(chunks)
+
+		for i, word := range strings.SplitAfter(response.Outputs[0].Text, " ") {
+			if i > 0 {
+				time.Sleep(dryRunStreamDelay)
+			}
+
+			select {
+			case chunks <- word:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return chunks, nil
+}
+
+// ResetSession does nothing since the dry-run provider has no session.
+func (d *dryRunProvider) ResetSession(user string) error {
+	return nil
+}
+
+// GetLabel returns the label of the decorated provider.
+func (d *dryRunProvider) GetLabel() string {
+	return d.provider.GetLabel()
+}
+
+// Stop does nothing since the decorated provider has never been initialized.
+func (d *dryRunProvider) Stop() error {
+	return nil
+}
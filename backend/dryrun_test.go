@@ -0,0 +1,56 @@
+package backend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fberrez/samantha/backend/provider"
+)
+
+func TestDryRun(t *testing.T) {
+	t.Setenv(dryRunEnv, "1")
+
+	p := &fakeProvider{label: fakeLabel}
+	b, toBackend, toFrontend := newTestBackend(t, p, "")
+	start(t, b, toBackend)
+
+	c := exchange(t, toBackend, toFrontend, newCapsule("alice", "hello there"))
+	if c.Error != nil {
+		t.Fatalf("capsule error = %v", c.Error)
+	}
+
+	if c.Stream == nil {
+		t.Fatal("the dry-run provider did not stream its response")
+	}
+
+	response := ""
+	for chunk := range c.Stream {
+		response += chunk
+	}
+
+	if want := dryRunPrefix + "hello there"; response != want {
+		t.Errorf("response = %q, want %q", response, want)
+	}
+
+	if calls := p.calls(); calls != 0 {
+		t.Errorf("provider called %d times under dry-run, want 0", calls)
+	}
+}
+
+func TestDryRunMessage(t *testing.T) {
+	p := &fakeProvider{label: fakeLabel}
+	d := &dryRunProvider{provider: p}
+
+	response, err := d.Message(context.Background(), &provider.Input{User: "alice", Text: "hello"})
+	if err != nil {
+		t.Fatalf("Message() error = %v", err)
+	}
+
+	if len(response.Outputs) != 1 || response.Outputs[0].Text != dryRunPrefix+"hello" {
+		t.Errorf("Message() outputs = %v, want the echoed message", response.Outputs)
+	}
+
+	if calls := p.calls(); calls != 0 {
+		t.Errorf("provider called %d times under dry-run, want 0", calls)
+	}
+}
@@ -0,0 +1,123 @@
+package backend
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/fberrez/samantha/capsule"
+	"github.com/juju/errors"
+)
+
+type (
+	// escalation decides when a conversation must be escalated to a human
+	// operator.
+	escalation struct {
+		// intents indexes the intents triggering an escalation.
+		intents map[string]bool
+
+		// command is the user command triggering an escalation.
+		command string
+
+		// lowConfidenceLimit is the number of consecutive low-confidence
+		// responses triggering an escalation. It is disabled when it is zero.
+		lowConfidenceLimit int
+
+		// response is the response sent to the user when the conversation is
+		// escalated.
+		response string
+
+		// mutex protects the low-confidence counters.
+		mutex sync.Mutex
+
+		// lowConfidenceCounts indexes the number of consecutive low-confidence
+		// responses by user.
+		lowConfidenceCounts map[string]int
+	}
+)
+
+const (
+	// defaultEscalationCommand is the default command triggering an escalation.
+	defaultEscalationCommand = "/human"
+
+	// defaultEscalationResponse is the default response sent to the user when
+	// the conversation is escalated.
+	defaultEscalationResponse = "A human operator has been notified and will answer you soon."
+)
+
+// newEscalation initializes an escalation with the given configuration.
+func newEscalation(config *Config) *escalation {
+	intents := map[string]bool{}
+	for _, intent := range config.EscalationIntents {
+		intents[intent] = true
+	}
+
+	command := config.EscalationCommand
+	if len(command) == 0 {
+		command = defaultEscalationCommand
+	}
+
+	response := config.EscalationResponse
+	if len(response) == 0 {
+		response = defaultEscalationResponse
+	}
+
+	return &escalation{
+		intents:             intents,
+		command:             command,
+		lowConfidenceLimit:  config.EscalationLowConfidence,
+		response:            response,
+		lowConfidenceCounts: map[string]int{},
+	}
+}
+
+// byCommand verifies if the given content is the escalation command.
+func (e *escalation) byCommand(content string) bool {
+	return strings.TrimSpace(content) == e.command
+}
+
+// byIntent verifies if the given top intent triggers an escalation, either
+// because it is an escalation intent or because the user received too many
+// consecutive low-confidence responses.
+func (e *escalation) byIntent(user string, intent *provider.Intent, minConfidence float32) bool {
+	if intent != nil && intent.Confidence >= minConfidence && e.intents[intent.Intent] {
+		return true
+	}
+
+	if e.lowConfidenceLimit == 0 {
+		return false
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if intent != nil && intent.Confidence >= minConfidence {
+		delete(e.lowConfidenceCounts, user)
+		return false
+	}
+
+	e.lowConfidenceCounts[user]++
+	return e.lowConfidenceCounts[user] >= e.lowConfidenceLimit
+}
+
+// reset resets the low-confidence counter of the given user.
+func (e *escalation) reset(user string) {
+	e.mutex.Lock()
+	delete(e.lowConfidenceCounts, user)
+	e.mutex.Unlock()
+}
+
+// Escalate tags the capsule as escalated to a human operator. The frontend
+// notifies the operator and stops replying automatically to the user.
+func (b *Backend) Escalate(capsule *capsule.Capsule) error {
+	if capsule == nil {
+		return errors.NotValidf("nil capsule")
+	}
+
+	logger.Infof("Escalating conversation of %s to a human operator", capsule.User)
+
+	b.escalation.reset(userKey(capsule))
+	capsule.Escalated = true
+	capsule.Responses = []string{b.escalation.response}
+	return nil
+}
@@ -0,0 +1,74 @@
+package backend
+
+import (
+	"strings"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/fberrez/samantha/capsule"
+)
+
+// history returns the history of the provider processing the capsule: the
+// history of the hinted provider whose label is the capsule backend hint, or
+// the history of the main provider.
+func (b *Backend) history(c *capsule.Capsule) *provider.History {
+	if h, ok := b.hintedHistories[c.BackendHint]; ok {
+		return h
+	}
+
+	return b.mainHistory
+}
+
+// input returns the input sent to the provider for the capsule, with the
+// history of the conversation of its user.
+func (b *Backend) input(c *capsule.Capsule) *provider.Input {
+	return &provider.Input{
+		User:        userKey(c),
+		Text:        c.Content,
+		History:     b.history(c).Turns(userKey(c)),
+		Attachments: attachments(c),
+	}
+}
+
+// remember adds the message of the input and its answer to the history.
+func remember(history *provider.History, input *provider.Input, answer string) {
+	if len(strings.TrimSpace(answer)) == 0 {
+		return
+	}
+
+	history.Add(input.User,
+		&provider.Turn{Role: provider.RoleUser, Text: input.Text},
+		&provider.Turn{Role: provider.RoleAssistant, Text: answer},
+	)
+}
+
+// responseText returns the text outputs of the response, separated by blank
+// lines.
+func responseText(response *provider.Response) string {
+	texts := []string{}
+	for _, output := range response.Outputs {
+		if len(output.Text) > 0 {
+			texts = append(texts, output.Text)
+		}
+	}
+
+	return strings.Join(texts, "\n\n")
+}
+
+// rememberOnClose forwards the chunks of the stream and adds the whole
+// response to the history once the stream is closed.
+func rememberOnClose(stream <-chan string, history *provider.History, input *provider.Input) <-chan string {
+	forwarded := make(chan string)
+	go func() {
+		defer close(forwarded)
+
+		answer := ""
+		for chunk := range stream {
+			answer += chunk
+			forwarded <- chunk
+		}
+
+		remember(history, input, answer)
+	}()
+
+	return forwarded
+}
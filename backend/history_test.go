@@ -0,0 +1,64 @@
+package backend
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/fberrez/samantha/backend/provider"
+)
+
+func TestHistorySent(t *testing.T) {
+	p := &fakeProvider{}
+	b, toBackend, toFrontend := newTestBackend(t, p, "historyTurns: 1\n")
+	start(t, b, toBackend)
+
+	for _, content := range []string{"one", "two", "three"} {
+		exchange(t, toBackend, toFrontend, newCapsule("alice", content))
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(p.inputs[0].History) != 0 {
+		t.Errorf("first history = %v, want none", p.inputs[0].History)
+	}
+
+	// Only the previous exchange is sent with historyTurns: 1.
+	want := []*provider.Turn{{Role: provider.RoleUser, Text: "two"}, {Role: provider.RoleAssistant, Text: "two"}}
+	if got := p.inputs[2].History; !reflect.DeepEqual(got, want) {
+		t.Errorf("third history = %v, want %v", got, want)
+	}
+}
+
+func TestHistoryNotRemembered(t *testing.T) {
+	p := &fakeProvider{answer: func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+		return textResponse(" "), nil
+	}}
+	b, toBackend, toFrontend := newTestBackend(t, p, "historyTurns: 2\n")
+	start(t, b, toBackend)
+
+	exchange(t, toBackend, toFrontend, newCapsule("alice", "hello"))
+	if turns := b.mainHistory.Turns("test/alice"); len(turns) != 0 {
+		t.Errorf("turns = %v, want none for a blank answer", turns)
+	}
+}
+
+func TestHistoryReset(t *testing.T) {
+	p := &fakeProvider{}
+	b, toBackend, toFrontend := newTestBackend(t, p, "historyTurns: 2\n")
+	start(t, b, toBackend)
+
+	exchange(t, toBackend, toFrontend, newCapsule("alice", "hello"))
+	if err := b.resetSessions("test/alice"); err != nil {
+		t.Fatalf("resetSessions() error = %v", err)
+	}
+
+	exchange(t, toBackend, toFrontend, newCapsule("alice", "hello again"))
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if history := p.inputs[1].History; len(history) != 0 {
+		t.Errorf("history = %v, want none after the reset", history)
+	}
+}
@@ -0,0 +1,197 @@
+package backend
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+)
+
+type (
+	// idleSweeper follows the activity of the conversations, to prompt the
+	// users gone silent and then close their conversation.
+	idleSweeper struct {
+		// promptAfter is the idle duration after which the prompt is sent. No
+		// prompt is sent when it is zero.
+		promptAfter time.Duration
+
+		// closeAfter is the idle duration after which the conversation is
+		// closed. Conversations are never closed when it is zero.
+		closeAfter time.Duration
+
+		// prompt is the message sent to the idle users.
+		prompt string
+
+		// goodbye is the message sent when the conversation is closed.
+		goodbye string
+
+		// mutex protects the activities map.
+		mutex sync.Mutex
+
+		// activities indexes the activity of the conversations by user key.
+		activities map[string]*activity
+	}
+
+	// activity is the activity of a conversation.
+	activity struct {
+		// provider is the label of the frontend provider of the user.
+		provider string
+
+		// user is the name of the user.
+		user string
+
+		// chat is the chat on which the proactive messages are sent.
+		chat string
+
+		// last is the time of the last message of the user.
+		last time.Time
+
+		// prompted is true when the prompt has been sent since the last
+		// message.
+		prompted bool
+	}
+)
+
+const (
+	// defaultIdlePrompt is the default message sent to the idle users.
+	defaultIdlePrompt = "Are you still there?"
+
+	// defaultIdleGoodbye is the default message sent when an idle
+	// conversation is closed.
+	defaultIdleGoodbye = "I am closing our conversation for now. Write to me anytime!"
+
+	// idleSweepInterval is the interval at which the idle conversations are
+	// looked for.
+	idleSweepInterval = 10 * time.Second
+)
+
+// newIdleSweeper initializes an idle sweeper with the given configuration.
+// It returns nil when both timeouts are disabled.
+func newIdleSweeper(config *Config) *idleSweeper {
+	if config.IdlePromptAfter <= 0 && config.IdleCloseAfter <= 0 {
+		return nil
+	}
+
+	prompt := config.IdlePrompt
+	if len(prompt) == 0 {
+		prompt = defaultIdlePrompt
+	}
+
+	goodbye := config.IdleGoodbye
+	if len(goodbye) == 0 {
+		goodbye = defaultIdleGoodbye
+	}
+
+	return &idleSweeper{
+		promptAfter: config.IdlePromptAfter,
+		closeAfter:  config.IdleCloseAfter,
+		prompt:      prompt,
+		goodbye:     goodbye,
+		activities:  map[string]*activity{},
+	}
+}
+
+// touch records a message of the user of the capsule. The users who cannot
+// receive proactive messages, since their chat is unknown, are not followed.
+func (s *idleSweeper) touch(c *capsule.Capsule, now time.Time) {
+	if len(c.Chat) == 0 {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.activities[userKey(c)] = &activity{
+		provider: c.FrontendProvider,
+		user:     c.User,
+		chat:     c.Chat,
+		last:     now,
+	}
+}
+
+// forget stops following the conversation of the given user.
+func (s *idleSweeper) forget(user string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.activities, user)
+}
+
+// sweep returns the conversations to prompt and the conversations to close,
+// indexed by user key. The closed conversations are no longer followed.
+func (s *idleSweeper) sweep(now time.Time) (map[string]*activity, map[string]*activity) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	prompted, closed := map[string]*activity{}, map[string]*activity{}
+	for key, a := range s.activities {
+		idle := now.Sub(a.last)
+		switch {
+		case s.closeAfter > 0 && idle >= s.closeAfter:
+			closed[key] = a
+			delete(s.activities, key)
+		case s.promptAfter > 0 && idle >= s.promptAfter && !a.prompted:
+			prompted[key] = a
+			a.prompted = true
+		}
+	}
+
+	return prompted, closed
+}
+
+// SetClock replaces the clock of the idle sweeper. It must be called before
+// Start.
+func (b *Backend) SetClock(clock Clock) {
+	b.clock = clock
+}
+
+// sweepIdle prompts the idle users and closes their conversation after a
+// longer idle period, until the backend is stopped.
+func (b *Backend) sweepIdle() {
+	defer b.wg.Done()
+
+	for {
+		select {
+		case <-b.clock.After(idleSweepInterval):
+		case <-b.ctx.Done():
+			return
+		}
+
+		prompted, closed := b.idle.sweep(b.clock.Now())
+		for _, a := range prompted {
+			b.sendProactive(a, b.idle.prompt)
+		}
+
+		for key, a := range closed {
+			if err := b.resetSessions(key); err != nil {
+				logger.WithError(err).Warn("Cannot close idle conversation")
+			}
+
+			b.escalation.reset(key)
+			b.clarification.reset(key)
+			b.sendProactive(a, b.idle.goodbye)
+		}
+	}
+}
+
+// sendProactive sends the text to the chat of the conversation as a
+// proactive capsule. It gives up when the backend is stopped.
+func (b *Backend) sendProactive(a *activity, text string) {
+	id, err := capsule.RandomGenerator{}.New()
+	if err != nil {
+		logger.WithError(err).Error("Cannot generate proactive capsule ID")
+		return
+	}
+
+	select {
+	case b.toFrontend <- &capsule.Capsule{
+		OriginalMessage:  id,
+		FrontendProvider: a.provider,
+		User:             a.user,
+		Chat:             a.chat,
+		Responses:        []string{text},
+		Proactive:        true,
+	}:
+	case <-b.ctx.Done():
+	}
+}
@@ -0,0 +1,118 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+)
+
+// newIdleBackend starts a backend prompting the users idle for a minute and
+// closing their conversation after five minutes, with a fake clock.
+func newIdleBackend(t *testing.T, p *fakeProvider) (chan *capsule.Capsule, chan *capsule.Capsule, *fakeClock) {
+	t.Helper()
+
+	b, toBackend, toFrontend := newTestBackend(t, p, "idlePromptAfter: 1m\nidleCloseAfter: 5m\nidleGoodbye: Bye\n")
+	clock := newFakeClock()
+	b.SetClock(clock)
+	start(t, b, toBackend)
+
+	return toBackend, toFrontend, clock
+}
+
+// chatCapsule returns a capsule of the user in the chat 42.
+func chatCapsule(user, content string) *capsule.Capsule {
+	c := newCapsule(user, content)
+	c.Chat = "42"
+	return c
+}
+
+// sweepAfter advances the clock once the idle sweeper waits for it.
+func sweepAfter(t *testing.T, clock *fakeClock, d time.Duration) {
+	t.Helper()
+
+	clock.waitTimer(t)
+	clock.advance(d)
+}
+
+// noCapsule verifies that no capsule is sent to the frontend.
+func noCapsule(t *testing.T, toFrontend <-chan *capsule.Capsule) {
+	t.Helper()
+
+	select {
+	case c := <-toFrontend:
+		t.Fatalf("capsule %+v sent, want none", c)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestIdlePromptAndGoodbye(t *testing.T) {
+	p := &fakeProvider{}
+	toBackend, toFrontend, clock := newIdleBackend(t, p)
+	exchange(t, toBackend, toFrontend, chatCapsule("alice", "hello"))
+
+	sweepAfter(t, clock, 30*time.Second)
+	noCapsule(t, toFrontend)
+
+	sweepAfter(t, clock, 30*time.Second)
+	prompt := receive(t, toFrontend)
+	if !prompt.Proactive || prompt.Chat != "42" || !reflect.DeepEqual(prompt.Responses, []string{defaultIdlePrompt}) {
+		t.Fatalf("capsule = %+v, want the proactive prompt", prompt)
+	}
+
+	// The prompt is sent once.
+	sweepAfter(t, clock, time.Minute)
+	noCapsule(t, toFrontend)
+
+	sweepAfter(t, clock, 3*time.Minute)
+	goodbye := receive(t, toFrontend)
+	if !goodbye.Proactive || !reflect.DeepEqual(goodbye.Responses, []string{"Bye"}) {
+		t.Fatalf("capsule = %+v, want the goodbye", goodbye)
+	}
+
+	p.mutex.Lock()
+	resets := append([]string{}, p.resets...)
+	p.mutex.Unlock()
+	if !reflect.DeepEqual(resets, []string{"test/alice"}) {
+		t.Errorf("reset sessions = %v, want the session of alice", resets)
+	}
+
+	// The closed conversation is no longer followed.
+	sweepAfter(t, clock, 10*time.Minute)
+	noCapsule(t, toFrontend)
+}
+
+func TestIdleActivity(t *testing.T) {
+	toBackend, toFrontend, clock := newIdleBackend(t, &fakeProvider{})
+	exchange(t, toBackend, toFrontend, chatCapsule("alice", "hello"))
+
+	// A new message restarts the idle period.
+	sweepAfter(t, clock, 50*time.Second)
+	exchange(t, toBackend, toFrontend, chatCapsule("alice", "still here"))
+	sweepAfter(t, clock, 50*time.Second)
+	noCapsule(t, toFrontend)
+
+	// A reset conversation is no longer followed.
+	reset := chatCapsule("alice", "/reset")
+	reset.Control = capsule.ControlReset
+	exchange(t, toBackend, toFrontend, reset)
+	sweepAfter(t, clock, 10*time.Minute)
+	noCapsule(t, toFrontend)
+}
+
+func TestIdleWithoutChat(t *testing.T) {
+	s := newIdleSweeper(&Config{IdlePromptAfter: time.Minute})
+	now := time.Now()
+	s.touch(newCapsule("alice", "hello"), now)
+
+	if prompted, _ := s.sweep(now.Add(time.Hour)); len(prompted) != 0 {
+		t.Errorf("prompted = %v, want none without chat", prompted)
+	}
+}
+
+func TestIdleDisabled(t *testing.T) {
+	if s := newIdleSweeper(&Config{}); s != nil {
+		t.Errorf("idle sweeper = %+v, want none", s)
+	}
+}
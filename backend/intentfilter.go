@@ -0,0 +1,58 @@
+package backend
+
+type (
+	// intentFilter restricts the intents whose provider output or action can
+	// be sent to the user.
+	intentFilter struct {
+		// allowed indexes the allowed intents. Every intent which is not
+		// blocked is allowed when it is empty.
+		allowed map[string]bool
+
+		// blocked indexes the blocked intents.
+		blocked map[string]bool
+
+		// response is the response sent instead of the output of a rejected
+		// intent.
+		response string
+	}
+)
+
+const (
+	// defaultBlockedIntentResponse is the default response sent instead of
+	// the output of a rejected intent.
+	defaultBlockedIntentResponse = "I can't help with that."
+)
+
+// newIntentFilter initializes an intent filter with the given configuration.
+func newIntentFilter(config *Config) *intentFilter {
+	allowed := map[string]bool{}
+	for _, intent := range config.AllowedIntents {
+		allowed[intent] = true
+	}
+
+	blocked := map[string]bool{}
+	for _, intent := range config.BlockedIntents {
+		blocked[intent] = true
+	}
+
+	response := config.BlockedIntentResponse
+	if len(response) == 0 {
+		response = defaultBlockedIntentResponse
+	}
+
+	return &intentFilter{
+		allowed:  allowed,
+		blocked:  blocked,
+		response: response,
+	}
+}
+
+// allows verifies if the output of the given top intent can be sent to the
+// user. When an allowlist is defined, a response without intent is rejected.
+func (f *intentFilter) allows(intent string) bool {
+	if f.blocked[intent] {
+		return false
+	}
+
+	return len(f.allowed) == 0 || f.allowed[intent]
+}
@@ -0,0 +1,49 @@
+package backend
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/fberrez/samantha/backend/provider"
+)
+
+func TestIntentFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		intent   string
+		response string
+	}{
+		{"unrestricted", "", "weather", "Sunny"},
+		{"unrestricted without intent", "", "", "Sunny"},
+		{"allowed", "allowedIntents: [weather]\n", "weather", "Sunny"},
+		{"not allowed", "allowedIntents: [weather]\n", "payment", defaultBlockedIntentResponse},
+		{"no intent with an allowlist", "allowedIntents: [weather]\n", "", defaultBlockedIntentResponse},
+		{"blocked", "blockedIntents: [payment]\n", "payment", defaultBlockedIntentResponse},
+		{"not blocked", "blockedIntents: [payment]\n", "weather", "Sunny"},
+		{"blocked and allowed", "allowedIntents: [payment]\nblockedIntents: [payment]\n", "payment", defaultBlockedIntentResponse},
+		{"custom response", "blockedIntents: [payment]\nblockedIntentResponse: No way.\n", "payment", "No way."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &fakeProvider{
+				answer: func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+					if len(tt.intent) == 0 {
+						return textResponse("Sunny"), nil
+					}
+					return intentResponse(tt.intent, 0.9, "Sunny"), nil
+				},
+			}
+
+			b, toBackend, toFrontend := newTestBackend(t, p, tt.config)
+			start(t, b, toBackend)
+
+			c := exchange(t, toBackend, toFrontend, newCapsule("alice", "hello"))
+			if want := []string{tt.response}; !reflect.DeepEqual(c.Responses, want) {
+				t.Errorf("responses = %v, want %v", c.Responses, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package backend
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+)
+
+const (
+	// defaultLocale is the locale used when neither the user nor the server
+	// have one.
+	defaultLocale = "en_US"
+)
+
+// UserLocation returns the location of the capsule user timezone. It falls
+// back to UTC when the timezone is unset or unknown.
+func UserLocation(c *capsule.Capsule) *time.Location {
+	if len(c.Timezone) == 0 {
+		return time.UTC
+	}
+
+	location, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		logger.WithError(err).Debugf("Unknown timezone %s, falling back to UTC", c.Timezone)
+		return time.UTC
+	}
+
+	return location
+}
+
+// UserLocale returns the locale of the capsule user. It falls back to the
+// server locale when unset.
+func UserLocale(c *capsule.Capsule) string {
+	if len(c.Locale) > 0 {
+		return c.Locale
+	}
+
+	return serverLocale()
+}
+
+// serverLocale returns the locale defined by the LC_ALL or LANG environment
+// variables, without its encoding (ex: en_US.UTF-8 becomes en_US).
+func serverLocale() string {
+	for _, env := range []string{"LC_ALL", "LANG"} {
+		locale := strings.SplitN(os.Getenv(env), ".", 2)[0]
+		if len(locale) > 0 && locale != "C" && locale != "POSIX" {
+			return locale
+		}
+	}
+
+	return defaultLocale
+}
@@ -0,0 +1,63 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+)
+
+func TestUserLocation(t *testing.T) {
+	timestamp := time.Date(2020, time.January, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		timezone string
+		want     string
+	}{
+		{"Paris", "Europe/Paris", "2020-01-15 13:00 CET"},
+		{"New York", "America/New_York", "2020-01-15 07:00 EST"},
+		{"unset", "", "2020-01-15 12:00 UTC"},
+		{"unknown", "Mars/Olympus_Mons", "2020-01-15 12:00 UTC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			location := UserLocation(&capsule.Capsule{Timezone: tt.timezone})
+			if got := timestamp.In(location).Format("2006-01-02 15:04 MST"); got != tt.want {
+				t.Errorf("formatted timestamp = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserLocale(t *testing.T) {
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LANG", "fr_FR.UTF-8")
+
+	if got := UserLocale(&capsule.Capsule{Locale: "de_DE"}); got != "de_DE" {
+		t.Errorf("UserLocale() = %q, want the user locale", got)
+	}
+
+	if got := UserLocale(&capsule.Capsule{}); got != "fr_FR" {
+		t.Errorf("UserLocale() = %q, want the server locale", got)
+	}
+
+	t.Setenv("LANG", "C")
+	if got := UserLocale(&capsule.Capsule{}); got != defaultLocale {
+		t.Errorf("UserLocale() = %q, want the default locale", got)
+	}
+}
+
+func TestTemplateTimezone(t *testing.T) {
+	b, toBackend, toFrontend := newTestBackend(t, &fakeProvider{}, `responseTemplate: "{{.Text}} ({{.Timezone}}, {{.Locale}})"`+"\n")
+	start(t, b, toBackend)
+
+	c := newCapsule("alice", "hello")
+	c.Timezone = "Europe/Paris"
+	c.Locale = "fr_FR"
+	c = exchange(t, toBackend, toFrontend, c)
+	if want := "hello (Europe/Paris, fr_FR)"; len(c.Responses) != 1 || c.Responses[0] != want {
+		t.Errorf("responses = %v, want %q", c.Responses, want)
+	}
+}
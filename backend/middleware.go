@@ -0,0 +1,153 @@
+package backend
+
+import (
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Handler processes a capsule received from the frontend.
+	Handler func(capsule *capsule.Capsule) error
+
+	// Middleware wraps a handler to run cross-cutting logic (logging,
+	// metrics, enrichment...) before and after it.
+	Middleware func(next Handler) Handler
+)
+
+var (
+	// middlewaresMutex protects the middlewares slice.
+	middlewaresMutex sync.Mutex
+
+	// middlewares is a slice containing all the middlewares registered with
+	// RegisterMiddleware.
+	middlewares = []Middleware{}
+
+	// metrics contains the metrics exported by MetricsMiddleware.
+	metrics = expvar.NewMap("backendCapsules")
+)
+
+// RegisterMiddleware registers a middleware wrapping the processing of each
+// capsule. The middlewares are applied in registration order, the first one
+// being the outermost. It must be called before New.
+func RegisterMiddleware(middleware Middleware) {
+	middlewaresMutex.Lock()
+	defer middlewaresMutex.Unlock()
+
+	middlewares = append(middlewares, middleware)
+}
+
+// registeredMiddlewares returns a copy of the registered middlewares.
+func registeredMiddlewares() []Middleware {
+	middlewaresMutex.Lock()
+	defer middlewaresMutex.Unlock()
+
+	return append([]Middleware{}, middlewares...)
+}
+
+// chain wraps the handler with the given middlewares. The first middleware is
+// the outermost one.
+func chain(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	return handler
+}
+
+// LoggingMiddleware is a sample middleware which logs each processed capsule
+// with its processing duration.
+func LoggingMiddleware(next Handler) Handler {
+	return func(capsule *capsule.Capsule) error {
+		start := time.Now()
+		err := next(capsule)
+
+		localLogger := logger.WithFields(log.Fields{
+			"provider": capsule.FrontendProvider,
+			"user":     capsule.User,
+			"intent":   capsule.Intent,
+			"duration": time.Since(start),
+		})
+
+		if err != nil {
+			localLogger.WithError(err).Info("Capsule processing failed")
+			return err
+		}
+
+		localLogger.Info("Capsule processed")
+		return nil
+	}
+}
+
+// MetricsMiddleware is a sample middleware which exports the number of
+// processed capsules, the number of failures and the total processing time
+// in the backendCapsules expvar map.
+func MetricsMiddleware(next Handler) Handler {
+	return func(capsule *capsule.Capsule) error {
+		start := time.Now()
+		err := next(capsule)
+
+		metrics.Add("processed", 1)
+		metrics.AddFloat("processingSeconds", time.Since(start).Seconds())
+		if err != nil {
+			metrics.Add("failed", 1)
+		}
+
+		return err
+	}
+}
+
+// renderMiddleware renders the responses of the processed capsule with the
+// response template.
+func (b *Backend) renderMiddleware(next Handler) Handler {
+	return func(capsule *capsule.Capsule) error {
+		if err := next(capsule); err != nil {
+			return err
+		}
+
+		return b.render(capsule)
+	}
+}
+
+// controlMiddleware executes the control of a control capsule instead of
+// calling the provider.
+func (b *Backend) controlMiddleware(next Handler) Handler {
+	return func(capsule *capsule.Capsule) error {
+		if len(capsule.Control) > 0 {
+			return b.control(capsule)
+		}
+
+		return next(capsule)
+	}
+}
+
+// escalationMiddleware escalates the conversation to a human operator when
+// the user sends the escalation command.
+func (b *Backend) escalationMiddleware(next Handler) Handler {
+	return func(capsule *capsule.Capsule) error {
+		if b.escalation.byCommand(capsule.Content) {
+			return b.Escalate(capsule)
+		}
+
+		return next(capsule)
+	}
+}
+
+// sentimentMiddleware sets the capsule sentiment. A very negative message is
+// answered with the negative sentiment response instead of calling the
+// provider.
+func (b *Backend) sentimentMiddleware(next Handler) Handler {
+	return func(capsule *capsule.Capsule) error {
+		b.analyzeSentiment(capsule)
+		if len(b.negativeSentimentResponse) > 0 && capsule.Sentiment < b.negativeSentimentThreshold {
+			logger.Debugf("Very negative message received from %s: %f", capsule.User, capsule.Sentiment)
+			capsule.Responses = append(capsule.Responses, b.negativeSentimentResponse)
+			return nil
+		}
+
+		return next(capsule)
+	}
+}
@@ -0,0 +1,211 @@
+package backend
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+)
+
+type (
+	// webhookNotifier posts the processed conversations to an outbound
+	// webhook. The notifications are sent by a background routine so they
+	// never block the capsules processing.
+	webhookNotifier struct {
+		// url is the webhook URL.
+		url string
+
+		// secret is the shared secret signing the requests. The requests are not
+		// signed when it is empty.
+		secret string
+
+		// client is the http client calling the webhook.
+		client *http.Client
+
+		// notifications is the queue of the notifications to send.
+		notifications chan *notification
+
+		// done is closed when the background routine returned.
+		done chan struct{}
+	}
+
+	// notification is the body posted to the webhook.
+	notification struct {
+		// OriginalMessage is the original message UUID of the capsule.
+		OriginalMessage uuid.UUID `json:"originalMessage"`
+
+		// FrontendProvider is the frontend provider of the user.
+		FrontendProvider string `json:"frontendProvider"`
+
+		// User is the user name.
+		User string `json:"user"`
+
+		// Content is the user message.
+		Content string `json:"content"`
+
+		// Intent is the top intent of the message.
+		Intent string `json:"intent"`
+
+		// Entities is a slice containing the recognized entities.
+		Entities []*capsule.Entity `json:"entities,omitempty"`
+
+		// Responses is a slice containing the responses sent to the user.
+		Responses []string `json:"responses"`
+
+		// Error is the processing error message.
+		Error string `json:"error,omitempty"`
+
+		// ReceivedAt is the time when the backend received the message.
+		ReceivedAt time.Time `json:"receivedAt"`
+
+		// RespondedAt is the time when the backend produced the responses.
+		RespondedAt time.Time `json:"respondedAt"`
+	}
+)
+
+const (
+	// SignatureHeader is the header containing the HMAC-SHA256 signature of the
+	// notification body, hex-encoded and prefixed with sha256=.
+	SignatureHeader = "X-Samantha-Signature"
+
+	// notifyTimeout is the timeout of a webhook request.
+	notifyTimeout = 5 * time.Second
+
+	// notifyAttempts is the number of attempts to send a notification.
+	notifyAttempts = 3
+
+	// notifyRetryDelay is the delay before the first retry. It doubles after
+	// each attempt.
+	notifyRetryDelay = time.Second
+
+	// notificationsQueueSize is the size of the notifications queue. The
+	// notifications are dropped when it is full.
+	notificationsQueueSize = 100
+)
+
+// newWebhookNotifier initializes a new webhook notifier and starts its
+// background routine. It returns nil when the URL is empty.
+func newWebhookNotifier(url, secret string) *webhookNotifier {
+	if len(url) == 0 {
+		return nil
+	}
+
+	n := &webhookNotifier{
+		url:           url,
+		secret:        secret,
+		client:        &http.Client{Timeout: notifyTimeout},
+		notifications: make(chan *notification, notificationsQueueSize),
+		done:          make(chan struct{}),
+	}
+
+	go n.run()
+	return n
+}
+
+// notifyMiddleware queues a notification of each processed capsule.
+func (b *Backend) notifyMiddleware(next Handler) Handler {
+	return func(capsule *capsule.Capsule) error {
+		receivedAt := time.Now()
+		err := next(capsule)
+
+		n := &notification{
+			OriginalMessage:  capsule.OriginalMessage,
+			FrontendProvider: capsule.FrontendProvider,
+			User:             capsule.User,
+			Content:          capsule.Content,
+			Intent:           capsule.Intent,
+			Entities:         capsule.Entities,
+			Responses:        capsule.Responses,
+			ReceivedAt:       receivedAt,
+			RespondedAt:      time.Now(),
+		}
+
+		if err != nil {
+			n.Error = err.Error()
+		}
+
+		select {
+		case b.notifier.notifications <- n:
+		default:
+			logger.Warn("Webhook notifications queue is full, dropping notification")
+		}
+
+		return err
+	}
+}
+
+// run sends the queued notifications until the notifier is stopped.
+func (n *webhookNotifier) run() {
+	defer close(n.done)
+
+	for notification := range n.notifications {
+		if err := n.send(notification); err != nil {
+			logger.WithError(err).Warn("Cannot notify webhook")
+		}
+	}
+}
+
+// send posts the notification, retrying on failure.
+func (n *webhookNotifier) send(notification *notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return errors.Annotate(err, "marshaling notification")
+	}
+
+	delay := notifyRetryDelay
+	for attempt := 1; ; attempt++ {
+		err = n.post(body)
+		if err == nil || attempt == notifyAttempts {
+			return err
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// post posts the body to the webhook.
+func (n *webhookNotifier) post(body []byte) error {
+	request, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Annotate(err, "creating webhook request")
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	if len(n.secret) > 0 {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write(body)
+		request.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	response, err := n.client.Do(request)
+	if err != nil {
+		return errors.Annotate(err, "calling webhook")
+	}
+	response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		return errors.Errorf("webhook responded with status %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// stop sends the queued notifications and stops the background routine. It
+// waits at most the given duration.
+func (n *webhookNotifier) stop(timeout time.Duration) {
+	close(n.notifications)
+
+	select {
+	case <-n.done:
+	case <-time.After(timeout):
+		logger.Warn("Pending webhook notifications dropped on shutdown")
+	}
+}
@@ -0,0 +1,82 @@
+package backend
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotification(t *testing.T) {
+	const secret = "s3cr3t"
+	received := make(chan *notification, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		if r.Header.Get(SignatureHeader) != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		n := &notification{}
+		if err := json.Unmarshal(body, n); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		received <- n
+	}))
+	defer server.Close()
+
+	b, toBackend, toFrontend := newTestBackend(t, &fakeProvider{}, "notifyWebhookURL: "+server.URL+"\nnotifyWebhookSecret: "+secret+"\n")
+	start(t, b, toBackend)
+
+	c := exchange(t, toBackend, toFrontend, newCapsule("alice", "hello"))
+	select {
+	case n := <-received:
+		if n.OriginalMessage != c.OriginalMessage || n.User != "alice" || n.Content != "hello" {
+			t.Errorf("notification = %+v, want the conversation of alice", n)
+		}
+
+		if want := []string{"hello"}; !reflect.DeepEqual(n.Responses, want) {
+			t.Errorf("notified responses = %v, want %v", n.Responses, want)
+		}
+
+		if n.RespondedAt.Before(n.ReceivedAt) {
+			t.Errorf("responded at %s, before receiving at %s", n.RespondedAt, n.ReceivedAt)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("no signed notification received")
+	}
+}
+
+func TestWebhookNotificationRetry(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	n := newWebhookNotifier(server.URL, "")
+	n.notifications <- &notification{User: "alice"}
+	n.stop(testTimeout)
+
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("webhook called %d times, want 2", got)
+	}
+}
@@ -0,0 +1,309 @@
+package botpress
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/fberrez/samantha/capsule"
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+)
+
+type (
+	// Botpress is a client of the Botpress Converse API. Botpress keeps the
+	// state of the conversation of each Botpress user: each user of the
+	// backend is mapped to a Botpress user ID, which is replaced on reset.
+	Botpress struct {
+		// client is the http client calling the API.
+		client *http.Client
+
+		// url is the base URL of the Botpress server.
+		url string
+
+		// token is the bearer token of the API. It is optional.
+		token string
+
+		// botID is the ID of the bot.
+		botID string
+
+		// mutex protects the userIDs map.
+		mutex sync.Mutex
+
+		// userIDs indexes the Botpress user IDs by user.
+		userIDs map[string]string
+	}
+
+	// converseRequest is the body of a converse request.
+	converseRequest struct {
+		// Type is the type of the message.
+		Type string `json:"type"`
+
+		// Text is the text of the message.
+		Text string `json:"text"`
+	}
+
+	// converseResponse is the body of a converse response.
+	converseResponse struct {
+		// Responses is a slice containing the response payloads of the bot.
+		Responses []*payload `json:"responses"`
+
+		// NLU is the understanding of the user message.
+		NLU *nlu `json:"nlu"`
+
+		// Message is the error message of a failed request.
+		Message string `json:"message"`
+	}
+
+	// payload is a response payload of the bot.
+	payload struct {
+		// Type is the type of the payload (ex: text, image).
+		Type string `json:"type"`
+
+		// Text is the text of a text payload.
+		Text string `json:"text"`
+
+		// Image is the URL of the image of an image payload.
+		Image string `json:"image"`
+
+		// Title is the title of an image payload.
+		Title string `json:"title"`
+	}
+
+	// nlu is the understanding of the user message.
+	nlu struct {
+		// Intent is the most confident intent.
+		Intent *intent `json:"intent"`
+
+		// Intents is a slice containing the predicted intents.
+		Intents []*intent `json:"intents"`
+
+		// Entities is a slice containing the extracted entities.
+		Entities []*entity `json:"entities"`
+	}
+
+	// intent is an intent predicted by the NLU.
+	intent struct {
+		// Name is the name of the intent.
+		Name string `json:"name"`
+
+		// Confidence is the confidence of the intent.
+		Confidence float32 `json:"confidence"`
+	}
+
+	// entity is an entity extracted by the NLU.
+	entity struct {
+		// Name is the name of the entity.
+		Name string `json:"name"`
+
+		// Meta contains the confidence of the entity.
+		Meta struct {
+			// Confidence is the confidence of the entity.
+			Confidence float32 `json:"confidence"`
+		} `json:"meta"`
+
+		// Data contains the value of the entity.
+		Data struct {
+			// Value is the value of the entity, whose type depends on the
+			// entity (ex: a number).
+			Value interface{} `json:"value"`
+		} `json:"data"`
+	}
+)
+
+const (
+	label = "botpress"
+
+	// requestTimeout is the timeout of the API requests.
+	requestTimeout = 30 * time.Second
+
+	// textType is the type of the text payloads.
+	textType = "text"
+
+	// imageType is the type of the image payloads.
+	imageType = "image"
+)
+
+// Initialize initializes a new Botpress client.
+func (b *Botpress) Initialize(config *provider.Config) (provider.Provider, error) {
+	if len(config.URL) == 0 {
+		return nil, errors.NotValidf("empty URL")
+	}
+
+	if len(config.BotID) == 0 {
+		return nil, errors.NotValidf("empty bot ID")
+	}
+
+	return &Botpress{
+		client:  &http.Client{Timeout: requestTimeout},
+		url:     strings.TrimSuffix(config.URL, "/"),
+		token:   config.Token,
+		botID:   config.BotID,
+		userIDs: map[string]string{},
+	}, nil
+}
+
+// Message sends the user message to the bot and returns its responses. The
+// text payloads are text outputs and the image payloads are cards.
+func (b *Botpress) Message(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+	userID, err := b.userID(input.User)
+	if err != nil {
+		return nil, errors.Annotate(err, "sending a message to Botpress")
+	}
+
+	statusCode, result, err := b.converse(ctx, userID, input.Text)
+	if err != nil {
+		return nil, provider.NewError(errorCode(statusCode, err), errors.Annotate(err, "sending a message to Botpress"))
+	}
+
+	response := &provider.Response{
+		StatusCode: statusCode,
+		Outputs:    []*provider.Output{},
+		Intents:    []*provider.Intent{},
+	}
+
+	for _, p := range result.Responses {
+		switch p.Type {
+		case textType:
+			response.Outputs = append(response.Outputs, &provider.Output{
+				ResponseType: textType,
+				Text:         p.Text,
+			})
+		case imageType:
+			response.Outputs = append(response.Outputs, &provider.Output{
+				ResponseType: imageType,
+				Card:         &capsule.Card{Title: p.Title, ImageURL: p.Image},
+			})
+		}
+	}
+
+	if result.NLU == nil {
+		return response, nil
+	}
+
+	intents := result.NLU.Intents
+	if len(intents) == 0 && result.NLU.Intent != nil {
+		intents = []*intent{result.NLU.Intent}
+	}
+
+	for _, i := range intents {
+		response.Intents = append(response.Intents, &provider.Intent{
+			Intent:     i.Name,
+			Confidence: i.Confidence,
+		})
+	}
+
+	for _, e := range result.NLU.Entities {
+		response.Entities = append(response.Entities, &provider.Entity{
+			Entity:     e.Name,
+			Value:      fmt.Sprint(e.Data.Value),
+			Confidence: e.Meta.Confidence,
+		})
+	}
+
+	return response, nil
+}
+
+// ResetSession replaces the Botpress user ID of the given user, so its next
+// message starts a new conversation.
+func (b *Botpress) ResetSession(user string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.userIDs, user)
+	return nil
+}
+
+// GetLabel returns the provider label.
+func (b *Botpress) GetLabel() string {
+	return label
+}
+
+// Stop does nothing since the client holds no resource.
+func (b *Botpress) Stop() error {
+	return nil
+}
+
+// userID returns the Botpress user ID of the given user. A new ID is
+// generated if the user has none.
+func (b *Botpress) userID(user string) (string, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if id, ok := b.userIDs[user]; ok {
+		return id, nil
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", errors.Annotate(err, "generating user ID")
+	}
+
+	b.userIDs[user] = id.String()
+	return id.String(), nil
+}
+
+// converse calls the converse endpoint with the NLU included and returns the
+// status code and the response.
+func (b *Botpress) converse(ctx context.Context, userID string, text string) (int, *converseResponse, error) {
+	data, err := json.Marshal(&converseRequest{Type: textType, Text: text})
+	if err != nil {
+		return 0, nil, errors.Annotate(err, "marshaling request")
+	}
+
+	endpoint := fmt.Sprintf("%s/api/v1/bots/%s/converse/%s?include=nlu", b.url, url.PathEscape(b.botID), url.PathEscape(userID))
+	request, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return 0, nil, errors.Annotate(err, "creating request")
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	if len(b.token) > 0 {
+		request.Header.Set("Authorization", "Bearer "+b.token)
+	}
+
+	response, err := b.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return 0, nil, errors.Annotate(err, "calling converse")
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return response.StatusCode, nil, errors.Annotate(err, "reading response")
+	}
+
+	result := &converseResponse{}
+	if err := json.Unmarshal(body, result); err != nil {
+		return response.StatusCode, nil, errors.Annotate(err, "unmarshaling response")
+	}
+
+	if response.StatusCode >= 300 {
+		return response.StatusCode, nil, errors.Errorf("converse responded with status %d: %s", response.StatusCode, result.Message)
+	}
+
+	return response.StatusCode, result, nil
+}
+
+// errorCode returns the code of a failed call to the API from the status of
+// its response, or from the error when there is no response.
+func errorCode(statusCode int, err error) string {
+	if code := provider.StatusErrorCode(statusCode); len(code) > 0 {
+		return code
+	}
+
+	if netErr, ok := errors.Cause(err).(net.Error); ok && netErr.Timeout() {
+		return provider.ErrorTimeout
+	}
+
+	return provider.ErrorUpstream
+}
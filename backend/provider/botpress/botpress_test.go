@@ -0,0 +1,199 @@
+package botpress
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/fberrez/samantha/capsule"
+)
+
+type (
+	// fakeServer is a Botpress server recording the converse requests.
+	fakeServer struct {
+		// mutex protects the recorded requests.
+		mutex sync.Mutex
+
+		// userIDs is a slice containing the Botpress user IDs of the requests.
+		userIDs []string
+
+		// texts is a slice containing the texts of the requests.
+		texts []string
+
+		// status is the status of the responses.
+		status int
+
+		// body is the body of the responses.
+		body string
+	}
+)
+
+// sampleResponse is a converse response with a text, an image and the NLU.
+const sampleResponse = `{
+	"responses": [
+		{"type": "text", "text": "Hello alice"},
+		{"type": "image", "image": "https://example.com/cat.png", "title": "A cat"},
+		{"type": "custom"}
+	],
+	"nlu": {
+		"intent": {"name": "greeting", "confidence": 0.9},
+		"intents": [{"name": "greeting", "confidence": 0.9}, {"name": "goodbye", "confidence": 0.1}],
+		"entities": [{"name": "number", "meta": {"confidence": 0.8}, "data": {"value": 3}}]
+	}
+}`
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix := "/api/v1/bots/bot/converse/"
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.URL.Path, prefix) || r.Header.Get("Authorization") != "Bearer secret" {
+		http.Error(w, `{"message":"unexpected request"}`, http.StatusBadRequest)
+		return
+	}
+
+	request := &converseRequest{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil || request.Type != textType {
+		http.Error(w, `{"message":"invalid body"}`, http.StatusBadRequest)
+		return
+	}
+
+	s.mutex.Lock()
+	s.userIDs = append(s.userIDs, strings.TrimPrefix(r.URL.Path, prefix))
+	s.texts = append(s.texts, request.Text)
+	s.mutex.Unlock()
+
+	w.WriteHeader(s.status)
+	w.Write([]byte(s.body))
+}
+
+// newTestBotpress returns a Botpress client of a fake server answering with
+// the given status and body.
+func newTestBotpress(t *testing.T, status int, body string) (provider.Provider, *fakeServer) {
+	t.Helper()
+
+	s := &fakeServer{status: status, body: body}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+
+	b, err := (&Botpress{}).Initialize(&provider.Config{URL: server.URL + "/", Token: "secret", BotID: "bot"})
+	if err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	return b, s
+}
+
+func TestMessage(t *testing.T) {
+	b, s := newTestBotpress(t, http.StatusOK, sampleResponse)
+
+	response, err := b.Message(context.Background(), &provider.Input{User: "alice", Text: "hello"})
+	if err != nil {
+		t.Fatalf("Message() error = %v", err)
+	}
+
+	if len(s.texts) != 1 || s.texts[0] != "hello" {
+		t.Errorf("sent texts = %q, want the message", s.texts)
+	}
+
+	wantOutputs := []*provider.Output{
+		{ResponseType: textType, Text: "Hello alice"},
+		{ResponseType: imageType, Card: &capsule.Card{Title: "A cat", ImageURL: "https://example.com/cat.png"}},
+	}
+	if !reflect.DeepEqual(response.Outputs, wantOutputs) {
+		t.Errorf("outputs = %+v, want the text and the image", response.Outputs)
+	}
+
+	wantIntents := []*provider.Intent{{Intent: "greeting", Confidence: 0.9}, {Intent: "goodbye", Confidence: 0.1}}
+	if !reflect.DeepEqual(response.Intents, wantIntents) {
+		t.Errorf("intents = %+v, want %+v", response.Intents, wantIntents)
+	}
+
+	wantEntities := []*provider.Entity{{Entity: "number", Value: "3", Confidence: 0.8}}
+	if !reflect.DeepEqual(response.Entities, wantEntities) {
+		t.Errorf("entities = %+v, want %+v", response.Entities, wantEntities)
+	}
+}
+
+func TestMessageWithoutNLU(t *testing.T) {
+	b, _ := newTestBotpress(t, http.StatusOK, `{"responses":[{"type":"text","text":"Hello"}]}`)
+
+	response, err := b.Message(context.Background(), &provider.Input{User: "alice", Text: "hello"})
+	if err != nil {
+		t.Fatalf("Message() error = %v", err)
+	}
+
+	if len(response.Outputs) != 1 || len(response.Intents) != 0 {
+		t.Errorf("response = %+v, want a text without intent", response)
+	}
+}
+
+func TestMessageErrorCode(t *testing.T) {
+	tests := []struct {
+		status int
+		code   string
+	}{
+		{http.StatusUnauthorized, provider.ErrorAuth},
+		{http.StatusTooManyRequests, provider.ErrorRateLimit},
+		{http.StatusInternalServerError, provider.ErrorUpstream},
+		{http.StatusNotFound, provider.ErrorUpstream},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			b, _ := newTestBotpress(t, tt.status, `{"message":"failed"}`)
+
+			_, err := b.Message(context.Background(), &provider.Input{User: "alice", Text: "hello"})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if code := provider.ErrorCode(err); code != tt.code {
+				t.Errorf("error code = %q, want %q", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestResetSession(t *testing.T) {
+	b, s := newTestBotpress(t, http.StatusOK, sampleResponse)
+
+	for _, user := range []string{"alice", "alice", "bob"} {
+		if _, err := b.Message(context.Background(), &provider.Input{User: user, Text: "hello"}); err != nil {
+			t.Fatalf("Message() error = %v", err)
+		}
+	}
+
+	if err := b.ResetSession("alice"); err != nil {
+		t.Fatalf("ResetSession() error = %v", err)
+	}
+
+	if _, err := b.Message(context.Background(), &provider.Input{User: "alice", Text: "hello"}); err != nil {
+		t.Fatalf("Message() error = %v", err)
+	}
+
+	ids := s.userIDs
+	if ids[0] != ids[1] || ids[0] == ids[2] {
+		t.Errorf("user IDs = %v, want a conversation for each user", ids)
+	}
+
+	if ids[3] == ids[0] {
+		t.Error("user ID of alice kept after the reset")
+	}
+}
+
+func TestInitializeInvalid(t *testing.T) {
+	configs := []*provider.Config{
+		{BotID: "bot"},
+		{URL: "http://localhost:3000"},
+	}
+
+	for _, config := range configs {
+		if _, err := (&Botpress{}).Initialize(config); err == nil {
+			t.Errorf("Initialize(%+v) expected an error", config)
+		}
+	}
+}
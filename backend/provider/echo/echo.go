@@ -0,0 +1,72 @@
+package echo
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/fberrez/samantha/backend/provider"
+)
+
+type (
+	// Echo is an offline provider responding to every message by echoing it.
+	// It is meant for demos and tests, which then need no credentials.
+	Echo struct{}
+)
+
+const (
+	label = "echo"
+)
+
+// Initialize returns the provider. It needs no configuration.
+func (e *Echo) Initialize(config *provider.Config) (provider.Provider, error) {
+	return &Echo{}, nil
+}
+
+// Message responds with the text of the message.
+func (e *Echo) Message(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+	return &provider.Response{
+		StatusCode: http.StatusOK,
+		Outputs: []*provider.Output{
+			{
+				ResponseType: "text",
+				Text:         input.Text,
+			},
+		},
+		Intents: []*provider.Intent{},
+	}, nil
+}
+
+// MessageStream streams the text of the message word by word. It is a simple
+// streamer for testing the streaming frontends.
+func (e *Echo) MessageStream(ctx context.Context, input *provider.Input) (<-chan string, error) {
+	chunks := make(chan string)
+	go func() {
+		defer close(chunks)
+
+		for _, word := range strings.SplitAfter(input.Text, " ") {
+			select {
+			case chunks <- word:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return chunks, nil
+}
+
+// ResetSession does nothing since the provider has no conversation state.
+func (e *Echo) ResetSession(user string) error {
+	return nil
+}
+
+// GetLabel returns the provider label.
+func (e *Echo) GetLabel() string {
+	return label
+}
+
+// Stop does nothing since the provider holds no resource.
+func (e *Echo) Stop() error {
+	return nil
+}
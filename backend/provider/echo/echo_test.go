@@ -0,0 +1,51 @@
+package echo
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/fberrez/samantha/backend/provider"
+)
+
+func TestMessage(t *testing.T) {
+	response, err := (&Echo{}).Message(context.Background(), &provider.Input{User: "alice", Text: "hello there"})
+	if err != nil {
+		t.Fatalf("Message() error = %v", err)
+	}
+
+	if len(response.Outputs) != 1 || response.Outputs[0].Text != "hello there" {
+		t.Errorf("outputs = %v, want the echoed text", response.Outputs)
+	}
+}
+
+func TestMessageStream(t *testing.T) {
+	chunks, err := (&Echo{}).MessageStream(context.Background(), &provider.Input{User: "alice", Text: "hello there you"})
+	if err != nil {
+		t.Fatalf("MessageStream() error = %v", err)
+	}
+
+	words := []string{}
+	for chunk := range chunks {
+		words = append(words, chunk)
+	}
+
+	if want := []string{"hello ", "there ", "you"}; !reflect.DeepEqual(words, want) {
+		t.Errorf("chunks = %q, want %q", words, want)
+	}
+}
+
+func TestMessageStreamCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	chunks, err := (&Echo{}).MessageStream(ctx, &provider.Input{User: "alice", Text: "hello there you"})
+	if err != nil {
+		t.Fatalf("MessageStream() error = %v", err)
+	}
+
+	<-chunks
+	cancel()
+
+	// The stream is closed once the context is canceled.
+	for range chunks {
+	}
+}
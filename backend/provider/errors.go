@@ -0,0 +1,80 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/juju/errors"
+)
+
+// The error codes are the codes of the capsule errors.
+const (
+	ErrorAuth      = capsule.ErrorAuth
+	ErrorRateLimit = capsule.ErrorRateLimit
+	ErrorUpstream  = capsule.ErrorUpstream
+	ErrorTimeout   = capsule.ErrorTimeout
+)
+
+// Error is a failure of a provider with its code, so it can be handled
+// without matching its text.
+type Error struct {
+	// Code is the code of the failure (ex: ErrorAuth).
+	Code string
+
+	// Err is the underlying error.
+	Err error
+}
+
+// NewError returns the error with the given code. It returns the error
+// unchanged when the code is empty.
+func NewError(code string, err error) error {
+	if len(code) == 0 || err == nil {
+		return err
+	}
+
+	return &Error{Code: code, Err: err}
+}
+
+// Error returns the text of the underlying error.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// ErrorCode returns the code of the given error, even once annotated. The
+// expired contexts are timeouts. It returns an empty string when the error has
+// no code.
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	switch cause := errors.Cause(err).(type) {
+	case *Error:
+		return cause.Code
+	default:
+		if cause == context.DeadlineExceeded {
+			return ErrorTimeout
+		}
+
+		return ""
+	}
+}
+
+// StatusErrorCode returns the code of a failure of a provider API from the
+// HTTP status of its response. It returns an empty string when the status is
+// not a failure.
+func StatusErrorCode(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrorAuth
+	case status == http.StatusTooManyRequests:
+		return ErrorRateLimit
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		return ErrorTimeout
+	case status >= http.StatusInternalServerError:
+		return ErrorUpstream
+	default:
+		return ""
+	}
+}
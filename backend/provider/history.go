@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+type (
+	// History keeps the last turns of the conversation of each user, so they
+	// can be sent to the providers which do not keep the context of the
+	// conversation on their side (ex: LLM providers).
+	History struct {
+		// mutex protects the turns map.
+		mutex sync.Mutex
+
+		// turns indexes the turns of the conversations by user.
+		turns map[string][]*Turn
+
+		// size is the maximum number of turns kept for each user.
+		size int
+	}
+
+	// Turn is a message of a conversation.
+	Turn struct {
+		// Role is the author of the message: RoleUser or RoleAssistant.
+		Role string `json:"role"`
+
+		// Text is the text of the message.
+		Text string `json:"text"`
+	}
+)
+
+const (
+	// RoleUser is the role of the messages of the user.
+	RoleUser = "user"
+
+	// RoleAssistant is the role of the answers of the provider.
+	RoleAssistant = "assistant"
+)
+
+// NewHistory initializes a history keeping at most size turns for each user.
+// It keeps nothing when size is zero or negative.
+func NewHistory(size int) *History {
+	return &History{
+		turns: map[string][]*Turn{},
+		size:  size,
+	}
+}
+
+// Add appends the turns to the conversation of the given user. The oldest
+// turns are dropped once the history is full.
+func (h *History) Add(user string, turns ...*Turn) {
+	if h.size <= 0 {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	history := append(h.turns[user], turns...)
+	if len(history) > h.size {
+		history = history[len(history)-h.size:]
+	}
+
+	h.turns[user] = history
+}
+
+// Turns returns a copy of the turns of the conversation of the given user,
+// from the oldest to the newest.
+func (h *History) Turns(user string) []*Turn {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return append([]*Turn{}, h.turns[user]...)
+}
+
+// Reset forgets the conversation of the given user.
+func (h *History) Reset(user string) {
+	h.mutex.Lock()
+	delete(h.turns, user)
+	h.mutex.Unlock()
+}
+
+// ExportSessions serializes the histories of all the users.
+func (h *History) ExportSessions() ([]byte, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	data, err := json.Marshal(h.turns)
+	if err != nil {
+		return nil, errors.Annotate(err, "marshaling histories")
+	}
+
+	return data, nil
+}
+
+// ImportSessions restores the histories serialized by ExportSessions. The
+// histories are truncated to the size of the history.
+func (h *History) ImportSessions(data []byte) error {
+	histories := map[string][]*Turn{}
+	if err := json.Unmarshal(data, &histories); err != nil {
+		return errors.Annotate(err, "unmarshaling histories")
+	}
+
+	for user, turns := range histories {
+		h.Reset(user)
+		h.Add(user, turns...)
+	}
+
+	return nil
+}
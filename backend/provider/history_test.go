@@ -0,0 +1,59 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+)
+
+// exchange returns the turns of a message of the user and its answer.
+func exchange(message, answer string) []*Turn {
+	return []*Turn{{Role: RoleUser, Text: message}, {Role: RoleAssistant, Text: answer}}
+}
+
+func TestHistoryBounded(t *testing.T) {
+	h := NewHistory(4)
+	h.Add("alice", exchange("1", "a")...)
+	h.Add("alice", exchange("2", "b")...)
+	h.Add("alice", exchange("3", "c")...)
+
+	want := append(exchange("2", "b"), exchange("3", "c")...)
+	if got := h.Turns("alice"); !reflect.DeepEqual(got, want) {
+		t.Errorf("turns = %v, want the last 2 exchanges", got)
+	}
+}
+
+func TestHistoryDisabled(t *testing.T) {
+	h := NewHistory(0)
+	h.Add("alice", exchange("hello", "hi")...)
+
+	if turns := h.Turns("alice"); len(turns) != 0 {
+		t.Errorf("turns = %v, want none", turns)
+	}
+}
+
+func TestHistoryReset(t *testing.T) {
+	h := NewHistory(4)
+	h.Add("alice", exchange("hello", "hi")...)
+	h.Add("bob", exchange("hello", "hi")...)
+
+	h.Reset("alice")
+	if turns := h.Turns("alice"); len(turns) != 0 {
+		t.Errorf("turns of alice = %v, want none after the reset", turns)
+	}
+
+	if turns := h.Turns("bob"); len(turns) != 2 {
+		t.Errorf("turns of bob = %v, want the history kept", turns)
+	}
+}
+
+func TestHistoryTurnsCopy(t *testing.T) {
+	h := NewHistory(4)
+	h.Add("alice", exchange("hello", "hi")...)
+
+	turns := h.Turns("alice")
+	turns[0] = &Turn{Role: RoleUser, Text: "changed"}
+
+	if got := h.Turns("alice"); got[0].Text != "hello" {
+		t.Errorf("first turn = %v, want the history unchanged", got[0])
+	}
+}
@@ -0,0 +1,206 @@
+package keyword
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/juju/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type (
+	// Keyword is an offline intent matcher. It matches the user messages
+	// against the rules of a patterns file and responds with their canned
+	// responses.
+	Keyword struct {
+		// rules is a slice containing the matching rules, in file order.
+		rules []*rule
+
+		// fallback is the response sent when no rule matches.
+		fallback string
+	}
+
+	// patterns is the structured patterns file.
+	patterns struct {
+		// Fallback is the response sent when no rule matches.
+		Fallback string `json:"fallback" yaml:"fallback"`
+
+		// Rules is a slice containing the matching rules.
+		Rules []*rule `json:"rules" yaml:"rules"`
+	}
+
+	// rule maps keywords and patterns to an intent and its responses.
+	rule struct {
+		// Intent is the name of the intent recognized by the rule.
+		Intent string `json:"intent" yaml:"intent"`
+
+		// Keywords is a slice containing the words recognizing the intent.
+		Keywords []string `json:"keywords" yaml:"keywords"`
+
+		// Patterns is a slice containing the regular expressions recognizing
+		// the intent.
+		Patterns []string `json:"patterns" yaml:"patterns"`
+
+		// Responses is a slice containing the responses of the intent.
+		Responses []string `json:"responses" yaml:"responses"`
+
+		// regexps is a slice containing the compiled patterns.
+		regexps []*regexp.Regexp
+	}
+)
+
+const (
+	label = "keyword"
+
+	// minKeywordConfidence is the confidence of a rule whose only one keyword
+	// matched. The confidence grows linearly with the matched keywords up to 1.
+	minKeywordConfidence = 0.5
+)
+
+var (
+	// wordPattern splits a message into words.
+	wordPattern = regexp.MustCompile(`[\pL\pN']+`)
+)
+
+// Initialize loads the patterns file given in the configuration.
+func (k *Keyword) Initialize(config *provider.Config) (provider.Provider, error) {
+	if len(config.PatternsFile) == 0 {
+		return nil, errors.NotValidf("empty patterns file")
+	}
+
+	data, err := ioutil.ReadFile(config.PatternsFile)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot read patterns file")
+	}
+
+	p := patterns{}
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, errors.Annotate(err, "cannot unmarshal patterns file")
+	}
+
+	for i, r := range p.Rules {
+		if r == nil || len(r.Intent) == 0 {
+			return nil, errors.NotValidf("rule %d without intent", i)
+		}
+
+		for j, keyword := range r.Keywords {
+			r.Keywords[j] = strings.ToLower(keyword)
+		}
+
+		for _, pattern := range r.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, errors.Annotatef(err, "compiling pattern of intent %s", r.Intent)
+			}
+
+			r.regexps = append(r.regexps, re)
+		}
+	}
+
+	return &Keyword{
+		rules:    p.Rules,
+		fallback: p.Fallback,
+	}, nil
+}
+
+// Message matches the message against the rules. A pattern match has a
+// confidence of 1. Otherwise, the confidence depends on the proportion of the
+// rule keywords found in the message. The responses of the best rule are
+// returned with the intent of each matching rule.
+func (k *Keyword) Message(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+	words := map[string]bool{}
+	for _, word := range wordPattern.FindAllString(strings.ToLower(input.Text), -1) {
+		words[word] = true
+	}
+
+	intents := []*provider.Intent{}
+	var best *rule
+	var bestConfidence float32
+	for _, r := range k.rules {
+		confidence := r.match(input.Text, words)
+		if confidence == 0 {
+			continue
+		}
+
+		intents = append(intents, &provider.Intent{
+			Intent:     r.Intent,
+			Confidence: confidence,
+		})
+
+		if confidence > bestConfidence {
+			best, bestConfidence = r, confidence
+		}
+	}
+
+	responses := []string{}
+	if best != nil {
+		responses = best.Responses
+	} else if len(k.fallback) > 0 {
+		responses = []string{k.fallback}
+	}
+
+	outputs := []*provider.Output{}
+	for _, response := range responses {
+		outputs = append(outputs, &provider.Output{
+			ResponseType: "text",
+			Text:         response,
+		})
+	}
+
+	return &provider.Response{
+		StatusCode: http.StatusOK,
+		Outputs:    outputs,
+		Intents:    intents,
+	}, nil
+}
+
+// ResetSession does nothing since the matcher has no conversation state.
+func (k *Keyword) ResetSession(user string) error {
+	return nil
+}
+
+// GetLabel returns the provider label.
+func (k *Keyword) GetLabel() string {
+	return label
+}
+
+// Stop does nothing since the matcher holds no resource.
+func (k *Keyword) Stop() error {
+	return nil
+}
+
+// match returns the confidence of the rule for the given message and its
+// lowercased words. It returns zero if the rule does not match.
+func (r *rule) match(text string, words map[string]bool) float32 {
+	for _, re := range r.regexps {
+		if re.MatchString(text) {
+			return 1
+		}
+	}
+
+	if len(r.Keywords) == 0 {
+		return 0
+	}
+
+	matched := 0
+	for _, keyword := range r.Keywords {
+		if words[keyword] {
+			matched++
+		}
+	}
+
+	if matched == 0 {
+		return 0
+	}
+
+	if len(r.Keywords) == 1 {
+		return 1
+	}
+
+	ratio := float32(matched-1) / float32(len(r.Keywords)-1)
+	return minKeywordConfidence + (1-minKeywordConfidence)*ratio
+}
@@ -0,0 +1,106 @@
+package keyword
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/fberrez/samantha/backend/provider"
+)
+
+const testPatterns = `
+fallback: "Sorry, I did not understand."
+rules:
+  - intent: greeting
+    keywords:
+      - hello
+      - hi
+    patterns:
+      - "(?i)^good (morning|afternoon|evening)"
+    responses:
+      - "Hello!"
+  - intent: weather
+    keywords:
+      - weather
+      - forecast
+      - tomorrow
+    responses:
+      - "It will be sunny."
+`
+
+// newTestKeyword initializes a keyword provider with the given patterns.
+func newTestKeyword(t *testing.T, patterns string) (provider.Provider, error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "patterns.yaml")
+	if err := ioutil.WriteFile(path, []byte(patterns), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return (&Keyword{}).Initialize(&provider.Config{PatternsFile: path})
+}
+
+func TestKeyword(t *testing.T) {
+	k, err := newTestKeyword(t, testPatterns)
+	if err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		text       string
+		intent     string
+		confidence float32
+		response   string
+	}{
+		{"keyword", "Hello there", "greeting", minKeywordConfidence, "Hello!"},
+		{"pattern", "good morning samantha", "greeting", 1, "Hello!"},
+		{"one keyword of three", "what about the weather?", "weather", minKeywordConfidence, "It will be sunny."},
+		{"every keyword", "weather forecast for tomorrow", "weather", 1, "It will be sunny."},
+		{"no match", "what is love?", "", 0, "Sorry, I did not understand."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := k.Message(context.Background(), &provider.Input{User: "alice", Text: tt.text})
+			if err != nil {
+				t.Fatalf("Message() error = %v", err)
+			}
+
+			if len(response.Outputs) != 1 || response.Outputs[0].Text != tt.response {
+				t.Errorf("outputs = %v, want %q", response.Outputs, tt.response)
+			}
+
+			if len(tt.intent) == 0 {
+				if len(response.Intents) != 0 {
+					t.Errorf("intents = %v, want none", response.Intents)
+				}
+				return
+			}
+
+			if len(response.Intents) != 1 || response.Intents[0].Intent != tt.intent || response.Intents[0].Confidence != tt.confidence {
+				t.Errorf("intents = %+v, want %s with confidence %f", response.Intents, tt.intent, tt.confidence)
+			}
+		})
+	}
+}
+
+func TestKeywordInvalidPatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns string
+	}{
+		{"rule without intent", "rules:\n  - keywords: [hello]\n"},
+		{"invalid pattern", "rules:\n  - intent: greeting\n    patterns: [\"(\"]\n"},
+		{"invalid YAML", "rules: [\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newTestKeyword(t, tt.patterns); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
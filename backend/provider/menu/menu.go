@@ -0,0 +1,216 @@
+package menu
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/juju/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type (
+	// Menu is a menu-driven bot without NLU. The users navigate the nodes of
+	// a menu file by selecting their options, displayed as buttons.
+	Menu struct {
+		// root is the name of the node of the users starting a conversation.
+		root string
+
+		// nodes indexes the menu nodes by name.
+		nodes map[string]*node
+
+		// invalidOption is the response sent when the user message is not an
+		// option of its current node.
+		invalidOption string
+
+		// mutex protects the current map.
+		mutex sync.Mutex
+
+		// current indexes the name of the current node by user.
+		current map[string]string
+	}
+
+	// menuFile is the structured menu file.
+	menuFile struct {
+		// Root is the name of the node of the users starting a conversation.
+		Root string `json:"root" yaml:"root"`
+
+		// InvalidOption is the response sent when the user message is not an
+		// option of its current node.
+		InvalidOption string `json:"invalidOption" yaml:"invalidOption"`
+
+		// Nodes indexes the menu nodes by name.
+		Nodes map[string]*node `json:"nodes" yaml:"nodes"`
+	}
+
+	// node is a menu node.
+	node struct {
+		// Text is the text displayed when the user reaches the node.
+		Text string `json:"text" yaml:"text"`
+
+		// Options is a slice containing the choices of the node. A node
+		// without option ends the navigation: the user goes back to the root.
+		Options []*option `json:"options" yaml:"options"`
+	}
+
+	// option is a choice of a menu node.
+	option struct {
+		// Label is the label of the button.
+		Label string `json:"label" yaml:"label"`
+
+		// Next is the name of the node reached by selecting the option.
+		Next string `json:"next" yaml:"next"`
+	}
+)
+
+const (
+	label = "menu"
+
+	// startCommand resets the navigation of the user to the root node.
+	startCommand = "/start"
+
+	// optionType is the response type of a node.
+	optionType = "option"
+
+	// defaultInvalidOption is the default response sent when the user message
+	// is not an option of its current node.
+	defaultInvalidOption = "Please choose one of the options."
+)
+
+// Initialize loads the menu file given in the configuration. Every option
+// must lead to an existing node.
+func (m *Menu) Initialize(config *provider.Config) (provider.Provider, error) {
+	if len(config.MenuFile) == 0 {
+		return nil, errors.NotValidf("empty menu file")
+	}
+
+	data, err := ioutil.ReadFile(config.MenuFile)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot read menu file")
+	}
+
+	f := menuFile{}
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, errors.Annotate(err, "cannot unmarshal menu file")
+	}
+
+	if _, ok := f.Nodes[f.Root]; !ok {
+		return nil, errors.NotFoundf("root node %q", f.Root)
+	}
+
+	for name, n := range f.Nodes {
+		if n == nil {
+			return nil, errors.NotValidf("empty node %s", name)
+		}
+
+		for _, o := range n.Options {
+			if o == nil || len(o.Label) == 0 {
+				return nil, errors.NotValidf("option without label in node %s", name)
+			}
+
+			if _, ok := f.Nodes[o.Next]; !ok {
+				return nil, errors.NotFoundf("node %q of option %s", o.Next, o.Label)
+			}
+		}
+	}
+
+	invalidOption := f.InvalidOption
+	if len(invalidOption) == 0 {
+		invalidOption = defaultInvalidOption
+	}
+
+	return &Menu{
+		root:          f.Root,
+		nodes:         f.Nodes,
+		invalidOption: invalidOption,
+		current:       map[string]string{},
+	}, nil
+}
+
+// Message moves the user to the node of the selected option and returns the
+// node text and options. An option is selected by its label or its number.
+// The start command and the first message of a user display the root node.
+// The intent of the response is the name of the reached node.
+func (m *Menu) Message(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	name, ok := m.current[input.User]
+	if !ok || strings.TrimSpace(input.Text) == startCommand {
+		return m.move(input.User, m.root, ""), nil
+	}
+
+	n := m.nodes[name]
+	if len(n.Options) == 0 {
+		return m.move(input.User, m.root, ""), nil
+	}
+
+	for i, o := range n.Options {
+		selection := strings.TrimSpace(input.Text)
+		if strings.EqualFold(selection, o.Label) || selection == strconv.Itoa(i+1) {
+			return m.move(input.User, o.Next, ""), nil
+		}
+	}
+
+	return m.move(input.User, name, m.invalidOption), nil
+}
+
+// move sets the current node of the user and returns its response, preceded
+// by the given notice if it is not empty. The user goes back to the root once
+// it reached a node without option.
+func (m *Menu) move(user string, name string, notice string) *provider.Response {
+	n := m.nodes[name]
+	if len(n.Options) == 0 {
+		m.current[user] = m.root
+	} else {
+		m.current[user] = name
+	}
+
+	outputs := []*provider.Output{}
+	if len(notice) > 0 {
+		outputs = append(outputs, &provider.Output{
+			ResponseType: "text",
+			Text:         notice,
+		})
+	}
+
+	labels := []string{}
+	for _, o := range n.Options {
+		labels = append(labels, o.Label)
+	}
+
+	outputs = append(outputs, &provider.Output{
+		ResponseType: optionType,
+		Text:         n.Text,
+		Options:      labels,
+	})
+
+	return &provider.Response{
+		StatusCode: http.StatusOK,
+		Outputs:    outputs,
+		Intents:    []*provider.Intent{{Intent: name, Confidence: 1}},
+	}
+}
+
+// ResetSession moves the user back to the root node on its next message.
+func (m *Menu) ResetSession(user string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.current, user)
+	return nil
+}
+
+// GetLabel returns the provider label.
+func (m *Menu) GetLabel() string {
+	return label
+}
+
+// Stop does nothing since the menu holds no resource.
+func (m *Menu) Stop() error {
+	return nil
+}
@@ -0,0 +1,134 @@
+package menu
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fberrez/samantha/backend/provider"
+)
+
+// sampleMenu is the path of the sample menu file.
+var sampleMenu = filepath.Join("..", "..", "menu.blank.yaml")
+
+// newTestMenu initializes a menu provider with the sample menu file.
+func newTestMenu(t *testing.T) provider.Provider {
+	t.Helper()
+
+	m, err := (&Menu{}).Initialize(&provider.Config{MenuFile: sampleMenu})
+	if err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	return m
+}
+
+// send sends the text of alice to the menu and returns the reached node and
+// the texts of the response.
+func send(t *testing.T, m provider.Provider, text string) (string, []string) {
+	t.Helper()
+
+	response, err := m.Message(context.Background(), &provider.Input{User: "alice", Text: text})
+	if err != nil {
+		t.Fatalf("Message(%q) error = %v", text, err)
+	}
+
+	texts := []string{}
+	for _, output := range response.Outputs {
+		texts = append(texts, output.Text)
+	}
+
+	return response.Intents[0].Intent, texts
+}
+
+func TestNavigation(t *testing.T) {
+	m := newTestMenu(t)
+
+	steps := []struct {
+		text string
+		node string
+	}{
+		{"hello", "main"},
+		{"1", "hours"},
+		{"back", "main"},
+		{"Contact", "contact"},
+		{"thanks", "main"},
+		{"opening hours", "hours"},
+		{"/start", "main"},
+	}
+
+	for _, step := range steps {
+		if node, _ := send(t, m, step.text); node != step.node {
+			t.Fatalf("%q reached node %s, want %s", step.text, node, step.node)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	m := newTestMenu(t)
+
+	response, err := m.Message(context.Background(), &provider.Input{User: "alice", Text: "hello"})
+	if err != nil {
+		t.Fatalf("Message() error = %v", err)
+	}
+
+	if len(response.Outputs) != 1 || response.Outputs[0].ResponseType != optionType {
+		t.Fatalf("outputs = %+v, want the options of the root", response.Outputs)
+	}
+
+	if want := []string{"Opening hours", "Contact"}; !reflect.DeepEqual(response.Outputs[0].Options, want) {
+		t.Errorf("options = %v, want %v", response.Outputs[0].Options, want)
+	}
+}
+
+func TestInvalidOption(t *testing.T) {
+	m := newTestMenu(t)
+	send(t, m, "hello")
+	send(t, m, "1")
+
+	node, texts := send(t, m, "3")
+	if node != "hours" || len(texts) != 2 || texts[0] != defaultInvalidOption {
+		t.Errorf("node %s with texts %q, want the notice and the same node", node, texts)
+	}
+}
+
+func TestMenuResetSession(t *testing.T) {
+	m := newTestMenu(t)
+	send(t, m, "hello")
+	send(t, m, "1")
+
+	if err := m.ResetSession("alice"); err != nil {
+		t.Fatalf("ResetSession() error = %v", err)
+	}
+
+	if node, _ := send(t, m, "back"); node != "main" {
+		t.Errorf("node = %s, want the root after a reset", node)
+	}
+}
+
+func TestInitializeInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		menu string
+	}{
+		{"missing root", "root: main\nnodes:\n  other:\n    text: hi\n"},
+		{"unknown next node", "root: main\nnodes:\n  main:\n    text: hi\n    options:\n      - label: Go\n        next: nowhere\n"},
+		{"option without label", "root: main\nnodes:\n  main:\n    text: hi\n    options:\n      - next: main\n"},
+		{"invalid YAML", "nodes: [\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "menu.yaml")
+			if err := ioutil.WriteFile(path, []byte(tt.menu), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := (&Menu{}).Initialize(&provider.Config{MenuFile: path}); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,322 @@
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// OpenAI is a client which communicates with an OpenAI-compatible chat
+	// completions API.
+	OpenAI struct {
+		// client is the http client calling the API.
+		client *http.Client
+
+		// url is the API URL.
+		url string
+
+		// token is the API key.
+		token string
+
+		// model is the model generating the responses.
+		model string
+
+		// systemPrompt is the system message sent first in each request.
+		systemPrompt string
+	}
+
+	// chatMessage is a message of a conversation.
+	chatMessage struct {
+		// Role is the author role (system, user or assistant).
+		Role string `json:"role"`
+
+		// Content is the message content.
+		Content string `json:"content"`
+	}
+
+	// chatRequest is the body of a chat completion request.
+	chatRequest struct {
+		// Model is the model generating the response.
+		Model string `json:"model"`
+
+		// Messages is a slice containing the conversation messages.
+		Messages []*chatMessage `json:"messages"`
+
+		// Stream enables the streaming of the response as server-sent events.
+		Stream bool `json:"stream,omitempty"`
+	}
+
+	// chatResponse is the body of a chat completion response.
+	chatResponse struct {
+		// Choices is a slice containing the generated responses.
+		Choices []*choice `json:"choices"`
+
+		// Error is the error returned by the API.
+		Error *apiError `json:"error"`
+	}
+
+	// choice is a generated response.
+	choice struct {
+		// Message is the generated message.
+		Message *chatMessage `json:"message"`
+
+		// Delta is the generated chunk of a streamed response.
+		Delta *chatMessage `json:"delta"`
+	}
+
+	// apiError is an error returned by the API.
+	apiError struct {
+		// Message is the error message.
+		Message string `json:"message"`
+	}
+)
+
+const (
+	label = "openai"
+
+	// defaultURL is the default API URL.
+	defaultURL = "https://api.openai.com/v1"
+
+	// defaultModel is the default model.
+	defaultModel = "gpt-4o-mini"
+
+	// requestTimeout is the timeout of the API requests.
+	requestTimeout = 60 * time.Second
+
+	// streamDataPrefix is the prefix of the server-sent events data lines.
+	streamDataPrefix = "data: "
+
+	// streamDone is the data of the last server-sent event.
+	streamDone = "[DONE]"
+)
+
+var (
+	// logger is a global logger of the package
+	logger = log.WithField("provider", label)
+)
+
+// Initialize initializes a new OpenAI client.
+func (o *OpenAI) Initialize(config *provider.Config) (provider.Provider, error) {
+	if len(config.Token) == 0 {
+		return nil, errors.NotValidf("empty API key")
+	}
+
+	url := strings.TrimSuffix(config.URL, "/")
+	if len(url) == 0 {
+		url = defaultURL
+	}
+
+	model := config.Model
+	if len(model) == 0 {
+		model = defaultModel
+	}
+
+	return &OpenAI{
+		client:       &http.Client{Timeout: requestTimeout},
+		url:          url,
+		token:        config.Token,
+		model:        model,
+		systemPrompt: config.SystemPrompt,
+	}, nil
+}
+
+// Message sends the user message, preceded by the system prompt and the input
+// history, and returns the generated response. Each paragraph of the response
+// is an output.
+func (o *OpenAI) Message(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+	statusCode, answer, err := o.complete(ctx, o.prompt(input))
+	if err != nil {
+		return nil, provider.NewError(errorCode(statusCode, err), errors.Annotate(err, "sending a message to OpenAI"))
+	}
+
+	outputs := []*provider.Output{}
+	for _, paragraph := range strings.Split(answer, "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); len(paragraph) == 0 {
+			continue
+		}
+
+		outputs = append(outputs, &provider.Output{
+			ResponseType: "text",
+			Text:         paragraph,
+		})
+	}
+
+	return &provider.Response{
+		StatusCode: statusCode,
+		Outputs:    outputs,
+		Intents:    []*provider.Intent{},
+	}, nil
+}
+
+// MessageStream sends the user message like Message and streams the
+// generated response.
+func (o *OpenAI) MessageStream(ctx context.Context, input *provider.Input) (<-chan string, error) {
+	request, err := o.newRequest(&chatRequest{Model: o.model, Messages: o.prompt(input), Stream: true})
+	if err != nil {
+		return nil, errors.Annotate(err, "streaming a message to OpenAI")
+	}
+
+	// A streamed response may last longer than the client timeout.
+	response, err := (&http.Client{}).Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, provider.NewError(errorCode(0, err), errors.Annotate(err, "streaming a message to OpenAI"))
+	}
+
+	if response.StatusCode >= 300 {
+		defer response.Body.Close()
+		err := errors.Errorf("chat completions responded with status %d", response.StatusCode)
+		return nil, provider.NewError(errorCode(response.StatusCode, err), err)
+	}
+
+	chunks := make(chan string)
+	go func() {
+		defer close(chunks)
+		defer response.Body.Close()
+
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, streamDataPrefix) {
+				continue
+			}
+
+			data := strings.TrimPrefix(line, streamDataPrefix)
+			if data == streamDone {
+				break
+			}
+
+			completion := chatResponse{}
+			if err := json.Unmarshal([]byte(data), &completion); err != nil {
+				logger.WithError(err).Warn("Cannot unmarshal streamed chunk")
+				continue
+			}
+
+			if len(completion.Choices) == 0 || completion.Choices[0].Delta == nil {
+				continue
+			}
+
+			chunk := completion.Choices[0].Delta.Content
+
+			select {
+			case chunks <- chunk:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			logger.WithError(err).Error("Streamed response interrupted")
+		}
+	}()
+
+	return chunks, nil
+}
+
+// ResetSession does nothing since the history of the conversations is kept by
+// the backend.
+func (o *OpenAI) ResetSession(user string) error {
+	return nil
+}
+
+// GetLabel returns the provider label.
+func (o *OpenAI) GetLabel() string {
+	return label
+}
+
+// Stop does nothing since the client holds no resource.
+func (o *OpenAI) Stop() error {
+	return nil
+}
+
+// prompt returns the system prompt followed by the history and the text of
+// the input.
+func (o *OpenAI) prompt(input *provider.Input) []*chatMessage {
+	messages := []*chatMessage{}
+	if len(o.systemPrompt) > 0 {
+		messages = append(messages, &chatMessage{Role: "system", Content: o.systemPrompt})
+	}
+
+	for _, turn := range input.History {
+		messages = append(messages, &chatMessage{Role: turn.Role, Content: turn.Text})
+	}
+
+	return append(messages, &chatMessage{Role: provider.RoleUser, Content: input.Text})
+}
+
+// complete calls the chat completions endpoint and returns the status code
+// and the generated text.
+func (o *OpenAI) complete(ctx context.Context, messages []*chatMessage) (int, string, error) {
+	request, err := o.newRequest(&chatRequest{Model: o.model, Messages: messages})
+	if err != nil {
+		return 0, "", err
+	}
+
+	response, err := o.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return 0, "", errors.Annotate(err, "calling chat completions")
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return response.StatusCode, "", errors.Annotate(err, "reading response")
+	}
+
+	completion := chatResponse{}
+	if err := json.Unmarshal(body, &completion); err != nil {
+		return response.StatusCode, "", errors.Annotate(err, "unmarshaling response")
+	}
+
+	if completion.Error != nil {
+		return response.StatusCode, "", errors.Errorf("chat completions: %s", completion.Error.Message)
+	}
+
+	if len(completion.Choices) == 0 || completion.Choices[0].Message == nil {
+		return response.StatusCode, "", errors.NotFoundf("choice in response")
+	}
+
+	return response.StatusCode, completion.Choices[0].Message.Content, nil
+}
+
+// errorCode returns the code of a failed call to the API from the status of
+// its response, or from the error when there is no response.
+func errorCode(statusCode int, err error) string {
+	if code := provider.StatusErrorCode(statusCode); len(code) > 0 {
+		return code
+	}
+
+	if netErr, ok := errors.Cause(err).(net.Error); ok && netErr.Timeout() {
+		return provider.ErrorTimeout
+	}
+
+	return provider.ErrorUpstream
+}
+
+// newRequest creates a chat completions request.
+func (o *OpenAI) newRequest(body *chatRequest) (*http.Request, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, errors.Annotate(err, "marshaling request")
+	}
+
+	request, err := http.NewRequest(http.MethodPost, o.url+"/chat/completions", bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Annotate(err, "creating request")
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+o.token)
+
+	return request, nil
+}
@@ -0,0 +1,244 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/juju/errors"
+)
+
+type (
+	// fakeServer is a chat completions API recording the requests.
+	fakeServer struct {
+		// mutex protects the recorded requests.
+		mutex sync.Mutex
+
+		// requests is a slice containing the bodies of the requests.
+		requests []*chatRequest
+
+		// status is the status of the responses.
+		status int
+
+		// body is the body of the responses.
+		body string
+	}
+
+	// timeoutError is a network error which timed out.
+	timeoutError struct{}
+)
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/chat/completions" || r.Header.Get("Authorization") != "Bearer secret" {
+		http.Error(w, `{"error":{"message":"unexpected request"}}`, http.StatusBadRequest)
+		return
+	}
+
+	request := &chatRequest{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		http.Error(w, `{"error":{"message":"invalid body"}}`, http.StatusBadRequest)
+		return
+	}
+
+	s.mutex.Lock()
+	s.requests = append(s.requests, request)
+	s.mutex.Unlock()
+
+	w.WriteHeader(s.status)
+	w.Write([]byte(s.body))
+}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// newTestOpenAI returns a client of a fake server answering with the given
+// status and body.
+func newTestOpenAI(t *testing.T, status int, body string) (*OpenAI, *fakeServer) {
+	t.Helper()
+
+	s := &fakeServer{status: status, body: body}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+
+	p, err := (&OpenAI{}).Initialize(&provider.Config{URL: server.URL + "/", Token: "secret", SystemPrompt: "You are Samantha"})
+	if err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	return p.(*OpenAI), s
+}
+
+// completion returns a chat completion response with the given content.
+func completion(content string) string {
+	data, _ := json.Marshal(&chatResponse{Choices: []*choice{{Message: &chatMessage{Role: "assistant", Content: content}}}})
+	return string(data)
+}
+
+// streamed returns the server-sent events of a response streamed in the given
+// chunks.
+func streamed(chunks ...string) string {
+	events := ""
+	for _, chunk := range chunks {
+		data, _ := json.Marshal(&chatResponse{Choices: []*choice{{Delta: &chatMessage{Content: chunk}}}})
+		events += streamDataPrefix + string(data) + "\n\n"
+	}
+
+	return events
+}
+
+func TestMessage(t *testing.T) {
+	o, s := newTestOpenAI(t, http.StatusOK, completion("Hello alice.\n\nHow are you?"))
+
+	response, err := o.Message(context.Background(), &provider.Input{
+		User: "alice",
+		Text: "What is my name?",
+		History: []*provider.Turn{
+			{Role: provider.RoleUser, Text: "My name is alice"},
+			{Role: provider.RoleAssistant, Text: "Nice to meet you"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Message() error = %v", err)
+	}
+
+	// The system prompt comes first, then the history in order.
+	want := []*chatMessage{
+		{Role: "system", Content: "You are Samantha"},
+		{Role: provider.RoleUser, Content: "My name is alice"},
+		{Role: provider.RoleAssistant, Content: "Nice to meet you"},
+		{Role: provider.RoleUser, Content: "What is my name?"},
+	}
+	if len(s.requests) != 1 || !reflect.DeepEqual(s.requests[0].Messages, want) {
+		t.Fatalf("requests = %+v, want the messages %+v", s.requests, want)
+	}
+
+	if s.requests[0].Model != defaultModel || s.requests[0].Stream {
+		t.Errorf("request = %+v, want the default model without streaming", s.requests[0])
+	}
+
+	texts := []string{}
+	for _, output := range response.Outputs {
+		texts = append(texts, output.Text)
+	}
+
+	if want := []string{"Hello alice.", "How are you?"}; !reflect.DeepEqual(texts, want) {
+		t.Errorf("outputs = %v, want a paragraph per output %v", texts, want)
+	}
+}
+
+func TestMessageError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		code   string
+	}{
+		{"unauthorized", http.StatusUnauthorized, `{"error":{"message":"invalid key"}}`, provider.ErrorAuth},
+		{"rate limited", http.StatusTooManyRequests, `{"error":{"message":"slow down"}}`, provider.ErrorRateLimit},
+		{"gateway timeout", http.StatusGatewayTimeout, `{"error":{"message":"timeout"}}`, provider.ErrorTimeout},
+		{"internal error", http.StatusInternalServerError, `{"error":{"message":"oops"}}`, provider.ErrorUpstream},
+		{"no choice", http.StatusOK, `{"choices":[]}`, provider.ErrorUpstream},
+		{"malformed", http.StatusOK, `{`, provider.ErrorUpstream},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, _ := newTestOpenAI(t, tt.status, tt.body)
+
+			_, err := o.Message(context.Background(), &provider.Input{User: "alice", Text: "hello"})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if code := provider.ErrorCode(err); code != tt.code {
+				t.Errorf("error code = %q, want %q", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		code   string
+	}{
+		{"forbidden", http.StatusForbidden, nil, provider.ErrorAuth},
+		{"request timeout", http.StatusRequestTimeout, nil, provider.ErrorTimeout},
+		{"bad gateway", http.StatusBadGateway, nil, provider.ErrorUpstream},
+		{"bad request", http.StatusBadRequest, errors.New("invalid"), provider.ErrorUpstream},
+		{"network timeout", 0, errors.Annotate(timeoutError{}, "calling chat completions"), provider.ErrorTimeout},
+		{"connection refused", 0, errors.New("connection refused"), provider.ErrorUpstream},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := errorCode(tt.status, tt.err); code != tt.code {
+				t.Errorf("errorCode(%d, %v) = %q, want %q", tt.status, tt.err, code, tt.code)
+			}
+		})
+	}
+}
+
+func TestMessageStream(t *testing.T) {
+	body := ": keep-alive\n\n" + streamed("Hello ", "alice") + streamDataPrefix + "{\n\n" + streamed("!") +
+		streamDataPrefix + streamDone + "\n\n" + streamed("after the end")
+	o, s := newTestOpenAI(t, http.StatusOK, body)
+
+	chunks, err := o.MessageStream(context.Background(), &provider.Input{User: "alice", Text: "hello"})
+	if err != nil {
+		t.Fatalf("MessageStream() error = %v", err)
+	}
+
+	// The comments and the malformed events are skipped, and the stream ends
+	// at the done event.
+	received := []string{}
+	timeout := time.After(5 * time.Second)
+	for done := false; !done; {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				done = true
+				break
+			}
+			received = append(received, chunk)
+		case <-timeout:
+			t.Fatalf("stream not closed, received %q", received)
+		}
+	}
+
+	if want := []string{"Hello ", "alice", "!"}; !reflect.DeepEqual(received, want) {
+		t.Errorf("chunks = %q, want %q", received, want)
+	}
+
+	if len(s.requests) != 1 || !s.requests[0].Stream {
+		t.Errorf("requests = %+v, want a streamed request", s.requests)
+	}
+}
+
+func TestMessageStreamError(t *testing.T) {
+	o, _ := newTestOpenAI(t, http.StatusTooManyRequests, `{"error":{"message":"slow down"}}`)
+
+	_, err := o.MessageStream(context.Background(), &provider.Input{User: "alice", Text: "hello"})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if code := provider.ErrorCode(err); code != provider.ErrorRateLimit {
+		t.Errorf("error code = %q, want %q", code, provider.ErrorRateLimit)
+	}
+
+	if !strings.Contains(err.Error(), fmt.Sprint(http.StatusTooManyRequests)) {
+		t.Errorf("error = %v, want the status", err)
+	}
+}
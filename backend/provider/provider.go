@@ -1,8 +1,11 @@
 package provider
 
 import (
+	"context"
 	"fmt"
+	"time"
 
+	"github.com/fberrez/samantha/capsule"
 	"github.com/google/uuid"
 )
 
@@ -13,9 +16,13 @@ type (
 		// of authorized users and user inputs write-only channel.
 		Initialize(config *Config) (Provider, error)
 
-		// Message sends a text message to the API provider and returns a structured
-		// result.
-		Message(text string) (*Response, error)
+		// Message sends a text message of the user of the input to the API
+		// provider and returns a structured result. Each user has its own
+		// conversation. The call is aborted when the context is canceled.
+		Message(ctx context.Context, input *Input) (*Response, error)
+
+		// ResetSession resets the conversation of the given user.
+		ResetSession(user string) error
 
 		// GetLabel returns the label of the provider
 		GetLabel() string
@@ -24,6 +31,87 @@ type (
 		Stop() error
 	}
 
+	// Streamer is implemented by the providers able to stream their response,
+	// such as LLM providers. The providers which do not stream are called with
+	// Message.
+	Streamer interface {
+		// MessageStream sends a text message of the user of the input to the
+		// API provider and returns a channel receiving the response chunks as
+		// they are generated. The channel is closed at the end of the response.
+		MessageStream(ctx context.Context, input *Input) (<-chan string, error)
+	}
+
+	// AttachmentReceiver is implemented by the providers able to process the
+	// files sent by users. The messages with attachments are not sent to the
+	// other providers.
+	AttachmentReceiver interface {
+		// MessageAttachments sends a text message of the user of the input and
+		// the input attachments to the API provider and returns a structured
+		// result.
+		MessageAttachments(ctx context.Context, input *Input) (*Response, error)
+	}
+
+	// Input is a message sent to a provider.
+	Input struct {
+		// User is the user sending the message.
+		User string
+
+		// Text is the text of the message.
+		Text string
+
+		// History is a slice containing the previous turns of the conversation
+		// of the user, from the oldest to the newest. The providers keeping the
+		// context of the conversation on their side can ignore it.
+		History []*Turn
+
+		// Attachments is a slice containing the files sent with the message.
+		Attachments []*Attachment
+	}
+
+	// Attachment is a file sent by a user.
+	Attachment struct {
+		// Name is the file name.
+		Name string `json:"name" yaml:"name"`
+
+		// MIME is the MIME type of the file.
+		MIME string `json:"mime" yaml:"mime"`
+
+		// Data is the file content.
+		Data []byte `json:"data" yaml:"data"`
+	}
+
+	// SessionExporter is implemented by the providers able to back up and
+	// restore the conversations of their users.
+	SessionExporter interface {
+		// ExportSessions serializes the sessions of all the users.
+		ExportSessions() ([]byte, error)
+
+		// ImportSessions restores the sessions serialized by ExportSessions.
+		ImportSessions(data []byte) error
+	}
+
+	// ConversationLister is implemented by the providers keeping the state of
+	// the conversation of each user.
+	ConversationLister interface {
+		// Conversations returns the active conversations.
+		Conversations() []*Conversation
+	}
+
+	// Conversation is the state of the conversation of a user.
+	Conversation struct {
+		// User is the user of the conversation, as given to Message.
+		User string
+
+		// SessionID is the ID of the session of the conversation.
+		SessionID string
+
+		// LastActivity is the time of the last message of the conversation.
+		LastActivity time.Time
+
+		// Turns is the number of messages of the conversation.
+		Turns int
+	}
+
 	// Config is a structured provider configuration.
 	Config struct {
 		// userID is the unique identifier of the current session.
@@ -43,6 +131,48 @@ type (
 
 		// AssistantID is the provider Assistant ID.
 		AssistantID string `json:"assistantID" yaml:"assistantID"`
+
+		// WorkspaceID is the workspace ID of the Watson Assistant v1 provider.
+		WorkspaceID string `json:"workspaceID" yaml:"workspaceID"`
+
+		// BotID is the bot ID of the Botpress provider.
+		BotID string `json:"botID" yaml:"botID"`
+
+		// Model is the model used by LLM providers.
+		Model string `json:"model" yaml:"model"`
+
+		// SystemPrompt is the system message defining the persona and the rules
+		// of LLM providers.
+		SystemPrompt string `json:"systemPrompt" yaml:"systemPrompt"`
+
+		// HistoryTurns is the number of previous exchanges of the user (a
+		// message and its answer) sent to the provider with each message. No
+		// history is kept when it is zero.
+		HistoryTurns int `json:"historyTurns" yaml:"historyTurns"`
+
+		// PatternsFile is the path of the patterns file of the keyword
+		// provider.
+		PatternsFile string `json:"patternsFile" yaml:"patternsFile"`
+
+		// MenuFile is the path of the menu file of the menu provider.
+		MenuFile string `json:"menuFile" yaml:"menuFile"`
+
+		// MaxTurns is the number of messages after which the conversation of a
+		// user is reset. Conversations are never reset when it is zero.
+		MaxTurns int `json:"maxTurns" yaml:"maxTurns"`
+
+		// SortIntents sorts the response intents by descending confidence and
+		// removes their duplicates. They are kept in the API order otherwise.
+		SortIntents bool `json:"sortIntents" yaml:"sortIntents"`
+
+		// MaxIntents is the maximum number of response intents. All the
+		// intents are kept when it is zero.
+		MaxIntents int `json:"maxIntents" yaml:"maxIntents"`
+
+		// KeepAliveInterval is the interval at which the idle sessions are
+		// pinged so they do not expire. Sessions are not kept alive when it is
+		// zero.
+		KeepAliveInterval time.Duration `json:"keepAliveInterval" yaml:"keepAliveInterval"`
 	}
 
 	// Response is a structured format of a response returned by a provider.
@@ -50,20 +180,51 @@ type (
 		// StatusCode is the HTTP status code of the response
 		StatusCode int `json:"statusCode" yaml:"statusCode"`
 
+		// ErrorCode is the code of the failure when the response is a fallback
+		// sent instead of the provider answer (ex: ErrorUpstream). It is empty
+		// otherwise.
+		ErrorCode string `json:"errorCode,omitempty" yaml:"errorCode,omitempty"`
+
 		// Outputs is a slice containing all outputs (responses content).
 		Outputs []*Output `json:"output" yaml:"output"`
 
 		// Intents is a slice containing all intents.
 		Intents []*Intent `json:"intents" yaml:"intents"`
+
+		// Entities is a slice containing the entities recognized in the user
+		// message.
+		Entities []*Entity `json:"entities,omitempty" yaml:"entities,omitempty"`
+
+		// Suggestions is a slice containing the labels of the disambiguation
+		// suggestions the user can pick from.
+		Suggestions []string `json:"suggestions" yaml:"suggestions"`
+
+		// SessionReset is true when the conversation of the user has been reset
+		// before processing the message.
+		SessionReset bool `json:"sessionReset" yaml:"sessionReset"`
 	}
 
-	// Output represents a response output.
+	// Output represents a response output. The fields filled depend on the
+	// response type.
 	Output struct {
-		// ResponseType is the type of the response.
+		// ResponseType is the type of the response (ex: text, option, pause).
 		ResponseType string `json:"responseType"`
 
-		// Text is the text of the response.
+		// Text is the text of the response. It is the title of an option.
 		Text string `json:"text"`
+
+		// Options is a slice containing the labels of the choices of an option.
+		Options []string `json:"options"`
+
+		// Pause is the duration of a pause.
+		Pause time.Duration `json:"pause"`
+
+		// Typing is true when a typing indicator must be displayed during a
+		// pause.
+		Typing bool `json:"typing"`
+
+		// Card is the rich card of a card response.
+		Card *capsule.Card `json:"card,omitempty"`
 	}
 
 	// Intent represents a response intent.
@@ -75,6 +236,19 @@ type (
 		Confidence float32 `json:"confidence"`
 	}
 
+	// Entity represents an entity recognized in the user message
+	// (ex: @city:Paris).
+	Entity struct {
+		// Entity is the name of the entity.
+		Entity string `json:"entity"`
+
+		// Value is the value of the entity.
+		Value string `json:"value"`
+
+		// Confidence is the confidence of the entity.
+		Confidence float32 `json:"confidence"`
+	}
+
 	// ContentType is used to classify a user input which can has a specific type
 	// such as text, image...
 	ContentType string
@@ -96,12 +270,12 @@ const (
 
 // String returns a string-formatted response.
 func (r *Response) String() string {
-	return fmt.Sprintf("StatusCode: %d Outputs: %v Intents: %v", r.StatusCode, r.Outputs, r.Intents)
+	return fmt.Sprintf("StatusCode: %d Outputs: %v Intents: %v Entities: %v Suggestions: %v", r.StatusCode, r.Outputs, r.Intents, r.Entities, r.Suggestions)
 }
 
 // String returns a string-formatted output.
 func (o *Output) String() string {
-	return fmt.Sprintf("ResponseType: %s Text: %s", o.ResponseType, o.Text)
+	return fmt.Sprintf("ResponseType: %s Text: %s Options: %v Pause: %s", o.ResponseType, o.Text, o.Options, o.Pause)
 }
 
 // String returns a string-formatted intent.
@@ -0,0 +1,91 @@
+package watson
+
+import (
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+)
+
+type (
+	// exportedSession is the serialized session of a user.
+	exportedSession struct {
+		// ID is the ID of the Watson session.
+		ID string `json:"id"`
+
+		// UserID is the user identifier sent with the messages of the session.
+		UserID uuid.UUID `json:"userID"`
+
+		// Turns is the number of messages sent in the session.
+		Turns int `json:"turns"`
+
+		// Suggestions indexes the values of the last disambiguation suggestions
+		// by label.
+		Suggestions map[string]string `json:"suggestions"`
+	}
+)
+
+// ExportSessions serializes the sessions of all the users. The context
+// variables are held by Watson in the session, so the session ID is enough to
+// restore them.
+func (w *Watson) ExportSessions() ([]byte, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	sessions := map[string]*exportedSession{}
+	for user, s := range w.sessions {
+		if s.id == nil {
+			continue
+		}
+
+		sessions[user] = &exportedSession{
+			ID:          *s.id,
+			UserID:      s.userID,
+			Turns:       s.turns,
+			Suggestions: s.suggestions,
+		}
+	}
+
+	data, err := json.Marshal(sessions)
+	if err != nil {
+		return nil, errors.Annotate(err, "marshaling sessions")
+	}
+
+	return data, nil
+}
+
+// ImportSessions restores the sessions serialized by ExportSessions. Watson
+// sessions expire after a period of inactivity, so the imported sessions are
+// validated lazily: an imported session rejected by Watson is recreated on
+// its next message.
+func (w *Watson) ImportSessions(data []byte) error {
+	sessions := map[string]*exportedSession{}
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return errors.Annotate(err, "unmarshaling sessions")
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for user, exported := range sessions {
+		if exported == nil || len(exported.ID) == 0 {
+			return errors.NotValidf("session of user %s", user)
+		}
+
+		id := exported.ID
+		suggestions := exported.Suggestions
+		if suggestions == nil {
+			suggestions = map[string]string{}
+		}
+
+		w.sessions[user] = &session{
+			id:          &id,
+			userID:      exported.UserID,
+			turns:       exported.Turns,
+			suggestions: suggestions,
+			imported:    true,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package watson
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestSessionsRoundTrip(t *testing.T) {
+	id := "session-1"
+	w := &Watson{sessions: map[string]*session{
+		"alice": {id: &id, userID: uuid.New(), turns: 3, suggestions: map[string]string{"Paris": "weather in Paris"}},
+		"bob":   {userID: uuid.New()},
+	}}
+
+	data, err := w.ExportSessions()
+	if err != nil {
+		t.Fatalf("ExportSessions() error = %v", err)
+	}
+
+	restored := &Watson{sessions: map[string]*session{}}
+	if err := restored.ImportSessions(data); err != nil {
+		t.Fatalf("ImportSessions() error = %v", err)
+	}
+
+	if _, ok := restored.sessions["bob"]; ok {
+		t.Error("a user without session was exported")
+	}
+
+	want, got := w.sessions["alice"], restored.sessions["alice"]
+	if got == nil {
+		t.Fatal("the session of alice was not imported")
+	}
+
+	if *got.id != *want.id || got.userID != want.userID || got.turns != want.turns {
+		t.Errorf("session = %+v, want %+v", got, want)
+	}
+
+	if !reflect.DeepEqual(got.suggestions, want.suggestions) {
+		t.Errorf("suggestions = %v, want %v", got.suggestions, want.suggestions)
+	}
+
+	if !got.imported {
+		t.Error("the imported session must be validated by its next message")
+	}
+}
+
+func TestImportSessionsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"not JSON", `{"alice":`},
+		{"nil session", `{"alice":null}`},
+		{"no session ID", `{"alice":{"turns":1}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Watson{sessions: map[string]*session{}}
+			if err := w.ImportSessions([]byte(tt.data)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package watson
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/watson-developer-cloud/go-sdk/core"
+)
+
+type (
+	// RateLimit throttles the calls to the API from the rate-limit headers of
+	// its responses, so the quota is not exhausted by a storm of rejected
+	// calls. The calls are paused until the reset of the quota when few calls
+	// remain, or for the Retry-After delay of a rejected call. The SDK gives
+	// the headers of every response, including the failed ones, but the API
+	// only sends them for the plans having a rate limit: without them, a
+	// rejected call (429) pauses the calls for a delay doubling on each
+	// rejection.
+	RateLimit struct {
+		// label is the label of the provider, under which the remaining quota
+		// is exported.
+		label string
+
+		// mutex protects the pause.
+		mutex sync.Mutex
+
+		// until is the time until which the calls are paused.
+		until time.Time
+
+		// backoff is the pause after the next rejected call without
+		// Retry-After header.
+		backoff time.Duration
+	}
+)
+
+const (
+	// remainingHeader is the header containing the number of calls remaining
+	// in the current rate-limit window.
+	remainingHeader = "X-RateLimit-Remaining"
+
+	// resetHeader is the header containing the time of the reset of the
+	// rate-limit window, as a Unix timestamp or as seconds from now.
+	resetHeader = "X-RateLimit-Reset"
+
+	// retryAfterHeader is the header containing the delay after which a
+	// rejected call can be retried, in seconds or as an HTTP date.
+	retryAfterHeader = "Retry-After"
+
+	// lowRemaining is the number of remaining calls from which the calls are
+	// paused. It leaves a margin for the concurrent calls.
+	lowRemaining = 2
+
+	// minBackoff is the first pause after a rejected call without
+	// Retry-After header.
+	minBackoff = time.Second
+
+	// maxPause is the maximum pause, so wrong headers cannot block the
+	// provider.
+	maxPause = time.Minute
+
+	// unixTimestamp is the value from which a reset header is a Unix
+	// timestamp rather than a number of seconds.
+	unixTimestamp = 1000000000
+)
+
+var (
+	// remainingMetrics exports the remaining calls of the rate limit by
+	// provider label, as backendRateLimitRemaining on /debug/vars.
+	remainingMetrics = expvar.NewMap("backendRateLimitRemaining")
+)
+
+// NewRateLimit initializes the rate limit of the provider with the given
+// label.
+func NewRateLimit(label string) *RateLimit {
+	return &RateLimit{label: label, backoff: minBackoff}
+}
+
+// Wait waits until the calls are no longer paused. It returns the error of
+// the context if it is canceled first.
+func (r *RateLimit) Wait(ctx context.Context) error {
+	r.mutex.Lock()
+	delay := time.Until(r.until)
+	r.mutex.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	logger.WithField("label", r.label).Debugf("Rate limit reached, pausing for %s", delay)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Update reads the rate-limit headers of the response and pauses the calls
+// when the quota is nearly exhausted or a call has been rejected.
+func (r *RateLimit) Update(response *core.DetailedResponse) {
+	if response == nil {
+		return
+	}
+
+	now := time.Now()
+	remaining, err := strconv.Atoi(response.Headers.Get(remainingHeader))
+	hasRemaining := err == nil
+	if hasRemaining {
+		metric := new(expvar.Int)
+		metric.Set(int64(remaining))
+		remainingMetrics.Set(r.label, metric)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if response.StatusCode == http.StatusTooManyRequests {
+		pause, ok := retryAfter(response.Headers.Get(retryAfterHeader), now)
+		if !ok {
+			pause = r.backoff
+			r.backoff *= 2
+			if r.backoff > maxPause {
+				r.backoff = maxPause
+			}
+		}
+
+		r.pause(now, pause)
+		return
+	}
+
+	r.backoff = minBackoff
+	if !hasRemaining || remaining > lowRemaining {
+		return
+	}
+
+	pause, ok := reset(response.Headers.Get(resetHeader), now)
+	if !ok {
+		if pause, ok = retryAfter(response.Headers.Get(retryAfterHeader), now); !ok {
+			pause = minBackoff
+		}
+	}
+
+	r.pause(now, pause)
+}
+
+// pause pauses the calls for the given duration, capped to maxPause. A longer
+// pause in progress is kept.
+func (r *RateLimit) pause(now time.Time, pause time.Duration) {
+	if pause > maxPause {
+		pause = maxPause
+	}
+
+	if until := now.Add(pause); until.After(r.until) {
+		r.until = until
+	}
+}
+
+// retryAfter parses a Retry-After header, given in seconds or as an HTTP
+// date, and returns the delay it defines.
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if len(value) == 0 {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	return date.Sub(now), true
+}
+
+// reset parses a reset header, given as a Unix timestamp or in seconds, and
+// returns the delay until the reset.
+func reset(value string, now time.Time) (time.Duration, bool) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	if seconds >= unixTimestamp {
+		return time.Unix(seconds, 0).Sub(now), true
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
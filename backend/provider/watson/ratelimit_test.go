@@ -0,0 +1,142 @@
+package watson
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/watson-developer-cloud/go-sdk/core"
+)
+
+// rateLimited returns a response with the given rate-limit headers.
+func rateLimited(status int, headers ...string) *core.DetailedResponse {
+	response := &core.DetailedResponse{StatusCode: status, Headers: http.Header{}}
+	for i := 0; i+1 < len(headers); i += 2 {
+		response.Headers.Set(headers[i], headers[i+1])
+	}
+
+	return response
+}
+
+// paused returns the pause of the calls from now.
+func (r *RateLimit) paused() time.Duration {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return time.Until(r.until)
+}
+
+func TestRateLimitLowRemaining(t *testing.T) {
+	r := NewRateLimit("test-low")
+	r.Update(rateLimited(http.StatusOK, remainingHeader, "1", resetHeader, "30"))
+
+	if pause := r.paused(); pause < 29*time.Second || pause > 30*time.Second {
+		t.Errorf("pause = %s, want until the reset", pause)
+	}
+
+	if remaining := remainingMetrics.Get("test-low"); remaining == nil || remaining.String() != "1" {
+		t.Errorf("remaining metric = %v, want 1", remaining)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := r.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Wait() error = %v, want the calls paused", err)
+	}
+}
+
+func TestRateLimitEnoughRemaining(t *testing.T) {
+	r := NewRateLimit("test-enough")
+	r.Update(rateLimited(http.StatusOK, remainingHeader, "50", resetHeader, "30"))
+	r.Update(rateLimited(http.StatusOK))
+	r.Update(nil)
+
+	if pause := r.paused(); pause > 0 {
+		t.Errorf("pause = %s, want none", pause)
+	}
+
+	if err := r.Wait(context.Background()); err != nil {
+		t.Errorf("Wait() error = %v", err)
+	}
+}
+
+func TestRateLimitRejected(t *testing.T) {
+	r := NewRateLimit("test-rejected")
+	r.Update(rateLimited(http.StatusTooManyRequests, retryAfterHeader, "5"))
+	if pause := r.paused(); pause < 4*time.Second || pause > 5*time.Second {
+		t.Errorf("pause = %s, want the Retry-After delay", pause)
+	}
+
+	// Without Retry-After header, the backoff doubles on each rejection and
+	// is capped.
+	r = NewRateLimit("test-backoff")
+	for i := 0; i < 10; i++ {
+		r.Update(rateLimited(http.StatusTooManyRequests))
+	}
+
+	if pause := r.paused(); pause < maxPause-time.Second || pause > maxPause {
+		t.Errorf("pause = %s, want the maximum pause", pause)
+	}
+
+	// A successful call resets the backoff.
+	r.Update(rateLimited(http.StatusOK))
+	if r.backoff != minBackoff {
+		t.Errorf("backoff = %s, want %s", r.backoff, minBackoff)
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	now := time.Date(2020, 3, 1, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		parse func(string, time.Time) (time.Duration, bool)
+		value string
+		pause time.Duration
+		ok    bool
+	}{
+		{"retry after seconds", retryAfter, "12", 12 * time.Second, true},
+		{"retry after date", retryAfter, "Sun, 01 Mar 2020 09:01:00 GMT", time.Minute, true},
+		{"retry after invalid", retryAfter, "soon", 0, false},
+		{"retry after missing", retryAfter, "", 0, false},
+		{"reset seconds", reset, "30", 30 * time.Second, true},
+		{"reset timestamp", reset, "1583053320", 2 * time.Minute, true},
+		{"reset invalid", reset, "soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pause, ok := tt.parse(tt.value, now)
+			if pause != tt.pause || ok != tt.ok {
+				t.Errorf("parse(%q) = %s, %t, want %s, %t", tt.value, pause, ok, tt.pause, tt.ok)
+			}
+		})
+	}
+}
+
+func TestMessageThrottled(t *testing.T) {
+	service := &fakeAssistant{
+		response:   rateLimited(http.StatusBadRequest, remainingHeader, "0", resetHeader, "30"),
+		messageErr: errors.New("call failed"),
+	}
+	w := newTestWatson(service, "alice")
+
+	if _, err := w.Message(context.Background(), &provider.Input{User: "alice", Text: "hello"}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// The next call waits for the reset of the quota instead of being sent.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := w.Message(ctx, &provider.Input{User: "alice", Text: "hello again"}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	if len(service.messages) != 1 {
+		t.Errorf("messages sent = %q, want the calls paused after the first one", service.messages)
+	}
+}
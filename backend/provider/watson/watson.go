@@ -1,12 +1,18 @@
 package watson
 
 import (
+	"context"
 	"encoding/json"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/fberrez/samantha/backend/provider"
+	"github.com/fberrez/samantha/capsule"
 	"github.com/google/uuid"
 	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
 	"github.com/watson-developer-cloud/go-sdk/assistantv2"
 	"github.com/watson-developer-cloud/go-sdk/core"
 )
@@ -15,17 +21,91 @@ type (
 	// Watson is client which communicates with the IBM Watson Assistant API
 	Watson struct {
 		// service is a http client which will communicates with the API
-		service *assistantv2.AssistantV2
+		service assistant
 
-		// userID is the unique identifier of the current session.
+		// userID is the unique identifier of the client. When it is not
+		// configured, each session gets its own generated identifier.
 		userID uuid.UUID
 
+		// IDGenerator generates the user identifiers of the sessions.
+		IDGenerator capsule.IDGenerator
+
 		// assistantID is the ID of the Watson Assistant.
 		// I can be found on the IBM Cloud (bluemix)
 		assistantID string
 
-		// SessionID is the ID of the connection session.
-		sessionID *string
+		// maxTurns is the number of messages after which a session is
+		// recreated. Sessions are never recreated when it is zero.
+		maxTurns int
+
+		// sortIntents sorts the response intents by descending confidence and
+		// removes their duplicates. They are kept in the API order otherwise.
+		sortIntents bool
+
+		// maxIntents is the maximum number of response intents. All the
+		// intents are kept when it is zero.
+		maxIntents int
+
+		// rateLimit throttles the calls from the rate-limit headers of the
+		// responses.
+		rateLimit *RateLimit
+
+		// mutex protects the sessions map.
+		mutex sync.Mutex
+
+		// sessions indexes the sessions by user.
+		sessions map[string]*session
+
+		// stopKeepAlive is closed to stop the keep-alive routine. It is nil
+		// when the sessions are not kept alive.
+		stopKeepAlive chan struct{}
+
+		// keepAliveDone is closed when the keep-alive routine returns.
+		keepAliveDone chan struct{}
+	}
+
+	// assistant is the part of the IBM Watson Assistant API used by the
+	// provider. It is implemented by the SDK service.
+	assistant interface {
+		// CreateSession creates a session.
+		CreateSession(options *assistantv2.CreateSessionOptions) (*core.DetailedResponse, error)
+
+		// GetCreateSessionResult returns the session created by CreateSession.
+		GetCreateSessionResult(response *core.DetailedResponse) *assistantv2.SessionResponse
+
+		// DeleteSession deletes a session.
+		DeleteSession(options *assistantv2.DeleteSessionOptions) (*core.DetailedResponse, error)
+
+		// Message sends a message in a session.
+		Message(options *assistantv2.MessageOptions) (*core.DetailedResponse, error)
+	}
+
+	// session is the Watson session of a user.
+	session struct {
+		// id is the ID of the session.
+		id *string
+
+		// userID is the user identifier sent with the messages of the session.
+		userID uuid.UUID
+
+		// turns is the number of messages sent in the session.
+		turns int
+
+		// suggestions indexes the values of the last disambiguation suggestions
+		// by label. A user message equal to a label is replaced by its value.
+		suggestions map[string]string
+
+		// imported is true while an imported session has not been validated by
+		// a successful message.
+		imported bool
+
+		// mutex serializes the calls made in the session, so a keep-alive ping
+		// does not race with a user message. It protects the other fields of
+		// the session but its ID.
+		mutex sync.Mutex
+
+		// lastUsed is the time of the last call made in the session.
+		lastUsed time.Time
 	}
 
 	// Config is the struct representing the config file.
@@ -65,6 +145,19 @@ type (
 
 		// Intents is a slice containing all intents values.
 		Intents []*Intent `json:"intents"`
+
+		// Entities is a slice containing all entities values.
+		Entities []*Entity `json:"entities"`
+	}
+
+	// Entity is an entity recognized in the user input.
+	Entity struct {
+		// Entity is the name of the entity.
+		Entity string `json:"entity"`
+		// Value is the value of the entity.
+		Value string `json:"value"`
+		// Confidence is the confidence of the entity.
+		Confidence float32 `json:"confidence"`
 	}
 
 	// Generic is a response value.
@@ -73,6 +166,40 @@ type (
 		ResponseType string `json:"response_type"`
 		// Text is the text of the value
 		Text string `json:"text"`
+		// Title is the title of a suggestion value.
+		Title string `json:"title"`
+		// Suggestions is a slice containing the disambiguation suggestions of a
+		// suggestion value.
+		Suggestions []*Suggestion `json:"suggestions"`
+		// Options is a slice containing the choices of an option value.
+		Options []*Suggestion `json:"options"`
+		// Time is the duration of a pause value, in milliseconds.
+		Time int `json:"time"`
+		// Typing is true when a typing indicator must be displayed during a
+		// pause value.
+		Typing bool `json:"typing"`
+	}
+
+	// Suggestion is a disambiguation suggestion or the choice of an option
+	// value.
+	Suggestion struct {
+		// Label is the label displayed to the user.
+		Label string `json:"label"`
+
+		// Value is the value sent to Watson when the suggestion is selected.
+		Value *SuggestionValue `json:"value"`
+	}
+
+	// SuggestionValue is the value of a disambiguation suggestion.
+	SuggestionValue struct {
+		// Input is the user input corresponding to the suggestion.
+		Input *SuggestionInput `json:"input"`
+	}
+
+	// SuggestionInput is the user input of a disambiguation suggestion.
+	SuggestionInput struct {
+		// Text is the text of the input.
+		Text string `json:"text"`
 	}
 
 	// Intent represents a response intent.
@@ -87,6 +214,28 @@ type (
 
 const (
 	label = "watson"
+
+	// suggestionType is the response type of the disambiguation suggestions.
+	suggestionType = "suggestion"
+
+	// optionType is the response type of the choices.
+	optionType = "option"
+
+	// pauseType is the response type of the pauses.
+	pauseType = "pause"
+
+	// defaultSuggestionTitle is the text displayed before the disambiguation
+	// suggestions when Watson does not give a title.
+	defaultSuggestionTitle = "Did you mean:"
+
+	// defaultOptionTitle is the text displayed before the choices when Watson
+	// does not give a title, since the choices are displayed under a response.
+	defaultOptionTitle = "Please choose an option:"
+)
+
+var (
+	// logger is a global logger of the package
+	logger = log.WithField("provider", label)
 )
 
 // Initialize initializes a new IBM Watson client and returns a new Watson struct.
@@ -106,58 +255,249 @@ func (w *Watson) Initialize(config *provider.Config) (provider.Provider, error)
 		service:     service,
 		assistantID: config.AssistantID,
 		userID:      config.UserID,
+		IDGenerator: capsule.RandomGenerator{},
+		maxTurns:    config.MaxTurns,
+		sortIntents: config.SortIntents,
+		maxIntents:  config.MaxIntents,
+		rateLimit:   NewRateLimit(label),
+		sessions:    map[string]*session{},
 	}
 
-	if err := client.CreateSession(config.AssistantID); err != nil {
-		return nil, errors.Annotate(err, "initializing a new IBM Watson service")
+	// The sessions are created on the first message of each user: a session
+	// is created and deleted once so invalid credentials fail the startup.
+	id, err := client.CreateSession(client.assistantID)
+	if err != nil {
+		return nil, errors.Annotate(err, "validating IBM Watson credentials")
+	}
+
+	if err := client.DeleteSession(id); err != nil {
+		logger.WithError(err).Warn("Cannot delete validation session")
+	}
+
+	if config.KeepAliveInterval > 0 {
+		client.stopKeepAlive = make(chan struct{})
+		client.keepAliveDone = make(chan struct{})
+		go client.keepAlive(config.KeepAliveInterval)
 	}
 
 	return client, nil
 }
 
 // CreateSession creates a new client session which would communicate
-// with a IBM Watson Assistant.
-func (w *Watson) CreateSession(id string) error {
+// with a IBM Watson Assistant and returns its ID.
+func (w *Watson) CreateSession(id string) (*string, error) {
 	response, err := w.service.CreateSession(&assistantv2.CreateSessionOptions{
 		AssistantID: core.StringPtr(id),
 	})
+	w.rateLimit.Update(response)
 
 	if err != nil {
-		return errors.Annotate(err, "creating a new IBM Watson session")
+		return nil, provider.NewError(ErrorCode(response), errors.Annotate(err, "creating a new IBM Watson session"))
 	}
 
 	// Cast response.Result to the specific dataType
 	createSessionResult := w.service.GetCreateSessionResult(response)
-	w.sessionID = createSessionResult.SessionID
+	if createSessionResult == nil || createSessionResult.SessionID == nil {
+		return nil, errors.NotFoundf("ID of the new IBM Watson session")
+	}
+
+	return createSessionResult.SessionID, nil
+}
+
+// DeleteSession deletes the session with the given ID.
+func (w *Watson) DeleteSession(sessionID *string) error {
+	// Call the assistant DeleteSession method
+	_, err := w.service.
+		DeleteSession(&assistantv2.DeleteSessionOptions{
+			AssistantID: core.StringPtr(w.assistantID),
+			SessionID:   sessionID,
+		})
+	if err != nil {
+		return errors.Annotate(err, "deleting an IBM Watson session")
+	}
+
 	return nil
 }
 
+// ResetSession deletes the session of the given user. A new session is
+// created on its next message.
+func (w *Watson) ResetSession(user string) error {
+	w.mutex.Lock()
+	s, ok := w.sessions[user]
+	delete(w.sessions, user)
+	w.mutex.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	return w.DeleteSession(s.id)
+}
+
+// session returns the session of the given user. A new session is created
+// if the user has no session or if its session reached the maximum number of
+// turns, in which case the returned boolean is true.
+func (w *Watson) session(user string) (*session, bool, error) {
+	w.mutex.Lock()
+	s, ok := w.sessions[user]
+	w.mutex.Unlock()
+
+	if ok && !w.expired(s) {
+		return s, false, nil
+	}
+
+	// The expired session is deleted before being recreated, so its context
+	// is reset.
+	if ok {
+		if err := w.DeleteSession(s.id); err != nil {
+			logger.WithError(err).Warn("Cannot delete expired session")
+		}
+	}
+
+	userID := w.userID
+	if userID == uuid.Nil {
+		var err error
+		userID, err = w.IDGenerator.New()
+		if err != nil {
+			return nil, false, errors.Annotate(err, "generating session user ID")
+		}
+	}
+
+	id, err := w.CreateSession(w.assistantID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	s = &session{
+		id:          id,
+		userID:      userID,
+		suggestions: map[string]string{},
+		lastUsed:    time.Now(),
+	}
+
+	w.mutex.Lock()
+	w.sessions[user] = s
+	w.mutex.Unlock()
+
+	return s, ok, nil
+}
+
+// expired verifies if the session reached the maximum number of turns.
+func (w *Watson) expired(s *session) bool {
+	if w.maxTurns == 0 {
+		return false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.turns >= w.maxTurns
+}
+
 // Message sends the user input to the IBM Watson Assistant and return a structured
-// result of this text processing.
-func (w *Watson) Message(message string) (*provider.Response, error) {
+// result of this text processing. The history of the input is ignored since
+// the assistant keeps the context of the conversation in its session.
+func (w *Watson) Message(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+	user, message := input.User, input.Text
+
+	// The SDK calls cannot be canceled: a canceled message is not sent.
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Annotate(err, "sending a message to IBM Watson Assistant")
+	}
+
+	// The calls are paused while the rate limit is reached.
+	if err := w.rateLimit.Wait(ctx); err != nil {
+		return nil, errors.Annotate(err, "sending a message to IBM Watson Assistant")
+	}
+
+	s, reset, err := w.session(user)
+	if err != nil {
+		return nil, errors.Annotate(err, "sending a message to IBM Watson Assistant")
+	}
+
+	s.mutex.Lock()
+
+	// A selected suggestion is replaced by its value.
+	if value, ok := s.suggestions[message]; ok {
+		message = value
+	}
+
 	// Call the assistant Message method
 	response, err := w.service.
 		Message(&assistantv2.MessageOptions{
 			AssistantID: core.StringPtr(w.assistantID),
-			SessionID:   w.sessionID,
+			SessionID:   s.id,
 			Input: &assistantv2.MessageInput{
 				Text: core.StringPtr(message),
 			},
 			Context: &assistantv2.MessageContext{
 				Global: &assistantv2.MessageContextGlobal{
 					System: &assistantv2.MessageContextGlobalSystem{
-						UserID: core.StringPtr(w.userID.String()),
+						UserID: core.StringPtr(s.userID.String()),
 					},
 				},
 			},
 		})
+	s.lastUsed = time.Now()
+	imported := s.imported
+	s.mutex.Unlock()
+	w.rateLimit.Update(response)
 
-	// Check successful call
+	// Check successful call. An imported session may have expired: it is
+	// dropped and the message is sent again in a new session.
 	if err != nil {
-		return nil, errors.Annotate(err, "sending a message to IBM Watson Assistant")
+		if imported {
+			logger.WithError(err).Warn("Imported session rejected, recreating it")
+
+			w.mutex.Lock()
+			delete(w.sessions, user)
+			w.mutex.Unlock()
+
+			return w.Message(ctx, input)
+		}
+
+		return nil, provider.NewError(ErrorCode(response), errors.Annotate(err, "sending a message to IBM Watson Assistant"))
 	}
 
-	return convertResponse(response.String())
+	result, suggestions, err := convertResponse(response.String(), w.sortIntents, w.maxIntents)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	s.imported = false
+	s.turns++
+	s.suggestions = suggestions
+	s.mutex.Unlock()
+
+	result.SessionReset = reset
+	return result, nil
+}
+
+// Conversations returns the conversations of the users who have a session.
+// The sessions are read outside of the sessions lock, since a session is
+// locked during its calls to the API.
+func (w *Watson) Conversations() []*provider.Conversation {
+	w.mutex.Lock()
+	sessions := map[string]*session{}
+	for user, s := range w.sessions {
+		sessions[user] = s
+	}
+	w.mutex.Unlock()
+
+	conversations := make([]*provider.Conversation, 0, len(sessions))
+	for user, s := range sessions {
+		s.mutex.Lock()
+		conversations = append(conversations, &provider.Conversation{
+			User:         user,
+			SessionID:    *s.id,
+			LastActivity: s.lastUsed,
+			Turns:        s.turns,
+		})
+		s.mutex.Unlock()
+	}
+
+	return conversations
 }
 
 // GetLabel returns the provider label.
@@ -165,30 +505,109 @@ func (w *Watson) GetLabel() string {
 	return label
 }
 
+// ErrorCode returns the code of a failed call to the API from the status of
+// its response. The failures without response are upstream failures.
+func ErrorCode(response *core.DetailedResponse) string {
+	if response == nil {
+		return provider.ErrorUpstream
+	}
+
+	if code := provider.StatusErrorCode(response.StatusCode); len(code) > 0 {
+		return code
+	}
+
+	return provider.ErrorUpstream
+}
+
 // convertResponse converts a response, given as a string, and returns a structured
-// response.
-func convertResponse(response string) (*provider.Response, error) {
+// response and the values of its disambiguation suggestions indexed by label.
+// The intents are ordered and truncated by orderIntents.
+func convertResponse(response string, sortIntents bool, maxIntents int) (*provider.Response, map[string]string, error) {
 	wResponse := ResponseWatson{}
 	if err := json.Unmarshal([]byte(response), &wResponse); err != nil {
-		return nil, errors.Annotate(err, "converting watson response")
+		return nil, nil, errors.Annotate(err, "converting watson response")
+	}
+
+	if wResponse.Result == nil {
+		return nil, nil, errors.Annotate(errors.NotFoundf("result"), "converting watson response")
+	}
+
+	result, values := ConvertOutput(wResponse.Result.Output, sortIntents, maxIntents)
+	result.StatusCode = wResponse.StatusCode
+	return result, values, nil
+}
+
+// ConvertOutput converts the output of a Watson response and returns a
+// structured response and the values of its disambiguation suggestions
+// indexed by label. It is shared by the Watson Assistant v1 provider, whose
+// responses have the same generic values, intents and entities.
+func ConvertOutput(output *OutputWatson, sortIntents bool, maxIntents int) (*provider.Response, map[string]string) {
+	// A response without output is converted to an empty response.
+	if output == nil {
+		output = &OutputWatson{}
 	}
 
 	outputs := []*provider.Output{}
 	intents := []*provider.Intent{}
-	for _, generic := range wResponse.Result.Output.Generics {
-		// In case of multiline response
-		for _, response := range strings.Split(generic.Text, "\n") {
-			output := &provider.Output{
+	suggestions := []string{}
+	values := map[string]string{}
+	for _, generic := range output.Generics {
+		if generic == nil {
+			continue
+		}
+
+		switch generic.ResponseType {
+		case suggestionType:
+			title := generic.Title
+			if len(title) == 0 {
+				title = defaultSuggestionTitle
+			}
+
+			outputs = append(outputs, &provider.Output{
 				ResponseType: generic.ResponseType,
-				Text:         response,
+				Text:         title,
+			})
+
+			suggestions = append(suggestions, labels(generic.Suggestions, values)...)
+		case optionType:
+			title := generic.Title
+			if len(title) == 0 {
+				title = defaultOptionTitle
 			}
 
-			outputs = append(outputs, output)
-		}
+			outputs = append(outputs, &provider.Output{
+				ResponseType: generic.ResponseType,
+				Text:         title,
+				Options:      labels(generic.Options, values),
+			})
+		case pauseType:
+			outputs = append(outputs, &provider.Output{
+				ResponseType: generic.ResponseType,
+				Pause:        time.Duration(generic.Time) * time.Millisecond,
+				Typing:       generic.Typing,
+			})
+		default:
+			if len(generic.Text) == 0 {
+				break
+			}
 
+			// In case of multiline response
+			for _, response := range strings.Split(generic.Text, "\n") {
+				output := &provider.Output{
+					ResponseType: generic.ResponseType,
+					Text:         response,
+				}
+
+				outputs = append(outputs, output)
+			}
+		}
 	}
 
-	for _, intent := range wResponse.Result.Output.Intents {
+	for _, intent := range output.Intents {
+		if intent == nil {
+			continue
+		}
+
 		intent := &provider.Intent{
 			Intent:     intent.Intent,
 			Confidence: intent.Confidence,
@@ -197,21 +616,159 @@ func convertResponse(response string) (*provider.Response, error) {
 		intents = append(intents, intent)
 	}
 
+	entities := []*provider.Entity{}
+	for _, entity := range output.Entities {
+		if entity == nil {
+			continue
+		}
+
+		entities = append(entities, &provider.Entity{
+			Entity:     entity.Entity,
+			Value:      entity.Value,
+			Confidence: entity.Confidence,
+		})
+	}
+
 	return &provider.Response{
-		StatusCode: wResponse.StatusCode,
-		Outputs:    outputs,
-		Intents:    intents,
-	}, nil
+		Outputs:     outputs,
+		Intents:     orderIntents(intents, sortIntents, maxIntents),
+		Entities:    entities,
+		Suggestions: suggestions,
+	}, values
 }
 
-// Stop deletes the session which communicates with the IBM Watson Assistant.
-func (w *Watson) Stop() error {
-	// Call the assistant DeleteSession method
-	_, err := w.service.
-		DeleteSession(&assistantv2.DeleteSessionOptions{
+// orderIntents sorts the intents by descending confidence, keeping the most
+// confident occurrence of each intent, when sorted is true. It then keeps the
+// first max intents, or all of them when max is zero.
+func orderIntents(intents []*provider.Intent, sorted bool, max int) []*provider.Intent {
+	if sorted {
+		sort.SliceStable(intents, func(i, j int) bool {
+			return intents[i].Confidence > intents[j].Confidence
+		})
+
+		seen := map[string]bool{}
+		unique := []*provider.Intent{}
+		for _, intent := range intents {
+			if seen[intent.Intent] {
+				continue
+			}
+
+			seen[intent.Intent] = true
+			unique = append(unique, intent)
+		}
+
+		intents = unique
+	}
+
+	if max > 0 && len(intents) > max {
+		intents = intents[:max]
+	}
+
+	return intents
+}
+
+// labels returns the labels of the given suggestions and adds their values to
+// the given map.
+func labels(suggestions []*Suggestion, values map[string]string) []string {
+	labels := []string{}
+	for _, suggestion := range suggestions {
+		if suggestion == nil {
+			continue
+		}
+
+		labels = append(labels, suggestion.Label)
+		if suggestion.Value != nil && suggestion.Value.Input != nil {
+			values[suggestion.Label] = suggestion.Value.Input.Text
+		}
+	}
+
+	return labels
+}
+
+// keepAlive pings the sessions idle for the given interval until the provider
+// is stopped. A session whose ping fails has expired: it is dropped so it is
+// recreated on the next message of its user.
+func (w *Watson) keepAlive(interval time.Duration) {
+	defer close(w.keepAliveDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopKeepAlive:
+			return
+		case <-ticker.C:
+		}
+
+		w.mutex.Lock()
+		sessions := map[string]*session{}
+		for user, s := range w.sessions {
+			sessions[user] = s
+		}
+		w.mutex.Unlock()
+
+		for user, s := range sessions {
+			if err := w.ping(s, interval); err != nil {
+				logger.WithError(err).Debug("Session expired, dropping it")
+
+				w.mutex.Lock()
+				if w.sessions[user] == s {
+					delete(w.sessions, user)
+				}
+				w.mutex.Unlock()
+			}
+		}
+	}
+}
+
+// ping sends an empty message in the session if it has been idle for the
+// given interval. The ping does not count as a turn.
+func (w *Watson) ping(s *session, interval time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// A user message may have been sent since the session was selected.
+	if time.Since(s.lastUsed) < interval {
+		return nil
+	}
+
+	response, err := w.service.
+		Message(&assistantv2.MessageOptions{
 			AssistantID: core.StringPtr(w.assistantID),
-			SessionID:   w.sessionID,
+			SessionID:   s.id,
+			Input: &assistantv2.MessageInput{
+				Text: core.StringPtr(""),
+			},
 		})
+	w.rateLimit.Update(response)
+	if err != nil {
+		return errors.Annotate(err, "pinging an IBM Watson session")
+	}
+
+	s.lastUsed = time.Now()
+	return nil
+}
+
+// Stop stops the keep-alive routine and deletes the sessions which
+// communicate with the IBM Watson Assistant.
+func (w *Watson) Stop() error {
+	if w.stopKeepAlive != nil {
+		close(w.stopKeepAlive)
+		<-w.keepAliveDone
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var err error
+	for user, s := range w.sessions {
+		if deleteErr := w.DeleteSession(s.id); deleteErr != nil {
+			err = deleteErr
+		}
+
+		delete(w.sessions, user)
+	}
 
 	return err
 }
@@ -0,0 +1,465 @@
+package watson
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/google/uuid"
+	"github.com/watson-developer-cloud/go-sdk/assistantv2"
+	"github.com/watson-developer-cloud/go-sdk/core"
+)
+
+type (
+	// fakeAssistant is an assistant API recording the calls instead of
+	// sending them.
+	fakeAssistant struct {
+		// mutex protects the recorded calls.
+		mutex sync.Mutex
+
+		// created is the number of created sessions.
+		created int
+
+		// deleted is a slice containing the IDs of the deleted sessions.
+		deleted []string
+
+		// messages is a slice containing the texts sent with Message.
+		messages []string
+
+		// messageErr is the error returned by Message. The messages succeed
+		// when it is nil.
+		messageErr error
+
+		// response is the response returned by Message.
+		response *core.DetailedResponse
+	}
+)
+
+func (a *fakeAssistant) CreateSession(options *assistantv2.CreateSessionOptions) (*core.DetailedResponse, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.created++
+	return &core.DetailedResponse{StatusCode: 201, Result: &assistantv2.SessionResponse{
+		SessionID: core.StringPtr(fmt.Sprintf("session-%d", a.created)),
+	}}, nil
+}
+
+func (a *fakeAssistant) GetCreateSessionResult(response *core.DetailedResponse) *assistantv2.SessionResponse {
+	result, _ := response.Result.(*assistantv2.SessionResponse)
+	return result
+}
+
+func (a *fakeAssistant) DeleteSession(options *assistantv2.DeleteSessionOptions) (*core.DetailedResponse, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.deleted = append(a.deleted, *options.SessionID)
+	return &core.DetailedResponse{StatusCode: 200}, nil
+}
+
+func (a *fakeAssistant) Message(options *assistantv2.MessageOptions) (*core.DetailedResponse, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.messages = append(a.messages, *options.Input.Text)
+	return a.response, a.messageErr
+}
+
+// pings returns the number of keep-alive pings, which are empty messages.
+func (a *fakeAssistant) pings() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	pings := 0
+	for _, text := range a.messages {
+		if len(text) == 0 {
+			pings++
+		}
+	}
+
+	return pings
+}
+
+// newTestWatson returns a Watson provider calling the fake assistant, with a
+// session idle for an hour for each given user.
+func newTestWatson(service *fakeAssistant, users ...string) *Watson {
+	w := &Watson{
+		service:   service,
+		rateLimit: NewRateLimit(label),
+		sessions:  map[string]*session{},
+	}
+
+	for _, user := range users {
+		w.sessions[user] = &session{
+			id:          core.StringPtr("session-" + user),
+			suggestions: map[string]string{},
+			lastUsed:    time.Now().Add(-time.Hour),
+		}
+	}
+
+	return w
+}
+
+// startKeepAlive starts the keep-alive routine of the provider.
+func startKeepAlive(w *Watson, interval time.Duration) {
+	w.stopKeepAlive = make(chan struct{})
+	w.keepAliveDone = make(chan struct{})
+	go w.keepAlive(interval)
+}
+
+// eventually waits until the condition is true.
+func eventually(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before the deadline")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestConvertOutputPauseAndOption(t *testing.T) {
+	tests := []struct {
+		name    string
+		generic *Generic
+		text    string
+		options []string
+		pause   time.Duration
+	}{
+		{
+			name:    "pause",
+			generic: &Generic{ResponseType: pauseType, Time: 1500, Typing: true},
+			pause:   1500 * time.Millisecond,
+		},
+		{
+			name:    "option",
+			generic: &Generic{ResponseType: optionType, Title: "Pick one", Options: []*Suggestion{{Label: "a"}, {Label: "b"}}},
+			text:    "Pick one",
+			options: []string{"a", "b"},
+		},
+		{
+			name:    "option without title",
+			generic: &Generic{ResponseType: optionType, Options: []*Suggestion{{Label: "a"}}},
+			text:    defaultOptionTitle,
+			options: []string{"a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, _ := ConvertOutput(&OutputWatson{Generics: []*Generic{tt.generic}}, false, 0)
+			if len(response.Outputs) != 1 {
+				t.Fatalf("outputs = %v, want one output", response.Outputs)
+			}
+
+			output := response.Outputs[0]
+			if output.Text != tt.text || output.Pause != tt.pause {
+				t.Errorf("output = %+v, want text %q and pause %s", output, tt.text, tt.pause)
+			}
+
+			if len(tt.options) > 0 && !reflect.DeepEqual(output.Options, tt.options) {
+				t.Errorf("options = %v, want %v", output.Options, tt.options)
+			}
+		})
+	}
+}
+
+func TestConvertResponseMalformed(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		valid    bool
+	}{
+		{"not JSON", `{"Result":`, false},
+		{"empty", `{}`, false},
+		{"empty result", `{"Result":{}}`, true},
+		{"empty output", `{"Result":{"output":{}}}`, true},
+		{"nil generic", `{"Result":{"output":{"generic":[null]}}}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, _, err := convertResponse(tt.response, false, 0)
+			if !tt.valid {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("convertResponse() error = %v", err)
+			}
+
+			if len(response.Outputs) != 0 || len(response.Intents) != 0 {
+				t.Errorf("response = %+v, want an empty response", response)
+			}
+		})
+	}
+}
+
+func TestConvertResponse(t *testing.T) {
+	response, _, err := convertResponse(`{"Result":{"output":{"generic":[{"response_type":"text","text":"first\nsecond"}],"intents":[{"intent":"greeting","confidence":0.9}]}}}`, false, 0)
+	if err != nil {
+		t.Fatalf("convertResponse() error = %v", err)
+	}
+
+	texts := []string{}
+	for _, output := range response.Outputs {
+		texts = append(texts, output.Text)
+	}
+
+	if want := []string{"first", "second"}; !reflect.DeepEqual(texts, want) {
+		t.Errorf("outputs = %v, want %v", texts, want)
+	}
+
+	if len(response.Intents) != 1 || response.Intents[0].Intent != "greeting" {
+		t.Errorf("intents = %v, want the greeting intent", response.Intents)
+	}
+}
+
+func TestConvertResponseIntents(t *testing.T) {
+	const response = `{"Result":{"output":{"intents":[` +
+		`{"intent":"weather","confidence":0.4},` +
+		`{"intent":"greeting","confidence":0.9},` +
+		`{"intent":"weather","confidence":0.7},` +
+		`{"intent":"goodbye","confidence":0.2}]}}}`
+
+	tests := []struct {
+		name       string
+		sorted     bool
+		maxIntents int
+		want       []string
+	}{
+		{"API order", false, 0, []string{"weather", "greeting", "weather", "goodbye"}},
+		{"truncated", false, 2, []string{"weather", "greeting"}},
+		{"sorted", true, 0, []string{"greeting", "weather", "goodbye"}},
+		{"sorted and truncated", true, 2, []string{"greeting", "weather"}},
+		{"more than the intents", true, 10, []string{"greeting", "weather", "goodbye"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, _, err := convertResponse(response, tt.sorted, tt.maxIntents)
+			if err != nil {
+				t.Fatalf("convertResponse() error = %v", err)
+			}
+
+			intents := []string{}
+			for _, intent := range result.Intents {
+				intents = append(intents, intent.Intent)
+			}
+
+			if !reflect.DeepEqual(intents, tt.want) {
+				t.Errorf("intents = %v, want %v", intents, tt.want)
+			}
+
+			// The most confident occurrence of a duplicate intent is kept.
+			if tt.sorted && len(result.Intents) > 1 && result.Intents[1].Confidence != 0.7 {
+				t.Errorf("confidence of weather = %v, want 0.7", result.Intents[1].Confidence)
+			}
+		})
+	}
+}
+
+func TestConvertResponseEntities(t *testing.T) {
+	response, _, err := convertResponse(`{"Result":{"output":{"entities":[{"entity":"city","value":"Paris","confidence":1},{"entity":"date","value":"2020-01-15","confidence":0.8}]}}}`, false, 0)
+	if err != nil {
+		t.Fatalf("convertResponse() error = %v", err)
+	}
+
+	if len(response.Entities) != 2 {
+		t.Fatalf("entities = %v, want 2 entities", response.Entities)
+	}
+
+	city := response.Entities[0]
+	if city.Entity != "city" || city.Value != "Paris" || city.Confidence != 1 {
+		t.Errorf("entity = %+v, want city Paris", city)
+	}
+
+	date := response.Entities[1]
+	if date.Entity != "date" || date.Value != "2020-01-15" || date.Confidence != 0.8 {
+		t.Errorf("entity = %+v, want the date", date)
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	service := &fakeAssistant{}
+	w := newTestWatson(service, "alice")
+	startKeepAlive(w, 10*time.Millisecond)
+
+	eventually(t, func() bool { return service.pings() >= 3 })
+
+	if err := w.Stop(); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+
+	// The routine is stopped before the sessions are deleted.
+	pings := service.pings()
+	time.Sleep(50 * time.Millisecond)
+	if service.pings() != pings {
+		t.Error("sessions pinged after Stop")
+	}
+
+	if !reflect.DeepEqual(service.deleted, []string{"session-alice"}) {
+		t.Errorf("deleted sessions = %v, want the session of alice", service.deleted)
+	}
+
+	if len(w.sessions) != 0 {
+		t.Errorf("sessions = %v, want none after Stop", w.sessions)
+	}
+}
+
+func TestKeepAliveExpiredSession(t *testing.T) {
+	service := &fakeAssistant{messageErr: errors.New("session expired")}
+	w := newTestWatson(service, "alice")
+	startKeepAlive(w, 10*time.Millisecond)
+	defer w.Stop()
+
+	// The expired session is dropped, so it is recreated on the next message.
+	eventually(t, func() bool {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+		return len(w.sessions) == 0
+	})
+}
+
+func TestPing(t *testing.T) {
+	service := &fakeAssistant{}
+	w := newTestWatson(service, "alice")
+	s := w.sessions["alice"]
+
+	if err := w.ping(s, time.Minute); err != nil {
+		t.Fatalf("ping() error = %v", err)
+	}
+
+	if service.pings() != 1 || s.turns != 0 {
+		t.Errorf("pings = %d and turns = %d, want one ping and no turn", service.pings(), s.turns)
+	}
+
+	// The session has just been used: the next ping is skipped.
+	if err := w.ping(s, time.Minute); err != nil {
+		t.Fatalf("ping() error = %v", err)
+	}
+
+	if service.pings() != 1 {
+		t.Errorf("pings = %d, want the recently used session skipped", service.pings())
+	}
+}
+
+func TestResetSession(t *testing.T) {
+	service := &fakeAssistant{}
+	w := newTestWatson(service, "alice", "bob")
+
+	if err := w.ResetSession("alice"); err != nil {
+		t.Fatalf("ResetSession() error = %v", err)
+	}
+
+	if _, ok := w.sessions["alice"]; ok {
+		t.Error("session of alice still in the sessions map")
+	}
+
+	if _, ok := w.sessions["bob"]; !ok {
+		t.Error("session of bob removed")
+	}
+
+	if !reflect.DeepEqual(service.deleted, []string{"session-alice"}) {
+		t.Errorf("deleted sessions = %v, want the session of alice", service.deleted)
+	}
+
+	// A user without session has nothing to delete.
+	if err := w.ResetSession("carol"); err != nil {
+		t.Errorf("ResetSession() error = %v", err)
+	}
+}
+
+func TestConversations(t *testing.T) {
+	w := newTestWatson(&fakeAssistant{}, "alice", "bob")
+	w.sessions["alice"].turns = 3
+
+	conversations := map[string]*provider.Conversation{}
+	for _, c := range w.Conversations() {
+		conversations[c.User] = c
+	}
+
+	if len(conversations) != 2 {
+		t.Fatalf("conversations = %v, want alice and bob", conversations)
+	}
+
+	alice := conversations["alice"]
+	if alice == nil || alice.SessionID != "session-alice" || alice.Turns != 3 || !alice.LastActivity.Equal(w.sessions["alice"].lastUsed) {
+		t.Errorf("conversation of alice = %+v, want the session of alice", alice)
+	}
+}
+
+func TestMessageErrorCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		response *core.DetailedResponse
+		code     string
+	}{
+		{"unauthorized", &core.DetailedResponse{StatusCode: http.StatusUnauthorized}, provider.ErrorAuth},
+		{"forbidden", &core.DetailedResponse{StatusCode: http.StatusForbidden}, provider.ErrorAuth},
+		{"rate limited", &core.DetailedResponse{StatusCode: http.StatusTooManyRequests, Headers: http.Header{"Retry-After": {"1"}}}, provider.ErrorRateLimit},
+		{"gateway timeout", &core.DetailedResponse{StatusCode: http.StatusGatewayTimeout}, provider.ErrorTimeout},
+		{"internal error", &core.DetailedResponse{StatusCode: http.StatusInternalServerError}, provider.ErrorUpstream},
+		{"bad request", &core.DetailedResponse{StatusCode: http.StatusBadRequest}, provider.ErrorUpstream},
+		{"no response", nil, provider.ErrorUpstream},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &fakeAssistant{response: tt.response, messageErr: errors.New("call failed")}
+			w := newTestWatson(service, "alice")
+
+			_, err := w.Message(context.Background(), &provider.Input{User: "alice", Text: "hello"})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if code := provider.ErrorCode(err); code != tt.code {
+				t.Errorf("error code = %q, want %q", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestMessageConcurrent(t *testing.T) {
+	service := &fakeAssistant{response: &core.DetailedResponse{
+		StatusCode: http.StatusOK,
+		Result:     json.RawMessage(`{"output":{"generic":[{"response_type":"text","text":"Hello"}]}}`),
+	}}
+	w := newTestWatson(service, "alice")
+	w.maxTurns = 3
+	w.userID = uuid.New()
+
+	// The turns and the suggestions of the session are read while the other
+	// messages update them.
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := w.Message(context.Background(), &provider.Input{User: "alice", Text: "hello"}); err != nil {
+				t.Errorf("Message() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	if len(service.messages) != 10 {
+		t.Errorf("messages sent = %q, want 10", service.messages)
+	}
+}
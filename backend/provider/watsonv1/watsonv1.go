@@ -0,0 +1,315 @@
+package watsonv1
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/fberrez/samantha/backend/provider/watson"
+	"github.com/juju/errors"
+	"github.com/watson-developer-cloud/go-sdk/assistantv1"
+	"github.com/watson-developer-cloud/go-sdk/core"
+)
+
+type (
+	// WatsonV1 is a client of the IBM Watson Assistant v1 API. The v1 API has
+	// no session: the conversation context of each user is sent with each
+	// message and replaced by the context of the response.
+	WatsonV1 struct {
+		// service is a http client which will communicates with the API
+		service *assistantv1.AssistantV1
+
+		// workspaceID is the ID of the Watson Assistant workspace.
+		workspaceID string
+
+		// maxTurns is the number of messages after which the context of a user
+		// is reset. Contexts are never reset when it is zero.
+		maxTurns int
+
+		// sortIntents sorts the response intents by descending confidence and
+		// removes their duplicates. They are kept in the API order otherwise.
+		sortIntents bool
+
+		// maxIntents is the maximum number of response intents. All the
+		// intents are kept when it is zero.
+		maxIntents int
+
+		// rateLimit throttles the calls from the rate-limit headers of the
+		// responses.
+		rateLimit *watson.RateLimit
+
+		// mutex protects the conversations map.
+		mutex sync.Mutex
+
+		// conversations indexes the conversations by user.
+		conversations map[string]*conversation
+	}
+
+	// conversation is the Watson conversation of a user.
+	conversation struct {
+		// context is the context returned by the last response. It is nil
+		// before the first message.
+		context *assistantv1.Context
+
+		// turns is the number of messages sent in the conversation.
+		turns int
+
+		// suggestions indexes the values of the last disambiguation suggestions
+		// by label. A user message equal to a label is replaced by its value.
+		suggestions map[string]string
+
+		// mutex serializes the messages of the conversation, since each
+		// message needs the context of the previous response.
+		mutex sync.Mutex
+
+		// lastUsed is the time of the last message of the conversation.
+		lastUsed time.Time
+	}
+
+	// responseV1 is the structured format of a Watson Assistant v1 response.
+	responseV1 struct {
+		// StatusCode is the status code of the response.
+		StatusCode int `json:"StatusCode"`
+
+		// Result is the result of the response.
+		Result *resultV1 `json:"Result"`
+	}
+
+	// resultV1 is the result of a v1 response. Unlike v2, the intents and the
+	// entities are not in the output.
+	resultV1 struct {
+		// Output is the output of the response.
+		Output *outputV1 `json:"output"`
+
+		// Intents is a slice containing all intents values.
+		Intents []*watson.Intent `json:"intents"`
+
+		// Entities is a slice containing all entities values.
+		Entities []*watson.Entity `json:"entities"`
+
+		// Context is the context of the conversation to send with the next
+		// message.
+		Context json.RawMessage `json:"context"`
+	}
+
+	// outputV1 is the output of a v1 response.
+	outputV1 struct {
+		// Generics is a slice containing all response values.
+		Generics []*watson.Generic `json:"generic"`
+
+		// Text is a slice containing the text responses. It is only used by
+		// the workspaces whose responses have no generic values.
+		Text []string `json:"text"`
+	}
+)
+
+const (
+	label = "watsonv1"
+
+	// textType is the response type of the text responses.
+	textType = "text"
+)
+
+// Initialize initializes a new IBM Watson Assistant v1 client and returns a
+// new WatsonV1 struct.
+func (w *WatsonV1) Initialize(config *provider.Config) (provider.Provider, error) {
+	if len(config.WorkspaceID) == 0 {
+		return nil, errors.NotValidf("empty workspace ID")
+	}
+
+	service, err := assistantv1.
+		NewAssistantV1(&assistantv1.AssistantV1Options{
+			URL:       config.URL,
+			Version:   config.Version,
+			IAMApiKey: config.Token,
+		})
+
+	if err != nil {
+		return nil, errors.Annotate(err, "initializing a new IBM Watson v1 service")
+	}
+
+	return &WatsonV1{
+		service:       service,
+		workspaceID:   config.WorkspaceID,
+		maxTurns:      config.MaxTurns,
+		sortIntents:   config.SortIntents,
+		maxIntents:    config.MaxIntents,
+		rateLimit:     watson.NewRateLimit(label),
+		conversations: map[string]*conversation{},
+	}, nil
+}
+
+// conversation returns the conversation of the given user. A new
+// conversation is started if the user has none or if its conversation
+// reached the maximum number of turns, in which case the returned boolean is
+// true.
+func (w *WatsonV1) conversation(user string) (*conversation, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	c, ok := w.conversations[user]
+	if ok && (w.maxTurns == 0 || c.turns < w.maxTurns) {
+		return c, false
+	}
+
+	c = &conversation{
+		suggestions: map[string]string{},
+		lastUsed:    time.Now(),
+	}
+	w.conversations[user] = c
+
+	return c, ok
+}
+
+// Message sends the user input with the context of its conversation to the
+// IBM Watson Assistant and returns a structured result of this text
+// processing. The context of the response is kept for the next message, so
+// the history of the input is ignored.
+func (w *WatsonV1) Message(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+	message := input.Text
+	// The calls are paused while the rate limit is reached.
+	if err := w.rateLimit.Wait(ctx); err != nil {
+		return nil, errors.Annotate(err, "sending a message to IBM Watson Assistant v1")
+	}
+
+	c, reset := w.conversation(input.User)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// The SDK calls cannot be canceled: a canceled message is not sent.
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Annotate(err, "sending a message to IBM Watson Assistant v1")
+	}
+
+	// A selected suggestion is replaced by its value.
+	if value, ok := c.suggestions[message]; ok {
+		message = value
+	}
+
+	response, err := w.service.
+		Message(&assistantv1.MessageOptions{
+			WorkspaceID: core.StringPtr(w.workspaceID),
+			Input: &assistantv1.InputData{
+				Text: core.StringPtr(message),
+			},
+			Context: c.context,
+		})
+	c.lastUsed = time.Now()
+	w.rateLimit.Update(response)
+	if err != nil {
+		return nil, provider.NewError(watson.ErrorCode(response), errors.Annotate(err, "sending a message to IBM Watson Assistant v1"))
+	}
+
+	result, next, suggestions, err := convertResponse(response.String(), w.sortIntents, w.maxIntents)
+	if err != nil {
+		return nil, err
+	}
+
+	c.context = next
+	c.turns++
+	c.suggestions = suggestions
+
+	result.SessionReset = reset
+	return result, nil
+}
+
+// ResetSession deletes the context of the given user. A new conversation is
+// started on its next message.
+func (w *WatsonV1) ResetSession(user string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	delete(w.conversations, user)
+	return nil
+}
+
+// Conversations returns the conversations of the users who have a context.
+// The session ID of a conversation is its Watson conversation ID.
+func (w *WatsonV1) Conversations() []*provider.Conversation {
+	w.mutex.Lock()
+	conversations := map[string]*conversation{}
+	for user, c := range w.conversations {
+		conversations[user] = c
+	}
+	w.mutex.Unlock()
+
+	result := make([]*provider.Conversation, 0, len(conversations))
+	for user, c := range conversations {
+		c.mutex.Lock()
+		id := ""
+		if c.context != nil && c.context.ConversationID != nil {
+			id = *c.context.ConversationID
+		}
+
+		result = append(result, &provider.Conversation{
+			User:         user,
+			SessionID:    id,
+			LastActivity: c.lastUsed,
+			Turns:        c.turns,
+		})
+		c.mutex.Unlock()
+	}
+
+	return result
+}
+
+// GetLabel returns the provider label.
+func (w *WatsonV1) GetLabel() string {
+	return label
+}
+
+// Stop deletes the contexts of the users. The v1 API keeps no session to
+// delete.
+func (w *WatsonV1) Stop() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.conversations = map[string]*conversation{}
+	return nil
+}
+
+// convertResponse converts a v1 response, given as a string, and returns a
+// structured response, the context to send with the next message and the
+// values of its disambiguation suggestions indexed by label.
+func convertResponse(response string, sortIntents bool, maxIntents int) (*provider.Response, *assistantv1.Context, map[string]string, error) {
+	wResponse := responseV1{}
+	if err := json.Unmarshal([]byte(response), &wResponse); err != nil {
+		return nil, nil, nil, errors.Annotate(err, "converting watson v1 response")
+	}
+
+	if wResponse.Result == nil {
+		return nil, nil, nil, errors.Annotate(errors.NotFoundf("result"), "converting watson v1 response")
+	}
+
+	output := &watson.OutputWatson{
+		Intents:  wResponse.Result.Intents,
+		Entities: wResponse.Result.Entities,
+	}
+
+	if wResponse.Result.Output != nil {
+		output.Generics = wResponse.Result.Output.Generics
+		if len(output.Generics) == 0 {
+			for _, text := range wResponse.Result.Output.Text {
+				output.Generics = append(output.Generics, &watson.Generic{
+					ResponseType: textType,
+					Text:         text,
+				})
+			}
+		}
+	}
+
+	var next *assistantv1.Context
+	if len(wResponse.Result.Context) > 0 {
+		next = &assistantv1.Context{}
+		if err := json.Unmarshal(wResponse.Result.Context, next); err != nil {
+			return nil, nil, nil, errors.Annotate(err, "converting watson v1 context")
+		}
+	}
+
+	result, values := watson.ConvertOutput(output, sortIntents, maxIntents)
+	result.StatusCode = wResponse.StatusCode
+	return result, next, values, nil
+}
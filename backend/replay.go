@@ -0,0 +1,42 @@
+package backend
+
+import (
+	"github.com/fberrez/samantha/capsule"
+	"github.com/juju/errors"
+)
+
+// Replay feeds the given capsules through the activated provider, without
+// any frontend, and returns the processed capsules. The capsules are copied
+// and their previous results are dropped. A processing error is set on the
+// returned capsule so the remaining capsules are still replayed. A streamed
+// response is collected into the responses of the capsule.
+func (b *Backend) Replay(capsules []*capsule.Capsule) ([]*capsule.Capsule, error) {
+	replayed := []*capsule.Capsule{}
+	for i, original := range capsules {
+		if original == nil {
+			return nil, errors.NotValidf("nil capsule at index %d", i)
+		}
+
+		c := &capsule.Capsule{
+			OriginalMessage:  original.OriginalMessage,
+			FrontendProvider: original.FrontendProvider,
+			Content:          original.Content,
+			User:             original.User,
+			Locale:           original.Locale,
+			Timezone:         original.Timezone,
+			Control:          original.Control,
+			Location:         original.Location,
+			Metadata:         original.Metadata,
+		}
+
+		if err := b.handler(c); err != nil {
+			c.Error = err
+		}
+
+		c.CollectStream()
+
+		replayed = append(replayed, c)
+	}
+
+	return replayed, nil
+}
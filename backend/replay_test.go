@@ -0,0 +1,48 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fberrez/samantha/backend/provider/echo"
+	"github.com/fberrez/samantha/capsule"
+)
+
+func TestReplay(t *testing.T) {
+	b, _, _ := newTestBackend(t, &echo.Echo{}, "")
+
+	recorded := []*capsule.Capsule{newCapsule("alice", "hello"), newCapsule("bob", "how are you?")}
+	recorded[0].Responses = []string{"stale response"}
+
+	replayed, err := b.Replay(recorded)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+
+	if len(replayed) != len(recorded) {
+		t.Fatalf("replayed %d capsules, want %d", len(replayed), len(recorded))
+	}
+
+	for i, c := range replayed {
+		if c.OriginalMessage != recorded[i].OriginalMessage || c.User != recorded[i].User {
+			t.Errorf("replayed capsule %d is not the recorded capsule", i)
+		}
+
+		if want := []string{recorded[i].Content}; !reflect.DeepEqual(c.Responses, want) {
+			t.Errorf("responses of capsule %d = %v, want %v", i, c.Responses, want)
+		}
+	}
+
+	// The recorded capsules are not modified.
+	if want := []string{"stale response"}; !reflect.DeepEqual(recorded[0].Responses, want) {
+		t.Errorf("recorded responses = %v, want %v", recorded[0].Responses, want)
+	}
+}
+
+func TestReplayNilCapsule(t *testing.T) {
+	b, _, _ := newTestBackend(t, &echo.Echo{}, "")
+
+	if _, err := b.Replay([]*capsule.Capsule{newCapsule("alice", "hello"), nil}); err == nil {
+		t.Error("expected an error for a nil capsule")
+	}
+}
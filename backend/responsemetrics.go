@@ -0,0 +1,91 @@
+package backend
+
+import (
+	"expvar"
+	"strings"
+
+	"github.com/fberrez/samantha/capsule"
+)
+
+const (
+	// unknownIntent is the intent under which the metrics of the capsules
+	// without intent are counted.
+	unknownIntent = "none"
+)
+
+var (
+	// responseMetrics measures the responses sent to the frontend by intent,
+	// to spot the intents producing walls of text or empty answers. It is
+	// exported on /debug/vars as backendResponses, with the keys:
+	//   - <intent>.capsules: the number of answered capsules.
+	//   - <intent>.bubbles: the number of responses.
+	//   - <intent>.characters: the number of characters of the responses.
+	//   - <intent>.words: the number of words of the responses.
+	//   - <intent>.sentences: the number of sentences of the responses.
+	//   - <intent>.empty: the number of capsules answered without response.
+	// The averages per capsule, or the words per sentence, are derived from
+	// them. There is no Prometheus registry in samantha: like the other
+	// metrics, they are exported with expvar, and can be scraped with an
+	// expvar exporter.
+	responseMetrics = expvar.NewMap("backendResponses")
+)
+
+// measureResponses counts the responses of the capsule in the response
+// metrics. The streamed responses are not measured.
+func measureResponses(c *capsule.Capsule) {
+	if c.Stream != nil {
+		return
+	}
+
+	intent := c.Intent
+	if len(intent) == 0 {
+		intent = unknownIntent
+	}
+
+	responseMetrics.Add(intent+".capsules", 1)
+	if len(c.Responses) == 0 && len(c.Cards) == 0 {
+		responseMetrics.Add(intent+".empty", 1)
+		return
+	}
+
+	characters, words, sentences := 0, 0, 0
+	for _, response := range c.Responses {
+		characters += len([]rune(response))
+		words += len(strings.Fields(response))
+		sentences += countSentences(response)
+	}
+
+	responseMetrics.Add(intent+".bubbles", int64(len(c.Responses)))
+	responseMetrics.Add(intent+".characters", int64(characters))
+	responseMetrics.Add(intent+".words", int64(words))
+	responseMetrics.Add(intent+".sentences", int64(sentences))
+}
+
+// countSentences returns the number of sentences of the text: the number of
+// sentence terminators followed by a space or ending the text, or one for a
+// text without terminator.
+func countSentences(text string) int {
+	text = strings.TrimSpace(text)
+	if len(text) == 0 {
+		return 0
+	}
+
+	sentences := 0
+	runes := []rune(text)
+	for i, r := range runes {
+		if !strings.ContainsRune(".!?", r) {
+			continue
+		}
+
+		if i == len(runes)-1 || runes[i+1] == ' ' || runes[i+1] == '\n' {
+			sentences++
+		}
+	}
+
+	// The last sentence may have no terminator.
+	if !strings.ContainsRune(".!?", runes[len(runes)-1]) {
+		sentences++
+	}
+
+	return sentences
+}
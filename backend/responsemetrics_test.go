@@ -0,0 +1,78 @@
+package backend
+
+import (
+	"context"
+	"expvar"
+	"testing"
+
+	"github.com/fberrez/samantha/backend/provider"
+)
+
+// responseMetric returns the value of the response metric with the given key.
+func responseMetric(key string) int64 {
+	if value, ok := responseMetrics.Get(key).(*expvar.Int); ok {
+		return value.Value()
+	}
+
+	return 0
+}
+
+func TestMeasureResponses(t *testing.T) {
+	p := &fakeProvider{answer: func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+		if input.Text == "nothing" {
+			return intentResponse("metrics_test", 0.9, ""), nil
+		}
+
+		response := intentResponse("metrics_test", 0.9, "Hello alice. How are you?")
+		response.Outputs = append(response.Outputs, &provider.Output{ResponseType: "text", Text: "I am fine"})
+		return response, nil
+	}}
+	b, toBackend, toFrontend := newTestBackend(t, p, "")
+	start(t, b, toBackend)
+
+	want := map[string]int64{
+		"metrics_test.capsules":   2,
+		"metrics_test.empty":      1,
+		"metrics_test.bubbles":    2,
+		"metrics_test.characters": 34,
+		"metrics_test.words":      8,
+		"metrics_test.sentences":  3,
+	}
+
+	// The metrics are global: the test checks how much they moved.
+	before := map[string]int64{}
+	for key := range want {
+		before[key] = responseMetric(key)
+	}
+
+	exchange(t, toBackend, toFrontend, newCapsule("alice", "hello"))
+	exchange(t, toBackend, toFrontend, newCapsule("alice", "nothing"))
+
+	for key, value := range want {
+		if got := responseMetric(key) - before[key]; got != value {
+			t.Errorf("%s moved by %d, want %d", key, got, value)
+		}
+	}
+}
+
+func TestCountSentences(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"  ", 0},
+		{"Hello", 1},
+		{"Hello.", 1},
+		{"Hello! How are you?", 2},
+		{"Hello. How are you", 2},
+		{"It costs 3.5 euros.", 1},
+		{"Wait...\nWhat?", 2},
+	}
+
+	for _, tt := range tests {
+		if got := countSentences(tt.text); got != tt.want {
+			t.Errorf("countSentences(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+)
+
+type (
+	// ScheduledMessage is a message sent to a user at a given time.
+	ScheduledMessage struct {
+		// ID identifies the scheduled message.
+		ID uuid.UUID `json:"id"`
+
+		// User is the name of the user.
+		User string `json:"user"`
+
+		// Provider is the label of the frontend provider of the user.
+		Provider string `json:"provider"`
+
+		// Chat is the address of the conversation on which the message is
+		// sent (ex: the Telegram chat ID).
+		Chat string `json:"chat"`
+
+		// Content is the text of the message.
+		Content string `json:"content"`
+
+		// At is the time when the message must be sent.
+		At time.Time `json:"at"`
+	}
+
+	// Clock gives the time to the scheduler. It can be replaced by a fake
+	// clock in tests.
+	Clock interface {
+		// Now returns the current time.
+		Now() time.Time
+
+		// After waits for the duration to elapse and then sends the current
+		// time on the returned channel.
+		After(d time.Duration) <-chan time.Time
+	}
+
+	// SystemClock is the default clock. It uses the time package.
+	SystemClock struct{}
+
+	// Scheduler sends the scheduled messages when they are due. The messages
+	// are sent to the frontend as proactive capsules, delivered on the chat of
+	// the user. The pending messages are stored in a file so they survive
+	// restarts.
+	Scheduler struct {
+		// mutex protects the messages and the file.
+		mutex sync.Mutex
+
+		// path is the path of the file storing the pending messages. They are
+		// only kept in memory when it is empty.
+		path string
+
+		// clock gives the current time.
+		clock Clock
+
+		// ids generates the IDs of the messages and of their capsules.
+		ids capsule.IDGenerator
+
+		// toFrontend is the channel on which the due messages are sent.
+		toFrontend chan<- *capsule.Capsule
+
+		// messages is a slice containing the pending messages sorted by time.
+		messages []*ScheduledMessage
+
+		// wake is signaled when a message is scheduled, so the next due time
+		// is computed again.
+		wake chan struct{}
+
+		// stop is closed to stop the scheduler routine.
+		stop chan struct{}
+	}
+)
+
+const (
+	// reminderDurationEntity is the entity containing the delay of a reminder
+	// (ex: 10m).
+	reminderDurationEntity = "duration"
+
+	// reminderContentEntity is the entity containing the text of a reminder.
+	// The user message is used when it is missing.
+	reminderContentEntity = "reminder"
+)
+
+// Now returns the current time.
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// After waits for the duration to elapse and then sends the current time on
+// the returned channel.
+func (SystemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// NewScheduler initializes a new scheduler sending the due messages on the
+// given channel. The pending messages are loaded from the file at the given
+// path, if any.
+func NewScheduler(path string, clock Clock, toFrontend chan<- *capsule.Capsule) (*Scheduler, error) {
+	s := &Scheduler{
+		path:       path,
+		clock:      clock,
+		ids:        capsule.RandomGenerator{},
+		toFrontend: toFrontend,
+		messages:   []*ScheduledMessage{},
+		wake:       make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+	}
+
+	if err := s.load(); err != nil {
+		return nil, errors.Annotatef(err, "loading schedules %s", path)
+	}
+
+	return s, nil
+}
+
+// Schedule adds a message to send at its time. It returns the ID of the
+// scheduled message.
+func (s *Scheduler) Schedule(message *ScheduledMessage) (uuid.UUID, error) {
+	if len(message.Provider) == 0 || len(message.Chat) == 0 {
+		return uuid.Nil, errors.NotValidf("scheduled message without provider or chat")
+	}
+
+	if len(message.Content) == 0 {
+		return uuid.Nil, errors.NotValidf("scheduled message without content")
+	}
+
+	id, err := s.ids.New()
+	if err != nil {
+		return uuid.Nil, errors.Annotate(err, "generating scheduled message ID")
+	}
+
+	scheduled := *message
+	scheduled.ID = id
+
+	s.mutex.Lock()
+	s.messages = append(s.messages, &scheduled)
+	sort.SliceStable(s.messages, func(i, j int) bool {
+		return s.messages[i].At.Before(s.messages[j].At)
+	})
+	err = s.save()
+	s.mutex.Unlock()
+
+	if err != nil {
+		return uuid.Nil, errors.Annotate(err, "saving schedules")
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	return id, nil
+}
+
+// Start sends the messages when they are due, until the scheduler is
+// stopped.
+func (s *Scheduler) Start(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for {
+		s.sendDue()
+
+		var due <-chan time.Time
+		if next, ok := s.next(); ok {
+			due = s.clock.After(next.Sub(s.clock.Now()))
+		}
+
+		select {
+		case <-due:
+		case <-s.wake:
+		case <-s.stop:
+			logger.Info("Scheduler stopped")
+			return
+		}
+	}
+}
+
+// Stop stops the scheduler routine. The pending messages stay in the file.
+func (s *Scheduler) Stop() {
+	close(s.stop)
+}
+
+// Remind is the action scheduling a reminder. The delay is read from the
+// duration entity (ex: 10m) and the text from the reminder entity.
+func (s *Scheduler) Remind(ctx context.Context, c *capsule.Capsule) ([]string, error) {
+	if len(c.Chat) == 0 {
+		return []string{"I cannot send you reminders here."}, nil
+	}
+
+	var delay time.Duration
+	content := c.Content
+	for _, entity := range c.Entities {
+		switch entity.Entity {
+		case reminderDurationEntity:
+			delay, _ = time.ParseDuration(entity.Value)
+		case reminderContentEntity:
+			content = entity.Value
+		}
+	}
+
+	if delay <= 0 {
+		return []string{"When should I remind you?"}, nil
+	}
+
+	at := s.clock.Now().Add(delay)
+	_, err := s.Schedule(&ScheduledMessage{
+		User:     c.User,
+		Provider: c.FrontendProvider,
+		Chat:     c.Chat,
+		Content:  "Reminder: " + content,
+		At:       at,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{"I will remind you at " + at.In(UserLocation(c)).Format("15:04 MST")}, nil
+}
+
+// next returns the time of the next pending message.
+func (s *Scheduler) next() (time.Time, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.messages) == 0 {
+		return time.Time{}, false
+	}
+
+	return s.messages[0].At, true
+}
+
+// sendDue sends the due messages and removes them from the pending messages.
+// A message is removed once sent, so a crash cannot lose it.
+func (s *Scheduler) sendDue() {
+	s.mutex.Lock()
+	now := s.clock.Now()
+	due := 0
+	for due < len(s.messages) && !s.messages[due].At.After(now) {
+		due++
+	}
+	messages := append([]*ScheduledMessage{}, s.messages[:due]...)
+	s.mutex.Unlock()
+
+	if len(messages) == 0 {
+		return
+	}
+
+	for _, message := range messages {
+		id, err := s.ids.New()
+		if err != nil {
+			logger.WithError(err).Error("Cannot generate scheduled capsule ID")
+			id = message.ID
+		}
+
+		s.toFrontend <- &capsule.Capsule{
+			OriginalMessage:  id,
+			FrontendProvider: message.Provider,
+			User:             message.User,
+			Chat:             message.Chat,
+			Responses:        []string{message.Content},
+			Proactive:        true,
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sent := map[uuid.UUID]bool{}
+	for _, message := range messages {
+		sent[message.ID] = true
+	}
+
+	pending := []*ScheduledMessage{}
+	for _, message := range s.messages {
+		if !sent[message.ID] {
+			pending = append(pending, message)
+		}
+	}
+
+	s.messages = pending
+	if err := s.save(); err != nil {
+		logger.WithError(err).Error("Cannot save schedules")
+	}
+}
+
+// load reads the pending messages from the file. A missing file contains no
+// messages.
+func (s *Scheduler) load() error {
+	if len(s.path) == 0 {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, &s.messages); err != nil {
+		return err
+	}
+
+	sort.SliceStable(s.messages, func(i, j int) bool {
+		return s.messages[i].At.Before(s.messages[j].At)
+	})
+
+	return nil
+}
+
+// save writes the pending messages to the file. The file is replaced
+// atomically so a crash cannot corrupt it.
+func (s *Scheduler) save() error {
+	if len(s.path) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(s.messages)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
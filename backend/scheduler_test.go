@@ -0,0 +1,268 @@
+package backend
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+)
+
+type (
+	// fakeClock is a clock whose time only moves when advanced.
+	fakeClock struct {
+		// mutex protects the time and the timers.
+		mutex sync.Mutex
+
+		// now is the current time.
+		now time.Time
+
+		// timers is a slice containing the channels returned by After which
+		// have not fired yet.
+		timers []*fakeTimer
+	}
+
+	// fakeTimer is a channel returned by After.
+	fakeTimer struct {
+		// at is the time when the timer fires.
+		at time.Time
+
+		// c is the channel on which the time is sent.
+		c chan time.Time
+	}
+)
+
+// newFakeClock initializes a fake clock at a fixed time.
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, time.March, 1, 9, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	timer := &fakeTimer{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		timer.c <- c.now
+		return timer.c
+	}
+
+	c.timers = append(c.timers, timer)
+	return timer.c
+}
+
+// advance moves the time forward and fires the timers which are due.
+func (c *fakeClock) advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+	timers := []*fakeTimer{}
+	for _, timer := range c.timers {
+		if timer.at.After(c.now) {
+			timers = append(timers, timer)
+			continue
+		}
+
+		timer.c <- c.now
+	}
+
+	c.timers = timers
+}
+
+// waitTimer waits until the scheduler waits for a message to be due.
+func (c *fakeClock) waitTimer(t *testing.T) {
+	t.Helper()
+
+	deadline := time.Now().Add(testTimeout)
+	for {
+		c.mutex.Lock()
+		waiting := len(c.timers) > 0
+		c.mutex.Unlock()
+
+		if waiting {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("the scheduler does not wait for a message")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// startScheduler initializes a scheduler storing its messages at the given
+// path and starts it until the end of the test.
+func startScheduler(t *testing.T, path string, clock Clock) (*Scheduler, chan *capsule.Capsule) {
+	t.Helper()
+
+	toFrontend := make(chan *capsule.Capsule, 10)
+	s, err := NewScheduler(path, clock, toFrontend)
+	if err != nil {
+		t.Fatalf("NewScheduler() error = %v", err)
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go s.Start(wg)
+	t.Cleanup(func() {
+		s.Stop()
+		wg.Wait()
+	})
+
+	return s, toFrontend
+}
+
+func TestSchedulerSendsDueMessages(t *testing.T) {
+	clock := newFakeClock()
+	s, toFrontend := startScheduler(t, "", clock)
+
+	message := &ScheduledMessage{User: "alice", Provider: "telegram", Chat: "42", Content: "Tea", At: clock.Now().Add(10 * time.Minute)}
+	if _, err := s.Schedule(message); err != nil {
+		t.Fatalf("Schedule() error = %v", err)
+	}
+
+	clock.waitTimer(t)
+	clock.advance(5 * time.Minute)
+	select {
+	case c := <-toFrontend:
+		t.Fatalf("capsule %+v sent before its time", c)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	clock.advance(5 * time.Minute)
+	select {
+	case c := <-toFrontend:
+		if !c.Proactive || c.Chat != "42" || c.FrontendProvider != "telegram" || len(c.Responses) != 1 || c.Responses[0] != "Tea" {
+			t.Errorf("capsule = %+v, want the proactive message", c)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("due message not sent")
+	}
+}
+
+func TestSchedulerPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	clock := newFakeClock()
+
+	s, err := NewScheduler(path, clock, make(chan *capsule.Capsule))
+	if err != nil {
+		t.Fatalf("NewScheduler() error = %v", err)
+	}
+
+	message := &ScheduledMessage{User: "alice", Provider: "telegram", Chat: "42", Content: "Tea", At: clock.Now().Add(time.Hour)}
+	if _, err := s.Schedule(message); err != nil {
+		t.Fatalf("Schedule() error = %v", err)
+	}
+
+	// The message is sent by the scheduler of the next run.
+	clock.advance(2 * time.Hour)
+	restarted, toFrontend := startScheduler(t, path, clock)
+	select {
+	case c := <-toFrontend:
+		if c.Responses[0] != "Tea" {
+			t.Errorf("capsule = %+v, want the persisted message", c)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("persisted message not sent")
+	}
+
+	// The message is removed from the file once sent.
+	deadline := time.Now().Add(testTimeout)
+	for {
+		restarted.mutex.Lock()
+		pending := len(restarted.messages)
+		restarted.mutex.Unlock()
+
+		if pending == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("sent message still pending")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	reloaded, err := NewScheduler(path, clock, nil)
+	if err != nil {
+		t.Fatalf("NewScheduler() error = %v", err)
+	}
+
+	if len(reloaded.messages) != 0 {
+		t.Errorf("pending messages = %v, want none once sent", reloaded.messages)
+	}
+}
+
+func TestScheduleInvalid(t *testing.T) {
+	s, err := NewScheduler("", newFakeClock(), nil)
+	if err != nil {
+		t.Fatalf("NewScheduler() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		message *ScheduledMessage
+	}{
+		{"no provider", &ScheduledMessage{Chat: "42", Content: "Tea"}},
+		{"no chat", &ScheduledMessage{Provider: "telegram", Content: "Tea"}},
+		{"no content", &ScheduledMessage{Provider: "telegram", Chat: "42"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.Schedule(tt.message); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestRemind(t *testing.T) {
+	clock := newFakeClock()
+	s, err := NewScheduler("", clock, nil)
+	if err != nil {
+		t.Fatalf("NewScheduler() error = %v", err)
+	}
+
+	c := newCapsule("alice", "remind me to drink tea in 10 minutes")
+	c.Chat = "42"
+	c.Entities = []*capsule.Entity{
+		{Entity: reminderDurationEntity, Value: "10m"},
+		{Entity: reminderContentEntity, Value: "drink tea"},
+	}
+
+	responses, err := s.Remind(context.Background(), c)
+	if err != nil {
+		t.Fatalf("Remind() error = %v", err)
+	}
+
+	if len(responses) != 1 || responses[0] != "I will remind you at 09:10 UTC" {
+		t.Errorf("responses = %q, want the reminder time", responses)
+	}
+
+	if len(s.messages) != 1 || s.messages[0].Content != "Reminder: drink tea" || !s.messages[0].At.Equal(clock.Now().Add(10*time.Minute)) {
+		t.Errorf("scheduled messages = %+v, want the reminder", s.messages)
+	}
+
+	// A reminder without delay is not scheduled.
+	c.Entities = nil
+	if responses, _ := s.Remind(context.Background(), c); len(responses) != 1 || responses[0] != "When should I remind you?" {
+		t.Errorf("responses = %q, want the delay question", responses)
+	}
+
+	if len(s.messages) != 1 {
+		t.Errorf("scheduled messages = %d, want the first reminder only", len(s.messages))
+	}
+}
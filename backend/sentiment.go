@@ -0,0 +1,109 @@
+package backend
+
+import (
+	"strings"
+	"unicode"
+)
+
+type (
+	// SentimentAnalyzer analyzes the sentiment of user messages.
+	SentimentAnalyzer interface {
+		// Analyze returns the sentiment score of the given text, from -1 (very
+		// negative) to 1 (very positive).
+		Analyze(text string) (float32, error)
+	}
+
+	// LexiconAnalyzer is a sentiment analyzer scoring texts with a lexicon of
+	// positive and negative words.
+	LexiconAnalyzer struct {
+		// lexicon indexes the word scores.
+		lexicon map[string]float32
+	}
+)
+
+var (
+	// defaultLexicon is the lexicon used by the default sentiment analyzer.
+	defaultLexicon = map[string]float32{
+		"good":        0.5,
+		"great":       0.8,
+		"excellent":   1,
+		"awesome":     1,
+		"perfect":     1,
+		"nice":        0.5,
+		"thanks":      0.5,
+		"thank":       0.5,
+		"love":        0.8,
+		"like":        0.3,
+		"happy":       0.7,
+		"cool":        0.4,
+		"helpful":     0.6,
+		"bad":         -0.5,
+		"wrong":       -0.5,
+		"terrible":    -1,
+		"awful":       -1,
+		"horrible":    -1,
+		"hate":        -0.9,
+		"useless":     -0.9,
+		"stupid":      -0.8,
+		"angry":       -0.8,
+		"annoying":    -0.7,
+		"frustrated":  -0.8,
+		"frustrating": -0.8,
+		"broken":      -0.6,
+		"worst":       -1,
+		"sad":         -0.6,
+	}
+
+	// negations are the words inverting the score of the following word.
+	negations = map[string]bool{
+		"not":   true,
+		"no":    true,
+		"never": true,
+		"don't": true,
+		"isn't": true,
+		"can't": true,
+	}
+)
+
+// NewLexiconAnalyzer initializes a sentiment analyzer using the default
+// lexicon.
+func NewLexiconAnalyzer() *LexiconAnalyzer {
+	return &LexiconAnalyzer{
+		lexicon: defaultLexicon,
+	}
+}
+
+// Analyze returns the average score of the words of the text found in the
+// lexicon. A word preceded by a negation has its score inverted.
+func (l *LexiconAnalyzer) Analyze(text string) (float32, error) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+
+	var sum float32
+	matches := 0
+	negated := false
+	for _, word := range words {
+		if negations[word] {
+			negated = true
+			continue
+		}
+
+		if score, ok := l.lexicon[word]; ok {
+			if negated {
+				score = -score
+			}
+
+			sum += score
+			matches++
+		}
+
+		negated = false
+	}
+
+	if matches == 0 {
+		return 0, nil
+	}
+
+	return sum / float32(matches), nil
+}
@@ -0,0 +1,33 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNegativeSentimentThreshold(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		content string
+		want    []string
+	}{
+		{"default threshold, negative", "", "this is terrible", []string{"Sorry about that"}},
+		{"default threshold, slightly negative", "", "this is wrong but fine", []string{"this is wrong but fine"}},
+		{"zero threshold, slightly negative", "negativeSentimentThreshold: 0\n", "this is wrong", []string{"Sorry about that"}},
+		{"zero threshold, neutral", "negativeSentimentThreshold: 0\n", "hello", []string{"hello"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := "sentimentAnalysis: true\nnegativeSentimentResponse: Sorry about that\n" + tt.config
+			b, toBackend, toFrontend := newTestBackend(t, &fakeProvider{}, config)
+			start(t, b, toBackend)
+
+			c := exchange(t, toBackend, toFrontend, newCapsule("alice", tt.content))
+			if !reflect.DeepEqual(c.Responses, tt.want) {
+				t.Errorf("responses = %v, want %v (sentiment %f)", c.Responses, tt.want, c.Sentiment)
+			}
+		})
+	}
+}
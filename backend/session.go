@@ -0,0 +1,39 @@
+package backend
+
+import (
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/juju/errors"
+)
+
+// ExportSessions serializes the sessions of the activated provider so they
+// can be restored with ImportSessions, for instance across restarts.
+func (b *Backend) ExportSessions() ([]byte, error) {
+	data, err := b.sessionExporter().ExportSessions()
+	if err != nil {
+		return nil, errors.Annotate(err, "exporting sessions")
+	}
+
+	return data, nil
+}
+
+// ImportSessions restores the sessions exported by ExportSessions in the
+// activated provider.
+func (b *Backend) ImportSessions(data []byte) error {
+	if err := b.sessionExporter().ImportSessions(data); err != nil {
+		return errors.Annotate(err, "importing sessions")
+	}
+
+	return nil
+}
+
+// sessionExporter returns the activated provider as a session exporter. The
+// circuit breaker is skipped since it does not hold any session. The history
+// of the main provider is exported when the provider keeps no session of its
+// own.
+func (b *Backend) sessionExporter() provider.SessionExporter {
+	if exporter, ok := unwrap(b.activatedProvider).(provider.SessionExporter); ok {
+		return exporter
+	}
+
+	return b.mainHistory
+}
@@ -0,0 +1,60 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fberrez/samantha/backend/provider"
+)
+
+func TestSessionsRoundTrip(t *testing.T) {
+	p := &fakeProvider{}
+	b, toBackend, toFrontend := newTestBackend(t, p, "historyTurns: 2\n")
+	start(t, b, toBackend)
+
+	exchange(t, toBackend, toFrontend, newCapsule("alice", "hello"))
+	exchange(t, toBackend, toFrontend, newCapsule("bob", "hi"))
+
+	data, err := b.ExportSessions()
+	if err != nil {
+		t.Fatalf("ExportSessions() error = %v", err)
+	}
+
+	restored, _, _ := newTestBackend(t, &fakeProvider{}, "historyTurns: 2\n")
+	if err := restored.ImportSessions(data); err != nil {
+		t.Fatalf("ImportSessions() error = %v", err)
+	}
+
+	for _, user := range []string{"test/alice", "test/bob"} {
+		want := b.mainHistory.Turns(user)
+		if len(want) == 0 {
+			t.Fatalf("no turns recorded for %s", user)
+		}
+
+		if got := restored.mainHistory.Turns(user); !reflect.DeepEqual(got, want) {
+			t.Errorf("turns of %s = %v, want %v", user, got, want)
+		}
+	}
+}
+
+func TestImportSessionsTruncated(t *testing.T) {
+	b, _, _ := newTestBackend(t, &fakeProvider{}, "historyTurns: 1\n")
+
+	data := []byte(`{"alice":[{"role":"user","text":"a"},{"role":"assistant","text":"b"},{"role":"user","text":"c"}]}`)
+	if err := b.ImportSessions(data); err != nil {
+		t.Fatalf("ImportSessions() error = %v", err)
+	}
+
+	want := []*provider.Turn{{Role: provider.RoleAssistant, Text: "b"}, {Role: provider.RoleUser, Text: "c"}}
+	if got := b.mainHistory.Turns("alice"); !reflect.DeepEqual(got, want) {
+		t.Errorf("turns = %v, want %v", got, want)
+	}
+}
+
+func TestImportSessionsInvalid(t *testing.T) {
+	b, _, _ := newTestBackend(t, &fakeProvider{}, "")
+
+	if err := b.ImportSessions([]byte(`{"alice":`)); err == nil {
+		t.Error("expected an error")
+	}
+}
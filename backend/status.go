@@ -0,0 +1,53 @@
+package backend
+
+import (
+	"context"
+
+	"github.com/fberrez/samantha/capsule"
+)
+
+type (
+	// statusKey is the context key of the status reporter of a capsule.
+	statusKey struct{}
+)
+
+// ReportStatus sends an interim status (ex: "Searching the database…") of the
+// capsule processed with the given context to the frontend, which displays it
+// until the answer arrives. It does nothing when the status updates are
+// disabled or when the context is not the context of a capsule.
+func ReportStatus(ctx context.Context, status string) {
+	if report, ok := ctx.Value(statusKey{}).(func(string)); ok {
+		report(status)
+	}
+}
+
+// bindStatus sets on the capsule context the reporter of its statuses and
+// reports that the answer is being typed. Control capsules have no status.
+func (b *Backend) bindStatus(c *capsule.Capsule) {
+	if !b.statusUpdates || len(c.Control) > 0 {
+		return
+	}
+
+	c.SetContext(context.WithValue(c.Context(), statusKey{}, func(status string) {
+		b.sendStatus(c, status)
+	}))
+
+	b.sendStatus(c, capsule.StatusTyping)
+}
+
+// sendStatus sends an interim capsule carrying the status to the frontend. It
+// gives up when the processing of the capsule is aborted.
+func (b *Backend) sendStatus(c *capsule.Capsule, status string) {
+	interim := &capsule.Capsule{
+		OriginalMessage:  c.OriginalMessage,
+		FrontendProvider: c.FrontendProvider,
+		User:             c.User,
+		Chat:             c.Chat,
+		Status:           status,
+	}
+
+	select {
+	case b.toFrontend <- interim:
+	case <-c.Context().Done():
+	}
+}
@@ -0,0 +1,56 @@
+package backend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/fberrez/samantha/capsule"
+)
+
+// searchingProvider reports a status before answering.
+func searchingProvider() *fakeProvider {
+	return &fakeProvider{answer: func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+		ReportStatus(ctx, "Searching the database")
+		return textResponse("Found it"), nil
+	}}
+}
+
+func TestStatusUpdates(t *testing.T) {
+	b, toBackend, toFrontend := newTestBackend(t, searchingProvider(), "statusUpdates: true\n")
+	start(t, b, toBackend)
+
+	sent := newCapsule("alice", "search")
+	toBackend <- sent
+
+	for _, status := range []string{capsule.StatusTyping, "Searching the database"} {
+		interim := receive(t, toFrontend)
+		if interim.Status != status || interim.OriginalMessage != sent.OriginalMessage || len(interim.Responses) != 0 {
+			t.Fatalf("interim capsule = %+v, want the status %q", interim, status)
+		}
+	}
+
+	if answer := receive(t, toFrontend); len(answer.Status) != 0 || len(answer.Responses) != 1 || answer.Responses[0] != "Found it" {
+		t.Errorf("answer = %+v, want the responses without status", answer)
+	}
+}
+
+func TestStatusUpdatesDisabled(t *testing.T) {
+	b, toBackend, toFrontend := newTestBackend(t, searchingProvider(), "")
+	start(t, b, toBackend)
+
+	if answer := exchange(t, toBackend, toFrontend, newCapsule("alice", "search")); len(answer.Status) != 0 || len(answer.Responses) != 1 {
+		t.Errorf("capsule = %+v, want the answer without status", answer)
+	}
+}
+
+func TestStatusUpdatesControl(t *testing.T) {
+	b, toBackend, toFrontend := newTestBackend(t, &fakeProvider{}, "statusUpdates: true\n")
+	start(t, b, toBackend)
+
+	c := newCapsule("alice", "/reset")
+	c.Control = capsule.ControlReset
+	if answer := exchange(t, toBackend, toFrontend, c); len(answer.Status) != 0 {
+		t.Errorf("capsule = %+v, want the answer without status", answer)
+	}
+}
@@ -0,0 +1,159 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/fberrez/samantha/capsule"
+	"github.com/juju/errors"
+)
+
+type (
+	// Summarizer summarizes the recent turns of a conversation for the
+	// operators.
+	Summarizer interface {
+		// Summarize returns a concise summary of the given turns of the
+		// conversation of the user, from the oldest to the newest.
+		Summarize(ctx context.Context, user string, turns []*provider.Turn) (string, error)
+	}
+
+	// ProviderSummarizer is a summarizer asking a summarization-capable
+	// backend provider (ex: an LLM provider) to summarize the conversations.
+	ProviderSummarizer struct {
+		// provider is the provider summarizing the conversations.
+		provider provider.Provider
+
+		// prompt is the instruction sent before the transcript.
+		prompt string
+	}
+)
+
+const (
+	// defaultSummaryPrompt is the default instruction sent to the provider
+	// before the transcript of the conversation.
+	defaultSummaryPrompt = "Summarize the following conversation between a user and an assistant in a few sentences."
+
+	// summaryUserPrefix prefixes the user of the summary requests, so they do
+	// not share the session of the summarized user.
+	summaryUserPrefix = "summary:"
+)
+
+// NewProviderSummarizer initializes a summarizer sending the transcripts to
+// the given provider after the prompt. The default prompt is used when it is
+// empty.
+func NewProviderSummarizer(p provider.Provider, prompt string) *ProviderSummarizer {
+	if len(prompt) == 0 {
+		prompt = defaultSummaryPrompt
+	}
+
+	return &ProviderSummarizer{provider: p, prompt: prompt}
+}
+
+// Summarize sends the transcript of the turns to the provider and returns its
+// text outputs. The session opened for the summary is reset afterwards.
+func (s *ProviderSummarizer) Summarize(ctx context.Context, user string, turns []*provider.Turn) (string, error) {
+	lines := []string{s.prompt, ""}
+	for _, turn := range turns {
+		lines = append(lines, fmt.Sprintf("%s: %s", turn.Role, turn.Text))
+	}
+
+	input := &provider.Input{
+		User: summaryUserPrefix + user,
+		Text: strings.Join(lines, "\n"),
+	}
+
+	defer func() {
+		if err := s.provider.ResetSession(input.User); err != nil {
+			logger.WithError(err).Warn("Cannot reset the session of the summary")
+		}
+	}()
+
+	response, err := s.provider.Message(ctx, input)
+	if err != nil {
+		return "", errors.Annotate(err, "summarizing conversation")
+	}
+
+	return responseText(response), nil
+}
+
+// newSummarizer returns the summarizer of the configuration: the main provider
+// or the hinted provider whose label is SummaryProvider. It returns nil when
+// SummaryProvider is empty.
+func newSummarizer(config *Config, main provider.Provider, hinted map[string]provider.Provider) (Summarizer, error) {
+	if len(config.SummaryProvider) == 0 {
+		return nil, nil
+	}
+
+	p := main
+	if config.SummaryProvider != config.Label {
+		var ok bool
+		if p, ok = hinted[config.SummaryProvider]; !ok {
+			return nil, errors.NotFoundf("summary provider %s", config.SummaryProvider)
+		}
+	}
+
+	return NewProviderSummarizer(p, config.SummaryPrompt), nil
+}
+
+// SetSummarizer replaces the summarizer of the conversations (ex: a dedicated
+// summarization service). A nil summarizer disables the summaries. It must be
+// called before Start.
+func (b *Backend) SetSummarizer(summarizer Summarizer) {
+	b.summarizer = summarizer
+}
+
+// summarize answers a summary control with the summary of the recent turns of
+// the user whose key is the capsule content. The turns are the ones kept in
+// the histories of the main provider and of the hinted providers.
+func (b *Backend) summarize(c *capsule.Capsule) error {
+	if b.summarizer == nil {
+		c.Responses = []string{"Summaries are not enabled."}
+		return nil
+	}
+
+	user := strings.TrimSpace(c.Content)
+	if len(user) == 0 {
+		return errors.NotValidf("summary without user")
+	}
+
+	turns := b.recentTurns(user)
+	if len(turns) == 0 {
+		c.Responses = []string{fmt.Sprintf("No recent conversation with %s.", user)}
+		return nil
+	}
+
+	summary, err := b.summarizer.Summarize(c.Context(), user, turns)
+	if err != nil {
+		return errors.Annotatef(err, "summarizing conversation of %s", user)
+	}
+
+	if len(strings.TrimSpace(summary)) == 0 {
+		return errors.NotFoundf("summary of the conversation of %s", user)
+	}
+
+	logger.WithField("provider", c.FrontendProvider).Infof("Conversation of %s summarized", user)
+	c.Responses = []string{summary}
+	return nil
+}
+
+// recentTurns returns the turns of the user kept in the history of the main
+// provider, followed by the turns kept in the histories of the hinted
+// providers by label.
+func (b *Backend) recentTurns(user string) []*provider.Turn {
+	turns := b.mainHistory.Turns(user)
+
+	labels := make([]string, 0, len(b.hintedHistories))
+	for label := range b.hintedHistories {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	for _, label := range labels {
+		turns = append(turns, b.hintedHistories[label].Turns(user)...)
+	}
+
+	return turns
+}
@@ -0,0 +1,147 @@
+package backend
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/fberrez/samantha/capsule"
+	"github.com/juju/errors"
+)
+
+type (
+	// fakeSummarizer is a summarizer recording the summarized turns.
+	fakeSummarizer struct {
+		// mutex protects the recorded turns.
+		mutex sync.Mutex
+
+		// user is the user of the last summarized conversation.
+		user string
+
+		// turns is a slice containing the last summarized turns.
+		turns []*provider.Turn
+
+		// err is the error returned by Summarize.
+		err error
+	}
+)
+
+func (s *fakeSummarizer) Summarize(ctx context.Context, user string, turns []*provider.Turn) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.user, s.turns = user, turns
+	if s.err != nil {
+		return "", s.err
+	}
+
+	return "Alice greeted the assistant.", nil
+}
+
+// summaryControl returns the capsule of an operator asking for the summary of
+// the conversation of the given user.
+func summaryControl(user string) *capsule.Capsule {
+	c := newCapsule("operator", user)
+	c.Control = capsule.ControlSummary
+	return c
+}
+
+func TestSummary(t *testing.T) {
+	b, toBackend, toFrontend := newTestBackend(t, &fakeProvider{}, "historyTurns: 5\n")
+	summarizer := &fakeSummarizer{}
+	b.SetSummarizer(summarizer)
+	start(t, b, toBackend)
+
+	exchange(t, toBackend, toFrontend, newCapsule("alice", "hello"))
+	exchange(t, toBackend, toFrontend, newCapsule("alice", "how are you?"))
+
+	c := exchange(t, toBackend, toFrontend, summaryControl("test/alice"))
+	if c.Error != nil {
+		t.Fatalf("capsule error = %v", c.Error)
+	}
+
+	if !reflect.DeepEqual(c.Responses, []string{"Alice greeted the assistant."}) {
+		t.Errorf("responses = %q, want the summary", c.Responses)
+	}
+
+	summarizer.mutex.Lock()
+	defer summarizer.mutex.Unlock()
+	want := []*provider.Turn{
+		{Role: provider.RoleUser, Text: "hello"},
+		{Role: provider.RoleAssistant, Text: "hello"},
+		{Role: provider.RoleUser, Text: "how are you?"},
+		{Role: provider.RoleAssistant, Text: "how are you?"},
+	}
+	if summarizer.user != "test/alice" || !reflect.DeepEqual(summarizer.turns, want) {
+		t.Errorf("summarized turns of %s = %v, want %v", summarizer.user, summarizer.turns, want)
+	}
+}
+
+func TestSummaryUnavailable(t *testing.T) {
+	tests := []struct {
+		name       string
+		summarizer Summarizer
+		content    string
+		response   string
+		err        bool
+	}{
+		{"disabled", nil, "test/alice", "Summaries are not enabled.", false},
+		{"no conversation", &fakeSummarizer{}, "test/bob", "No recent conversation with test/bob.", false},
+		{"no user", &fakeSummarizer{}, " ", "", true},
+		{"summarizer failure", &fakeSummarizer{err: errors.New("summarizer down")}, "test/alice", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, toBackend, toFrontend := newTestBackend(t, &fakeProvider{}, "historyTurns: 5\n")
+			b.SetSummarizer(tt.summarizer)
+			start(t, b, toBackend)
+
+			exchange(t, toBackend, toFrontend, newCapsule("alice", "hello"))
+			c := exchange(t, toBackend, toFrontend, summaryControl(tt.content))
+			if (c.Error != nil) != tt.err {
+				t.Fatalf("capsule error = %v, want error: %t", c.Error, tt.err)
+			}
+
+			if !tt.err && !reflect.DeepEqual(c.Responses, []string{tt.response}) {
+				t.Errorf("responses = %q, want %q", c.Responses, tt.response)
+			}
+		})
+	}
+}
+
+func TestProviderSummarizer(t *testing.T) {
+	p := &fakeProvider{answer: func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+		return textResponse("A short summary."), nil
+	}}
+	s := NewProviderSummarizer(p, "")
+
+	summary, err := s.Summarize(context.Background(), "test/alice", []*provider.Turn{
+		{Role: provider.RoleUser, Text: "hello"},
+		{Role: provider.RoleAssistant, Text: "hi"},
+	})
+	if err != nil {
+		t.Fatalf("Summarize() error = %v", err)
+	}
+
+	if summary != "A short summary." {
+		t.Errorf("summary = %q, want the provider response", summary)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if len(p.inputs) != 1 || p.inputs[0].User != "summary:test/alice" {
+		t.Fatalf("inputs = %+v, want a single input in a separate session", p.inputs)
+	}
+
+	if text := p.inputs[0].Text; !strings.HasPrefix(text, defaultSummaryPrompt) || !strings.HasSuffix(text, "user: hello\nassistant: hi") {
+		t.Errorf("text = %q, want the prompt and the transcript", text)
+	}
+
+	if !reflect.DeepEqual(p.resets, []string{"summary:test/alice"}) {
+		t.Errorf("reset sessions = %v, want the session of the summary", p.resets)
+	}
+}
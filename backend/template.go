@@ -0,0 +1,83 @@
+package backend
+
+import (
+	"bytes"
+	"text/template"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/juju/errors"
+)
+
+type (
+	// templateData is the data given to the response template for each
+	// response.
+	templateData struct {
+		// Text is the response text.
+		Text string
+
+		// User is the name of the user.
+		User string
+
+		// Intent is the top intent recognized by the backend provider.
+		Intent string
+
+		// Locale is the locale of the user.
+		Locale string
+
+		// Timezone is the timezone of the user.
+		Timezone string
+
+		// Now is the current time in the user timezone.
+		Now time.Time
+	}
+)
+
+// newResponseTemplate parses the given response template. It returns nil if
+// the template is empty, in which case the responses are not modified.
+func newResponseTemplate(text string) (*template.Template, error) {
+	if len(text) == 0 {
+		return nil, nil
+	}
+
+	t, err := template.New("response").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, errors.Annotate(err, "parsing response template")
+	}
+
+	// Executes the template once so an invalid field reference fails at
+	// startup rather than on the first message.
+	if err := t.Execute(&bytes.Buffer{}, &templateData{}); err != nil {
+		return nil, errors.Annotate(err, "validating response template")
+	}
+
+	return t, nil
+}
+
+// render applies the response template to each response of the capsule.
+func (b *Backend) render(capsule *capsule.Capsule) error {
+	if b.responseTemplate == nil {
+		return nil
+	}
+
+	location := UserLocation(capsule)
+	for i, response := range capsule.Responses {
+		buffer := &bytes.Buffer{}
+		data := &templateData{
+			Text:     response,
+			User:     capsule.User,
+			Intent:   capsule.Intent,
+			Locale:   UserLocale(capsule),
+			Timezone: location.String(),
+			Now:      time.Now().In(location),
+		}
+
+		if err := b.responseTemplate.Execute(buffer, data); err != nil {
+			return errors.Annotate(err, "rendering response")
+		}
+
+		capsule.Responses[i] = buffer.String()
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResponseTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     []string
+	}{
+		{"pass-through", "", []string{"hello"}},
+		{"user name", `responseTemplate: "{{.User}}, {{.Text}}"`, []string{"alice, hello"}},
+		{"signature", `responseTemplate: "{{.Text}} -- Samantha"`, []string{"hello -- Samantha"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, toBackend, toFrontend := newTestBackend(t, &fakeProvider{}, tt.template+"\n")
+			start(t, b, toBackend)
+
+			c := exchange(t, toBackend, toFrontend, newCapsule("alice", "hello"))
+			if !reflect.DeepEqual(c.Responses, tt.want) {
+				t.Errorf("responses = %v, want %v", c.Responses, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidResponseTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+	}{
+		{"syntax error", "{{.Text"},
+		{"unknown field", "{{.Name}}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newResponseTemplate(tt.template); err == nil {
+				t.Errorf("newResponseTemplate(%q) returned no error", tt.template)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package backend
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type (
+	// responseVariants replaces the provider output of an intent by one of its
+	// configured variants, picked at random, so the bot does not always
+	// answer the same text.
+	responseVariants struct {
+		// variants indexes the response variants by intent.
+		variants map[string][]string
+
+		// mutex protects the random generator, which is not safe for
+		// concurrent use.
+		mutex sync.Mutex
+
+		// random picks the variants.
+		random *rand.Rand
+	}
+)
+
+// newResponseVariants initializes the response variants of the given
+// configuration. The intents without variant are ignored.
+func newResponseVariants(config *Config) *responseVariants {
+	variants := map[string][]string{}
+	for intent, responses := range config.ResponseVariants {
+		if len(responses) > 0 {
+			variants[intent] = responses
+		}
+	}
+
+	return &responseVariants{
+		variants: variants,
+		random:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// pick returns a random variant of the given intent. It returns false if the
+// intent has no variant.
+func (v *responseVariants) pick(intent string) (string, bool) {
+	responses, ok := v.variants[intent]
+	if !ok {
+		return "", false
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	return responses[v.random.Intn(len(responses))], true
+}
+
+// SeedResponseVariants seeds the selection of the response variants, so the
+// picked variants are deterministic. It must be called before Start.
+func (b *Backend) SeedResponseVariants(seed int64) {
+	b.variants.mutex.Lock()
+	defer b.variants.mutex.Unlock()
+
+	b.variants.random = rand.New(rand.NewSource(seed))
+}
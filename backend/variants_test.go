@@ -0,0 +1,93 @@
+package backend
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/fberrez/samantha/backend/provider"
+)
+
+// variantsConfig is the configuration of the response variants tests.
+const variantsConfig = `minConfidence: 0.5
+responseVariants:
+  greeting: [Hi, Hello, Hey]
+`
+
+// greetingProvider returns a fake provider recognizing the given intent with
+// the given confidence.
+func greetingProvider(intent string, confidence float32) *fakeProvider {
+	return &fakeProvider{
+		answer: func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+			return intentResponse(intent, confidence, "Provider greeting"), nil
+		},
+	}
+}
+
+// greetings returns the responses to n messages of a backend whose variants
+// are seeded with the given seed.
+func greetings(t *testing.T, seed int64, n int) []string {
+	t.Helper()
+
+	b, toBackend, toFrontend := newTestBackend(t, greetingProvider("greeting", 0.9), variantsConfig)
+	b.SeedResponseVariants(seed)
+	start(t, b, toBackend)
+
+	responses := []string{}
+	for i := 0; i < n; i++ {
+		c := exchange(t, toBackend, toFrontend, newCapsule("alice", "hello"))
+		if len(c.Responses) != 1 {
+			t.Fatalf("responses = %q, want one variant", c.Responses)
+		}
+
+		responses = append(responses, c.Responses[0])
+	}
+
+	return responses
+}
+
+func TestResponseVariants(t *testing.T) {
+	variants := map[string]bool{"Hi": true, "Hello": true, "Hey": true}
+
+	picked := map[string]bool{}
+	for _, response := range greetings(t, 1, 30) {
+		if !variants[response] {
+			t.Fatalf("response %q is not a variant", response)
+		}
+
+		picked[response] = true
+	}
+
+	if len(picked) < 2 {
+		t.Errorf("picked variants = %v, want several variants", picked)
+	}
+}
+
+func TestResponseVariantsSeeded(t *testing.T) {
+	if first, second := greetings(t, 42, 10), greetings(t, 42, 10); !reflect.DeepEqual(first, second) {
+		t.Errorf("variants %q then %q, want the same variants with the same seed", first, second)
+	}
+}
+
+func TestResponseVariantsIgnored(t *testing.T) {
+	tests := []struct {
+		name       string
+		intent     string
+		confidence float32
+	}{
+		{"low confidence", "greeting", 0.2},
+		{"intent without variant", "goodbye", 0.9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, toBackend, toFrontend := newTestBackend(t, greetingProvider(tt.intent, tt.confidence), variantsConfig)
+			start(t, b, toBackend)
+
+			c := exchange(t, toBackend, toFrontend, newCapsule("alice", "hello"))
+			if len(c.Responses) != 1 || c.Responses[0] != "Provider greeting" {
+				t.Errorf("responses = %q, want the provider output", c.Responses)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/backend/provider"
+	"github.com/fberrez/samantha/capsule"
+)
+
+func TestConcurrentProcessing(t *testing.T) {
+	const (
+		users    = 20
+		messages = 10
+	)
+
+	p := &fakeProvider{answer: func(ctx context.Context, input *provider.Input) (*provider.Response, error) {
+		// The slow calls let the workers overlap.
+		time.Sleep(time.Millisecond)
+		return textResponse(input.Text), nil
+	}}
+	b, toBackend, toFrontend := newTestBackend(t, p, "backendWorkers: 4\n")
+	start(t, b, toBackend)
+
+	// The answers are collected while they are sent, so the workers are never
+	// blocked by the frontend.
+	received := map[string][]string{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < users*messages; i++ {
+			select {
+			case c := <-toFrontend:
+				received[c.User] = append(received[c.User], c.Responses...)
+			case <-time.After(testTimeout):
+				return
+			}
+		}
+	}()
+
+	wg := sync.WaitGroup{}
+	for u := 0; u < users; u++ {
+		wg.Add(1)
+		go func(user string) {
+			defer wg.Done()
+			for m := 0; m < messages; m++ {
+				toBackend <- newCapsule(user, strconv.Itoa(m))
+			}
+		}(fmt.Sprintf("user%d", u))
+	}
+	wg.Wait()
+	<-done
+
+	for u := 0; u < users; u++ {
+		user := fmt.Sprintf("user%d", u)
+		if len(received[user]) != messages {
+			t.Fatalf("%s received %d answers, want %d", user, len(received[user]), messages)
+		}
+
+		// The messages of a user are processed in order.
+		for m, response := range received[user] {
+			if response != strconv.Itoa(m) {
+				t.Errorf("%s answer %d = %s, want %d", user, m, response, m)
+			}
+		}
+	}
+
+	select {
+	case c := <-toFrontend:
+		t.Errorf("unexpected capsule sent to the frontend: %+v", c)
+	default:
+	}
+
+	if calls := p.calls(); calls != users*messages {
+		t.Errorf("provider called %d times, want %d: the backend consumed its own answers", calls, users*messages)
+	}
+}
+
+func TestWorkerIndex(t *testing.T) {
+	b := &Backend{workers: 4}
+	c := &capsule.Capsule{FrontendProvider: "test", User: "alice"}
+
+	index := b.workerIndex(c)
+	if index < 0 || index >= b.workers {
+		t.Fatalf("workerIndex() = %d, want an index lower than %d", index, b.workers)
+	}
+
+	for i := 0; i < 10; i++ {
+		if got := b.workerIndex(c); got != index {
+			t.Errorf("workerIndex() = %d, want the same worker %d for a user", got, index)
+		}
+	}
+}
@@ -1,7 +1,12 @@
 package capsule
 
 import (
+	"context"
+	"strings"
+	"time"
+
 	"github.com/google/uuid"
+	"github.com/juju/errors"
 )
 
 type (
@@ -14,8 +19,261 @@ type (
 		OriginalMessage  uuid.UUID `json:"from" yaml:"from"`
 		FrontendProvider string    `json:"frontendProvider" yaml:"frontendProvider"`
 		Content          string    `json:"content" yaml:"content"`
+		RawContent       string    `json:"rawContent,omitempty" yaml:"rawContent,omitempty"`
 		User             string    `json:"user" yaml:"user"`
+		Chat             string    `json:"chat,omitempty" yaml:"chat,omitempty"`
+		ThreadID         string    `json:"threadID,omitempty" yaml:"threadID,omitempty"`
+		Locale           string    `json:"locale" yaml:"locale"`
+		Timezone         string    `json:"timezone" yaml:"timezone"`
+		Intent           string    `json:"intent" yaml:"intent"`
+		Entities         []*Entity `json:"entities,omitempty" yaml:"entities,omitempty"`
 		Responses        []string  `json:"responses" yaml:"responses"`
+		Suggestions      []string  `json:"suggestions" yaml:"suggestions"`
+		Pauses           []*Pause  `json:"pauses" yaml:"pauses"`
+		Sentiment        float32   `json:"sentiment" yaml:"sentiment"`
+		Escalated        bool      `json:"escalated" yaml:"escalated"`
+		Control          string    `json:"control" yaml:"control"`
+		BackendHint      string    `json:"backendHint,omitempty" yaml:"backendHint,omitempty"`
 		Error            error     `json:"error" yaml:"error"`
+
+		// ErrorCode is the code of the error of the capsule (ex: ErrorAuth), so
+		// the frontend can handle it without matching its text. It is empty
+		// when the error has no code.
+		ErrorCode string `json:"errorCode,omitempty" yaml:"errorCode,omitempty"`
+
+		// Attachments are the files sent by the user with the message. The
+		// content is the caption of the files.
+		Attachments []*Attachment `json:"attachments,omitempty" yaml:"attachments,omitempty"`
+
+		// Cards are rich cards sent after the responses (ex: products). The
+		// frontend providers which cannot display them receive their text.
+		Cards []*Card `json:"cards,omitempty" yaml:"cards,omitempty"`
+
+		// Location is the location shared by the user. The content contains
+		// its coordinates as text. It is nil for the other messages.
+		Location *Location `json:"location,omitempty" yaml:"location,omitempty"`
+
+		// Metadata contains raw data of the frontend provider about the message
+		// (ex: the Telegram chat type), available to the backend actions. The
+		// keys depend on the provider.
+		Metadata map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+
+		// Proactive is true when the capsule is not the answer to a user
+		// message (ex: a reminder). Its responses are sent to its chat.
+		Proactive bool `json:"proactive,omitempty" yaml:"proactive,omitempty"`
+
+		// FrontendCapabilities describes what the frontend provider of the
+		// capsule can display, so the backend can shape the responses. It is
+		// nil when the provider does not declare its capabilities.
+		FrontendCapabilities *Capabilities `json:"frontendCapabilities,omitempty" yaml:"frontendCapabilities,omitempty"`
+
+		// Status is the interim status of the processing of the original
+		// message (ex: StatusTyping). A capsule with a status is sent before
+		// the answer and has no responses: each status replaces the previous
+		// one until the answer arrives.
+		Status string `json:"status,omitempty" yaml:"status,omitempty"`
+
+		// Stream receives the response chunks of a streaming backend provider.
+		// It is nil when the response is in Responses.
+		Stream <-chan string `json:"-" yaml:"-"`
+
+		// ctx is the context of the processing of the capsule. It is not
+		// serialized: the capsules received from a serializing transport have
+		// no context.
+		ctx context.Context
+	}
+
+	// Attachment is a file sent by the user.
+	Attachment struct {
+		// Name is the file name.
+		Name string `json:"name" yaml:"name"`
+
+		// MIME is the MIME type of the file (ex: application/pdf).
+		MIME string `json:"mime" yaml:"mime"`
+
+		// Data is the file content.
+		Data []byte `json:"data" yaml:"data"`
+	}
+
+	// Location is a geographic location.
+	Location struct {
+		// Latitude and Longitude are the coordinates of the location in
+		// degrees.
+		Latitude  float64 `json:"latitude" yaml:"latitude"`
+		Longitude float64 `json:"longitude" yaml:"longitude"`
 	}
+
+	// Card is a rich card: a title, a subtitle, an image and buttons.
+	Card struct {
+		// Title is the title of the card.
+		Title string `json:"title" yaml:"title"`
+
+		// Subtitle is the text under the title. It is optional.
+		Subtitle string `json:"subtitle,omitempty" yaml:"subtitle,omitempty"`
+
+		// ImageURL is the URL of the image of the card. It is optional.
+		ImageURL string `json:"imageURL,omitempty" yaml:"imageURL,omitempty"`
+
+		// Buttons is a slice containing the buttons of the card.
+		Buttons []*CardButton `json:"buttons,omitempty" yaml:"buttons,omitempty"`
+	}
+
+	// CardButton is a button of a card. It either opens its URL or sends its
+	// value as a user message.
+	CardButton struct {
+		// Label is the label of the button.
+		Label string `json:"label" yaml:"label"`
+
+		// URL is the URL opened by the button.
+		URL string `json:"url,omitempty" yaml:"url,omitempty"`
+
+		// Value is the message sent by the button when it has no URL. It
+		// defaults to the label.
+		Value string `json:"value,omitempty" yaml:"value,omitempty"`
+	}
+
+	// Capabilities describes the content a frontend provider can display.
+	Capabilities struct {
+		// Buttons is true when the provider displays the suggestions as
+		// buttons. The suggestions are flattened to a numbered text list
+		// otherwise.
+		Buttons bool `json:"buttons" yaml:"buttons"`
+
+		// Cards is true when the provider displays the rich cards natively.
+		// The cards are sent as text otherwise.
+		Cards bool `json:"cards" yaml:"cards"`
+	}
+
+	// Entity is an entity recognized in the user input. Actions use it as slot
+	// value.
+	Entity struct {
+		// Entity is the name of the entity (ex: city).
+		Entity string `json:"entity" yaml:"entity"`
+
+		// Value is the value of the entity (ex: Paris).
+		Value string `json:"value" yaml:"value"`
+
+		// Confidence is the confidence of the entity.
+		Confidence float32 `json:"confidence" yaml:"confidence"`
+	}
+
+	// Pause is a pause made before sending a response.
+	Pause struct {
+		// Index is the index of the response sent after the pause.
+		Index int `json:"index" yaml:"index"`
+
+		// Duration is the duration of the pause.
+		Duration time.Duration `json:"duration" yaml:"duration"`
+
+		// Typing is true when a typing indicator must be displayed during the
+		// pause.
+		Typing bool `json:"typing" yaml:"typing"`
+	}
+
+	// IDGenerator generates the UUIDs identifying messages and sessions. It can
+	// be replaced by a deterministic generator in tests.
+	IDGenerator interface {
+		// New returns a new UUID.
+		New() (uuid.UUID, error)
+	}
+
+	// RandomGenerator is the default ID generator. It generates version 4 UUIDs.
+	RandomGenerator struct{}
 )
+
+const (
+	// ErrorAuth is the code of the failures caused by invalid or missing
+	// credentials of a backend provider. Retrying does not help.
+	ErrorAuth = "AUTH"
+
+	// ErrorRateLimit is the code of the failures caused by the rate limit of
+	// a backend provider API. The message can be retried later.
+	ErrorRateLimit = "RATE_LIMIT"
+
+	// ErrorUpstream is the code of the failures of a backend provider API.
+	ErrorUpstream = "UPSTREAM"
+
+	// ErrorTimeout is the code of the calls to a backend provider which did
+	// not complete in time.
+	ErrorTimeout = "TIMEOUT"
+
+	// StatusTyping is the status of a capsule whose answer is being
+	// prepared. The frontend providers display it as a typing indicator.
+	StatusTyping = "typing"
+
+	// ControlReset is the control asking the backend to reset the conversation
+	// of the capsule user.
+	ControlReset = "reset"
+
+	// ControlForget is the control asking the backend to delete the data of
+	// the capsule user: its sessions, its escalation counters and its pending
+	// clarification.
+	ControlForget = "forget"
+
+	// ControlSummary is the control asking the backend for a summary of the
+	// recent conversation of the user whose key (provider/user) is the
+	// capsule content. The summary is sent to the capsule user.
+	ControlSummary = "summary"
+)
+
+// Validate verifies that the capsule can be processed: it must identify its
+// original message and its frontend provider, and have a content, attachments
+// or a control.
+func (c *Capsule) Validate() error {
+	if c.OriginalMessage == uuid.Nil {
+		return errors.NotValidf("capsule without original message")
+	}
+
+	if len(c.FrontendProvider) == 0 {
+		return errors.NotValidf("capsule %s without frontend provider", c.OriginalMessage)
+	}
+
+	if len(strings.TrimSpace(c.Content)) == 0 && len(c.Attachments) == 0 && len(c.Control) == 0 {
+		return errors.NotValidf("capsule %s without content", c.OriginalMessage)
+	}
+
+	return nil
+}
+
+// Context returns the context of the capsule processing. It is canceled when
+// the processing must be aborted (ex: on shutdown). It returns the background
+// context when the capsule has no context.
+func (c *Capsule) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+
+	return c.ctx
+}
+
+// HasContext returns true when a context has been set on the capsule.
+func (c *Capsule) HasContext() bool {
+	return c.ctx != nil
+}
+
+// SetContext sets the context of the capsule processing.
+func (c *Capsule) SetContext(ctx context.Context) {
+	c.ctx = ctx
+}
+
+// CollectStream waits for the end of the streamed response and appends it to
+// the responses, so the capsule can be delivered or serialized as a whole. It
+// does nothing when the capsule has no stream.
+func (c *Capsule) CollectStream() {
+	if c.Stream == nil {
+		return
+	}
+
+	text := ""
+	for chunk := range c.Stream {
+		text += chunk
+	}
+
+	c.Stream = nil
+	c.Responses = append(c.Responses, text)
+}
+
+// New returns a new version 4 UUID.
+func (RandomGenerator) New() (uuid.UUID, error) {
+	return uuid.NewRandom()
+}
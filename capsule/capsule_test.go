@@ -0,0 +1,55 @@
+package capsule
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		capsule *Capsule
+		valid   bool
+	}{
+		{"text", &Capsule{OriginalMessage: uuid.New(), FrontendProvider: "telegram", Content: "hello"}, true},
+		{"attachment", &Capsule{OriginalMessage: uuid.New(), FrontendProvider: "telegram", Attachments: []*Attachment{{Name: "photo.jpg"}}}, true},
+		{"control", &Capsule{OriginalMessage: uuid.New(), FrontendProvider: "telegram", Control: ControlReset}, true},
+		{"no original message", &Capsule{FrontendProvider: "telegram", Content: "hello"}, false},
+		{"no frontend provider", &Capsule{OriginalMessage: uuid.New(), Content: "hello"}, false},
+		{"no content", &Capsule{OriginalMessage: uuid.New(), FrontendProvider: "telegram"}, false},
+		{"blank content", &Capsule{OriginalMessage: uuid.New(), FrontendProvider: "telegram", Content: " \n\t"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.capsule.Validate()
+			if tt.valid && err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+
+			if !tt.valid && err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestContext(t *testing.T) {
+	c := &Capsule{}
+	if c.HasContext() || c.Context() != context.Background() {
+		t.Error("capsule without context, want the background context")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.SetContext(ctx)
+	if !c.HasContext() || c.Context() != ctx {
+		t.Error("context not set")
+	}
+
+	cancel()
+	if c.Context().Err() != context.Canceled {
+		t.Errorf("context error = %v, want canceled", c.Context().Err())
+	}
+}
@@ -0,0 +1,88 @@
+package capsule
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+type (
+	// CodedError is an error identified by a code, so the receiver of a
+	// serialized capsule can handle it without parsing its message.
+	CodedError struct {
+		// Code identifies the error (ex: provider_unavailable).
+		Code string
+
+		// Message is the error message.
+		Message string
+	}
+
+	// coder is implemented by the errors carrying a code.
+	coder interface {
+		ErrorCode() string
+	}
+
+	// jsonCapsule is the capsule without its JSON methods.
+	jsonCapsule Capsule
+)
+
+// Error returns the error message.
+func (e *CodedError) Error() string {
+	return e.Message
+}
+
+// ErrorCode returns the error code.
+func (e *CodedError) ErrorCode() string {
+	return e.Code
+}
+
+// MarshalJSON serializes the capsule. The error is serialized as its message
+// since an error value cannot be unmarshaled. The code of the error fills the
+// error code of the capsule when it is empty.
+func (c Capsule) MarshalJSON() ([]byte, error) {
+	serialized := struct {
+		jsonCapsule
+		Error string `json:"error,omitempty"`
+	}{
+		jsonCapsule: jsonCapsule(c),
+	}
+
+	if c.Error != nil {
+		serialized.Error = c.Error.Error()
+		if coded, ok := c.Error.(coder); ok && len(c.ErrorCode) == 0 {
+			serialized.ErrorCode = coded.ErrorCode()
+		}
+	}
+
+	return json.Marshal(serialized)
+}
+
+// UnmarshalJSON deserializes the capsule. The error is reconstructed as a
+// plain error, or as a CodedError when the capsule has an error code. An error
+// which is not a string, as serialized by the previous versions, is ignored.
+func (c *Capsule) UnmarshalJSON(data []byte) error {
+	serialized := struct {
+		*jsonCapsule
+		Error json.RawMessage `json:"error,omitempty"`
+	}{
+		jsonCapsule: (*jsonCapsule)(c),
+	}
+
+	if err := json.Unmarshal(data, &serialized); err != nil {
+		return err
+	}
+
+	c.Error = nil
+
+	var message string
+	if err := json.Unmarshal(serialized.Error, &message); err != nil || len(message) == 0 {
+		return nil
+	}
+
+	if len(c.ErrorCode) > 0 {
+		c.Error = &CodedError{Code: c.ErrorCode, Message: message}
+	} else {
+		c.Error = errors.New(message)
+	}
+
+	return nil
+}
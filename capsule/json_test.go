@@ -0,0 +1,147 @@
+package capsule
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// roundTrip marshals and unmarshals the capsule.
+func roundTrip(t *testing.T, c *Capsule) *Capsule {
+	t.Helper()
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	got := &Capsule{}
+	if err := json.Unmarshal(data, got); err != nil {
+		t.Fatalf("Unmarshal(%s) error = %v", data, err)
+	}
+
+	return got
+}
+
+func TestRoundTrip(t *testing.T) {
+	c := &Capsule{
+		OriginalMessage:  uuid.New(),
+		FrontendProvider: "telegram",
+		Content:          "hello",
+		User:             "alice",
+		Responses:        []string{"Hello alice"},
+		Suggestions:      []string{"weather"},
+		Entities:         []*Entity{{Entity: "city", Value: "Paris", Confidence: 0.9}},
+	}
+
+	got := roundTrip(t, c)
+	if got.Error != nil {
+		t.Errorf("error = %v, want none", got.Error)
+	}
+
+	if !reflect.DeepEqual(got, c) {
+		t.Errorf("capsule = %+v, want %+v", got, c)
+	}
+}
+
+func TestRoundTripMetadata(t *testing.T) {
+	c := &Capsule{
+		OriginalMessage: uuid.New(),
+		Content:         "hello",
+		Metadata:        map[string]string{"chat_id": "42", "chat_type": "private"},
+	}
+
+	if got := roundTrip(t, c); !reflect.DeepEqual(got.Metadata, c.Metadata) {
+		t.Errorf("metadata = %v, want %v", got.Metadata, c.Metadata)
+	}
+
+	// The metadata is omitted when empty.
+	data, err := json.Marshal(&Capsule{OriginalMessage: uuid.New()})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	if strings.Contains(string(data), "metadata") {
+		t.Errorf("JSON = %s, want no metadata", data)
+	}
+}
+
+func TestRoundTripError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code string
+	}{
+		{"plain error", errors.New("provider unavailable"), ""},
+		{"coded error", &CodedError{Code: "timeout", Message: "provider timed out"}, "timeout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := roundTrip(t, &Capsule{OriginalMessage: uuid.New(), Error: tt.err})
+			if got.Error == nil || got.Error.Error() != tt.err.Error() {
+				t.Fatalf("error = %v, want %v", got.Error, tt.err)
+			}
+
+			coded, ok := got.Error.(*CodedError)
+			if ok != (len(tt.code) > 0) {
+				t.Fatalf("error %T, want a coded error: %t", got.Error, len(tt.code) > 0)
+			}
+
+			if ok && coded.ErrorCode() != tt.code {
+				t.Errorf("code = %q, want %q", coded.ErrorCode(), tt.code)
+			}
+		})
+	}
+}
+
+func TestRoundTripErrorCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		capsule *Capsule
+		code    string
+	}{
+		{"code of the capsule", &Capsule{Error: errors.New("invalid key"), ErrorCode: "auth"}, "auth"},
+		{"code of the error", &Capsule{Error: &CodedError{Code: "timeout", Message: "provider timed out"}}, "timeout"},
+		{"code of the capsule first", &Capsule{Error: &CodedError{Code: "timeout", Message: "provider timed out"}, ErrorCode: "upstream"}, "upstream"},
+		{"code without error", &Capsule{ErrorCode: "rate_limited"}, "rate_limited"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.capsule.OriginalMessage = uuid.New()
+
+			got := roundTrip(t, tt.capsule)
+			if got.ErrorCode != tt.code {
+				t.Errorf("error code = %q, want %q", got.ErrorCode, tt.code)
+			}
+
+			if tt.capsule.Error == nil {
+				if got.Error != nil {
+					t.Errorf("error = %v, want none", got.Error)
+				}
+
+				return
+			}
+
+			if coded, ok := got.Error.(*CodedError); !ok || coded.Code != tt.code {
+				t.Errorf("error = %#v, want a coded error with the code %q", got.Error, tt.code)
+			}
+		})
+	}
+}
+
+func TestUnmarshalLegacyError(t *testing.T) {
+	c := &Capsule{Error: errors.New("stale")}
+	if err := json.Unmarshal([]byte(`{"content":"hello","error":{}}`), c); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if c.Error != nil || c.Content != "hello" {
+		t.Errorf("capsule = %+v, want the content without error", c)
+	}
+}
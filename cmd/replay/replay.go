@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fberrez/samantha/backend"
+	"github.com/fberrez/samantha/capsule"
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// replay reads a JSONL file of capsules, replays them through the backend
+// provider configured by BACKEND_CONFIG_FILE and prints the responses.
+func main() {
+	file := flag.String("file", "capsules.jsonl", "JSONL file containing one capsule per line")
+	flag.Parse()
+
+	// Only the replay output is written on stdout.
+	log.SetOutput(os.Stderr)
+
+	capsules, err := readCapsules(*file)
+	if err != nil {
+		log.WithError(err).Fatal("Cannot read capsules")
+	}
+
+	back, err := backend.New(make(chan *capsule.Capsule), make(chan *capsule.Capsule))
+	if err != nil {
+		log.WithError(err).Fatal("Cannot initialize backend")
+	}
+
+	replayed, err := back.Replay(capsules)
+	if err != nil {
+		log.WithError(err).Fatal("Cannot replay capsules")
+	}
+
+	for _, c := range replayed {
+		fmt.Printf("> [%s] %s\n", c.User, c.Content)
+		if c.Error != nil {
+			fmt.Printf("! %s\n", c.Error)
+			continue
+		}
+
+		for _, response := range c.Responses {
+			fmt.Printf("< %s\n", response)
+		}
+	}
+}
+
+// readCapsules reads the capsules of the given JSONL file.
+func readCapsules(path string) ([]*capsule.Capsule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Annotate(err, "opening capsules file")
+	}
+	defer f.Close()
+
+	capsules := []*capsule.Capsule{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		c := &capsule.Capsule{}
+		if err := json.Unmarshal(scanner.Bytes(), c); err != nil {
+			return nil, errors.Annotatef(err, "unmarshaling capsule at line %d", line)
+		}
+
+		capsules = append(capsules, c)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Annotate(err, "reading capsules file")
+	}
+
+	return capsules, nil
+}
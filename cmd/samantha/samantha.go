@@ -1,14 +1,18 @@
 package main
 
 import (
+	"context"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/fberrez/samantha/backend"
 	"github.com/fberrez/samantha/capsule"
 	"github.com/fberrez/samantha/frontend"
+	"github.com/fberrez/samantha/transport"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -36,21 +40,64 @@ func init() {
 	}
 }
 
+const (
+	// roleEnv is the name of the environment variable containing the role of
+	// the process: all (default), frontend or backend. The frontend and the
+	// backend can run in separate processes with the nats transport.
+	roleEnv = "SAMANTHA_ROLE"
+
+	// adminListenEnv is the name of the environment variable containing the
+	// address of the admin HTTP API (ex: localhost:9090). The API is disabled
+	// when it is empty.
+	adminListenEnv = "SAMANTHA_ADMIN_LISTEN"
+
+	// schedulesFileEnv is the name of the environment variable containing the
+	// path of the file storing the scheduled messages. They are lost on
+	// restart when it is empty.
+	schedulesFileEnv = "SAMANTHA_SCHEDULES_FILE"
+
+	// drainTimeoutEnv is the name of the environment variable containing the
+	// maximum duration of each phase of the drain on shutdown (ex: 30s): the
+	// frontend and the backend are drained in turn.
+	drainTimeoutEnv = "SAMANTHA_DRAIN_TIMEOUT"
+
+	// defaultDrainTimeout is the default maximum duration of each phase of
+	// the drain.
+	defaultDrainTimeout = 10 * time.Second
+)
+
 func main() {
-	// Initializes channel.
-	// capsuleChan is the channel making the connection between the
-	// frontend and the backend. When a user input is received on the frontend-side
-	// via a frontend provider, it is sent to the backend to be processed by a NLU
-	// provider. The backend uses this channel to send the response to the frontend.
-	capsuleChan := make(chan *capsule.Capsule)
-
-	// Initializes frontend manager
-	front, err := frontend.New(capsuleChan)
+	role := os.Getenv(roleEnv)
+	if role == "" {
+		role = "all"
+	}
+
+	runFrontend := role == "all" || role == "frontend"
+	runBackend := role == "all" || role == "backend"
+	if !runFrontend && !runBackend {
+		panic("unknown role " + role)
+	}
+
+	drainTimeout := defaultDrainTimeout
+	if value := os.Getenv(drainTimeoutEnv); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			panic(err)
+		}
+
+		drainTimeout = timeout
+	}
+
+	// Initializes the transports. toBackend carries the user inputs received
+	// on the frontend-side via a frontend provider to the backend, where they
+	// are processed by a NLU provider. toFrontend carries the responses back
+	// to the frontend.
+	toBackend, err := transport.New(transport.ToBackend)
 	if err != nil {
 		panic(err)
 	}
 
-	back, err := backend.New(capsuleChan)
+	toFrontend, err := transport.New(transport.ToFrontend)
 	if err != nil {
 		panic(err)
 	}
@@ -58,11 +105,94 @@ func main() {
 	// Initiliazes a new WaitGroup.
 	wg := sync.WaitGroup{}
 
-	// Starts the nlp client listening loop.
-	wg.Add(1)
-	go front.Start(&wg)
-	wg.Add(1)
-	go back.Start(&wg)
+	var front *frontend.Frontend
+	if runFrontend {
+		// Initializes frontend manager
+		frontendOut := make(chan *capsule.Capsule)
+		go transport.Pump(frontendOut, toBackend)
+
+		front, err = frontend.New(frontendOut, toFrontend.Subscribe())
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	backendWg := sync.WaitGroup{}
+	schedulerWg := sync.WaitGroup{}
+	var back *backend.Backend
+	var backendOut chan *capsule.Capsule
+	var scheduler *backend.Scheduler
+	if runBackend {
+		backendOut = make(chan *capsule.Capsule)
+		go transport.Pump(backendOut, toFrontend)
+
+		// Initializes the scheduler sending the reminders.
+		scheduler, err = backend.NewScheduler(os.Getenv(schedulesFileEnv), backend.SystemClock{}, backendOut)
+		if err != nil {
+			panic(err)
+		}
+
+		// Registers the actions triggered by intents.
+		if err := backend.RegisterAction("get_time", backend.CurrentTime); err != nil {
+			panic(err)
+		}
+		if err := backend.RegisterAction("set_reminder", scheduler.Remind); err != nil {
+			panic(err)
+		}
+
+		// Registers the middlewares wrapping the capsules processing.
+		backend.RegisterMiddleware(backend.LoggingMiddleware)
+		backend.RegisterMiddleware(backend.MetricsMiddleware)
+
+		back, err = backend.New(toBackend.Subscribe(), backendOut)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// Starts the listening loops.
+	if front != nil {
+		wg.Add(1)
+		go front.Start(&wg)
+	}
+	if back != nil {
+		backendWg.Add(1)
+		go back.Start(&backendWg)
+
+		schedulerWg.Add(1)
+		go scheduler.Start(&schedulerWg)
+	}
+
+	// Starts the admin API: the conversations of the backend and the
+	// maintenance mode of the frontend.
+	var admin *http.Server
+	if listen := os.Getenv(adminListenEnv); listen != "" {
+		mux := http.NewServeMux()
+		if back != nil {
+			mux.Handle("/", back.AdminHandler())
+		}
+		if front != nil {
+			mux.Handle("/maintenance", front.MaintenanceHandler())
+		}
+
+		admin = &http.Server{Addr: listen, Handler: mux}
+		go func() {
+			if err := admin.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.WithError(err).Error("Admin API stopped")
+			}
+		}()
+	}
+
+	// SIGUSR2 toggles the maintenance mode of the frontend.
+	if front != nil {
+		maintenance := make(chan os.Signal, 1)
+		signal.Notify(maintenance, syscall.SIGUSR2)
+		go func() {
+			for range maintenance {
+				front.SetMaintenance(!front.Maintenance())
+			}
+		}()
+	}
 
 	// Initializes channel which handles SIGTERM and SIGINT
 	quit := make(chan os.Signal)
@@ -71,10 +201,76 @@ func main() {
 	// Wait for a SIGTERM or SIGINT
 	<-quit
 
-	// Closes channel
-	close(capsuleChan)
+	if admin != nil {
+		admin.Close()
+	}
+
+	// Drains the messages in progress before closing the transports: the
+	// frontend stops sending the user messages to the backend and waits for
+	// the responses of the messages already sent, then the backend finishes
+	// the capsules it received. Each phase has its own deadline, so a slow
+	// frontend does not leave the backend without time. What remains at the
+	// deadline is aborted.
+	if front != nil {
+		drain, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		if err := front.Drain(drain); err != nil {
+			log.WithError(err).Warn("Frontend not drained")
+		}
+		cancel()
+	}
+	if back != nil {
+		drain, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		if err := back.Drain(drain); err != nil {
+			log.WithError(err).Warn("Backend not drained")
+		}
+		cancel()
+	}
+
+	// Closes the transports. The backend is stopped first so it does not send
+	// responses to a stopped frontend.
+	toBackend.Close()
+	backendWg.Wait()
+	if scheduler != nil {
+		scheduler.Stop()
+		schedulerWg.Wait()
+	}
+	if backendOut != nil {
+		close(backendOut)
+	}
+	toFrontend.Close()
 	wg.Wait()
 
+	errs := []error{}
+	if back != nil {
+		errs = append(errs, back.ShutdownError())
+	}
+	if front != nil {
+		errs = append(errs, front.ShutdownError())
+	}
+
+	shutdown(os.Exit, errs...)
+}
+
+// shutdown logs the outcome of the shutdown and exits with the given exit
+// function: the exit code is zero when every error is nil, and one otherwise
+// so the orchestration tools detect the unclean shutdowns.
+func shutdown(exit func(int), errs ...error) {
+	failures := 0
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		failures++
+		log.WithError(err).Error("Provider failed to stop")
+	}
+
+	if failures > 0 {
+		log.Errorf("Unclean shutdown: %d failures", failures)
+		exit(1)
+		return
+	}
+
 	log.Info("Graceful shutdown")
-	os.Exit(0)
+	exit(0)
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestShutdownExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		errs []error
+		code int
+	}{
+		{"clean", []error{nil, nil}, 0},
+		{"no component", nil, 0},
+		{"failing provider", []error{nil, errors.New("stopping frontend: provider telegram: timeout")}, 1},
+		{"every component failing", []error{errors.New("backend"), errors.New("frontend")}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := -1
+			shutdown(func(c int) { code = c }, tt.errs...)
+
+			if code != tt.code {
+				t.Errorf("exit code = %d, want %d", code, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/juju/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type (
+	// MissingError is the error returned when the configuration file does not
+	// exist, so the callers can tell it from an invalid file.
+	MissingError struct {
+		// Path is the path of the missing file.
+		Path string
+	}
+)
+
+const (
+	// tomlListKey is the key of the array of tables containing the list of a
+	// TOML file, since the root of a TOML document is always a table.
+	tomlListKey = "items"
+)
+
+// Decode reads the configuration file at the given path and unmarshals it in
+// v. The format is detected from the file extension: .yaml, .yml, .json or
+// .toml. A list is read in TOML from the array of tables named items.
+func Decode(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &MissingError{Path: path}
+	}
+	if err != nil {
+		return errors.Annotate(err, "cannot read config file")
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, v)
+	case ".json":
+		err = json.Unmarshal(data, v)
+	case ".toml":
+		err = decodeTOML(data, v)
+	default:
+		return errors.NotSupportedf("config file extension %q of %s", ext, path)
+	}
+
+	if err != nil {
+		return errors.Annotate(err, "cannot unmarshal config file")
+	}
+
+	return nil
+}
+
+// Error returns the error message.
+func (e *MissingError) Error() string {
+	return fmt.Sprintf("no config file found at %s", e.Path)
+}
+
+// IsMissing reports whether the cause of the error is a missing configuration
+// file.
+func IsMissing(err error) bool {
+	_, ok := errors.Cause(err).(*MissingError)
+	return ok
+}
+
+// decodeTOML unmarshals the TOML data in v. When v points to a slice, the
+// slice is read from the items array of tables.
+func decodeTOML(data []byte, v interface{}) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Slice {
+		_, err := toml.NewDecoder(bytes.NewReader(data)).Decode(v)
+		return err
+	}
+
+	wrapper := reflect.New(reflect.StructOf([]reflect.StructField{{
+		Name: "Items",
+		Type: value.Elem().Type(),
+		Tag:  reflect.StructTag(`toml:"` + tomlListKey + `"`),
+	}}))
+
+	if _, err := toml.NewDecoder(bytes.NewReader(data)).Decode(wrapper.Interface()); err != nil {
+		return err
+	}
+
+	value.Elem().Set(wrapper.Elem().Field(0))
+	return nil
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type (
+	// testProvider is a configuration shaped like the provider configurations.
+	testProvider struct {
+		Label    string            `json:"label" yaml:"label"`
+		Users    []string          `json:"users" yaml:"users"`
+		Limit    int               `json:"limit" yaml:"limit"`
+		Enabled  bool              `json:"enabled" yaml:"enabled"`
+		Prefixes map[string]string `json:"prefixes" yaml:"prefixes"`
+	}
+)
+
+var (
+	// providersFiles contains the same list of providers in each format.
+	providersFiles = map[string]string{
+		"providers.yaml": `
+- label: telegram
+  users: [alice, bob]
+  limit: 10
+  enabled: true
+  prefixes:
+    llm: openai
+- label: webhook
+`,
+		"providers.json": `[
+  {"label": "telegram", "users": ["alice", "bob"], "limit": 10, "enabled": true, "prefixes": {"llm": "openai"}},
+  {"label": "webhook"}
+]`,
+		"providers.toml": `
+[[items]]
+label = "telegram"
+users = ["alice", "bob"]
+limit = 10
+enabled = true
+
+[items.prefixes]
+llm = "openai"
+
+[[items]]
+label = "webhook"
+`,
+	}
+)
+
+// write writes the file in a temporary directory and returns its path.
+func write(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestDecode(t *testing.T) {
+	want := []*testProvider{
+		{Label: "telegram", Users: []string{"alice", "bob"}, Limit: 10, Enabled: true, Prefixes: map[string]string{"llm": "openai"}},
+		{Label: "webhook"},
+	}
+
+	for name, content := range providersFiles {
+		t.Run(name, func(t *testing.T) {
+			got := []*testProvider{}
+			if err := Decode(write(t, name, content), &got); err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("providers = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeStruct(t *testing.T) {
+	files := map[string]string{
+		"config.yml":  "label: watson\nlimit: 3\n",
+		"config.json": `{"label": "watson", "limit": 3}`,
+		"config.toml": "label = \"watson\"\nlimit = 3\n",
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			got := &testProvider{}
+			if err := Decode(write(t, name, content), got); err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			if want := (&testProvider{Label: "watson", Limit: 3}); !reflect.DeepEqual(got, want) {
+				t.Errorf("config = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	t.Run("unknown extension", func(t *testing.T) {
+		err := Decode(write(t, "config.ini", "label=watson"), &testProvider{})
+		if err == nil || IsMissing(err) {
+			t.Errorf("Decode() error = %v, want an unsupported extension", err)
+		}
+	})
+
+	t.Run("invalid content", func(t *testing.T) {
+		err := Decode(write(t, "config.json", "{"), &testProvider{})
+		if err == nil || IsMissing(err) {
+			t.Errorf("Decode() error = %v, want an unmarshaling error", err)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		err := Decode(filepath.Join(t.TempDir(), "config.yaml"), &testProvider{})
+		if !IsMissing(err) {
+			t.Errorf("Decode() error = %v, want a missing file", err)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/juju/errors"
+)
+
+type (
+	// Sink stores the capsules which could not be processed or delivered
+	// after all the attempts, so they can be inspected or replayed later.
+	Sink interface {
+		// Store stores the failed capsule.
+		Store(entry *Entry) error
+	}
+
+	// Entry is a capsule whose processing or delivery failed.
+	Entry struct {
+		// Capsule is the failed capsule.
+		Capsule *capsule.Capsule `json:"capsule"`
+
+		// Error is the error message of the last attempt.
+		Error string `json:"error"`
+
+		// Attempts is the number of attempts made.
+		Attempts int `json:"attempts"`
+
+		// Time is the time of the last attempt.
+		Time time.Time `json:"time"`
+	}
+
+	// File appends the failed capsules to a file, as JSON lines.
+	File struct {
+		// path is the path of the file.
+		path string
+
+		// mutex serializes the writes.
+		mutex sync.Mutex
+	}
+
+	// Channel sends the failed capsules on a channel. The capsules are
+	// dropped when the channel is full.
+	Channel chan<- *Entry
+)
+
+// NewEntry returns the entry of the capsule which failed with the given error
+// after the given number of attempts.
+func NewEntry(c *capsule.Capsule, err error, attempts int) *Entry {
+	return &Entry{
+		Capsule:  c,
+		Error:    err.Error(),
+		Attempts: attempts,
+		Time:     time.Now(),
+	}
+}
+
+// NewFile initializes a sink appending the failed capsules to the file at the
+// given path. The file is created if needed.
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// Store appends the failed capsule to the file.
+func (f *File) Store(entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Annotate(err, "storing dead letter")
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Annotate(err, "storing dead letter")
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return errors.Annotate(err, "storing dead letter")
+	}
+
+	return nil
+}
+
+// Store sends the failed capsule on the channel without blocking.
+func (c Channel) Store(entry *Entry) error {
+	select {
+	case c <- entry:
+		return nil
+	default:
+		return errors.New("dead letter channel is full")
+	}
+}
@@ -0,0 +1,69 @@
+package deadletter
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/google/uuid"
+)
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deadletter.jsonl")
+	sink := NewFile(path)
+
+	for _, user := range []string{"alice", "bob"} {
+		c := &capsule.Capsule{OriginalMessage: uuid.New(), User: user, Content: "hello"}
+		if err := sink.Store(NewEntry(c, errors.New("provider unavailable"), 3)); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	users := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := &Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			t.Fatalf("line %s: %v", scanner.Text(), err)
+		}
+
+		if entry.Error != "provider unavailable" || entry.Attempts != 3 || entry.Time.IsZero() {
+			t.Errorf("entry = %+v, want the error and the attempts", entry)
+		}
+
+		users = append(users, entry.Capsule.User)
+	}
+
+	if strings.Join(users, ",") != "alice,bob" {
+		t.Errorf("stored users = %v, want alice and bob", users)
+	}
+}
+
+func TestChannel(t *testing.T) {
+	entries := make(chan *Entry, 1)
+	sink := Channel(entries)
+	entry := NewEntry(&capsule.Capsule{OriginalMessage: uuid.New()}, errors.New("failed"), 1)
+
+	if err := sink.Store(entry); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	if err := sink.Store(entry); err == nil {
+		t.Error("expected an error when the channel is full")
+	}
+
+	if stored := <-entries; stored != entry {
+		t.Errorf("entry = %+v, want the stored entry", stored)
+	}
+}
@@ -0,0 +1,185 @@
+package frontend
+
+import (
+	"strings"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/juju/errors"
+)
+
+type (
+	// command handles a user command instead of sending it to the backend as a
+	// regular message.
+	command func(f *Frontend, userInput *provider.CapsuleProvider) error
+)
+
+const (
+	// defaultCommandPrefix is the default prefix of the user commands.
+	defaultCommandPrefix = "/"
+
+	// defaultLLMBackend is the default label of the backend provider
+	// processing the messages of the llm command.
+	defaultLLMBackend = "openai"
+)
+
+var (
+	// commands indexes the user commands by name, without prefix.
+	commands = map[string]command{
+		"reset":    resetCommand,
+		"repeat":   repeatCommand,
+		"forgetme": forgetCommand,
+		"selftest": selfTestCommand,
+		"summary":  summaryCommand,
+		"llm":      llmCommand,
+	}
+)
+
+// loadCommandPrefixes returns the command prefixes of the activated providers
+// indexed by provider label.
+func loadCommandPrefixes(providerConfig []*ProviderConfig) map[string]string {
+	prefixes := map[string]string{}
+	for _, pc := range providerConfig {
+		if pc.IsActivated && len(pc.CommandPrefix) > 0 {
+			prefixes[pc.Label] = pc.CommandPrefix
+		}
+	}
+
+	return prefixes
+}
+
+// loadLLMBackends returns the backend providers of the llm command of the
+// activated providers indexed by provider label.
+func loadLLMBackends(providerConfig []*ProviderConfig) map[string]string {
+	backends := map[string]string{}
+	for _, pc := range providerConfig {
+		if pc.IsActivated && len(pc.LLMBackend) > 0 {
+			backends[pc.Label] = pc.LLMBackend
+		}
+	}
+
+	return backends
+}
+
+// findCommand returns the command corresponding to the first word of the
+// given content. Commands are only recognized at the start of a message, with
+// the command prefix of the provider.
+func (f *Frontend) findCommand(providerLabel, content string) (command, bool) {
+	prefix, ok := f.commandPrefixes[providerLabel]
+	if !ok {
+		prefix = defaultCommandPrefix
+	}
+
+	fields := strings.Fields(content)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], prefix) {
+		return nil, false
+	}
+
+	c, ok := commands[strings.TrimPrefix(fields[0], prefix)]
+	return c, ok
+}
+
+// resetCommand sends a control capsule asking the backend to reset the
+// conversation of the user.
+func resetCommand(f *Frontend, userInput *provider.CapsuleProvider) error {
+	c := toCapsule(userInput)
+	c.Control = capsule.ControlReset
+	f.submit(c)
+	return nil
+}
+
+// repeatCommand asks the provider of the user to send its last answer again.
+// The providers which do not keep the answers respond that there is nothing
+// to repeat.
+func repeatCommand(f *Frontend, userInput *provider.CapsuleProvider) error {
+	for _, p := range f.activatedProviders {
+		if p.GetLabel() != userInput.ProviderLabel {
+			continue
+		}
+
+		if repeater, ok := p.(provider.Repeater); ok {
+			return repeater.Repeat(userInput.OriginalMessage)
+		}
+
+		c := toCapsule(userInput)
+		c.Responses = []string{provider.SystemLog("Nothing to repeat", provider.Info)}
+		return p.Message(c)
+	}
+
+	return errors.NotFoundf("frontend provider %s", userInput.ProviderLabel)
+}
+
+// forgetCommand deletes the data of the user on request. The provider of the
+// user deletes its pending messages, its answer history and its delivery
+// state, the frontend ends its escalation cooldown, and a control capsule asks
+// the backend to delete its sessions and escalation counters. The backend
+// confirms the deletion. The logs, the authorized users configuration and the
+// data kept by the chat platform itself are not deleted.
+func forgetCommand(f *Frontend, userInput *provider.CapsuleProvider) error {
+	for _, p := range f.activatedProviders {
+		if p.GetLabel() != userInput.ProviderLabel {
+			continue
+		}
+
+		if forgetter, ok := p.(provider.Forgetter); ok {
+			if err := forgetter.Forget(userInput.OriginalMessage); err != nil {
+				return errors.Annotate(err, "deleting user data")
+			}
+		}
+	}
+
+	delete(f.escalations, userInput.ProviderLabel+"/"+userInput.User)
+
+	c := toCapsule(userInput)
+	c.Control = capsule.ControlForget
+	f.submit(c)
+	return nil
+}
+
+// summaryCommand asks the backend for a summary of the recent conversation of
+// the user given as argument (ex: /summary alice). The user is looked up on
+// the provider of the operator, unless it is given as provider/user. It is
+// restricted to the operator users.
+func summaryCommand(f *Frontend, userInput *provider.CapsuleProvider) error {
+	if !f.isOperator(userInput) {
+		return f.reply(userInput, provider.SystemLog("This command is restricted to operators", provider.ErrorStatus))
+	}
+
+	fields := strings.Fields(userInput.Content)
+	if len(fields) != 2 {
+		return f.reply(userInput, provider.SystemLog("Usage: summary <user>", provider.Info))
+	}
+
+	user := fields[1]
+	if !strings.Contains(user, "/") {
+		user = userInput.ProviderLabel + "/" + user
+	}
+
+	c := toCapsule(userInput)
+	c.Control = capsule.ControlSummary
+	c.Content = user
+	f.submit(c)
+	return nil
+}
+
+// llmCommand sends the message following the command to the LLM backend
+// provider (ex: /llm write a haiku) instead of the default backend provider.
+// The backend answers with an error when the LLM backend provider is not
+// activated.
+func llmCommand(f *Frontend, userInput *provider.CapsuleProvider) error {
+	fields := strings.Fields(userInput.Content)
+	text := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(userInput.Content), fields[0]))
+	if len(text) == 0 {
+		return f.reply(userInput, provider.SystemLog("Usage: llm <message>", provider.Info))
+	}
+
+	backend, ok := f.llmBackends[userInput.ProviderLabel]
+	if !ok {
+		backend = defaultLLMBackend
+	}
+
+	userInput.Content = text
+	userInput.BackendHint = backend
+	f.sendToBackend(userInput)
+	return nil
+}
@@ -0,0 +1,172 @@
+package frontend
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/google/uuid"
+)
+
+func TestForgetCommand(t *testing.T) {
+	f, _, toBackend, _ := newTestFrontend(newFakeProvider("fake"))
+	f.escalations["fake/alice"] = time.Now()
+	f.escalations["fake/bob"] = time.Now()
+
+	userInput := &provider.CapsuleProvider{OriginalMessage: uuid.New(), ProviderLabel: "fake", User: "alice", Content: "/forgetme"}
+	command, ok := f.findCommand(userInput.ProviderLabel, userInput.Content)
+	if !ok {
+		t.Fatal("command /forgetme not found")
+	}
+
+	if err := command(f, userInput); err != nil {
+		t.Fatalf("command error = %v", err)
+	}
+
+	// The backend is asked to delete the sessions of the user.
+	c := <-toBackend
+	if c.Control != capsule.ControlForget || c.OriginalMessage != userInput.OriginalMessage {
+		t.Errorf("capsule = %+v, want a forget control of the message", c)
+	}
+
+	if _, ok := f.escalations["fake/alice"]; ok {
+		t.Error("escalation cooldown of alice kept")
+	}
+
+	if _, ok := f.escalations["fake/bob"]; !ok {
+		t.Error("escalation cooldown of bob deleted")
+	}
+}
+
+func TestSummaryCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    string
+		content string
+		summary string
+		reply   string
+	}{
+		{"user of the provider", "alice", "/summary bob", "fake/bob", ""},
+		{"user of another provider", "alice", "/summary irc/bob", "irc/bob", ""},
+		{"without user", "alice", "/summary", "", "Usage: summary <user>"},
+		{"not an operator", "bob", "/summary alice", "", "restricted to operators"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newFakeProvider("fake")
+			f, _, toBackend, _ := newTestFrontend(p)
+			f.operatorUsers = loadOperatorUsers([]*ProviderConfig{{Label: "fake", IsActivated: true, OperatorUsers: []string{"alice"}}})
+
+			userInput := &provider.CapsuleProvider{OriginalMessage: uuid.New(), ProviderLabel: "fake", User: tt.user, Content: tt.content}
+			command, ok := f.findCommand(userInput.ProviderLabel, userInput.Content)
+			if !ok {
+				t.Fatal("command /summary not found")
+			}
+
+			if err := command(f, userInput); err != nil {
+				t.Fatalf("command error = %v", err)
+			}
+
+			if len(tt.summary) > 0 {
+				c := <-toBackend
+				if c.Control != capsule.ControlSummary || c.Content != tt.summary || c.User != tt.user {
+					t.Errorf("capsule = %+v, want a summary control of %s", c, tt.summary)
+				}
+				return
+			}
+
+			if len(toBackend) != 0 {
+				t.Errorf("capsules sent to the backend = %d, want none", len(toBackend))
+			}
+
+			if deliveries := p.deliveries(); len(deliveries) != 1 || !strings.Contains(deliveries[0].Responses[0], tt.reply) {
+				t.Errorf("deliveries = %+v, want the reply %q", deliveries, tt.reply)
+			}
+		})
+	}
+}
+
+func TestFindCommand(t *testing.T) {
+	f, _, _, _ := newTestFrontend(newFakeProvider("fake"), newFakeProvider("irc"))
+	f.commandPrefixes = loadCommandPrefixes([]*ProviderConfig{
+		{Label: "irc", IsActivated: true, CommandPrefix: "!"},
+		{Label: "fake", IsActivated: true},
+	})
+
+	tests := []struct {
+		name     string
+		provider string
+		content  string
+		found    bool
+	}{
+		{"default prefix", "fake", "/reset", true},
+		{"default prefix with arguments", "fake", "/reset now", true},
+		{"other prefix", "fake", "!reset", false},
+		{"configured prefix", "irc", "!reset", true},
+		{"default prefix of a configured provider", "irc", "/reset", false},
+		{"not at the start", "irc", "please !reset", false},
+		{"unknown command", "irc", "!unknown", false},
+		{"empty", "irc", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, found := f.findCommand(tt.provider, tt.content); found != tt.found {
+				t.Errorf("findCommand(%q, %q) found = %t, want %t", tt.provider, tt.content, found, tt.found)
+			}
+		})
+	}
+}
+
+func TestLLMCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *ProviderConfig
+		content string
+		backend string
+		text    string
+	}{
+		{"default backend", &ProviderConfig{Label: "fake", IsActivated: true}, "/llm write a haiku", "openai", "write a haiku"},
+		{"configured backend", &ProviderConfig{Label: "fake", IsActivated: true, LLMBackend: "claude"}, "/llm write\na haiku", "claude", "write\na haiku"},
+		{"configured prefix", &ProviderConfig{Label: "fake", IsActivated: true, CommandPrefix: "!"}, "!llm write a haiku", "openai", "write a haiku"},
+		{"without message", &ProviderConfig{Label: "fake", IsActivated: true}, "/llm  ", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newFakeProvider("fake")
+			f, _, toBackend, _ := newTestFrontend(p)
+			f.commandPrefixes = loadCommandPrefixes([]*ProviderConfig{tt.config})
+			f.llmBackends = loadLLMBackends([]*ProviderConfig{tt.config})
+
+			userInput := &provider.CapsuleProvider{OriginalMessage: uuid.New(), ProviderLabel: "fake", User: "alice", Content: tt.content}
+			command, ok := f.findCommand(userInput.ProviderLabel, userInput.Content)
+			if !ok {
+				t.Fatalf("command %q not found", tt.content)
+			}
+
+			if err := command(f, userInput); err != nil {
+				t.Fatalf("command error = %v", err)
+			}
+
+			if len(tt.backend) > 0 {
+				c := <-toBackend
+				if c.BackendHint != tt.backend || c.Content != tt.text {
+					t.Errorf("capsule = %+v, want %q hinted to %s", c, tt.text, tt.backend)
+				}
+				return
+			}
+
+			if len(toBackend) != 0 {
+				t.Errorf("capsules sent to the backend = %d, want none", len(toBackend))
+			}
+
+			if deliveries := p.deliveries(); len(deliveries) != 1 || !strings.Contains(deliveries[0].Responses[0], "Usage: llm <message>") {
+				t.Errorf("deliveries = %+v, want the usage", deliveries)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package frontend
+
+import (
+	"expvar"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/deadletter"
+	"github.com/juju/errors"
+)
+
+type (
+	// delivery is a capsule whose delivery is retried.
+	delivery struct {
+		// capsule is the capsule to deliver.
+		capsule *capsule.Capsule
+
+		// attempt is the number of the next attempt.
+		attempt int
+	}
+)
+
+const (
+	// deliveryAttempts is the name of the environment variable containing
+	// the number of attempts to deliver a capsule to the user. It defaults to
+	// 1: the failed deliveries are not retried.
+	deliveryAttempts = "FRONTEND_DELIVERY_ATTEMPTS"
+
+	// deliveryRetryDelay is the name of the environment variable containing
+	// the delay before the first retry of a delivery (ex: 2s). It doubles
+	// after each attempt.
+	deliveryRetryDelay = "FRONTEND_DELIVERY_RETRY_DELAY"
+
+	// deadLetterFile is the name of the environment variable containing the
+	// path of the file to which the undelivered capsules are appended. They
+	// are discarded when it is empty.
+	deadLetterFile = "FRONTEND_DEAD_LETTER_FILE"
+
+	// defaultDeliveryAttempts is the default number of attempts to deliver a
+	// capsule.
+	defaultDeliveryAttempts = 1
+
+	// defaultDeliveryRetryDelay is the default delay before the first retry
+	// of a delivery.
+	defaultDeliveryRetryDelay = time.Second
+
+	// retryBufferSize is the size of the buffer of the deliveries to retry.
+	retryBufferSize = 64
+)
+
+var (
+	// deadLetterMetric counts the capsules stored in the dead letter.
+	deadLetterMetric = expvar.NewInt("frontendDeadLetters")
+)
+
+// SetDeadLetter replaces the dead letter of the frontend. A nil dead letter
+// discards the undelivered capsules. It must be called before Start.
+func (f *Frontend) SetDeadLetter(deadLetter deadletter.Sink) {
+	f.deadLetter = deadLetter
+}
+
+// loadDeliveryAttempts returns the number of attempts to deliver a capsule
+// defined in a environment variable.
+func loadDeliveryAttempts() (int, error) {
+	value := os.Getenv(deliveryAttempts)
+	if value == "" {
+		return defaultDeliveryAttempts, nil
+	}
+
+	attempts, err := strconv.Atoi(value)
+	if err != nil || attempts < 1 {
+		return 0, errors.NotValidf("%s %q", deliveryAttempts, value)
+	}
+
+	return attempts, nil
+}
+
+// loadDeliveryRetryDelay returns the delay before the first retry of a
+// delivery defined in a environment variable.
+func loadDeliveryRetryDelay() (time.Duration, error) {
+	value := os.Getenv(deliveryRetryDelay)
+	if value == "" {
+		return defaultDeliveryRetryDelay, nil
+	}
+
+	delay, err := time.ParseDuration(value)
+	if err != nil || delay <= 0 {
+		return 0, errors.NotValidf("%s %q", deliveryRetryDelay, value)
+	}
+
+	return delay, nil
+}
+
+// retryDelivery schedules the next attempt of a failed delivery, after a
+// delay doubling with each attempt. Only the delivery is retried: the
+// backend does not process the capsule again. The capsule is stored in the
+// dead letter once the attempts are exhausted, or when the delivery cannot
+// succeed (ex: the provider lost the original message).
+func (f *Frontend) retryDelivery(c *capsule.Capsule, attempt int, err error) {
+	if attempt >= f.deliveryAttempts || !retryableDelivery(err) {
+		logger.WithError(err).WithField("attempts", attempt).Errorf("Cannot deliver capsule %s", c.OriginalMessage)
+		f.storeDeadLetter(c, err, attempt)
+		return
+	}
+
+	logger.WithError(err).Debugf("Retrying delivery of capsule %s", c.OriginalMessage)
+	time.AfterFunc(f.deliveryRetryDelay<<uint(attempt-1), func() {
+		select {
+		case f.retries <- &delivery{capsule: c, attempt: attempt + 1}:
+		default:
+			logger.Errorf("Cannot retry delivery of capsule %s: too many retries", c.OriginalMessage)
+			f.storeDeadLetter(c, err, attempt)
+		}
+	})
+}
+
+// retryableDelivery verifies if the delivery failing with the given error can
+// be attempted again. The deliveries to an unknown provider or message fail
+// the same way on each attempt.
+func retryableDelivery(err error) bool {
+	return !errors.IsNotFound(err) && !errors.IsNotProvisioned(err) &&
+		!errors.IsNotValid(err) && !errors.IsNotSupported(err)
+}
+
+// storeDeadLetter stores the undelivered capsule in the dead letter, if any.
+// The capsule is no longer pending in the outbound queue nor outstanding for
+// the drain.
+func (f *Frontend) storeDeadLetter(c *capsule.Capsule, err error, attempts int) {
+	f.settle(c.OriginalMessage)
+
+	if f.queue != nil {
+		if err := f.queue.done(c); err != nil {
+			logger.WithError(err).Warn("Cannot remove undelivered capsule from outbound queue")
+		}
+	}
+
+	if f.deadLetter == nil {
+		return
+	}
+
+	if err := f.deadLetter.Store(deadletter.NewEntry(c, err, attempts)); err != nil {
+		logger.WithError(err).Error("Cannot store dead letter")
+		return
+	}
+
+	deadLetterMetric.Add(1)
+}
@@ -0,0 +1,135 @@
+package frontend
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+)
+
+// failingProvider returns a fake provider failing the first deliveries with
+// the given error, and the function returning the number of attempts.
+func failingProvider(failures int, err error) (*fakeProvider, func() int) {
+	mutex := sync.Mutex{}
+	attempts := 0
+
+	p := newFakeProvider("fake")
+	p.fail = func(c *capsule.Capsule) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		attempts++
+		if failures < 0 || attempts <= failures {
+			return err
+		}
+
+		return nil
+	}
+
+	return p, func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		return attempts
+	}
+}
+
+// deliver sends a response to the frontend with the given number of delivery
+// attempts, and waits until the condition is true.
+func deliver(t *testing.T, p *fakeProvider, attempts int, deadLetter *memoryDeadLetter, condition func() bool) chan *capsule.Capsule {
+	t.Helper()
+
+	f, userInput, toBackend, toFrontend := newTestFrontend(p)
+	f.deliveryAttempts = attempts
+	f.deliveryRetryDelay = time.Millisecond
+	f.deadLetter = deadLetter
+	done := startFrontend(f)
+	t.Cleanup(func() {
+		close(userInput)
+		<-done
+	})
+
+	toFrontend <- &capsule.Capsule{OriginalMessage: uuid.New(), FrontendProvider: "fake", User: "alice", Responses: []string{"Hello alice"}}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	return toBackend
+}
+
+func TestDeliveryRetry(t *testing.T) {
+	p, attempts := failingProvider(2, errors.New("network unreachable"))
+	deadLetter := &memoryDeadLetter{}
+	toBackend := deliver(t, p, 3, deadLetter, func() bool { return len(p.deliveries()) == 1 })
+
+	if n := attempts(); n != 3 {
+		t.Errorf("attempts = %d, want 3", n)
+	}
+
+	// Only the delivery is retried: the backend does not process the capsule
+	// again.
+	if len(toBackend) != 0 {
+		t.Errorf("capsules sent to the backend = %d, want none", len(toBackend))
+	}
+
+	if stored := deadLetter.stored(); stored != 0 {
+		t.Errorf("%d dead letters, want none", stored)
+	}
+}
+
+func TestDeliveryDeadLetter(t *testing.T) {
+	p, attempts := failingProvider(-1, errors.New("network unreachable"))
+	deadLetter := &memoryDeadLetter{}
+	deliver(t, p, 3, deadLetter, func() bool { return deadLetter.stored() == 1 })
+
+	if n := attempts(); n != 3 {
+		t.Errorf("attempts = %d, want 3", n)
+	}
+
+	deadLetter.mutex.Lock()
+	defer deadLetter.mutex.Unlock()
+	if entry := deadLetter.entries[0]; entry.Attempts != 3 || entry.Error != "network unreachable" {
+		t.Errorf("dead letter = %+v, want the capsule after 3 attempts", entry)
+	}
+}
+
+func TestDeliveryNotRetryable(t *testing.T) {
+	p, attempts := failingProvider(-1, errors.NotFoundf("message"))
+	deadLetter := &memoryDeadLetter{}
+	deliver(t, p, 3, deadLetter, func() bool { return deadLetter.stored() == 1 })
+
+	if n := attempts(); n != 1 {
+		t.Errorf("attempts = %d, want 1 for a lost message", n)
+	}
+}
+
+func TestLoadDeliveryAttempts(t *testing.T) {
+	tests := []struct {
+		value    string
+		attempts int
+		valid    bool
+	}{
+		{"", defaultDeliveryAttempts, true},
+		{"3", 3, true},
+		{"0", 0, false},
+		{"many", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Setenv(deliveryAttempts, tt.value)
+
+		attempts, err := loadDeliveryAttempts()
+		if (err == nil) != tt.valid || attempts != tt.attempts {
+			t.Errorf("%q: attempts = %d, error = %v", tt.value, attempts, err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package frontend
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/google/uuid"
+)
+
+const (
+	// drainPollInterval is the interval at which Drain verifies if responses
+	// are still outstanding.
+	drainPollInterval = 100 * time.Millisecond
+)
+
+// Drain stops accepting the user messages and waits until the responses of the
+// messages sent to the backend have been delivered, including the streamed
+// responses and the deliveries to retry, or until the context is done. The
+// user messages received meanwhile are answered with the maintenance notice
+// of their provider. It returns the error of the context if responses are
+// still outstanding, which are then lost on shutdown.
+func (f *Frontend) Drain(ctx context.Context) error {
+	atomic.StoreInt32(&f.draining, 1)
+	logger.Info("Draining frontend")
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		outstanding := f.outstandingCount()
+		if outstanding == 0 {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			logger.Warnf("Frontend drained with %d outstanding responses", outstanding)
+			return ctx.Err()
+		}
+	}
+}
+
+// Draining returns true once Drain has been called.
+func (f *Frontend) Draining() bool {
+	return atomic.LoadInt32(&f.draining) == 1
+}
+
+// submit sends the capsule to the backend. Its response is outstanding until
+// it is received.
+func (f *Frontend) submit(c *capsule.Capsule) {
+	f.outstandingMutex.Lock()
+	f.outstanding[c.OriginalMessage] = true
+	f.outstandingMutex.Unlock()
+
+	f.toBackend <- c
+}
+
+// settle marks the response of the given original message as delivered, or
+// given up.
+func (f *Frontend) settle(originalMessage uuid.UUID) {
+	f.outstandingMutex.Lock()
+	delete(f.outstanding, originalMessage)
+	f.outstandingMutex.Unlock()
+}
+
+// outstandingCount returns the number of messages sent to the backend whose
+// response has not been delivered yet.
+func (f *Frontend) outstandingCount() int {
+	f.outstandingMutex.Lock()
+	defer f.outstandingMutex.Unlock()
+
+	return len(f.outstanding)
+}
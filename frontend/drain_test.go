@@ -0,0 +1,157 @@
+package frontend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+)
+
+// drainSubmitted submits a message of alice to the backend, then starts the
+// drain of the frontend. It returns the capsule received by the backend, the
+// channel of the responses and the channel receiving the result of Drain.
+func drainSubmitted(t *testing.T, f *Frontend, userInput chan *provider.CapsuleProvider, toBackend chan *capsule.Capsule) (*capsule.Capsule, <-chan error) {
+	t.Helper()
+
+	done := startFrontend(f)
+	t.Cleanup(func() {
+		close(userInput)
+		<-done
+	})
+
+	userInput <- &provider.CapsuleProvider{OriginalMessage: uuid.New(), ProviderLabel: "fake", User: "alice", Content: "hello"}
+
+	var submitted *capsule.Capsule
+	select {
+	case submitted = <-toBackend:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no capsule sent to the backend")
+	}
+
+	drained := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		drained <- f.Drain(ctx)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !f.Draining() {
+		if time.Now().After(deadline) {
+			t.Fatal("drain not started")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	return submitted, drained
+}
+
+// notDrained verifies that the drain is still waiting.
+func notDrained(t *testing.T, drained <-chan error) {
+	t.Helper()
+
+	select {
+	case err := <-drained:
+		t.Fatalf("Drain() returned %v with an outstanding response", err)
+	case <-time.After(2 * drainPollInterval):
+	}
+}
+
+// waitDrained waits for the end of the drain.
+func waitDrained(t *testing.T, drained <-chan error) {
+	t.Helper()
+
+	select {
+	case err := <-drained:
+		if err != nil {
+			t.Fatalf("Drain() error = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("frontend not drained")
+	}
+}
+
+func TestDrainAnswersSubmitted(t *testing.T) {
+	p := newFakeProvider("fake")
+	f, userInput, toBackend, toFrontend := newTestFrontend(p)
+	f.maintenanceNotices["fake"] = defaultMaintenanceNotice
+	submitted, drained := drainSubmitted(t, f, userInput, toBackend)
+
+	// The messages received during the drain are no longer sent to the
+	// backend.
+	userInput <- &provider.CapsuleProvider{OriginalMessage: uuid.New(), ProviderLabel: "fake", User: "bob", Content: "hello"}
+	notDrained(t, drained)
+	if len(toBackend) != 0 {
+		t.Fatalf("capsules sent to the backend = %d, want none during the drain", len(toBackend))
+	}
+
+	submitted.Responses = []string{"Hello alice"}
+	toFrontend <- submitted
+	waitDrained(t, drained)
+
+	deliveries := p.deliveries()
+	if len(deliveries) != 2 || deliveries[0].Responses[0] != defaultMaintenanceNotice || deliveries[1].Responses[0] != "Hello alice" {
+		t.Errorf("deliveries = %+v, want the maintenance notice then the response of alice", deliveries)
+	}
+}
+
+func TestDrainRetriedDelivery(t *testing.T) {
+	p, attempts := failingProvider(1, errors.New("network unreachable"))
+	f, userInput, toBackend, toFrontend := newTestFrontend(p)
+	f.deliveryAttempts = 2
+	f.deliveryRetryDelay = 3 * drainPollInterval
+	submitted, drained := drainSubmitted(t, f, userInput, toBackend)
+
+	submitted.Responses = []string{"Hello alice"}
+	toFrontend <- submitted
+	notDrained(t, drained)
+
+	waitDrained(t, drained)
+	if n := attempts(); n != 2 || len(p.deliveries()) != 1 {
+		t.Errorf("%d attempts and deliveries %+v, want the retried delivery before the end of the drain", n, p.deliveries())
+	}
+}
+
+func TestDrainStreamedDelivery(t *testing.T) {
+	p := newFakeProvider("fake")
+	f, userInput, toBackend, toFrontend := newTestFrontend(p)
+	submitted, drained := drainSubmitted(t, f, userInput, toBackend)
+
+	stream := make(chan string, 2)
+	submitted.Stream = stream
+	toFrontend <- submitted
+	stream <- "Hello "
+	notDrained(t, drained)
+
+	stream <- "alice"
+	close(stream)
+	waitDrained(t, drained)
+
+	if deliveries := p.deliveries(); len(deliveries) != 1 || deliveries[0].Responses[0] != "Hello alice" {
+		t.Errorf("deliveries = %+v, want the streamed response", deliveries)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	f, userInput, toBackend, _ := newTestFrontend(newFakeProvider("fake"))
+	done := startFrontend(f)
+	defer func() {
+		close(userInput)
+		<-done
+	}()
+
+	userInput <- &provider.CapsuleProvider{OriginalMessage: uuid.New(), ProviderLabel: "fake", User: "alice", Content: "hello"}
+	<-toBackend
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := f.Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Drain() error = %v, want the deadline exceeded", err)
+	}
+}
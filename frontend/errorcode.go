@@ -0,0 +1,32 @@
+package frontend
+
+import (
+	"github.com/fberrez/samantha/capsule"
+	"github.com/juju/errors"
+)
+
+// errorNotices indexes by error code the notices sent to the users instead of
+// the errors of the backend. The temporary failures invite the user to retry,
+// the others are apologies. The errors without code are sent as is.
+var errorNotices = map[string]string{
+	capsule.ErrorRateLimit: "I'm receiving too many messages, please retry in a moment",
+	capsule.ErrorTimeout:   "I took too long to answer, please retry",
+	capsule.ErrorAuth:      "Sorry, I cannot answer right now",
+	capsule.ErrorUpstream:  "Sorry, I cannot answer right now",
+}
+
+// explainError replaces the error of the capsule by the notice of its code.
+// The original error is logged.
+func explainError(c *capsule.Capsule) {
+	if c.Error == nil {
+		return
+	}
+
+	notice, ok := errorNotices[c.ErrorCode]
+	if !ok {
+		return
+	}
+
+	logger.WithError(c.Error).WithField("code", c.ErrorCode).Warn("Backend error replaced by its notice")
+	c.Error = errors.New(notice)
+}
@@ -1,18 +1,29 @@
 package frontend
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/config"
+	"github.com/fberrez/samantha/deadletter"
 	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/fberrez/samantha/frontend/provider/line"
+	"github.com/fberrez/samantha/frontend/provider/messenger"
+	"github.com/fberrez/samantha/frontend/provider/reddit"
 	"github.com/fberrez/samantha/frontend/provider/telegram"
+	"github.com/fberrez/samantha/frontend/provider/twitter"
+	"github.com/fberrez/samantha/frontend/provider/wechat"
+	"github.com/fberrez/samantha/frontend/provider/xmpp"
+	"github.com/google/uuid"
 	"github.com/juju/errors"
 	log "github.com/sirupsen/logrus"
-	yaml "gopkg.in/yaml.v2"
 )
 
 type (
@@ -22,14 +33,139 @@ type (
 		// activatedProviders is a slice containing all activated frontend providers.
 		activatedProviders []provider.Provider
 
-		// userInput is a only-read channel which receives local capsules sent by
-		// the frontend providers.
-		userInput <-chan *provider.CapsuleProvider
+		// userInput is the channel which receives local capsules sent by the
+		// frontend providers. It is shared by the providers and owned by the
+		// frontend: the providers never close it.
+		userInput chan *provider.CapsuleProvider
 
-		capsule chan *capsule.Capsule
+		// toBackend is the channel on which the user capsules are sent to the
+		// backend.
+		toBackend chan<- *capsule.Capsule
+
+		// toFrontend is the channel receiving the capsules processed by the
+		// backend.
+		toFrontend <-chan *capsule.Capsule
+
+		// operators indexes the operators to notify on escalation by provider
+		// label.
+		operators map[string]*operator
+
+		// escalations indexes the end of the escalation cooldown by user. During
+		// the cooldown, the user messages are forwarded to the operator instead
+		// of the backend.
+		escalations map[string]time.Time
+
+		// quietHours indexes the quiet hours of the proactive messages by
+		// provider label.
+		quietHours map[string]*quietHours
+
+		// slowResponses indexes the interim messages sent when the backend is
+		// slow by provider label.
+		slowResponses map[string]*slowResponse
+
+		// waiting indexes by original message the timers of the capsules
+		// waiting for their response.
+		waiting map[uuid.UUID]*time.Timer
+
+		// maintenance is 1 when the maintenance mode is on. It is accessed
+		// atomically since it is toggled from other routines.
+		maintenance int32
+
+		// maintenanceNotices indexes the notices sent during the maintenance by
+		// provider label.
+		maintenanceNotices map[string]string
+
+		// draining is 1 once the drain started: the user messages are no
+		// longer sent to the backend. It is accessed atomically.
+		draining int32
+
+		// outstandingMutex protects the outstanding map, read by Drain.
+		outstandingMutex sync.Mutex
+
+		// outstanding indexes the original messages sent to the backend whose
+		// response has not been delivered yet.
+		outstanding map[uuid.UUID]bool
+
+		// commandPrefixes indexes the prefixes of the user commands by provider
+		// label. The providers without prefix use defaultCommandPrefix.
+		commandPrefixes map[string]string
+
+		// llmBackends indexes the backend providers of the llm command by
+		// provider label. The providers without backend use defaultLLMBackend.
+		llmBackends map[string]string
+
+		// slow receives the capsules whose response is late.
+		slow chan *capsule.Capsule
+
+		// spellCorrectors indexes the spell correctors of the messages by
+		// provider label and language.
+		spellCorrectors map[string]map[string]provider.SpellCorrector
+
+		// operatorUsers indexes by provider label the users allowed to run the
+		// operator commands.
+		operatorUsers map[string]map[string]bool
+
+		// selfTests indexes by original message the self-tests waiting for
+		// the response of the backend.
+		selfTests map[uuid.UUID]*selfTest
+
+		// expiredSelfTests receives the original messages of the self-tests
+		// which reached their timeout.
+		expiredSelfTests chan uuid.UUID
+
+		// deliveryAttempts is the number of attempts to deliver a capsule to
+		// the user.
+		deliveryAttempts int
+
+		// deliveryRetryDelay is the delay before the first retry of a
+		// delivery. It doubles after each attempt.
+		deliveryRetryDelay time.Duration
+
+		// retries receives the deliveries to attempt again.
+		retries chan *delivery
+
+		// deadLetter stores the capsules whose delivery failed. They are
+		// discarded when it is nil.
+		deadLetter deadletter.Sink
+
+		// held is a slice containing the proactive capsules held until the end
+		// of the quiet hours of their provider.
+		held []*capsule.Capsule
 
 		// wg is local wait group which handles all providers routines.
 		wg *sync.WaitGroup
+
+		// stopped indexes by provider label the channels closed when the
+		// provider routines return.
+		stopped map[string]chan struct{}
+
+		// shutdownTimeout is the maximum duration to wait for the providers
+		// routines to return on shutdown.
+		shutdownTimeout time.Duration
+
+		// ctx is the context of the capsules sent to the backend. It is canceled
+		// on shutdown to abort their processing.
+		ctx context.Context
+
+		// cancel cancels the frontend context.
+		cancel context.CancelFunc
+
+		// queue persists the outbound capsules until they are delivered. It is
+		// nil when the persistence is disabled.
+		queue *queue
+
+		// shutdownErr aggregates the failures of the shutdown. It is nil when
+		// the providers stopped cleanly.
+		shutdownErr error
+	}
+
+	// stopResult is the result of the Stop method of a provider.
+	stopResult struct {
+		// label is the label of the provider.
+		label string
+
+		// err is the error returned by Stop.
+		err error
 	}
 
 	// ProviderConfig is a structured provider configuration.
@@ -40,12 +176,242 @@ type (
 		// IsActivated defines if the provider is activated or not.
 		IsActivated bool `json:"isActivated" yaml:"isActivated"`
 
-		// Token is the API provider token
+		// Token is the API provider token. It is the client ID of the Reddit
+		// provider and the OAuth 2.0 user access token of the Twitter provider.
 		Token string `json:"token" yaml:"token"`
 
+		// Secret is the API provider secret. It is required by webhook-based
+		// providers such as LINE and Messenger. It is the password of the XMPP
+		// provider, the AppSecret of the WeChat provider, the client secret of
+		// the Reddit provider and the consumer secret of the Twitter provider.
+		Secret string `json:"secret" yaml:"secret"`
+
+		// Username is the account of the providers connecting to a server
+		// (ex: the JID of the XMPP provider, the AppID of the WeChat
+		// provider).
+		Username string `json:"username" yaml:"username"`
+
+		// Password is the password of the account of the providers which
+		// authenticate as a user (ex: the Reddit provider).
+		Password string `json:"password" yaml:"password"`
+
+		// Server is the address of the server the provider connects to
+		// (ex: xmpp.example.com:5222). It is optional.
+		Server string `json:"server" yaml:"server"`
+
+		// Listen is the address on which webhook-based providers listen
+		// (ex: ":8080").
+		Listen string `json:"listen" yaml:"listen"`
+
+		// TLSCertFile and TLSKeyFile are the paths of the TLS certificate and
+		// private key. Webhook-based providers serve HTTPS when they are set.
+		TLSCertFile string `json:"tlsCertFile" yaml:"tlsCertFile"`
+		TLSKeyFile  string `json:"tlsKeyFile" yaml:"tlsKeyFile"`
+
+		// WebhookSecret is the shared secret webhook-based providers expect in
+		// the X-Webhook-Secret header of the requests they receive. The
+		// Telegram provider sets it as the secret token of its webhook, sent
+		// in the X-Telegram-Bot-Api-Secret-Token header.
+		WebhookSecret string `json:"webhookSecret" yaml:"webhookSecret"`
+
+		// Mode is the way the provider receives the user messages, for the
+		// providers supporting several ways. The Telegram provider either
+		// fetches them by long polling (longpoll, the default) or receives
+		// them on its webhook server (webhook).
+		Mode string `json:"mode" yaml:"mode"`
+
+		// WebhookURL is the public URL of the webhook server in webhook mode
+		// (ex: https://bot.example.com/telegram). The server listens on
+		// Listen, and TLSCertFile is sent to Telegram so self-signed
+		// certificates are accepted. WebhookSecret is required in webhook
+		// mode.
+		WebhookURL string `json:"webhookURL" yaml:"webhookURL"`
+
+		// VerifyToken is the token webhook-based providers expect in the
+		// verification handshake of their subscription (ex: the
+		// hub.verify_token of the Messenger provider).
+		VerifyToken string `json:"verifyToken" yaml:"verifyToken"`
+
 		// AutorizedUsers is a slice containing all authorized users.
 		// These users are authorized to use the frontend provider.
 		AuthorizedUsers []*provider.User `json:"authorizedUsers" yaml:"authorizedUsers"`
+
+		// AuthorizedUsersFile is the path of the YAML file storing the
+		// authorized users. It replaces AuthorizedUsers, and keeps the users
+		// added or removed while running. It is ignored when a user store is
+		// registered with RegisterUserStore.
+		AuthorizedUsersFile string `json:"authorizedUsersFile" yaml:"authorizedUsersFile"`
+
+		// AllowAllUsers disables the authorization: anyone can use the provider,
+		// for instance for public demos. It defaults to false.
+		AllowAllUsers bool `json:"allowAllUsers" yaml:"allowAllUsers"`
+
+		// UnauthorizedMessage is sent once to each unauthorized user who writes
+		// to the bot (ex: "You're not authorized. Contact the admin."). The
+		// unauthorized users are silently ignored when it is empty.
+		UnauthorizedMessage string `json:"unauthorizedMessage" yaml:"unauthorizedMessage"`
+
+		// RateLimit is the maximum number of messages per minute of a user. The
+		// messages are not limited when it is zero.
+		RateLimit int `json:"rateLimit" yaml:"rateLimit"`
+
+		// RemoveUnreachableUsers is the number of consecutive delivery failures
+		// after which a user who blocked the bot is removed from the authorized
+		// users. Users are never removed when it is zero.
+		RemoveUnreachableUsers int `json:"removeUnreachableUsers" yaml:"removeUnreachableUsers"`
+
+		// AckReaction is the reaction set on user messages to acknowledge their
+		// receipt. It is optional.
+		AckReaction string `json:"ackReaction" yaml:"ackReaction"`
+
+		// MinMessageLength is the minimum length of a trimmed text message.
+		// Shorter messages are not forwarded to the backend. It defaults to 1.
+		MinMessageLength int `json:"minMessageLength" yaml:"minMessageLength"`
+
+		// MaxInputLength is the maximum length of a text message. Longer
+		// messages are truncated. The messages are not limited when it is zero.
+		MaxInputLength int `json:"maxInputLength" yaml:"maxInputLength"`
+
+		// RejectLongInput rejects the messages longer than MaxInputLength
+		// instead of truncating them.
+		RejectLongInput bool `json:"rejectLongInput" yaml:"rejectLongInput"`
+
+		// FormatCode enables the formatting of the responses looking like code
+		// (JSON, indented source code...) as code blocks.
+		FormatCode bool `json:"formatCode" yaml:"formatCode"`
+
+		// AllowedChatTypes is a slice containing the types of the chats in
+		// which the provider answers (Telegram: private, group, supergroup or
+		// channel), so the bot does not answer in any group it is added to.
+		AllowedChatTypes []string `json:"allowedChatTypes" yaml:"allowedChatTypes"`
+
+		// AllowedChatIDs is a slice containing the IDs of the chats in which
+		// the provider answers whatever their type (ex: a given group). The
+		// provider answers in every chat when both allowlists are empty.
+		AllowedChatIDs []int64 `json:"allowedChatIDs" yaml:"allowedChatIDs"`
+
+		// GroupMode enables the mention-gating in group chats: only the messages
+		// mentioning the bot or replying to it are processed.
+		GroupMode bool `json:"groupMode" yaml:"groupMode"`
+
+		// HandleChannelPosts enables the processing of the posts of the
+		// channels administered by the bot. The responses are posted in the
+		// channel.
+		HandleChannelPosts bool `json:"handleChannelPosts" yaml:"handleChannelPosts"`
+
+		// ChannelTrigger is the prefix of the channel posts processed by the
+		// bot. It defaults to the mention of the bot.
+		ChannelTrigger string `json:"channelTrigger" yaml:"channelTrigger"`
+
+		// CorrectEditedMessages handles the edited messages as corrections: the
+		// edited message is sent to the backend again, and replaces the
+		// original message if it has not been answered yet. The edits are
+		// ignored otherwise.
+		CorrectEditedMessages bool `json:"correctEditedMessages" yaml:"correctEditedMessages"`
+
+		// MaxFileSize is the maximum size in bytes of the files sent by users.
+		// Larger files are rejected. It defaults to 20MB, the download limit of
+		// the Telegram Bot API.
+		MaxFileSize int `json:"maxFileSize" yaml:"maxFileSize"`
+
+		// MaxResponseBubbles is the maximum number of responses sent for a
+		// message, so a long answer does not flood the user. The overflowing
+		// responses are joined in the last one. The responses are not limited
+		// when it is zero.
+		MaxResponseBubbles int `json:"maxResponseBubbles" yaml:"maxResponseBubbles"`
+
+		// SpellDictionaryFile is the path of the spelling dictionary of the
+		// provider, mapping the languages (ex: en) to the words of the domain.
+		// The words of the default key apply to every language. The typos of
+		// the messages are corrected before they are sent to the backend.
+		// The messages are not corrected when it is empty.
+		SpellDictionaryFile string `json:"spellDictionaryFile" yaml:"spellDictionaryFile"`
+
+		// ResponsePrefix is prepended to each response bubble, so the bots
+		// sharing a backend reply with their own persona (ex: "Sam: "). The
+		// responses are not prefixed when it is empty.
+		ResponsePrefix string `json:"responsePrefix" yaml:"responsePrefix"`
+
+		// CollectFeedback appends thumbs up and down buttons to the answers so
+		// the users can rate them.
+		CollectFeedback bool `json:"collectFeedback" yaml:"collectFeedback"`
+
+		// FeedbackFile is the path of the file to which the ratings are
+		// appended as JSON lines. The ratings are only counted in the metrics
+		// when it is empty.
+		FeedbackFile string `json:"feedbackFile" yaml:"feedbackFile"`
+
+		// LogLevel is the log level of the provider (ex: warning). It overrides
+		// the global level so a noisy provider can be quieted. The global level
+		// is used when it is empty.
+		LogLevel string `json:"logLevel" yaml:"logLevel"`
+
+		// LogSampling is the sampling rate of the logs of the received
+		// messages: one message out of LogSampling is logged. Every message is
+		// logged when it is lower than 2.
+		LogSampling int `json:"logSampling" yaml:"logSampling"`
+
+		// OperatorChat is the chat of the human operator notified when a
+		// conversation is escalated. Escalations are not forwarded when it is
+		// empty.
+		OperatorChat string `json:"operatorChat" yaml:"operatorChat"`
+
+		// EscalationCooldown is the duration during which the messages of an
+		// escalated user are forwarded to the operator. It defaults to 30m.
+		EscalationCooldown time.Duration `json:"escalationCooldown" yaml:"escalationCooldown"`
+
+		// QuietHours is the daily window during which the proactive messages
+		// are not sent. They are always sent when it is nil.
+		QuietHours *QuietHours `json:"quietHours" yaml:"quietHours"`
+
+		// SlowResponseThreshold is the duration after which an interim message
+		// is sent to the user when the backend has not answered yet. No interim
+		// message is sent when it is zero.
+		SlowResponseThreshold time.Duration `json:"slowResponseThreshold" yaml:"slowResponseThreshold"`
+
+		// SlowResponseMessage is the interim message. It defaults to "Still
+		// working on it…".
+		SlowResponseMessage string `json:"slowResponseMessage" yaml:"slowResponseMessage"`
+
+		// MaintenanceNotice is the notice answering the user messages during
+		// the maintenance. It defaults to "I am down for maintenance, please
+		// try again later.".
+		MaintenanceNotice string `json:"maintenanceNotice" yaml:"maintenanceNotice"`
+
+		// VoiceResponses sends the responses as voice messages too, to every
+		// user. It requires a synthesizer registered with RegisterSynthesizer.
+		VoiceResponses bool `json:"voiceResponses" yaml:"voiceResponses"`
+
+		// CommandPrefix is the prefix of the user commands (ex: !reset). It
+		// defaults to /. The commands are only recognized at the start of a
+		// message.
+		CommandPrefix string `json:"commandPrefix" yaml:"commandPrefix"`
+
+		// LLMBackend is the label of the backend provider processing the
+		// messages of the llm command (ex: /llm write a haiku). It defaults to
+		// openai.
+		LLMBackend string `json:"llmBackend" yaml:"llmBackend"`
+
+		// OperatorUsers are the users allowed to run the operator commands
+		// (ex: /selftest, /summary).
+		OperatorUsers []string `json:"operatorUsers" yaml:"operatorUsers"`
+	}
+
+	// InitializationError is the error returned when frontend providers failed
+	// to initialize.
+	InitializationError struct {
+		// Failures indexes the initialization errors by provider label.
+		Failures map[string]error
+	}
+
+	// operator is a human operator notified when a conversation is escalated.
+	operator struct {
+		// chat is the operator chat.
+		chat string
+
+		// cooldown is the duration during which the messages of an escalated
+		// user are forwarded to the operator.
+		cooldown time.Duration
 	}
 )
 
@@ -57,6 +423,37 @@ const (
 	// defaultConfigFilePath is the default path of the configuration file
 	// when the environment variable has not been initialized.
 	defaultConfigFilePath = "frontend/config.yaml"
+
+	// allowMissingConfig is the name of the environment variable allowing the
+	// frontend to start without configuration file, with no provider. It
+	// defaults to false.
+	allowMissingConfig = "FRONTEND_ALLOW_MISSING_CONFIG"
+
+	// inputBufferSize is the name of the environment variable containing the
+	// size of the user input buffer.
+	inputBufferSize = "FRONTEND_INPUT_BUFFER_SIZE"
+
+	// failFast is the name of the environment variable defining if the
+	// frontend fails when a provider cannot be initialized. When it is false,
+	// the failing providers are skipped. It defaults to true.
+	failFast = "FRONTEND_FAIL_FAST"
+
+	// queueFile is the name of the environment variable containing the path
+	// of the outbound queue log. The outbound capsules are not persisted when
+	// it is empty.
+	queueFile = "FRONTEND_QUEUE_FILE"
+
+	// defaultInputBufferSize is the default size of the user input buffer.
+	// When the buffer is full, the providers ask the users to retry instead of
+	// blocking their handlers.
+	defaultInputBufferSize = 64
+
+	// defaultEscalationCooldown is the default escalation cooldown.
+	defaultEscalationCooldown = 30 * time.Minute
+
+	// defaultShutdownTimeout is the default maximum duration to wait for the
+	// providers routines to return on shutdown.
+	defaultShutdownTimeout = 15 * time.Second
 )
 
 var (
@@ -65,12 +462,19 @@ var (
 
 	// providerCollection indexes all implemented providers.
 	providerCollection map[string]provider.Provider = map[string]provider.Provider{
-		"telegram": &telegram.Telegram{},
+		"telegram":  &telegram.Telegram{},
+		"line":      &line.Line{},
+		"xmpp":      &xmpp.XMPP{},
+		"wechat":    &wechat.WeChat{},
+		"reddit":    &reddit.Reddit{},
+		"messenger": &messenger.Messenger{},
+		"twitter":   &twitter.Twitter{},
 	}
 )
 
-// New initiliazes a new frontend providers manager.
-func New(capsuleChan chan *capsule.Capsule) (*Frontend, error) {
+// New initiliazes a new frontend providers manager. The user capsules are
+// sent on toBackend and the processed capsules are received on toFrontend.
+func New(toBackend chan<- *capsule.Capsule, toFrontend <-chan *capsule.Capsule) (*Frontend, error) {
 	// Loads a new structured configuration with the informations of a given
 	// configuration file.
 	providerConfig, err := loadConfig()
@@ -78,46 +482,189 @@ func New(capsuleChan chan *capsule.Capsule) (*Frontend, error) {
 		return nil, errors.Annotate(err, "initiliazing frontend")
 	}
 
-	// Initializes a userInput channel.
-	userInput := make(chan *provider.CapsuleProvider)
+	// Initializes a buffered userInput channel.
+	size, err := loadInputBufferSize()
+	if err != nil {
+		return nil, errors.Annotate(err, "initiliazing frontend")
+	}
 
-	// Loads frontend providers defined as activated.
-	providers, err := loadProvider(providerConfig, userInput)
+	userInput := make(chan *provider.CapsuleProvider, size)
+
+	// Registers the providers of the plugins before loading the activated
+	// providers, so the plugins can be activated in the configuration.
+	if dir := os.Getenv(pluginDir); dir != "" {
+		if err := loadPlugins(dir); err != nil {
+			return nil, errors.Annotate(err, "initiliazing frontend")
+		}
+	}
+
+	// Loads frontend providers defined as activated. Unless the frontend fails
+	// fast, the failing providers are skipped while the healthy ones are loaded.
+	fast, err := loadFailFast()
 	if err != nil {
 		return nil, errors.Annotate(err, "initiliazing frontend")
 	}
 
+	providers, err := loadProvider(providerConfig, userInput, fast)
+	if err != nil {
+		if fast || len(providers) == 0 {
+			return nil, errors.Annotate(err, "initiliazing frontend")
+		}
+
+		logger.WithError(err).Warn("Skipping frontend providers")
+	}
+
+	quiet, err := loadQuietHours(providerConfig)
+	if err != nil {
+		return nil, errors.Annotate(err, "initiliazing frontend")
+	}
+
+	spell, err := loadSpellCorrectors(providerConfig)
+	if err != nil {
+		return nil, errors.Annotate(err, "initiliazing frontend")
+	}
+
+	attempts, err := loadDeliveryAttempts()
+	if err != nil {
+		return nil, errors.Annotate(err, "initiliazing frontend")
+	}
+
+	retryDelay, err := loadDeliveryRetryDelay()
+	if err != nil {
+		return nil, errors.Annotate(err, "initiliazing frontend")
+	}
+
+	var deadLetter deadletter.Sink
+	if path := os.Getenv(deadLetterFile); path != "" {
+		deadLetter = deadletter.NewFile(path)
+	}
+
+	var q *queue
+	if path := os.Getenv(queueFile); path != "" {
+		if q, err = openQueue(path); err != nil {
+			return nil, errors.Annotate(err, "initiliazing frontend")
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Frontend{
+		ctx:                ctx,
+		cancel:             cancel,
 		activatedProviders: providers,
 		userInput:          userInput,
-		capsule:            capsuleChan,
+		toBackend:          toBackend,
+		toFrontend:         toFrontend,
+		operators:          loadOperators(providerConfig),
+		escalations:        map[string]time.Time{},
+		quietHours:         quiet,
+		slowResponses:      loadSlowResponses(providerConfig),
+		commandPrefixes:    loadCommandPrefixes(providerConfig),
+		llmBackends:        loadLLMBackends(providerConfig),
+		maintenanceNotices: loadMaintenanceNotices(providerConfig),
+		waiting:            map[uuid.UUID]*time.Timer{},
+		outstanding:        map[uuid.UUID]bool{},
+		slow:               make(chan *capsule.Capsule, slowBufferSize),
+		spellCorrectors:    spell,
+		operatorUsers:      loadOperatorUsers(providerConfig),
+		selfTests:          map[uuid.UUID]*selfTest{},
+		expiredSelfTests:   make(chan uuid.UUID, selfTestBufferSize),
+		deliveryAttempts:   attempts,
+		deliveryRetryDelay: retryDelay,
+		retries:            make(chan *delivery, retryBufferSize),
+		deadLetter:         deadLetter,
 		wg:                 &sync.WaitGroup{},
+		stopped:            map[string]chan struct{}{},
+		shutdownTimeout:    defaultShutdownTimeout,
+		queue:              q,
 	}, nil
 }
 
-// Start starts frontend providers and user inputs listening.
+// Start starts frontend providers and user inputs listening. The providers
+// are started in the order of the configuration file, unless they declare a
+// startup order. Each provider runs in its own routine.
 func (f *Frontend) Start(wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	localLogger := logger.WithField("action", "listening")
 
-	for _, provider := range f.activatedProviders {
+	sortByStartupOrder(f.activatedProviders)
+	for _, p := range f.activatedProviders {
+		localLogger.Debugf("Starting provider %s", p.GetLabel())
+		stopped := make(chan struct{})
+		f.stopped[p.GetLabel()] = stopped
+
 		f.wg.Add(1)
-		go provider.Start()
+		go func(p provider.Provider) {
+			defer f.wg.Done()
+			defer close(stopped)
+			p.Start()
+		}(p)
 	}
 
 	// Initializes a local function which will stop all activated providers when
-	// a channel has been closed.
-	stop := func(f *Frontend) {
+	// a channel has been closed. A stuck provider does not prevent the shutdown:
+	// it is reported as a failure, like the providers which failed to stop. It
+	// returns false if a provider did not return from Stop before the deadline.
+	stop := func(f *Frontend) bool {
 		localLogger.Info("Closing frontend providers")
-		f.stopProviders()
-		f.wg.Wait()
+		f.cancel()
+		deadline := time.Now().Add(f.shutdownTimeout)
+		failures, returned := f.stopProviders(deadline)
+		if !waitWithTimeout(f.wg, time.Until(deadline)) {
+			for label, stopped := range f.stopped {
+				select {
+				case <-stopped:
+				default:
+					localLogger.Warnf("Provider %s did not stop within %s", label, f.shutdownTimeout)
+					failures = append(failures, fmt.Sprintf("provider %s did not stop within %s", label, f.shutdownTimeout))
+				}
+			}
+		}
+
+		if f.queue != nil {
+			if err := f.queue.close(); err != nil {
+				localLogger.WithError(err).Error("Cannot close outbound queue")
+				failures = append(failures, err.Error())
+			}
+		}
+
+		if len(failures) > 0 {
+			sort.Strings(failures)
+			f.shutdownErr = errors.Errorf("stopping frontend: %s", strings.Join(failures, "; "))
+		}
+
+		return returned
 	}
 
+	// Delivers the capsules which were pending when the application stopped.
+	// The providers which are not ready yet are attempted again later.
+	f.redeliver()
+
+	flush := time.NewTicker(quietHoursFlushInterval)
+	defer flush.Stop()
+
+	redelivery := time.NewTicker(redeliveryInterval)
+	defer redelivery.Stop()
+
 	localLogger.Info("Starting listening loop")
 listeningLoop:
 	for {
 		select {
+		case <-flush.C:
+			f.flushHeld()
+		case <-redelivery.C:
+			f.redeliver()
+		case capsule := <-f.slow:
+			if err := f.sendInterim(capsule); err != nil {
+				localLogger.WithError(err).Warn("Cannot send interim message")
+			}
+		case retry := <-f.retries:
+			f.deliver(retry.capsule, retry.attempt)
+		case id := <-f.expiredSelfTests:
+			f.settle(id)
+			if _, err := f.finishSelfTest(id, nil); err != nil {
+				localLogger.WithError(err).Error("Cannot report self-test")
+			}
 		case capsule, ok := <-f.userInput:
 			if !ok {
 				stop(f)
@@ -125,15 +672,74 @@ listeningLoop:
 			}
 
 			localLogger.Debugf("Capsule received from %s: %s", capsule.ProviderLabel, capsule.Content)
+			if f.isEscalated(capsule.ProviderLabel, capsule.User) {
+				if err := f.forwardToOperator(capsule); err != nil {
+					localLogger.WithError(err).Error("Cannot forward user message to operator")
+				}
+				break
+			}
+
+			// During the maintenance and the drain, the backend is not called
+			// at all.
+			if f.Maintenance() || f.Draining() {
+				if err := f.replyMaintenance(capsule); err != nil {
+					localLogger.WithError(err).Error("Cannot send maintenance notice")
+				}
+				break
+			}
+
+			if command, ok := f.findCommand(capsule.ProviderLabel, capsule.Content); ok {
+				if err := command(f, capsule); err != nil {
+					localLogger.WithError(err).Error("Cannot run user command")
+				}
+				break
+			}
+
 			f.sendToBackend(capsule)
-		case capsule, ok := <-f.capsule:
+		case capsule, ok := <-f.toFrontend:
 			if !ok {
-				stop(f)
+				// The user inputs channel is closed once every provider
+				// returned from Stop, so no handler sends on it anymore. It is
+				// left open when a provider is stuck.
+				if stop(f) {
+					close(f.userInput)
+				}
 				break listeningLoop
 			}
 
-			if err := f.message(capsule); err != nil {
-				localLogger.WithError(err).Error("Cannot process error received from backend")
+			// An interim status is not the answer: the message is still
+			// pending.
+			if len(capsule.Status) > 0 {
+				if err := f.status(capsule); err != nil {
+					localLogger.WithError(err).Debug("Cannot display status")
+				}
+				break
+			}
+
+			if selfTest, err := f.finishSelfTest(capsule.OriginalMessage, capsule); selfTest {
+				f.settle(capsule.OriginalMessage)
+				if err != nil {
+					localLogger.WithError(err).Error("Cannot report self-test")
+				}
+				break
+			}
+
+			explainError(capsule)
+			if capsule.Proactive {
+				f.settle(capsule.OriginalMessage)
+				if _, err := f.notify(capsule); err != nil {
+					localLogger.WithError(err).Error("Cannot send proactive message")
+				}
+				break
+			}
+
+			f.unwatch(capsule.OriginalMessage)
+			f.deliver(capsule, 1)
+
+			if capsule.Escalated {
+				if err := f.escalate(capsule); err != nil {
+					localLogger.WithError(err).Error("Cannot escalate conversation to operator")
+				}
 			}
 		}
 
@@ -142,6 +748,7 @@ listeningLoop:
 }
 
 // loadConfig loads the providers configuration from file defined in a environment variable.
+// The file format is detected from its extension (YAML, JSON or TOML).
 // It returns an array of structured providers configuration.
 func loadConfig() ([]*ProviderConfig, error) {
 	// Gets the config file path.
@@ -152,17 +759,21 @@ func loadConfig() ([]*ProviderConfig, error) {
 
 	logger.WithField("filename", path).Info("Parsing config file")
 
-	// Reads config file.
-	data, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, errors.Annotate(err, "cannot read config file")
-	}
-
 	var c []*ProviderConfig
 
-	// Unmarshals the read bytes.
-	if err = yaml.Unmarshal(data, &c); err != nil {
-		return nil, errors.Annotate(err, "cannot unmarshal config file")
+	// Reads and unmarshals the config file. A missing file is only accepted
+	// when it is explicitly allowed.
+	if err := config.Decode(path, &c); err != nil {
+		if !config.IsMissing(err) {
+			return nil, err
+		}
+
+		if allow, _ := strconv.ParseBool(os.Getenv(allowMissingConfig)); !allow {
+			return nil, errors.Annotatef(err, "set %s", configFile)
+		}
+
+		logger.WithField("filename", path).Warn("Config file not found, starting without provider")
+		return []*ProviderConfig{}, nil
 	}
 
 	// Formats label
@@ -173,10 +784,47 @@ func loadConfig() ([]*ProviderConfig, error) {
 	return c, nil
 }
 
-// loadProviders loads the providers if they are declared as activated.
-func loadProvider(providerConfig []*ProviderConfig, userInput chan<- *provider.CapsuleProvider) ([]provider.Provider, error) {
+// loadInputBufferSize returns the size of the user input buffer defined in a
+// environment variable.
+func loadInputBufferSize() (int, error) {
+	value := os.Getenv(inputBufferSize)
+	if value == "" {
+		return defaultInputBufferSize, nil
+	}
+
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 0 {
+		return 0, errors.NotValidf("%s %q", inputBufferSize, value)
+	}
+
+	return size, nil
+}
+
+// loadFailFast returns the fail fast mode defined in a environment variable.
+func loadFailFast() (bool, error) {
+	value := os.Getenv(failFast)
+	if value == "" {
+		return true, nil
+	}
+
+	fast, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.NotValidf("%s %q", failFast, value)
+	}
+
+	return fast, nil
+}
+
+// loadProviders loads the providers if they are declared as activated. The
+// providers are returned in the order of the configuration, and a label can
+// only be activated once. In fail fast mode, it returns the first provider
+// failure. Otherwise, the failing providers are skipped and the loaded
+// providers are returned with a InitializationError listing the failures.
+func loadProvider(providerConfig []*ProviderConfig, userInput chan<- *provider.CapsuleProvider, failFast bool) ([]provider.Provider, error) {
 	// providers is a slice containing initiliazed provider.
 	providers := []provider.Provider{}
+	failures := map[string]error{}
+	activated := map[string]bool{}
 
 	// Each of the providers contained in the configuration slice are loaded
 	// only if they are declared as activated.
@@ -184,62 +832,516 @@ func loadProvider(providerConfig []*ProviderConfig, userInput chan<- *provider.C
 		// Verifies if the provider exists in the collection of implemented providers.
 		p, ok := providerCollection[pc.Label]
 		if !ok {
-			return nil, errors.NotFoundf("provider called `%s`", pc.Label)
+			err := errors.NotFoundf("provider called `%s`", pc.Label)
+			if failFast {
+				return nil, err
+			}
+
+			failures[pc.Label] = err
+			continue
+		}
+
+		// The messages are routed by provider label: a label cannot be
+		// activated twice.
+		if pc.IsActivated && activated[pc.Label] {
+			err := errors.AlreadyExistsf("activated provider %s", pc.Label)
+			if failFast {
+				return nil, err
+			}
+
+			failures[pc.Label+" (duplicate)"] = err
+			continue
 		}
 
 		// If the provider is declared as activated in the configuration file,
 		// it is initialized and added to the slice of providers.
 		if pc.IsActivated {
+			activated[pc.Label] = true
+
 			// Initializes a new provider config which will be sent to the provider
 			// for initializing it.
 			config := &provider.Config{
-				Token:           pc.Token,
-				AuthorizedUsers: pc.AuthorizedUsers,
-				UserInput:       userInput,
+				Token:                  pc.Token,
+				Secret:                 pc.Secret,
+				Username:               pc.Username,
+				Password:               pc.Password,
+				Server:                 pc.Server,
+				Listen:                 pc.Listen,
+				TLSCertFile:            pc.TLSCertFile,
+				TLSKeyFile:             pc.TLSKeyFile,
+				WebhookSecret:          pc.WebhookSecret,
+				VerifyToken:            pc.VerifyToken,
+				Mode:                   pc.Mode,
+				WebhookURL:             pc.WebhookURL,
+				AllowAllUsers:          pc.AllowAllUsers,
+				UnauthorizedMessage:    pc.UnauthorizedMessage,
+				RateLimit:              pc.RateLimit,
+				RemoveUnreachableUsers: pc.RemoveUnreachableUsers,
+				AckReaction:            pc.AckReaction,
+				MinMessageLength:       pc.MinMessageLength,
+				MaxInputLength:         pc.MaxInputLength,
+				RejectLongInput:        pc.RejectLongInput,
+				FormatCode:             pc.FormatCode,
+				AllowedChatTypes:       pc.AllowedChatTypes,
+				AllowedChatIDs:         pc.AllowedChatIDs,
+				GroupMode:              pc.GroupMode,
+				HandleChannelPosts:     pc.HandleChannelPosts,
+				ChannelTrigger:         pc.ChannelTrigger,
+				CorrectEditedMessages:  pc.CorrectEditedMessages,
+				MaxFileSize:            pc.MaxFileSize,
+				MaxResponseBubbles:     pc.MaxResponseBubbles,
+				ResponsePrefix:         pc.ResponsePrefix,
+				CollectFeedback:        pc.CollectFeedback,
+				Synthesizer:            registeredSynthesizer(pc.Label),
+				VoiceResponses:         pc.VoiceResponses,
+				LogSampling:            pc.LogSampling,
+				UserInput:              userInput,
 			}
 
-			var err error
-			p, err = p.Initialize(config)
+			if len(pc.FeedbackFile) > 0 {
+				config.FeedbackSink = provider.NewFileFeedbackSink(pc.FeedbackFile)
+			}
+
+			// The authorized users are loaded from the user store of the
+			// provider.
+			store, err := loadUserStore(pc)
+			if err == nil {
+				config.UserStore = store
+				config.AuthorizedUsers, err = store.List()
+			}
+			if err == nil {
+				err = provider.SetLogLevel(pc.Label, pc.LogLevel)
+			}
+			if err == nil {
+				p, err = p.Initialize(config)
+			}
 			if err != nil {
 				annotation := fmt.Sprintf("loading provider %s", pc.Label)
-				return nil, errors.Annotate(err, annotation)
+				if failFast {
+					return nil, errors.Annotate(err, annotation)
+				}
+
+				failures[pc.Label] = errors.Annotate(err, annotation)
+				continue
 			}
 
+			watchUsers(p, store)
 			providers = append(providers, p)
 		}
 	}
 
+	if len(failures) > 0 {
+		return providers, &InitializationError{Failures: failures}
+	}
+
 	return providers, nil
 }
 
+// Error returns the labels of the failing providers and their errors.
+func (e *InitializationError) Error() string {
+	labels := []string{}
+	for label := range e.Failures {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	failures := []string{}
+	for _, label := range labels {
+		failures = append(failures, e.Failures[label].Error())
+	}
+
+	return fmt.Sprintf("%d frontend providers failed to initialize: %s", len(failures), strings.Join(failures, "; "))
+}
+
+// sortByStartupOrder sorts the providers by ascending startup order. The
+// providers without startup order have the order zero, and the providers of
+// a same order keep their configuration order.
+func sortByStartupOrder(providers []provider.Provider) {
+	order := func(p provider.Provider) int {
+		if orderer, ok := p.(provider.StartupOrderer); ok {
+			return orderer.StartupOrder()
+		}
+
+		return 0
+	}
+
+	sort.SliceStable(providers, func(i, j int) bool {
+		return order(providers[i]) < order(providers[j])
+	})
+}
+
+// loadOperators returns the operators of the activated providers, indexed by
+// provider label.
+func loadOperators(providerConfig []*ProviderConfig) map[string]*operator {
+	operators := map[string]*operator{}
+	for _, pc := range providerConfig {
+		if !pc.IsActivated || len(pc.OperatorChat) == 0 {
+			continue
+		}
+
+		cooldown := pc.EscalationCooldown
+		if cooldown <= 0 {
+			cooldown = defaultEscalationCooldown
+		}
+
+		operators[pc.Label] = &operator{
+			chat:     pc.OperatorChat,
+			cooldown: cooldown,
+		}
+	}
+
+	return operators
+}
+
 // sendToBackend sends a given capsule to the backend using the capsule out channel.
+// The invalid capsules are dropped so a buggy provider cannot send them to
+// the backend. The capsule carries the frontend context, so its processing is
+// aborted on shutdown.
 func (f *Frontend) sendToBackend(userInput *provider.CapsuleProvider) {
-	capsule := &capsule.Capsule{
+	c := toCapsule(userInput)
+	c.FrontendCapabilities = f.capabilities(userInput.ProviderLabel)
+	f.correctSpelling(c)
+	c.SetContext(f.ctx)
+	if err := c.Validate(); err != nil {
+		logger.WithError(err).WithField("provider", userInput.ProviderLabel).Warn("Dropping invalid capsule")
+		return
+	}
+
+	f.submit(c)
+	f.watch(c)
+}
+
+// capabilities returns the capabilities of the given provider, or nil if it
+// does not declare them.
+func (f *Frontend) capabilities(providerLabel string) *capsule.Capabilities {
+	for _, p := range f.activatedProviders {
+		if p.GetLabel() != providerLabel {
+			continue
+		}
+
+		if capable, ok := p.(provider.Capable); ok {
+			return capable.Capabilities()
+		}
+	}
+
+	return nil
+}
+
+// toCapsule converts a provider capsule to a capsule.
+func toCapsule(userInput *provider.CapsuleProvider) *capsule.Capsule {
+	return &capsule.Capsule{
 		OriginalMessage:  userInput.OriginalMessage,
 		FrontendProvider: userInput.ProviderLabel,
 		Content:          userInput.Content,
 		User:             userInput.User,
+		Chat:             userInput.Chat,
+		ThreadID:         userInput.ThreadID,
+		Locale:           userInput.Locale,
+		Timezone:         userInput.Timezone,
+		BackendHint:      userInput.BackendHint,
+		Attachments:      userInput.Attachments,
+		Location:         userInput.Location,
+		Metadata:         userInput.Metadata,
 	}
-
-	f.capsule <- capsule
 }
 
 // message is used to send message to a user. The given capsule contains all
 // informations needed to send the message to the good provider, the good user...
+// When the persistence is enabled, the capsule is enqueued before being sent
+// and marked as delivered once sent.
 func (f *Frontend) message(capsule *capsule.Capsule) error {
 	for _, p := range f.activatedProviders {
-		if capsule.FrontendProvider == p.GetLabel() {
+		if capsule.FrontendProvider != p.GetLabel() {
+			continue
+		}
+
+		// A streamed response is delivered in its own routine so the listening
+		// loop is not held while the response is generated.
+		if capsule.Stream != nil {
+			go f.messageStream(p, capsule)
+			return nil
+		}
+
+		if f.queue == nil {
 			return p.Message(capsule)
 		}
+
+		if err := f.queue.enqueue(capsule); err != nil {
+			logger.WithError(err).Warn("Cannot persist outbound capsule")
+		}
+
+		if err := p.Message(capsule); err != nil {
+			return err
+		}
+
+		return f.queue.done(capsule)
+	}
+
+	return errors.NotFoundf("frontend provider %s", capsule.FrontendProvider)
+}
+
+// deliver sends the response to its user. A failed delivery is attempted
+// again: the response remains outstanding for the drain until it is
+// delivered or stored in the dead letter. A streamed response is settled
+// once its routine delivered it.
+func (f *Frontend) deliver(capsule *capsule.Capsule, attempt int) {
+	// The routine of a streamed response collects the stream into the
+	// capsule: it is read before.
+	streamed := capsule.Stream != nil
+	if err := f.message(capsule); err != nil {
+		f.retryDelivery(capsule, attempt, err)
+		return
+	}
+
+	if !streamed {
+		f.settle(capsule.OriginalMessage)
+	}
+}
+
+// status displays the interim status of the capsule with its frontend
+// provider. The statuses of the self-tests and the statuses of the providers
+// which cannot display them are ignored.
+func (f *Frontend) status(capsule *capsule.Capsule) error {
+	if _, ok := f.selfTests[capsule.OriginalMessage]; ok {
+		return nil
+	}
+
+	for _, p := range f.activatedProviders {
+		if capsule.FrontendProvider != p.GetLabel() {
+			continue
+		}
+
+		receiver, ok := p.(provider.StatusReceiver)
+		if !ok {
+			return nil
+		}
+
+		return receiver.Status(capsule.OriginalMessage, capsule.Status)
 	}
 
 	return errors.NotFoundf("frontend provider %s", capsule.FrontendProvider)
 }
 
-// stopProviders stop all running providers.
-func (f *Frontend) stopProviders() {
+// messageStream delivers a streamed response. The providers which cannot
+// display it as it is generated receive the whole response at once.
+func (f *Frontend) messageStream(p provider.Provider, c *capsule.Capsule) {
+	defer f.settle(c.OriginalMessage)
+
+	var err error
+	if receiver, ok := p.(provider.StreamReceiver); ok {
+		err = receiver.MessageStream(c)
+	} else {
+		c.CollectStream()
+		err = p.Message(c)
+	}
+
+	if err != nil {
+		logger.WithError(err).Error("Cannot deliver streamed response")
+	}
+}
+
+// redeliver sends the capsules left pending in the outbound queue. The
+// original messages are lost with the restart, so the responses are sent to
+// the capsule chat with the provider Notify method. A capsule which cannot be
+// delivered after maxRedeliveryAttempts is stored in the dead letter. A
+// capsule held during the quiet hours stays pending until it is sent.
+func (f *Frontend) redeliver() {
+	if f.queue == nil {
+		return
+	}
+
+	for _, c := range f.queue.recoveredCapsules() {
+		if f.isHeld(c) {
+			continue
+		}
+
+		held, err := f.notify(c)
+		if err != nil {
+			attempts, attemptErr := f.queue.attempt(c)
+			if attemptErr != nil {
+				logger.WithError(attemptErr).Warn("Cannot record redelivery attempt")
+			}
+
+			if attempts >= maxRedeliveryAttempts {
+				logger.WithError(err).WithField("attempts", attempts).Errorf("Cannot redeliver capsule %s", c.OriginalMessage)
+				f.storeDeadLetter(c, err, attempts)
+				continue
+			}
+
+			logger.WithError(err).Warnf("Cannot redeliver capsule %s", c.OriginalMessage)
+			continue
+		}
+
+		if held {
+			continue
+		}
+
+		if err := f.queue.done(c); err != nil {
+			logger.WithError(err).Error("Cannot mark redelivered capsule")
+		}
+	}
+}
+
+// notify sends the capsule responses to the capsule chat. It is the path of
+// the proactive messages: during the quiet hours of the provider, the capsule
+// is held or dropped instead. It returns true when the capsule is held, so it
+// is not sent yet.
+func (f *Frontend) notify(c *capsule.Capsule) (bool, error) {
+	if len(c.Chat) == 0 {
+		return false, errors.NotProvisionedf("chat of capsule")
+	}
+
+	if q, quiet := f.isQuiet(c.FrontendProvider); quiet {
+		return f.hold(q, c), nil
+	}
+
+	texts := c.Responses
+	if c.Error != nil && len(c.Error.Error()) > 0 {
+		texts = []string{provider.SystemLog(c.Error.Error(), provider.ErrorStatus)}
+	}
+
+	for _, p := range f.activatedProviders {
+		if p.GetLabel() != c.FrontendProvider {
+			continue
+		}
+
+		notifier, ok := p.(provider.Notifier)
+		if !ok {
+			return false, errors.NotSupportedf("notification by frontend provider %s", c.FrontendProvider)
+		}
+
+		for _, text := range texts {
+			if err := notifier.Notify(c.Chat, text); err != nil {
+				return false, err
+			}
+		}
+
+		return false, nil
+	}
+
+	return false, errors.NotFoundf("frontend provider %s", c.FrontendProvider)
+}
+
+// escalate notifies the operator of the escalated capsule and starts the
+// escalation cooldown of its user.
+func (f *Frontend) escalate(capsule *capsule.Capsule) error {
+	text := fmt.Sprintf("Conversation escalated by %s (%s): %s", capsule.User, capsule.FrontendProvider, capsule.Content)
+	if err := f.notifyOperator(capsule.FrontendProvider, text); err != nil {
+		return err
+	}
+
+	cooldown := f.operators[capsule.FrontendProvider].cooldown
+	f.escalations[capsule.FrontendProvider+"/"+capsule.User] = time.Now().Add(cooldown)
+	return nil
+}
+
+// isEscalated verifies if the given user is in an escalation cooldown.
+func (f *Frontend) isEscalated(providerLabel, user string) bool {
+	key := providerLabel + "/" + user
+	end, ok := f.escalations[key]
+	if !ok {
+		return false
+	}
+
+	if time.Now().After(end) {
+		delete(f.escalations, key)
+		return false
+	}
+
+	return true
+}
+
+// forwardToOperator forwards a message of an escalated user to the operator.
+// An empty capsule is sent back to the provider so it can release the
+// message.
+func (f *Frontend) forwardToOperator(userInput *provider.CapsuleProvider) error {
+	text := fmt.Sprintf("Message from %s (%s): %s", userInput.User, userInput.ProviderLabel, userInput.Content)
+	if err := f.notifyOperator(userInput.ProviderLabel, text); err != nil {
+		return err
+	}
+
+	return f.message(toCapsule(userInput))
+}
+
+// notifyOperator sends the text to the operator of the given provider.
+func (f *Frontend) notifyOperator(providerLabel, text string) error {
+	operator, ok := f.operators[providerLabel]
+	if !ok {
+		return errors.NotFoundf("operator of frontend provider %s", providerLabel)
+	}
+
 	for _, p := range f.activatedProviders {
-		p.Stop()
-		f.wg.Done()
+		if p.GetLabel() != providerLabel {
+			continue
+		}
+
+		notifier, ok := p.(provider.Notifier)
+		if !ok {
+			return errors.NotSupportedf("notification by frontend provider %s", providerLabel)
+		}
+
+		return notifier.Notify(operator.chat, text)
+	}
+
+	return errors.NotFoundf("frontend provider %s", providerLabel)
+}
+
+// stopProviders stop all running providers. The providers are stopped
+// concurrently so a provider whose Stop blocks does not hold the others. It
+// returns the failures of the providers which could not be stopped before the
+// deadline, and false if a provider did not return from Stop.
+func (f *Frontend) stopProviders(deadline time.Time) ([]string, bool) {
+	results := make(chan *stopResult, len(f.activatedProviders))
+	pending := map[string]bool{}
+	for _, p := range f.activatedProviders {
+		pending[p.GetLabel()] = true
+		go func(p provider.Provider) {
+			results <- &stopResult{label: p.GetLabel(), err: p.Stop()}
+		}(p)
+	}
+
+	failures := []string{}
+	timeout := time.After(time.Until(deadline))
+	for len(pending) > 0 {
+		select {
+		case result := <-results:
+			delete(pending, result.label)
+			if result.err != nil {
+				logger.WithError(result.err).Errorf("Cannot stop provider %s", result.label)
+				failures = append(failures, fmt.Sprintf("provider %s: %s", result.label, result.err))
+			}
+		case <-timeout:
+			for label := range pending {
+				logger.Warnf("Provider %s did not stop within %s", label, f.shutdownTimeout)
+				failures = append(failures, fmt.Sprintf("provider %s did not stop within %s", label, f.shutdownTimeout))
+			}
+			return failures, false
+		}
+	}
+
+	return failures, true
+}
+
+// ShutdownError returns the failures of the shutdown of the frontend
+// providers, or nil if they stopped cleanly. It must be called once Start has
+// returned.
+func (f *Frontend) ShutdownError() error {
+	return f.shutdownErr
+}
+
+// waitWithTimeout waits for the wait group for at most the given duration. It
+// returns false if the timeout expired.
+func waitWithTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
 	}
 }
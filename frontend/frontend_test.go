@@ -0,0 +1,617 @@
+package frontend
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/config"
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/google/uuid"
+)
+
+type (
+	// fakeProvider is a frontend provider recording the capsules it delivers.
+	fakeProvider struct {
+		// label is the label of the provider.
+		label string
+
+		// stuck makes Start block forever, even after Stop.
+		stuck bool
+
+		// initErr is the error returned by Initialize.
+		initErr error
+
+		// fail returns the error of the delivery of the given capsule. The
+		// capsules are delivered when it is nil or returns nil.
+		fail func(c *capsule.Capsule) error
+
+		// mutex protects the delivered capsules.
+		mutex sync.Mutex
+
+		// delivered is a slice containing the capsules delivered.
+		delivered []*capsule.Capsule
+
+		// notifyErr is the error returned by Notify. The texts are notified
+		// when it is nil.
+		notifyErr error
+
+		// notified is a slice containing the texts notified.
+		notified []string
+
+		// stop is closed by Stop.
+		stop chan struct{}
+
+		// stopErr is the error returned by Stop.
+		stopErr error
+
+		// release makes Stop block until it is closed, when it is not nil.
+		release chan struct{}
+	}
+
+	// textOnlyProvider is a fake provider which cannot display buttons.
+	textOnlyProvider struct {
+		*fakeProvider
+	}
+
+	// orderedProvider is a fake provider declaring a startup order.
+	orderedProvider struct {
+		*fakeProvider
+
+		// order is the startup order of the provider.
+		order int
+	}
+)
+
+// newFakeProvider initializes a fake provider with the given label.
+func newFakeProvider(label string) *fakeProvider {
+	return &fakeProvider{label: label, stop: make(chan struct{})}
+}
+
+func (p *fakeProvider) Initialize(config *provider.Config) (provider.Provider, error) {
+	if p.initErr != nil {
+		return nil, p.initErr
+	}
+
+	return p, nil
+}
+
+func (p *fakeProvider) Start() {
+	if p.stuck {
+		select {}
+	}
+
+	<-p.stop
+}
+
+func (p *fakeProvider) Message(c *capsule.Capsule) error {
+	if p.fail != nil {
+		if err := p.fail(c); err != nil {
+			return err
+		}
+	}
+
+	p.mutex.Lock()
+	p.delivered = append(p.delivered, c)
+	p.mutex.Unlock()
+	return nil
+}
+
+func (p *fakeProvider) Notify(chat string, text string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.notifyErr != nil {
+		return p.notifyErr
+	}
+
+	p.notified = append(p.notified, text)
+	return nil
+}
+
+func (p *fakeProvider) GetLabel() string {
+	return p.label
+}
+
+func (p *fakeProvider) Stop() error {
+	close(p.stop)
+	if p.release != nil {
+		<-p.release
+	}
+
+	return p.stopErr
+}
+
+func (p *textOnlyProvider) Capabilities() *capsule.Capabilities {
+	return &capsule.Capabilities{}
+}
+
+func (p *orderedProvider) StartupOrder() int {
+	return p.order
+}
+
+// deliveries returns the capsules delivered.
+func (p *fakeProvider) deliveries() []*capsule.Capsule {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return append([]*capsule.Capsule{}, p.delivered...)
+}
+
+// notifications returns the texts notified by the provider.
+func (p *fakeProvider) notifications() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return append([]string{}, p.notified...)
+}
+
+// register registers the providers in the provider collection until the end
+// of the test.
+func register(t *testing.T, providers ...*fakeProvider) {
+	t.Helper()
+
+	for _, p := range providers {
+		label := p.label
+		previous, registered := providerCollection[label]
+		providerCollection[label] = p
+		t.Cleanup(func() {
+			if registered {
+				providerCollection[label] = previous
+			} else {
+				delete(providerCollection, label)
+			}
+		})
+	}
+}
+
+// newTestFrontend initializes a frontend with the given providers, without
+// configuration file. It returns the frontend, the channel of the user inputs
+// and the channels connecting it to the backend.
+func newTestFrontend(providers ...provider.Provider) (*Frontend, chan *provider.CapsuleProvider, chan *capsule.Capsule, chan *capsule.Capsule) {
+	userInput := make(chan *provider.CapsuleProvider, defaultInputBufferSize)
+	toBackend := make(chan *capsule.Capsule, 100)
+	toFrontend := make(chan *capsule.Capsule, 100)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Frontend{
+		ctx:                ctx,
+		cancel:             cancel,
+		activatedProviders: providers,
+		userInput:          userInput,
+		toBackend:          toBackend,
+		toFrontend:         toFrontend,
+		operators:          map[string]*operator{},
+		escalations:        map[string]time.Time{},
+		quietHours:         map[string]*quietHours{},
+		slowResponses:      map[string]*slowResponse{},
+		commandPrefixes:    map[string]string{},
+		llmBackends:        map[string]string{},
+		maintenanceNotices: map[string]string{},
+		waiting:            map[uuid.UUID]*time.Timer{},
+		outstanding:        map[uuid.UUID]bool{},
+		slow:               make(chan *capsule.Capsule, slowBufferSize),
+		spellCorrectors:    map[string]map[string]provider.SpellCorrector{},
+		operatorUsers:      map[string]map[string]bool{},
+		selfTests:          map[uuid.UUID]*selfTest{},
+		expiredSelfTests:   make(chan uuid.UUID, selfTestBufferSize),
+		deliveryAttempts:   1,
+		retries:            make(chan *delivery, retryBufferSize),
+		wg:                 &sync.WaitGroup{},
+		stopped:            map[string]chan struct{}{},
+		shutdownTimeout:    defaultShutdownTimeout,
+	}, userInput, toBackend, toFrontend
+}
+
+// startFrontend starts the frontend and returns a channel closed when Start
+// returns.
+func startFrontend(f *Frontend) <-chan struct{} {
+	done := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		f.Start(wg)
+		close(done)
+	}()
+
+	return done
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	stuck := newFakeProvider("stuck")
+	stuck.stuck = true
+	healthy := newFakeProvider("healthy")
+
+	f, userInput, _, _ := newTestFrontend(stuck, healthy)
+	f.shutdownTimeout = 200 * time.Millisecond
+	done := startFrontend(f)
+
+	begin := time.Now()
+	close(userInput)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not complete")
+	}
+
+	if elapsed := time.Since(begin); elapsed < f.shutdownTimeout {
+		t.Errorf("shutdown completed in %s, before the timeout", elapsed)
+	}
+
+	err := f.ShutdownError()
+	if err == nil {
+		t.Fatal("expected the stuck provider to be reported")
+	}
+
+	if msg := err.Error(); !strings.Contains(msg, "provider stuck did not stop") || strings.Contains(msg, "healthy") {
+		t.Errorf("shutdown error = %q, want only the stuck provider", msg)
+	}
+}
+
+func TestShutdownStopFailure(t *testing.T) {
+	failing := newFakeProvider("failing")
+	failing.stopErr = errors.New("connection reset")
+
+	f, userInput, _, _ := newTestFrontend(failing, newFakeProvider("healthy"))
+	done := startFrontend(f)
+	close(userInput)
+	<-done
+
+	err := f.ShutdownError()
+	if err == nil {
+		t.Fatal("expected the failing provider to be reported")
+	}
+
+	if msg := err.Error(); !strings.Contains(msg, "provider failing: connection reset") || strings.Contains(msg, "healthy") {
+		t.Errorf("shutdown error = %q, want only the failing provider", msg)
+	}
+}
+
+func TestShutdownClean(t *testing.T) {
+	f, userInput, _, _ := newTestFrontend(newFakeProvider("healthy"))
+	done := startFrontend(f)
+	close(userInput)
+	<-done
+
+	if err := f.ShutdownError(); err != nil {
+		t.Errorf("shutdown error = %v, want none", err)
+	}
+}
+
+func TestShutdownClosesUserInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		blocked bool
+		closed  bool
+	}{
+		{"providers stopped", false, true},
+		{"provider blocked in Stop", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newFakeProvider("fake")
+			if tt.blocked {
+				p.release = make(chan struct{})
+				defer close(p.release)
+			}
+
+			f, userInput, _, toFrontend := newTestFrontend(p)
+			f.shutdownTimeout = 50 * time.Millisecond
+			done := startFrontend(f)
+
+			// The frontend stops once the responses channel is closed.
+			close(toFrontend)
+			<-done
+
+			closed := false
+			select {
+			case _, ok := <-userInput:
+				closed = !ok
+			default:
+			}
+
+			if closed != tt.closed {
+				t.Errorf("user inputs channel closed: %t, want %t", closed, tt.closed)
+			}
+		})
+	}
+}
+
+func TestWaitWithTimeout(t *testing.T) {
+	wg := &sync.WaitGroup{}
+	if !waitWithTimeout(wg, time.Second) {
+		t.Error("waitWithTimeout() = false for an empty wait group")
+	}
+
+	wg.Add(1)
+	if waitWithTimeout(wg, 50*time.Millisecond) {
+		t.Error("waitWithTimeout() = true for a blocked wait group")
+	}
+	wg.Done()
+}
+
+func TestLoadInputBufferSize(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  int
+		valid bool
+	}{
+		{"default", "", defaultInputBufferSize, true},
+		{"size", "10", 10, true},
+		{"unbuffered", "0", 0, true},
+		{"negative", "-1", 0, false},
+		{"not a number", "ten", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(inputBufferSize, tt.value)
+
+			size, err := loadInputBufferSize()
+			if (err == nil) != tt.valid {
+				t.Fatalf("loadInputBufferSize() error = %v, want valid %t", err, tt.valid)
+			}
+
+			if size != tt.want {
+				t.Errorf("loadInputBufferSize() = %d, want %d", size, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.yaml")
+	invalid := filepath.Join(dir, "invalid.yaml")
+	if err := ioutil.WriteFile(invalid, []byte("- label: [telegram"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Setenv(configFile, missing)
+
+		_, err := loadConfig()
+		if !config.IsMissing(err) || !strings.Contains(err.Error(), configFile) {
+			t.Errorf("loadConfig() error = %v, want a missing file naming %s", err, configFile)
+		}
+	})
+
+	t.Run("allowed missing file", func(t *testing.T) {
+		t.Setenv(configFile, missing)
+		t.Setenv(allowMissingConfig, "true")
+
+		providers, err := loadConfig()
+		if err != nil || len(providers) != 0 {
+			t.Errorf("loadConfig() = %v, %v, want no provider", providers, err)
+		}
+	})
+
+	t.Run("unparseable file", func(t *testing.T) {
+		t.Setenv(configFile, invalid)
+		t.Setenv(allowMissingConfig, "true")
+
+		if _, err := loadConfig(); err == nil || config.IsMissing(err) {
+			t.Errorf("loadConfig() error = %v, want a parse error", err)
+		}
+	})
+}
+
+func TestLoadProviderFailures(t *testing.T) {
+	broken := newFakeProvider("broken")
+	broken.initErr = errors.New("invalid token")
+	register(t, newFakeProvider("healthy"), broken)
+
+	config := []*ProviderConfig{
+		{Label: "healthy", IsActivated: true},
+		{Label: "broken", IsActivated: true},
+		{Label: "unknown", IsActivated: true},
+	}
+
+	t.Run("fail fast", func(t *testing.T) {
+		providers, err := loadProvider(config, make(chan *provider.CapsuleProvider), true)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+
+		if len(providers) != 0 {
+			t.Errorf("providers = %v, want none", providers)
+		}
+	})
+
+	t.Run("skip failing providers", func(t *testing.T) {
+		providers, err := loadProvider(config, make(chan *provider.CapsuleProvider), false)
+		if len(providers) != 1 || providers[0].GetLabel() != "healthy" {
+			t.Errorf("providers = %v, want the healthy provider", providers)
+		}
+
+		initErr, ok := err.(*InitializationError)
+		if !ok {
+			t.Fatalf("error = %v, want an initialization error", err)
+		}
+
+		if len(initErr.Failures) != 2 || initErr.Failures["broken"] == nil || initErr.Failures["unknown"] == nil {
+			t.Errorf("failures = %v, want the broken and unknown providers", initErr.Failures)
+		}
+
+		if msg := err.Error(); !strings.Contains(msg, "2 frontend providers") || !strings.Contains(msg, "invalid token") {
+			t.Errorf("error = %q, want the aggregated failures", msg)
+		}
+	})
+}
+
+func TestLoadProviderOrder(t *testing.T) {
+	register(t, newFakeProvider("a"), newFakeProvider("b"), newFakeProvider("c"))
+
+	config := []*ProviderConfig{
+		{Label: "c", IsActivated: true},
+		{Label: "a", IsActivated: true},
+		{Label: "b", IsActivated: true},
+		{Label: "a", IsActivated: true},
+	}
+
+	providers, err := loadProvider(config, make(chan *provider.CapsuleProvider), false)
+	if labels := labelsOf(providers); labels != "c,a,b" {
+		t.Errorf("providers = %s, want the configuration order", labels)
+	}
+
+	initErr, ok := err.(*InitializationError)
+	if !ok || len(initErr.Failures) != 1 || initErr.Failures["a (duplicate)"] == nil {
+		t.Errorf("error = %v, want the duplicate label", err)
+	}
+}
+
+func TestSortByStartupOrder(t *testing.T) {
+	providers := []provider.Provider{
+		newFakeProvider("a"),
+		&orderedProvider{newFakeProvider("late"), 10},
+		newFakeProvider("b"),
+		&orderedProvider{newFakeProvider("webhook"), -1},
+		newFakeProvider("c"),
+	}
+
+	sortByStartupOrder(providers)
+	if labels := labelsOf(providers); labels != "webhook,a,b,c,late" {
+		t.Errorf("providers = %s, want webhook,a,b,c,late", labels)
+	}
+}
+
+// labelsOf returns the comma separated labels of the given providers.
+func labelsOf(providers []provider.Provider) string {
+	labels := []string{}
+	for _, p := range providers {
+		labels = append(labels, p.GetLabel())
+	}
+
+	return strings.Join(labels, ",")
+}
+
+func TestSendToBackendInvalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     *provider.CapsuleProvider
+		forwarded bool
+	}{
+		{"valid", &provider.CapsuleProvider{OriginalMessage: uuid.New(), ProviderLabel: "fake", Content: "hello"}, true},
+		{"no original message", &provider.CapsuleProvider{ProviderLabel: "fake", Content: "hello"}, false},
+		{"no provider label", &provider.CapsuleProvider{OriginalMessage: uuid.New(), Content: "hello"}, false},
+		{"no content", &provider.CapsuleProvider{OriginalMessage: uuid.New(), ProviderLabel: "fake"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, _, toBackend, _ := newTestFrontend(newFakeProvider("fake"))
+			f.sendToBackend(tt.input)
+
+			if forwarded := len(toBackend) == 1; forwarded != tt.forwarded {
+				t.Errorf("capsule forwarded to the backend: %t, want %t", forwarded, tt.forwarded)
+			}
+
+			if outstanding := f.outstandingCount(); outstanding != len(toBackend) {
+				t.Errorf("outstanding messages = %d, want %d", outstanding, len(toBackend))
+			}
+		})
+	}
+}
+
+func TestSendToBackendCapabilities(t *testing.T) {
+	f, _, toBackend, _ := newTestFrontend(newFakeProvider("fake"), &textOnlyProvider{newFakeProvider("sms")})
+
+	f.sendToBackend(&provider.CapsuleProvider{OriginalMessage: uuid.New(), ProviderLabel: "fake", Content: "hello"})
+	if c := <-toBackend; c.FrontendCapabilities != nil {
+		t.Errorf("capabilities = %+v, want none for a provider without capabilities", c.FrontendCapabilities)
+	}
+
+	f.sendToBackend(&provider.CapsuleProvider{OriginalMessage: uuid.New(), ProviderLabel: "sms", Content: "hello"})
+	if c := <-toBackend; c.FrontendCapabilities == nil || c.FrontendCapabilities.Buttons {
+		t.Errorf("capabilities = %+v, want the capabilities of the text only provider", c.FrontendCapabilities)
+	}
+}
+
+func TestSendToBackendMetadata(t *testing.T) {
+	f, _, toBackend, _ := newTestFrontend(newFakeProvider("fake"))
+	metadata := map[string]string{"chat_type": "group"}
+
+	f.sendToBackend(&provider.CapsuleProvider{OriginalMessage: uuid.New(), ProviderLabel: "fake", Content: "hello", Metadata: metadata})
+	if c := <-toBackend; c.Metadata["chat_type"] != "group" {
+		t.Errorf("metadata = %v, want %v", c.Metadata, metadata)
+	}
+}
+
+func TestSendToBackendThread(t *testing.T) {
+	f, _, toBackend, _ := newTestFrontend(newFakeProvider("fake"))
+
+	f.sendToBackend(&provider.CapsuleProvider{OriginalMessage: uuid.New(), ProviderLabel: "fake", Content: "hello", ThreadID: "7"})
+	if c := <-toBackend; c.ThreadID != "7" {
+		t.Errorf("thread ID = %q, want the thread of the message", c.ThreadID)
+	}
+}
+
+func TestSendToBackendContext(t *testing.T) {
+	f, userInput, toBackend, _ := newTestFrontend(newFakeProvider("fake"))
+	done := startFrontend(f)
+
+	userInput <- &provider.CapsuleProvider{OriginalMessage: uuid.New(), ProviderLabel: "fake", User: "alice", Content: "hello"}
+
+	var sent *capsule.Capsule
+	select {
+	case sent = <-toBackend:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no capsule sent to the backend")
+	}
+
+	if !sent.HasContext() || sent.Context().Err() != nil {
+		t.Fatalf("context error = %v, want a live context", sent.Context().Err())
+	}
+
+	// The processing of the capsule is aborted on shutdown.
+	close(userInput)
+	<-done
+
+	select {
+	case <-sent.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Error("context not canceled on shutdown")
+	}
+}
+
+func TestNoSelfConsumption(t *testing.T) {
+	p := newFakeProvider("fake")
+	f, userInput, toBackend, toFrontend := newTestFrontend(p)
+	done := startFrontend(f)
+
+	userInput <- &provider.CapsuleProvider{OriginalMessage: uuid.New(), ProviderLabel: "fake", User: "alice", Content: "hello"}
+
+	// The capsule sent to the backend is not consumed by the frontend.
+	var sent *capsule.Capsule
+	select {
+	case sent = <-toBackend:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no capsule sent to the backend")
+	}
+
+	if deliveries := p.deliveries(); len(deliveries) != 0 {
+		t.Errorf("delivered capsules = %v, want none before the response", deliveries)
+	}
+
+	// The response of the backend is delivered once.
+	sent.Responses = []string{"Hello alice"}
+	toFrontend <- sent
+	close(userInput)
+	<-done
+
+	if deliveries := p.deliveries(); len(deliveries) != 1 || deliveries[0].OriginalMessage != sent.OriginalMessage {
+		t.Errorf("delivered capsules = %v, want the response", deliveries)
+	}
+
+	if len(toBackend) != 0 {
+		t.Errorf("capsules sent to the backend = %d, want none after the response", len(toBackend))
+	}
+}
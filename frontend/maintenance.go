@@ -0,0 +1,97 @@
+package frontend
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/juju/errors"
+)
+
+const (
+	// defaultMaintenanceNotice is the default notice sent to the users during
+	// the maintenance.
+	defaultMaintenanceNotice = "I am down for maintenance, please try again later."
+)
+
+// loadMaintenanceNotices returns the maintenance notices of the activated
+// providers indexed by provider label.
+func loadMaintenanceNotices(providerConfig []*ProviderConfig) map[string]string {
+	notices := map[string]string{}
+	for _, pc := range providerConfig {
+		if !pc.IsActivated {
+			continue
+		}
+
+		notice := pc.MaintenanceNotice
+		if len(notice) == 0 {
+			notice = defaultMaintenanceNotice
+		}
+
+		notices[pc.Label] = notice
+	}
+
+	return notices
+}
+
+// SetMaintenance turns the maintenance mode on or off. During the
+// maintenance, every user message is answered with the maintenance notice of
+// its provider instead of being sent to the backend. It is safe to call it
+// while the frontend is running.
+func (f *Frontend) SetMaintenance(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+
+	atomic.StoreInt32(&f.maintenance, value)
+	logger.WithField("enabled", enabled).Warn("Maintenance mode changed")
+}
+
+// Maintenance returns true when the maintenance mode is on.
+func (f *Frontend) Maintenance() bool {
+	return atomic.LoadInt32(&f.maintenance) == 1
+}
+
+// MaintenanceHandler returns the handler of the admin HTTP API toggling the
+// maintenance mode. GET returns the mode and POST sets it from the enabled
+// query parameter (ex: POST /maintenance?enabled=true).
+func (f *Frontend) MaintenanceHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+			if err != nil {
+				http.Error(w, "invalid enabled parameter", http.StatusBadRequest)
+				return
+			}
+
+			f.SetMaintenance(enabled)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"enabled": f.Maintenance()})
+	})
+}
+
+// replyMaintenance answers the user message with the maintenance notice of
+// its provider.
+func (f *Frontend) replyMaintenance(userInput *provider.CapsuleProvider) error {
+	for _, p := range f.activatedProviders {
+		if p.GetLabel() != userInput.ProviderLabel {
+			continue
+		}
+
+		c := toCapsule(userInput)
+		c.Responses = []string{f.maintenanceNotices[userInput.ProviderLabel]}
+		return p.Message(c)
+	}
+
+	return errors.NotFoundf("frontend provider %s", userInput.ProviderLabel)
+}
@@ -0,0 +1,81 @@
+package frontend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/google/uuid"
+)
+
+// toggleMaintenance sets the maintenance mode through the admin API.
+func toggleMaintenance(t *testing.T, f *Frontend, enabled string) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	f.MaintenanceHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/maintenance?enabled="+enabled, nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"enabled":`+enabled) {
+		t.Fatalf("response %d %s, want the maintenance %s", w.Code, w.Body, enabled)
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	p := newFakeProvider("fake")
+	f, userInput, toBackend, _ := newTestFrontend(p)
+	f.maintenanceNotices["fake"] = defaultMaintenanceNotice
+	done := startFrontend(f)
+	defer func() {
+		close(userInput)
+		<-done
+	}()
+
+	toggleMaintenance(t, f, "true")
+	userInput <- &provider.CapsuleProvider{OriginalMessage: uuid.New(), ProviderLabel: "fake", User: "alice", Content: "hello"}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(p.deliveries()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("maintenance notice not delivered")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	if deliveries := p.deliveries(); deliveries[0].Responses[0] != defaultMaintenanceNotice {
+		t.Errorf("responses = %q, want the maintenance notice", deliveries[0].Responses)
+	}
+
+	if len(toBackend) != 0 {
+		t.Fatalf("capsules sent to the backend = %d, want none during the maintenance", len(toBackend))
+	}
+
+	// The messages reach the backend again once the maintenance is over.
+	toggleMaintenance(t, f, "false")
+	userInput <- &provider.CapsuleProvider{OriginalMessage: uuid.New(), ProviderLabel: "fake", User: "alice", Content: "hello"}
+
+	select {
+	case c := <-toBackend:
+		if c.Content != "hello" {
+			t.Errorf("capsule = %+v, want the user message", c)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no capsule sent to the backend after the maintenance")
+	}
+}
+
+func TestMaintenanceHandlerInvalid(t *testing.T) {
+	f, _, _, _ := newTestFrontend(newFakeProvider("fake"))
+
+	w := httptest.NewRecorder()
+	f.MaintenanceHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/maintenance?enabled=maybe", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	if f.Maintenance() {
+		t.Error("maintenance enabled by an invalid request")
+	}
+}
@@ -0,0 +1,76 @@
+package frontend
+
+import (
+	"path/filepath"
+	"plugin"
+	"strings"
+
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/juju/errors"
+)
+
+const (
+	// pluginDir is the name of the environment variable containing the
+	// directory of the provider plugins. No plugin is loaded when it is empty.
+	pluginDir = "FRONTEND_PLUGIN_DIR"
+
+	// pluginSymbol is the symbol a provider plugin must export: a function
+	// returning a new provider.
+	pluginSymbol = "NewProvider"
+)
+
+// loadPlugins registers the providers of the Go plugins (.so files) found in
+// the given directory, under their label. A plugin which cannot be loaded is
+// skipped. Go plugins are only supported on Linux, FreeBSD and macOS, and
+// must be built with the same Go version and dependencies as Samantha
+// (go build -buildmode=plugin).
+func loadPlugins(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.so"))
+	if err != nil {
+		return errors.Annotate(err, "listing plugins")
+	}
+
+	for _, path := range paths {
+		label, err := loadPlugin(path)
+		if err != nil {
+			logger.WithError(err).WithField("plugin", path).Warn("Cannot load provider plugin")
+			continue
+		}
+
+		logger.WithField("plugin", path).Infof("Provider plugin %s loaded", label)
+	}
+
+	return nil
+}
+
+// loadPlugin registers the provider of the given plugin and returns its
+// label.
+func loadPlugin(path string) (string, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return "", errors.Annotate(err, "opening plugin")
+	}
+
+	symbol, err := p.Lookup(pluginSymbol)
+	if err != nil {
+		return "", errors.Annotate(err, "looking up plugin symbol")
+	}
+
+	newProvider, ok := symbol.(func() provider.Provider)
+	if !ok {
+		return "", errors.NotValidf("%s symbol of type %T", pluginSymbol, symbol)
+	}
+
+	instance := newProvider()
+	if instance == nil {
+		return "", errors.NotValidf("nil provider")
+	}
+
+	label := strings.ToLower(instance.GetLabel())
+	if _, ok := providerCollection[label]; ok {
+		return "", errors.AlreadyExistsf("provider %s", label)
+	}
+
+	providerCollection[label] = instance
+	return label, nil
+}
@@ -0,0 +1,123 @@
+package frontend
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"testing"
+)
+
+var (
+	// testPlugin is the test plugin, built and loaded once per test binary
+	// since a Go plugin cannot be loaded twice.
+	testPlugin struct {
+		// once builds and loads the plugin once.
+		once sync.Once
+
+		// dir is the directory of the plugin, next to a file which is not a
+		// plugin.
+		dir string
+
+		// skipped is the reason why the plugin cannot be built.
+		skipped string
+
+		// err is the error of the loading.
+		err error
+	}
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if len(testPlugin.dir) > 0 {
+		os.RemoveAll(testPlugin.dir)
+	}
+
+	os.Exit(code)
+}
+
+// buildPlugin builds the test plugin in the given directory, with the same
+// race detector setting as the test binary. It returns the output of the
+// build when it fails.
+func buildPlugin(dir string) (string, error) {
+	args := []string{"build", "-buildmode=plugin", "-o", filepath.Join(dir, "plugin.so")}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "-race" && setting.Value == "true" {
+				args = append(args, "-race")
+			}
+		}
+	}
+
+	output, err := exec.Command("go", append(args, "./testdata/plugin")...).CombinedOutput()
+	return string(output), err
+}
+
+// loadTestPlugin builds the test plugin and loads the plugins of its
+// directory on the first call, and returns the directory.
+func loadTestPlugin(t *testing.T) string {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("building a plugin is slow")
+	}
+
+	testPlugin.once.Do(func() {
+		dir, err := ioutil.TempDir("", "plugin")
+		if err != nil {
+			testPlugin.err = err
+			return
+		}
+		testPlugin.dir = dir
+
+		if output, err := buildPlugin(dir); err != nil {
+			testPlugin.skipped = fmt.Sprintf("cannot build plugin: %v\n%s", err, output)
+			return
+		}
+
+		// A file which is not a plugin is skipped.
+		if err := ioutil.WriteFile(filepath.Join(dir, "broken.so"), []byte("not a plugin"), 0600); err != nil {
+			testPlugin.err = err
+			return
+		}
+
+		testPlugin.err = loadPlugins(dir)
+	})
+
+	if len(testPlugin.skipped) > 0 {
+		t.Skip(testPlugin.skipped)
+	}
+
+	if testPlugin.err != nil {
+		t.Fatalf("loading plugins error = %v", testPlugin.err)
+	}
+
+	return testPlugin.dir
+}
+
+func TestLoadPlugins(t *testing.T) {
+	dir := loadTestPlugin(t)
+
+	p, ok := providerCollection["plugin"]
+	if !ok {
+		t.Fatal("the plugin provider is not registered")
+	}
+
+	if label := p.GetLabel(); label != "Plugin" {
+		t.Errorf("label = %q, want Plugin", label)
+	}
+
+	// A provider cannot be registered twice.
+	if _, err := loadPlugin(filepath.Join(dir, "plugin.so")); err == nil {
+		t.Error("expected an error when the provider is already registered")
+	}
+}
+
+func TestLoadPluginsEmptyDir(t *testing.T) {
+	if err := loadPlugins(t.TempDir()); err != nil {
+		t.Errorf("loadPlugins() error = %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package provider
+
+import (
+	"encoding/json"
+	"expvar"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+)
+
+type (
+	// Feedback is the rating of a bot answer by a user.
+	Feedback struct {
+		// OriginalMessage is the UUID of the message whose answer is rated.
+		OriginalMessage uuid.UUID `json:"originalMessage"`
+
+		// ProviderLabel is the label of the provider of the user.
+		ProviderLabel string `json:"providerLabel"`
+
+		// User is the name of the user.
+		User string `json:"user"`
+
+		// Intent is the intent of the rated answer. It is empty when the answer
+		// has no intent.
+		Intent string `json:"intent"`
+
+		// Positive is true for a thumbs up and false for a thumbs down.
+		Positive bool `json:"positive"`
+
+		// Time is the time of the rating.
+		Time time.Time `json:"time"`
+	}
+
+	// FeedbackSink stores the feedbacks of the users.
+	FeedbackSink interface {
+		// Record stores the feedback.
+		Record(feedback *Feedback) error
+	}
+
+	// FileFeedbackSink appends the feedbacks to a file, as JSON lines.
+	FileFeedbackSink struct {
+		// path is the path of the file.
+		path string
+
+		// mutex serializes the writes.
+		mutex sync.Mutex
+	}
+)
+
+var (
+	// feedbackMetrics counts the feedbacks by intent and rating (ex:
+	// get_time.up).
+	feedbackMetrics = expvar.NewMap("frontendFeedback")
+)
+
+// NewFileFeedbackSink initializes a sink appending the feedbacks to the file
+// at the given path. The file is created if needed.
+func NewFileFeedbackSink(path string) *FileFeedbackSink {
+	return &FileFeedbackSink{path: path}
+}
+
+// Record appends the feedback to the file.
+func (s *FileFeedbackSink) Record(feedback *Feedback) error {
+	data, err := json.Marshal(feedback)
+	if err != nil {
+		return errors.Annotate(err, "recording feedback")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Annotate(err, "recording feedback")
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return errors.Annotate(err, "recording feedback")
+	}
+
+	return nil
+}
+
+// RecordFeedback counts the feedback in the metrics and stores it in the sink.
+// A nil sink only counts the feedback.
+func RecordFeedback(sink FeedbackSink, feedback *Feedback) error {
+	rating := "down"
+	if feedback.Positive {
+		rating = "up"
+	}
+
+	intent := feedback.Intent
+	if len(intent) == 0 {
+		intent = "none"
+	}
+
+	feedbackMetrics.Add(intent+"."+rating, 1)
+
+	if sink == nil {
+		return nil
+	}
+
+	return sink.Record(feedback)
+}
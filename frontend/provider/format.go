@@ -0,0 +1,30 @@
+package provider
+
+type (
+	// MessageFormatter is implemented by the providers formatting the
+	// responses in the markup of their platform (ex: Markdown, HTML).
+	MessageFormatter interface {
+		// Format returns the text of the output as sent to the user.
+		Format(output *Output) string
+	}
+
+	// Output is a response to send to a user, independent of its
+	// presentation. Each provider formats it idiomatically.
+	Output struct {
+		// Text is the text of the response.
+		Text string
+
+		// Code is true when the text is code, which must be displayed
+		// verbatim in a monospace font when possible.
+		Code bool
+	}
+
+	// PlainFormatter formats the outputs as plain text. It is the formatter
+	// of the providers without markup.
+	PlainFormatter struct{}
+)
+
+// Format returns the text of the output unchanged.
+func (PlainFormatter) Format(output *Output) string {
+	return output.Text
+}
@@ -0,0 +1,23 @@
+package provider
+
+import (
+	"testing"
+)
+
+func TestPlainFormatter(t *testing.T) {
+	tests := []struct {
+		name   string
+		output *Output
+	}{
+		{"text", &Output{Text: "Hello *alice*"}},
+		{"code", &Output{Text: "a := 1", Code: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (PlainFormatter{}).Format(tt.output); got != tt.output.Text {
+				t.Errorf("Format() = %q, want %q", got, tt.output.Text)
+			}
+		})
+	}
+}
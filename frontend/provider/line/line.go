@@ -0,0 +1,518 @@
+package line
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/fberrez/samantha/frontend/provider/webhook"
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Line contains all variables needed to communicate with the LINE
+	// Messaging API. User messages are received on a webhook.
+	Line struct {
+		// AuthorizedUsers is a authorized users slice. The LINE user ID of an
+		// authorized user is its name.
+		AuthorizedUsers []*provider.User
+
+		// AllowAllUsers disables the authorization check: anyone can talk to
+		// the bot.
+		AllowAllUsers bool
+
+		// RateLimiter limits the number of messages of each user. It is nil when
+		// the messages are not limited.
+		RateLimiter *provider.RateLimiter
+
+		// LogSampler samples the logs of the received messages. It is nil when
+		// every message is logged.
+		LogSampler *provider.LogSampler
+
+		// token is the channel access token.
+		token string
+
+		// secret is the channel secret used to validate the webhook signatures.
+		secret string
+
+		// server is the webhook server.
+		server *webhook.Server
+
+		// client is the http client calling the LINE Messaging API.
+		client *http.Client
+
+		// pendingMessages keeps the received messages that have not been
+		// answered.
+		pendingMessages *provider.PendingMessages
+
+		// IDGenerator generates the UUIDs of the user messages.
+		IDGenerator capsule.IDGenerator
+
+		// userInput is a channel connected to the frontend manager. It is used to
+		// send user messages to that manager.
+		userInput chan<- *provider.CapsuleProvider
+	}
+
+	// message represents user messages.
+	message struct {
+		// uuid is the message uuid.
+		uuid uuid.UUID
+
+		// replyToken is the token used to reply to the message.
+		replyToken string
+
+		// receivedAt is the reception time of the message.
+		receivedAt time.Time
+
+		// userID is the LINE ID of the user who sent the message.
+		userID string
+	}
+
+	// webhookRequest is the body of a webhook request.
+	webhookRequest struct {
+		// Events is a slice containing the webhook events.
+		Events []*event `json:"events"`
+	}
+
+	// event is a webhook event.
+	event struct {
+		// Type is the event type (ex: message).
+		Type string `json:"type"`
+
+		// ReplyToken is the token used to reply to the event.
+		ReplyToken string `json:"replyToken"`
+
+		// Source is the source of the event.
+		Source *source `json:"source"`
+
+		// Message is the message of a message event.
+		Message *eventMessage `json:"message"`
+	}
+
+	// source is the source of an event.
+	source struct {
+		// Type is the source type (ex: user).
+		Type string `json:"type"`
+
+		// UserID is the LINE ID of the user.
+		UserID string `json:"userId"`
+	}
+
+	// eventMessage is the message of a message event.
+	eventMessage struct {
+		// Type is the message type (ex: text).
+		Type string `json:"type"`
+
+		// Text is the message text.
+		Text string `json:"text"`
+	}
+
+	// textMessage is a text message sent to a user.
+	textMessage struct {
+		// Type is the message type.
+		Type string `json:"type"`
+
+		// Text is the message text.
+		Text string `json:"text"`
+
+		// QuickReply contains the buttons displayed under the message.
+		QuickReply *quickReply `json:"quickReply,omitempty"`
+	}
+
+	// quickReply contains the quick reply buttons of a message.
+	quickReply struct {
+		// Items is a slice containing the buttons.
+		Items []*quickReplyItem `json:"items"`
+	}
+
+	// quickReplyItem is a quick reply button.
+	quickReplyItem struct {
+		// Type is the item type.
+		Type string `json:"type"`
+
+		// Action is the action triggered by the button.
+		Action *messageAction `json:"action"`
+	}
+
+	// messageAction is an action sending a message on behalf of the user.
+	messageAction struct {
+		// Type is the action type.
+		Type string `json:"type"`
+
+		// Label is the label of the button.
+		Label string `json:"label"`
+
+		// Text is the text sent by the user.
+		Text string `json:"text"`
+	}
+
+	// replyRequest is the body of a reply request.
+	replyRequest struct {
+		// ReplyToken is the token of the message to reply to.
+		ReplyToken string `json:"replyToken"`
+
+		// Messages is a slice containing the messages to send.
+		Messages []*textMessage `json:"messages"`
+	}
+
+	// pushRequest is the body of a push request.
+	pushRequest struct {
+		// To is the LINE ID of the user.
+		To string `json:"to"`
+
+		// Messages is a slice containing the messages to send.
+		Messages []*textMessage `json:"messages"`
+	}
+)
+
+const (
+	// label is the provider label.
+	label = "line"
+
+	// apiURL is the URL of the LINE Messaging API.
+	apiURL = "https://api.line.me/v2/bot/message"
+
+	// signatureHeader is the header containing the webhook request signature.
+	signatureHeader = "X-Line-Signature"
+
+	// replyTokenLifetime is the duration after which a reply token is
+	// considered as stale.
+	replyTokenLifetime = 30 * time.Second
+
+	// maxMessages is the maximum number of messages sent in one request.
+	maxMessages = 5
+
+	// maxQuickReplyItems is the maximum number of quick reply buttons.
+	maxQuickReplyItems = 13
+
+	// maxLabelLength is the maximum length of a quick reply button label.
+	maxLabelLength = 20
+)
+
+var (
+	// logger is a global logger of the package
+	logger = provider.NewLogger(label)
+)
+
+// Initialize initiliazes a provider with the given channel access token,
+// channel secret, slice of authorized users and user inputs write-only channel.
+func (l *Line) Initialize(config *provider.Config) (provider.Provider, error) {
+	logger.Debugf("Initializing %s", label)
+
+	if len(config.Secret) == 0 {
+		return nil, errors.NotValidf("empty channel secret")
+	}
+
+	client := &Line{
+		AuthorizedUsers: config.AuthorizedUsers,
+		AllowAllUsers:   config.AllowAllUsers,
+		RateLimiter:     provider.NewRateLimiter(config.RateLimit, provider.RateLimitWindow),
+		LogSampler:      provider.NewLogSampler(config.LogSampling),
+		token:           config.Token,
+		secret:          config.Secret,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		pendingMessages: provider.NewPendingMessages(),
+		IDGenerator:     capsule.RandomGenerator{},
+		userInput:       config.UserInput,
+	}
+
+	server, err := webhook.New(&webhook.Config{
+		Listen:      config.Listen,
+		TLSCertFile: config.TLSCertFile,
+		TLSKeyFile:  config.TLSKeyFile,
+		Secret:      config.WebhookSecret,
+	}, http.HandlerFunc(client.webhookHandler))
+	if err != nil {
+		return nil, errors.Annotate(err, "initializing line")
+	}
+
+	client.server = server
+	return client, nil
+}
+
+// Start starts the webhook server.
+func (l *Line) Start() {
+	logger.Debugf("Starting %s on %s", label, l.server.Addr())
+
+	if err := l.server.Start(); err != nil {
+		logger.WithError(err).Error("Webhook server stopped")
+	}
+}
+
+// Message sends the text message to the user.
+func (l *Line) Message(capsule *capsule.Capsule) error {
+	pending, err := l.pendingMessages.Take(capsule.OriginalMessage)
+	if err != nil {
+		return err
+	}
+	pendingMessage := pending.(*message)
+
+	if capsule.Error != nil && len(capsule.Error.Error()) > 0 {
+		return l.send(pendingMessage, []string{provider.SystemLog(capsule.Error.Error(), provider.ErrorStatus)}, nil)
+	}
+
+	return l.send(pendingMessage, capsule.Responses, capsule.Suggestions)
+}
+
+// Notify pushes the text to the user or group whose LINE ID is given.
+func (l *Line) Notify(chat string, text string) error {
+	return l.call("/push", &pushRequest{
+		To:       chat,
+		Messages: []*textMessage{{Type: "text", Text: text}},
+	})
+}
+
+// Capabilities returns the capabilities of the provider. The suggestions are
+// displayed as quick reply buttons.
+func (l *Line) Capabilities() *capsule.Capabilities {
+	return &capsule.Capabilities{Buttons: true}
+}
+
+// GetLabel returns the label of the provider
+func (l *Line) GetLabel() string {
+	return label
+}
+
+// Stop closes the webhook server.
+func (l *Line) Stop() error {
+	if err := l.server.Stop(); err != nil {
+		return errors.Annotate(err, "closing webhook server")
+	}
+
+	return nil
+}
+
+// webhookHandler handles the webhook requests sent by LINE.
+func (l *Line) webhookHandler(w http.ResponseWriter, r *http.Request) {
+	localLogger := logger.WithField("action", "receiving user message")
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "cannot read body", http.StatusBadRequest)
+		return
+	}
+
+	if !l.validSignature(body, r.Header.Get(signatureHeader)) {
+		localLogger.Debug("Webhook request received with an invalid signature")
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	request := webhookRequest{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		http.Error(w, "cannot unmarshal body", http.StatusBadRequest)
+		return
+	}
+
+	for _, e := range request.Events {
+		if e.Type != "message" || e.Message == nil || e.Message.Type != "text" || e.Source == nil {
+			continue
+		}
+
+		if !l.AllowAllUsers && l.authorizedUser(e.Source.UserID) == nil {
+			localLogger.WithFields(log.Fields{
+				"from":    e.Source.UserID,
+				"message": e.Message.Text,
+			}).Debug("User message received from unauthorized user")
+			continue
+		}
+
+		if l.LogSampler.Sample() {
+			localLogger.WithFields(log.Fields{
+				"from":    e.Source.UserID,
+				"message": e.Message.Text,
+			}).Debug("User message received")
+		}
+
+		if !l.RateLimiter.Allow(e.Source.UserID) {
+			localLogger.WithField("from", e.Source.UserID).Debug("User rate limit exceeded")
+			err := l.call("/reply", &replyRequest{
+				ReplyToken: e.ReplyToken,
+				Messages:   []*textMessage{{Type: "text", Text: provider.SystemLog(provider.RateLimitMessage, provider.Info)}},
+			})
+			if err != nil {
+				localLogger.WithError(err).Error("Cannot reply to rate-limited user")
+			}
+			continue
+		}
+
+		if err := l.processUserMessage(e); err != nil {
+			localLogger.WithError(err).Error("Cannot process user message")
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// validSignature verifies that the given signature is the base64-encoded
+// HMAC-SHA256 of the body computed with the channel secret.
+func (l *Line) validSignature(body []byte, signature string) bool {
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(l.secret))
+	mac.Write(body)
+	return hmac.Equal(decoded, mac.Sum(nil))
+}
+
+// authorizedUser returns the authorized user whose LINE user ID is given, or
+// nil if the user is not authorized.
+func (l *Line) authorizedUser(userID string) *provider.User {
+	for _, user := range l.AuthorizedUsers {
+		if user.Name == userID {
+			return user
+		}
+	}
+
+	return nil
+}
+
+// processUserMessage processes a message event by adding it to the pending
+// messages, converting it to a provider capsule and sending it to the
+// frontend manager.
+func (l *Line) processUserMessage(e *event) error {
+	// Generates a new UUID.
+	uuid, err := l.IDGenerator.New()
+	if err != nil {
+		return errors.Annotate(err, "processing user message")
+	}
+
+	message := &message{
+		uuid:       uuid,
+		replyToken: e.ReplyToken,
+		receivedAt: time.Now(),
+		userID:     e.Source.UserID,
+	}
+
+	capsuleProvider := &provider.CapsuleProvider{
+		OriginalMessage: message.uuid,
+		ProviderLabel:   label,
+		Content:         e.Message.Text,
+		User:            message.userID,
+		Chat:            message.userID,
+	}
+
+	if user := l.authorizedUser(message.userID); user != nil {
+		capsuleProvider.Locale = user.Locale
+		capsuleProvider.Timezone = user.Timezone
+	}
+
+	// Sends the provider capsule-formatted message to the frontend manager,
+	// and keeps the message until it is answered. The user is asked to retry
+	// when the frontend manager is overloaded.
+	if !l.pendingMessages.Forward(l.userInput, capsuleProvider, message) {
+		if err := l.send(message, []string{provider.SystemLog(provider.BusyMessage, provider.Info)}, nil); err != nil {
+			return errors.Annotate(err, "sending busy message")
+		}
+	}
+
+	return nil
+}
+
+// send sends the given texts to the user of the pending message. The reply
+// token is used for the first request if it is not stale, the push API is
+// used otherwise. The suggestions are displayed as quick reply buttons under
+// the last text.
+func (l *Line) send(pendingMessage *message, texts []string, suggestions []string) error {
+	canReply := time.Since(pendingMessage.receivedAt) < replyTokenLifetime
+
+	for len(texts) > 0 {
+		n := len(texts)
+		if n > maxMessages {
+			n = maxMessages
+		}
+
+		messages := []*textMessage{}
+		for _, text := range texts[:n] {
+			messages = append(messages, &textMessage{Type: "text", Text: text})
+		}
+		texts = texts[n:]
+
+		if len(texts) == 0 && len(suggestions) > 0 {
+			messages[len(messages)-1].QuickReply = newQuickReply(suggestions)
+		}
+
+		if canReply {
+			// A reply token can be used only once.
+			canReply = false
+			err := l.call("/reply", &replyRequest{ReplyToken: pendingMessage.replyToken, Messages: messages})
+			if err == nil {
+				continue
+			}
+
+			logger.WithError(err).Warn("Cannot reply to user message, falling back to push")
+		}
+
+		if err := l.call("/push", &pushRequest{To: pendingMessage.userID, Messages: messages}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newQuickReply returns the quick reply buttons of the given suggestions.
+func newQuickReply(suggestions []string) *quickReply {
+	items := []*quickReplyItem{}
+	for _, suggestion := range suggestions {
+		if len(items) == maxQuickReplyItems {
+			break
+		}
+
+		label := []rune(suggestion)
+		if len(label) > maxLabelLength {
+			label = label[:maxLabelLength]
+		}
+
+		items = append(items, &quickReplyItem{
+			Type: "action",
+			Action: &messageAction{
+				Type:  "message",
+				Label: string(label),
+				Text:  suggestion,
+			},
+		})
+	}
+
+	return &quickReply{Items: items}
+}
+
+// call sends the given payload to the given endpoint of the LINE Messaging API.
+func (l *Line) call(endpoint string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Annotatef(err, "calling %s", endpoint)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, apiURL+endpoint, bytes.NewReader(data))
+	if err != nil {
+		return errors.Annotatef(err, "calling %s", endpoint)
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+l.token)
+
+	response, err := l.client.Do(request)
+	if err != nil {
+		return errors.Annotatef(err, "calling %s", endpoint)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(response.Body)
+		return errors.Errorf("calling %s: %s: %s", endpoint, response.Status, body)
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package provider
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// LogSampler samples the per-message logs: one message out of rate is
+	// logged. A nil sampler logs all the messages.
+	LogSampler struct {
+		// rate is the sampling rate.
+		rate uint64
+
+		// count is the number of sampled messages.
+		count uint64
+	}
+
+	// standardOutput writes on the output of the standard logger, which is
+	// configured after the provider loggers are created.
+	standardOutput struct{}
+
+	// standardFormatter formats the entries with the formatter of the
+	// standard logger.
+	standardFormatter struct{}
+)
+
+var (
+	// loggersMutex protects the loggers map.
+	loggersMutex sync.Mutex
+
+	// loggers indexes the provider loggers by label.
+	loggers = map[string]*log.Logger{}
+)
+
+// NewLogger returns the logger of the given provider. It writes like the
+// standard logger, with its own level which can be set with SetLogLevel.
+func NewLogger(label string) *log.Entry {
+	loggersMutex.Lock()
+	defer loggersMutex.Unlock()
+
+	l, ok := loggers[label]
+	if !ok {
+		l = log.New()
+		l.Out = standardOutput{}
+		l.Formatter = standardFormatter{}
+		l.SetLevel(log.GetLevel())
+		loggers[label] = l
+	}
+
+	return l.WithFields(log.Fields{
+		"package":  "frontend",
+		"provider": label,
+	})
+}
+
+// SetLogLevel sets the level of the logger of the given provider. The level of
+// the standard logger is used when the level is empty.
+func SetLogLevel(label, level string) error {
+	loggersMutex.Lock()
+	defer loggersMutex.Unlock()
+
+	l, ok := loggers[label]
+	if !ok {
+		return nil
+	}
+
+	if len(level) == 0 {
+		l.SetLevel(log.GetLevel())
+		return nil
+	}
+
+	parsed, err := log.ParseLevel(level)
+	if err != nil {
+		return errors.NotValidf("log level %q", level)
+	}
+
+	l.SetLevel(parsed)
+	return nil
+}
+
+// NewLogSampler initializes a new sampler logging one message out of rate. It
+// returns nil when the rate is lower than 2.
+func NewLogSampler(rate int) *LogSampler {
+	if rate < 2 {
+		return nil
+	}
+
+	return &LogSampler{rate: uint64(rate)}
+}
+
+// Sample counts a message and verifies if it must be logged.
+func (s *LogSampler) Sample() bool {
+	if s == nil {
+		return true
+	}
+
+	return (atomic.AddUint64(&s.count, 1)-1)%s.rate == 0
+}
+
+// Write writes on the output of the standard logger.
+func (standardOutput) Write(p []byte) (int, error) {
+	return log.StandardLogger().Out.Write(p)
+}
+
+// Format formats the entry with the formatter of the standard logger.
+func (standardFormatter) Format(entry *log.Entry) ([]byte, error) {
+	return log.StandardLogger().Formatter.Format(entry)
+}
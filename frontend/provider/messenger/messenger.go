@@ -0,0 +1,489 @@
+package messenger
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/fberrez/samantha/frontend/provider/webhook"
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Messenger contains all variables needed to communicate with a Facebook
+	// page through the Messenger Platform. User messages are received on a
+	// webhook and answered with the Send API.
+	Messenger struct {
+		// AuthorizedUsers is a authorized users slice. The page-scoped ID
+		// (PSID) of an authorized user is its name.
+		AuthorizedUsers []*provider.User
+
+		// AllowAllUsers disables the authorization check: anyone can talk to
+		// the bot.
+		AllowAllUsers bool
+
+		// RateLimiter limits the number of messages of each user. It is nil when
+		// the messages are not limited.
+		RateLimiter *provider.RateLimiter
+
+		// LogSampler samples the logs of the received messages. It is nil when
+		// every message is logged.
+		LogSampler *provider.LogSampler
+
+		// token is the page access token.
+		token string
+
+		// secret is the app secret used to validate the webhook signatures.
+		secret string
+
+		// verifyToken is the token expected in the verification handshake.
+		verifyToken string
+
+		// server is the webhook server.
+		server *webhook.Server
+
+		// client is the http client calling the Send API.
+		client *http.Client
+
+		// pendingMessages keeps the received messages that have not been
+		// answered.
+		pendingMessages *provider.PendingMessages
+
+		// IDGenerator generates the UUIDs of the user messages.
+		IDGenerator capsule.IDGenerator
+
+		// userInput is a channel connected to the frontend manager. It is used to
+		// send user messages to that manager.
+		userInput chan<- *provider.CapsuleProvider
+	}
+
+	// message represents user messages.
+	message struct {
+		// uuid is the message uuid.
+		uuid uuid.UUID
+
+		// psid is the page-scoped ID of the user who sent the message.
+		psid string
+	}
+
+	// webhookRequest is the body of a webhook request.
+	webhookRequest struct {
+		// Object is the object of the subscription (ex: page).
+		Object string `json:"object"`
+
+		// Entries is a slice containing the page entries.
+		Entries []*entry `json:"entry"`
+	}
+
+	// entry is a batch of events of a page.
+	entry struct {
+		// Messaging is a slice containing the messaging events.
+		Messaging []*messagingEvent `json:"messaging"`
+	}
+
+	// messagingEvent is a messaging event.
+	messagingEvent struct {
+		// Sender is the user who sent the message.
+		Sender *participant `json:"sender"`
+
+		// Message is the message of a message event.
+		Message *eventMessage `json:"message"`
+	}
+
+	// participant is the sender or the recipient of a message.
+	participant struct {
+		// ID is the page-scoped ID of the user.
+		ID string `json:"id"`
+	}
+
+	// eventMessage is the message of a message event.
+	eventMessage struct {
+		// Text is the message text.
+		Text string `json:"text"`
+
+		// IsEcho is true for the messages sent by the page.
+		IsEcho bool `json:"is_echo"`
+	}
+
+	// sendRequest is the body of a Send API request.
+	sendRequest struct {
+		// Recipient is the user receiving the message.
+		Recipient *participant `json:"recipient"`
+
+		// MessagingType is the messaging type (ex: RESPONSE).
+		MessagingType string `json:"messaging_type"`
+
+		// Message is the sent message.
+		Message *textMessage `json:"message"`
+	}
+
+	// textMessage is a text message sent to a user.
+	textMessage struct {
+		// Text is the message text.
+		Text string `json:"text"`
+
+		// QuickReplies are the buttons displayed under the message.
+		QuickReplies []*quickReply `json:"quick_replies,omitempty"`
+	}
+
+	// quickReply is a quick reply button.
+	quickReply struct {
+		// ContentType is the content type of the button.
+		ContentType string `json:"content_type"`
+
+		// Title is the label of the button.
+		Title string `json:"title"`
+
+		// Payload is the payload sent back when the button is pressed.
+		Payload string `json:"payload"`
+	}
+)
+
+const (
+	// label is the provider label.
+	label = "messenger"
+
+	// apiURL is the URL of the Send API.
+	apiURL = "https://graph.facebook.com/v17.0/me/messages"
+
+	// signatureHeader is the header containing the webhook request signature.
+	signatureHeader = "X-Hub-Signature-256"
+
+	// signaturePrefix prefixes the hex-encoded signature.
+	signaturePrefix = "sha256="
+
+	// responseType and updateType are the messaging types of the responses
+	// and of the notifications.
+	responseType = "RESPONSE"
+	updateType   = "UPDATE"
+
+	// maxQuickReplies is the maximum number of quick reply buttons.
+	maxQuickReplies = 13
+
+	// maxTitleLength is the maximum length of a quick reply button title.
+	maxTitleLength = 20
+)
+
+var (
+	// logger is a global logger of the package
+	logger = provider.NewLogger(label)
+)
+
+// Initialize initiliazes a provider with the given page access token, app
+// secret, verify token, slice of authorized users and user inputs write-only
+// channel.
+func (m *Messenger) Initialize(config *provider.Config) (provider.Provider, error) {
+	logger.Debugf("Initializing %s", label)
+
+	if len(config.Token) == 0 {
+		return nil, errors.NotValidf("empty page access token")
+	}
+
+	if len(config.Secret) == 0 {
+		return nil, errors.NotValidf("empty app secret")
+	}
+
+	if len(config.VerifyToken) == 0 {
+		return nil, errors.NotValidf("empty verify token")
+	}
+
+	client := &Messenger{
+		AuthorizedUsers: config.AuthorizedUsers,
+		AllowAllUsers:   config.AllowAllUsers,
+		RateLimiter:     provider.NewRateLimiter(config.RateLimit, provider.RateLimitWindow),
+		LogSampler:      provider.NewLogSampler(config.LogSampling),
+		token:           config.Token,
+		secret:          config.Secret,
+		verifyToken:     config.VerifyToken,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		pendingMessages: provider.NewPendingMessages(),
+		IDGenerator:     capsule.RandomGenerator{},
+		userInput:       config.UserInput,
+	}
+
+	// The Messenger Platform cannot send the shared secret header: the
+	// requests are authenticated by their signature instead.
+	server, err := webhook.New(&webhook.Config{
+		Listen:      config.Listen,
+		TLSCertFile: config.TLSCertFile,
+		TLSKeyFile:  config.TLSKeyFile,
+	}, http.HandlerFunc(client.webhookHandler))
+	if err != nil {
+		return nil, errors.Annotate(err, "initializing messenger")
+	}
+
+	client.server = server
+	return client, nil
+}
+
+// Start starts the webhook server. The server answers the verification
+// handshake of the webhook subscription and receives the user messages.
+func (m *Messenger) Start() {
+	logger.Debugf("Starting %s on %s", label, m.server.Addr())
+
+	if err := m.server.Start(); err != nil {
+		logger.WithError(err).Error("Webhook server stopped")
+	}
+}
+
+// Message sends the text message to the user with the Send API.
+func (m *Messenger) Message(capsule *capsule.Capsule) error {
+	pending, err := m.pendingMessages.Take(capsule.OriginalMessage)
+	if err != nil {
+		return err
+	}
+	pendingMessage := pending.(*message)
+
+	if capsule.Error != nil && len(capsule.Error.Error()) > 0 {
+		return m.send(pendingMessage.psid, responseType, &textMessage{Text: provider.SystemLog(capsule.Error.Error(), provider.ErrorStatus)})
+	}
+
+	for i, response := range capsule.Responses {
+		text := &textMessage{Text: response}
+		if i == len(capsule.Responses)-1 {
+			text.QuickReplies = newQuickReplies(capsule.Suggestions)
+		}
+
+		if err := m.send(pendingMessage.psid, responseType, text); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Notify sends the text to the user whose PSID is given.
+func (m *Messenger) Notify(chat string, text string) error {
+	return m.send(chat, updateType, &textMessage{Text: text})
+}
+
+// Capabilities returns the capabilities of the provider. The suggestions
+// are displayed as quick reply buttons.
+func (m *Messenger) Capabilities() *capsule.Capabilities {
+	return &capsule.Capabilities{Buttons: true}
+}
+
+// GetLabel returns the label of the provider
+func (m *Messenger) GetLabel() string {
+	return label
+}
+
+// Stop closes the webhook server.
+func (m *Messenger) Stop() error {
+	if err := m.server.Stop(); err != nil {
+		return errors.Annotate(err, "closing webhook server")
+	}
+
+	return nil
+}
+
+// webhookHandler handles the webhook requests sent by the Messenger Platform.
+// A GET request is the verification handshake, a POST request contains
+// messaging events.
+func (m *Messenger) webhookHandler(w http.ResponseWriter, r *http.Request) {
+	localLogger := logger.WithField("action", "receiving user message")
+
+	if r.Method == http.MethodGet {
+		m.verify(w, r)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "cannot read body", http.StatusBadRequest)
+		return
+	}
+
+	if !m.validSignature(body, r.Header.Get(signatureHeader)) {
+		localLogger.Debug("Webhook request received with an invalid signature")
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	request := webhookRequest{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		http.Error(w, "cannot unmarshal body", http.StatusBadRequest)
+		return
+	}
+
+	for _, e := range request.Entries {
+		for _, event := range e.Messaging {
+			if event.Sender == nil || event.Message == nil || event.Message.IsEcho || len(event.Message.Text) == 0 {
+				continue
+			}
+
+			psid := event.Sender.ID
+			if !m.AllowAllUsers && m.authorizedUser(psid) == nil {
+				localLogger.WithFields(log.Fields{
+					"from":    psid,
+					"message": event.Message.Text,
+				}).Debug("User message received from unauthorized user")
+				continue
+			}
+
+			if m.LogSampler.Sample() {
+				localLogger.WithFields(log.Fields{
+					"from":    psid,
+					"message": event.Message.Text,
+				}).Debug("User message received")
+			}
+
+			if !m.RateLimiter.Allow(psid) {
+				localLogger.WithField("from", psid).Debug("User rate limit exceeded")
+				if err := m.send(psid, responseType, &textMessage{Text: provider.SystemLog(provider.RateLimitMessage, provider.Info)}); err != nil {
+					localLogger.WithError(err).Error("Cannot reply to rate-limited user")
+				}
+				continue
+			}
+
+			if err := m.processUserMessage(psid, event.Message.Text); err != nil {
+				localLogger.WithError(err).Error("Cannot process user message")
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// verify answers the verification handshake of the webhook subscription with
+// the challenge when the verify token matches.
+func (m *Messenger) verify(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("hub.mode") != "subscribe" || subtle.ConstantTimeCompare([]byte(query.Get("hub.verify_token")), []byte(m.verifyToken)) != 1 {
+		logger.Debug("Webhook verification received with an invalid verify token")
+		http.Error(w, "invalid verify token", http.StatusForbidden)
+		return
+	}
+
+	w.Write([]byte(query.Get("hub.challenge")))
+}
+
+// validSignature verifies that the given signature is the hex-encoded
+// HMAC-SHA256 of the body computed with the app secret.
+func (m *Messenger) validSignature(body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return false
+	}
+
+	decoded, err := hex.DecodeString(strings.TrimPrefix(signature, signaturePrefix))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(m.secret))
+	mac.Write(body)
+	return hmac.Equal(decoded, mac.Sum(nil))
+}
+
+// authorizedUser returns the authorized user whose PSID is given, or nil if
+// the user is not authorized.
+func (m *Messenger) authorizedUser(psid string) *provider.User {
+	for _, user := range m.AuthorizedUsers {
+		if user.Name == psid {
+			return user
+		}
+	}
+
+	return nil
+}
+
+// processUserMessage processes a user message by adding it to the pending
+// messages, converting it to a provider capsule and sending it to the
+// frontend manager.
+func (m *Messenger) processUserMessage(psid, text string) error {
+	// Generates a new UUID.
+	uuid, err := m.IDGenerator.New()
+	if err != nil {
+		return errors.Annotate(err, "processing user message")
+	}
+
+	message := &message{
+		uuid: uuid,
+		psid: psid,
+	}
+
+	capsuleProvider := &provider.CapsuleProvider{
+		OriginalMessage: message.uuid,
+		ProviderLabel:   label,
+		Content:         text,
+		User:            psid,
+		Chat:            psid,
+	}
+
+	if user := m.authorizedUser(psid); user != nil {
+		capsuleProvider.Locale = user.Locale
+		capsuleProvider.Timezone = user.Timezone
+	}
+
+	// Sends the provider capsule-formatted message to the frontend manager,
+	// and keeps the message until it is answered. The user is asked to retry
+	// when the frontend manager is overloaded.
+	if !m.pendingMessages.Forward(m.userInput, capsuleProvider, message) {
+		if err := m.send(psid, responseType, &textMessage{Text: provider.SystemLog(provider.BusyMessage, provider.Info)}); err != nil {
+			return errors.Annotate(err, "sending busy message")
+		}
+	}
+
+	return nil
+}
+
+// newQuickReplies returns the quick reply buttons of the given suggestions.
+func newQuickReplies(suggestions []string) []*quickReply {
+	replies := []*quickReply{}
+	for _, suggestion := range suggestions {
+		if len(replies) == maxQuickReplies {
+			break
+		}
+
+		title := []rune(suggestion)
+		if len(title) > maxTitleLength {
+			title = title[:maxTitleLength]
+		}
+
+		replies = append(replies, &quickReply{
+			ContentType: "text",
+			Title:       string(title),
+			Payload:     suggestion,
+		})
+	}
+
+	return replies
+}
+
+// send sends the text message to the user whose PSID is given with the Send
+// API.
+func (m *Messenger) send(psid, messagingType string, text *textMessage) error {
+	data, err := json.Marshal(&sendRequest{
+		Recipient:     &participant{ID: psid},
+		MessagingType: messagingType,
+		Message:       text,
+	})
+	if err != nil {
+		return errors.Annotate(err, "calling the Send API")
+	}
+
+	response, err := m.client.Post(apiURL+"?access_token="+url.QueryEscape(m.token), "application/json", bytes.NewReader(data))
+	if err != nil {
+		return errors.Annotate(err, "calling the Send API")
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(response.Body)
+		return errors.Errorf("calling the Send API: %s: %s", response.Status, body)
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package provider
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+)
+
+type (
+	// PendingMessages keeps the received messages which have not been
+	// answered yet, so the answer of a message is sent to its chat. The
+	// messages are provider-specific: each provider stores its own type. It is
+	// safe for concurrent use.
+	PendingMessages struct {
+		// mutex protects the messages map.
+		mutex sync.Mutex
+
+		// messages indexes the pending messages by original message.
+		messages map[uuid.UUID]interface{}
+	}
+)
+
+// NewPendingMessages initializes empty pending messages.
+func NewPendingMessages() *PendingMessages {
+	return &PendingMessages{messages: map[uuid.UUID]interface{}{}}
+}
+
+// Add adds the message received with the given original message ID.
+func (p *PendingMessages) Add(id uuid.UUID, message interface{}) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.messages[id] = message
+}
+
+// Take removes and returns the pending message of the given original message
+// ID.
+func (p *PendingMessages) Take(id uuid.UUID) (interface{}, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(p.messages) == 0 {
+		return nil, errors.NotProvisionedf("pending messages")
+	}
+
+	message, ok := p.messages[id]
+	if !ok {
+		return nil, errors.NotFoundf("message (uuid: %s)", id)
+	}
+
+	delete(p.messages, id)
+	return message, nil
+}
+
+// Forward adds the message to the pending messages and sends its provider
+// capsule to the frontend manager without blocking. When the user input
+// channel is full, the message is removed and false is returned, in which
+// case the provider should answer the user with BusyMessage.
+func (p *PendingMessages) Forward(userInput chan<- *CapsuleProvider, capsuleProvider *CapsuleProvider, message interface{}) bool {
+	p.Add(capsuleProvider.OriginalMessage, message)
+	if Forward(userInput, capsuleProvider) {
+		return true
+	}
+
+	p.Take(capsuleProvider.OriginalMessage)
+	return false
+}
@@ -0,0 +1,56 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+)
+
+func TestPendingMessages(t *testing.T) {
+	p := NewPendingMessages()
+	first, second := uuid.New(), uuid.New()
+	p.Add(first, "first")
+	p.Add(second, "second")
+
+	if message, err := p.Take(second); err != nil || message != "second" {
+		t.Errorf("Take() = %v, %v, want the second message", message, err)
+	}
+
+	// A message is taken once.
+	if _, err := p.Take(second); !errors.IsNotFound(err) {
+		t.Errorf("Take() error = %v, want a not found error", err)
+	}
+
+	if message, err := p.Take(first); err != nil || message != "first" {
+		t.Errorf("Take() = %v, %v, want the first message", message, err)
+	}
+
+	if _, err := p.Take(first); !errors.IsNotProvisioned(err) {
+		t.Errorf("Take() error = %v, want a not provisioned error", err)
+	}
+}
+
+func TestPendingMessagesForward(t *testing.T) {
+	p := NewPendingMessages()
+	userInput := make(chan *CapsuleProvider, 1)
+
+	accepted := &CapsuleProvider{OriginalMessage: uuid.New()}
+	if !p.Forward(userInput, accepted, "accepted") {
+		t.Fatal("Forward() = false with room in the user input channel")
+	}
+
+	// The channel is full: the message is not kept.
+	rejected := &CapsuleProvider{OriginalMessage: uuid.New()}
+	if p.Forward(userInput, rejected, "rejected") {
+		t.Fatal("Forward() = true with a full user input channel")
+	}
+
+	if _, err := p.Take(rejected.OriginalMessage); err == nil {
+		t.Error("rejected message kept in the pending messages")
+	}
+
+	if message, err := p.Take(accepted.OriginalMessage); err != nil || message != "accepted" {
+		t.Errorf("Take() = %v, %v, want the accepted message", message, err)
+	}
+}
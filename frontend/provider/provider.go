@@ -23,8 +23,73 @@ type (
 		// GetLabel returns the label of the provider
 		GetLabel() string
 
-		// Stop closes the provider listener.
-		Stop()
+		// Stop closes the provider listener. It returns an error if the
+		// provider could not be stopped cleanly.
+		Stop() error
+	}
+
+	// Notifier is implemented by the providers able to send a message to a
+	// given chat without replying to a user message.
+	Notifier interface {
+		// Notify sends the text to the given chat.
+		Notify(chat string, text string) error
+	}
+
+	// StreamReceiver is implemented by the providers able to display a
+	// streamed response as it is generated. The streamed responses are
+	// collected and sent with Message to the other providers.
+	StreamReceiver interface {
+		// MessageStream sends the chunks received from the capsule stream to
+		// the user.
+		MessageStream(capsule *capsule.Capsule) error
+	}
+
+	// StatusReceiver is implemented by the providers able to display the
+	// interim statuses of the backend (ex: typing) until the answer arrives.
+	// The statuses are ignored for the other providers.
+	StatusReceiver interface {
+		// Status displays the status of the given message, replacing its
+		// previous status.
+		Status(originalMessage uuid.UUID, status string) error
+	}
+
+	// Capable is implemented by the providers declaring the content they can
+	// display. The capabilities are sent to the backend with the capsules.
+	Capable interface {
+		// Capabilities returns the capabilities of the provider.
+		Capabilities() *capsule.Capabilities
+	}
+
+	// StartupOrderer is implemented by the providers which must be started
+	// before or after the others (ex: a provider serving a webhook shared by
+	// several providers).
+	StartupOrderer interface {
+		// StartupOrder returns the startup order of the provider. The providers
+		// are started by ascending order, the default order being zero.
+		StartupOrder() int
+	}
+
+	// Forgetter is implemented by the providers keeping data about their
+	// users, so it can be deleted on request.
+	Forgetter interface {
+		// Forget deletes the data kept about the user of the given message.
+		// The message stays pending so the deletion can be confirmed.
+		Forget(originalMessage uuid.UUID) error
+	}
+
+	// Repeater is implemented by the providers keeping the last answers sent
+	// to their users, so the repeat command can send them again.
+	Repeater interface {
+		// Repeat sends again the last answer to the user of the given
+		// message.
+		Repeat(originalMessage uuid.UUID) error
+	}
+
+	// Synthesizer converts the text responses to speech, for the providers
+	// able to reply with voice messages.
+	Synthesizer interface {
+		// Synthesize returns the audio of the spoken text, encoded in OGG/Opus.
+		Synthesize(text string) ([]byte, error)
 	}
 
 	// Config is a structured configuration for provider
@@ -32,10 +97,144 @@ type (
 		// Token is the API provider token
 		Token string
 
+		// Secret is the API provider secret, used by webhook-based providers to
+		// validate the requests they receive.
+		Secret string
+
+		// Username is the account of the providers connecting to a server.
+		Username string
+
+		// Password is the password of the account of the providers which
+		// authenticate as a user.
+		Password string
+
+		// Server is the address of the server the provider connects to.
+		Server string
+
+		// Listen is the address on which webhook-based providers listen.
+		Listen string
+
+		// TLSCertFile is the TLS certificate path of webhook-based providers.
+		TLSCertFile string
+
+		// TLSKeyFile is the TLS private key path of webhook-based providers.
+		TLSKeyFile string
+
+		// WebhookSecret is the shared secret webhook-based providers expect in
+		// the requests they receive.
+		WebhookSecret string
+
+		// Mode is the way the provider receives the user messages, for the
+		// providers supporting several ways (ex: longpoll or webhook for
+		// Telegram).
+		Mode string
+
+		// WebhookURL is the public URL to which the messages are pushed in
+		// webhook mode.
+		WebhookURL string
+
+		// VerifyToken is the token webhook-based providers expect in the
+		// verification handshake of their subscription.
+		VerifyToken string
+
 		// AutorizedUsers is a slice containing all authorized users.
 		// These users are authorized to use the frontend provider.
 		AuthorizedUsers []*User
 
+		// UserStore is the store of the authorized users, in which the
+		// providers removing users persist their changes.
+		UserStore UserStore
+
+		// AllowAllUsers disables the authorization: anyone can use the
+		// frontend provider.
+		AllowAllUsers bool
+
+		// UnauthorizedMessage is sent once to each unauthorized user. The
+		// unauthorized users are silently ignored when it is empty.
+		UnauthorizedMessage string
+
+		// RateLimit is the maximum number of messages per minute of a user. The
+		// messages are not limited when it is zero.
+		RateLimit int
+
+		// RemoveUnreachableUsers is the number of consecutive delivery failures
+		// after which a user who blocked the bot is removed from the authorized
+		// users. Users are never removed when it is zero.
+		RemoveUnreachableUsers int
+
+		// AckReaction is the reaction set on user messages to acknowledge their
+		// receipt. It is ignored by providers which do not support reactions.
+		AckReaction string
+
+		// MinMessageLength is the minimum length of a trimmed text message.
+		// Shorter messages are not forwarded.
+		MinMessageLength int
+
+		// MaxInputLength is the maximum length of a text message. Longer
+		// messages are truncated, or rejected when RejectLongInput is true. The
+		// messages are not limited when it is zero.
+		MaxInputLength int
+
+		// RejectLongInput rejects the messages longer than MaxInputLength
+		// instead of truncating them.
+		RejectLongInput bool
+
+		// FormatCode enables the formatting of the responses looking like code.
+		FormatCode bool
+
+		// AllowedChatTypes is a slice containing the types of the chats in
+		// which the provider answers (ex: private).
+		AllowedChatTypes []string
+
+		// AllowedChatIDs is a slice containing the IDs of the chats in which
+		// the provider answers whatever their type. The provider answers in
+		// every chat when both allowlists are empty.
+		AllowedChatIDs []int64
+
+		// GroupMode enables the mention-gating in group chats.
+		GroupMode bool
+
+		// HandleChannelPosts enables the processing of the channel posts
+		// starting with ChannelTrigger.
+		HandleChannelPosts bool
+
+		// ChannelTrigger is the prefix of the processed channel posts.
+		ChannelTrigger string
+
+		// CorrectEditedMessages handles the edited messages as corrections
+		// superseding the original messages. The edits are ignored otherwise.
+		CorrectEditedMessages bool
+
+		// MaxFileSize is the maximum size in bytes of the files sent by users.
+		MaxFileSize int
+
+		// MaxResponseBubbles is the maximum number of responses sent for a
+		// message. The responses are not limited when it is zero.
+		MaxResponseBubbles int
+
+		// ResponsePrefix is prepended to each response sent to the users (ex:
+		// "Sam: "). The responses are not prefixed when it is empty.
+		ResponsePrefix string
+
+		// CollectFeedback enables the rating of the answers by the users.
+		CollectFeedback bool
+
+		// FeedbackSink stores the ratings of the answers. The ratings are only
+		// counted in the metrics when it is nil.
+		FeedbackSink FeedbackSink
+
+		// Synthesizer converts the responses to voice messages. The responses
+		// are only sent as text when it is nil.
+		Synthesizer Synthesizer
+
+		// VoiceResponses sends the voice messages to every user. Otherwise,
+		// they are only sent in reply to audio messages.
+		VoiceResponses bool
+
+		// LogSampling is the sampling rate of the logs of the received
+		// messages: one message out of LogSampling is logged.
+		LogSampling int
+
 		// UserInput is a only-write channel which is used to send local capsules to
 		// the frontend manager.
 		UserInput chan<- *CapsuleProvider
@@ -55,6 +254,37 @@ type (
 
 		// User is the name of the user
 		User string `json:"user" yaml:"user"`
+
+		// Chat is the address of the conversation for the provider Notify
+		// method (ex: the Telegram chat ID). It allows to reach the user
+		// without the original message.
+		Chat string `json:"chat" yaml:"chat"`
+
+		// ThreadID identifies the thread of the message in the chat (ex: the
+		// Telegram message replied to), for the providers supporting threaded
+		// replies. The answer is sent in the same thread. It is empty when the
+		// message is not in a thread.
+		ThreadID string `json:"threadID,omitempty" yaml:"threadID,omitempty"`
+
+		// Locale is the locale of the user (ex: en_US).
+		Locale string `json:"locale" yaml:"locale"`
+
+		// Timezone is the IANA timezone of the user (ex: Europe/Paris).
+		Timezone string `json:"timezone" yaml:"timezone"`
+
+		// BackendHint is the label of the backend provider which must process
+		// the message. The main backend provider is used when it is empty.
+		BackendHint string `json:"backendHint" yaml:"backendHint"`
+
+		// Attachments are the files sent by the user with the message.
+		Attachments []*capsule.Attachment `json:"attachments" yaml:"attachments"`
+
+		// Location is the location shared by the user.
+		Location *capsule.Location `json:"location" yaml:"location"`
+
+		// Metadata contains raw data of the provider about the message (ex:
+		// the chat type).
+		Metadata map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
 	}
 
 	// User represents a user of the provider.
@@ -64,6 +294,13 @@ type (
 
 		// Name is the user name.
 		Name string `json:"name" yaml:"name"`
+
+		// Locale is the locale of the user (ex: en_US). It is optional.
+		Locale string `json:"locale" yaml:"locale"`
+
+		// Timezone is the IANA timezone of the user (ex: Europe/Paris). It is
+		// optional.
+		Timezone string `json:"timezone" yaml:"timezone"`
 	}
 
 	// ContentType is used to classify a user input which can has a specific type
@@ -84,6 +321,12 @@ const (
 	// Audio is the input type when the input is an audio file.
 	Audio ContentType = "Audio"
 
+	// File is the input type when the input is a document.
+	File ContentType = "File"
+
+	// Location is the input type when the input is a shared location.
+	Location ContentType = "Location"
+
 	// ErrorType is the input type when the input is an error.
 	ErrorType ContentType = "Error"
 
@@ -95,8 +338,24 @@ const (
 
 	// Delimiter is used to separate responses and display it as a multibubble message.
 	Delimiter string = "|"
+
+	// BusyMessage is the message sent to the user when its input cannot be
+	// forwarded because the frontend manager is overloaded.
+	BusyMessage string = "I'm busy, please retry"
 )
 
+// Forward sends the provider capsule to the frontend manager without blocking.
+// It returns false if the user input channel is full, in which case the
+// provider should answer the user with BusyMessage.
+func Forward(userInput chan<- *CapsuleProvider, capsuleProvider *CapsuleProvider) bool {
+	select {
+	case userInput <- capsuleProvider:
+		return true
+	default:
+		return false
+	}
+}
+
 // SystemLog returns a new formatted string which would correspond to a system
 // message.
 func SystemLog(content string, status SystemLogStatus) string {
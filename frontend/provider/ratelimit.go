@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// RateLimiter limits the number of messages a user can send during a
+	// window. A nil rate limiter allows all the messages.
+	RateLimiter struct {
+		// limit is the maximum number of messages per window.
+		limit int
+
+		// window is the duration of a window.
+		window time.Duration
+
+		// mutex protects the windows map.
+		mutex sync.Mutex
+
+		// windows indexes the current window of each user.
+		windows map[string]*rateWindow
+
+		// sweptAt is the time at which the expired windows were last evicted.
+		sweptAt time.Time
+	}
+
+	// rateWindow is the current window of a user.
+	rateWindow struct {
+		// start is the start of the window.
+		start time.Time
+
+		// count is the number of messages received during the window.
+		count int
+	}
+)
+
+const (
+	// RateLimitWindow is the window of the per-user rate limits.
+	RateLimitWindow = time.Minute
+
+	// RateLimitMessage is the message sent to the user who exceeds its rate
+	// limit.
+	RateLimitMessage string = "Too many messages, please wait a moment"
+)
+
+// NewRateLimiter initializes a new rate limiter allowing limit messages per
+// window and user. It returns nil when the limit is not positive.
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	if limit <= 0 {
+		return nil
+	}
+
+	return &RateLimiter{
+		limit:   limit,
+		window:  window,
+		windows: map[string]*rateWindow{},
+		sweptAt: time.Now(),
+	}
+}
+
+// Allow verifies if the user can send a new message and counts it.
+func (r *RateLimiter) Allow(user string) bool {
+	if r == nil {
+		return true
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	r.sweep(now)
+
+	w, ok := r.windows[user]
+	if !ok || now.Sub(w.start) >= r.window {
+		w = &rateWindow{start: now}
+		r.windows[user] = w
+	}
+
+	w.count++
+	return w.count <= r.limit
+}
+
+// sweep evicts the expired windows once per window, so the users who stopped
+// writing are forgotten. The mutex must be held.
+func (r *RateLimiter) sweep(now time.Time) {
+	if now.Sub(r.sweptAt) < r.window {
+		return
+	}
+
+	for user, w := range r.windows {
+		if now.Sub(w.start) >= r.window {
+			delete(r.windows, user)
+		}
+	}
+
+	r.sweptAt = now
+}
@@ -0,0 +1,64 @@
+package provider
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	r := NewRateLimiter(2, time.Hour)
+	for i, want := range []bool{true, true, false} {
+		if got := r.Allow("alice"); got != want {
+			t.Errorf("message %d: Allow() = %t, want %t", i, got, want)
+		}
+	}
+
+	// The limit is per user.
+	if !r.Allow("bob") {
+		t.Error("Allow() = false for another user")
+	}
+}
+
+func TestRateLimiterWindow(t *testing.T) {
+	const window = 50 * time.Millisecond
+	r := NewRateLimiter(1, window)
+	if !r.Allow("alice") || r.Allow("alice") {
+		t.Fatal("expected the second message to be limited")
+	}
+
+	time.Sleep(window)
+	if !r.Allow("alice") {
+		t.Error("Allow() = false in a new window")
+	}
+}
+
+func TestRateLimiterEviction(t *testing.T) {
+	const window = 50 * time.Millisecond
+	r := NewRateLimiter(1, window)
+	for i := 0; i < 100; i++ {
+		r.Allow(fmt.Sprintf("user%d", i))
+	}
+
+	time.Sleep(window)
+	r.Allow("alice")
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.windows) != 1 {
+		t.Errorf("%d windows kept, want only the window of the active user", len(r.windows))
+	}
+}
+
+func TestNilRateLimiter(t *testing.T) {
+	r := NewRateLimiter(0, time.Minute)
+	if r != nil {
+		t.Fatal("expected no rate limiter for a zero limit")
+	}
+
+	for i := 0; i < 10; i++ {
+		if !r.Allow("alice") {
+			t.Fatal("a nil rate limiter must allow every message")
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package reddit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+type (
+	// api is a client of the Reddit API authenticated as a script application.
+	// It caches the access token until it expires and waits for the rate limit
+	// window to reset when the remaining requests are exhausted.
+	api struct {
+		// clientID and clientSecret are the credentials of the application.
+		clientID     string
+		clientSecret string
+
+		// username and password are the credentials of the bot account.
+		username string
+		password string
+
+		// client is the http client calling the API.
+		client *http.Client
+
+		// mutex protects the access token and the rate limit state.
+		mutex sync.Mutex
+
+		// accessToken is the current access token.
+		accessToken string
+
+		// expiresAt is the expiration time of the access token.
+		expiresAt time.Time
+
+		// remaining is the number of requests remaining in the current rate
+		// limit window. It is negative until the first response is received.
+		remaining float64
+
+		// resetAt is the end of the current rate limit window.
+		resetAt time.Time
+	}
+
+	// tokenResponse is the response of the access token request.
+	tokenResponse struct {
+		// AccessToken is the access token.
+		AccessToken string `json:"access_token"`
+
+		// ExpiresIn is the lifetime of the access token in seconds.
+		ExpiresIn int `json:"expires_in"`
+
+		// Error is the error returned instead of the access token.
+		Error string `json:"error"`
+	}
+
+	// listing is a page of things returned by the API.
+	listing struct {
+		Data struct {
+			// After is the fullname of the last thing of the page. It is empty
+			// on the last page.
+			After string `json:"after"`
+
+			// Children are the things of the page.
+			Children []*thing `json:"children"`
+		} `json:"data"`
+	}
+
+	// thing is an item of the inbox: a private message (t4) or a comment (t1).
+	thing struct {
+		// Kind is the type prefix of the thing.
+		Kind string `json:"kind"`
+
+		Data struct {
+			// Name is the fullname of the thing (ex: t4_abc123).
+			Name string `json:"name"`
+
+			// Author is the name of the redditor who wrote the thing.
+			Author string `json:"author"`
+
+			// Body is the markdown text of the thing.
+			Body string `json:"body"`
+
+			// Type is the type of the comment notification (ex:
+			// username_mention). It is empty for private messages.
+			Type string `json:"type"`
+		} `json:"data"`
+	}
+
+	// apiError is the error returned by the API.
+	apiError struct {
+		// StatusCode is the HTTP status code of the response.
+		StatusCode int
+
+		// Message is the body of the response.
+		Message string
+	}
+)
+
+const (
+	// authURL is the URL of the access token endpoint.
+	authURL = "https://www.reddit.com/api/v1/access_token"
+
+	// apiURL is the URL of the OAuth API.
+	apiURL = "https://oauth.reddit.com"
+
+	// userAgent is the user agent required by the API rules.
+	userAgent = "samantha-front/1.0"
+
+	// tokenMargin is the duration before its expiration after which an access
+	// token is renewed.
+	tokenMargin = time.Minute
+
+	// pageSize is the number of things requested per page.
+	pageSize = 100
+)
+
+// newAPI initializes a client of the Reddit API.
+func newAPI(clientID, clientSecret, username, password string) *api {
+	return &api{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		username:     username,
+		password:     password,
+		client:       &http.Client{Timeout: 30 * time.Second},
+		remaining:    -1,
+	}
+}
+
+// unread returns the unread things of the inbox, following the after
+// pagination until the last page.
+func (a *api) unread() ([]*thing, error) {
+	things := []*thing{}
+	after := ""
+	for {
+		query := url.Values{
+			"limit": {strconv.Itoa(pageSize)},
+			"mark":  {"false"},
+		}
+		if len(after) > 0 {
+			query.Set("after", after)
+		}
+
+		page := &listing{}
+		if err := a.do(http.MethodGet, "/message/unread?"+query.Encode(), nil, page); err != nil {
+			return nil, errors.Annotate(err, "fetching unread messages")
+		}
+
+		things = append(things, page.Data.Children...)
+		if len(page.Data.After) == 0 || page.Data.After == after {
+			return things, nil
+		}
+
+		after = page.Data.After
+	}
+}
+
+// markRead marks the things whose fullnames are given as read.
+func (a *api) markRead(names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	form := url.Values{"id": {strings.Join(names, ",")}}
+	return errors.Annotate(a.do(http.MethodPost, "/api/read_message", form, nil), "marking messages as read")
+}
+
+// reply replies to the thing whose fullname is given.
+func (a *api) reply(name, text string) error {
+	form := url.Values{
+		"api_type": {"json"},
+		"thing_id": {name},
+		"text":     {text},
+	}
+
+	return errors.Annotate(a.do(http.MethodPost, "/api/comment", form, nil), "replying to "+name)
+}
+
+// compose sends a new private message to the given redditor.
+func (a *api) compose(to, subject, text string) error {
+	form := url.Values{
+		"api_type": {"json"},
+		"to":       {to},
+		"subject":  {subject},
+		"text":     {text},
+	}
+
+	return errors.Annotate(a.do(http.MethodPost, "/api/compose", form, nil), "sending private message to "+to)
+}
+
+// do calls the API and decodes the response in result when it is not nil.
+// The form is sent as the body of the request when it is not nil.
+func (a *api) do(method, path string, form url.Values, result interface{}) error {
+	token, err := a.token()
+	if err != nil {
+		return err
+	}
+
+	a.waitRateLimit()
+
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	request, err := http.NewRequest(method, apiURL+path, body)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Authorization", "bearer "+token)
+	request.Header.Set("User-Agent", userAgent)
+	if form != nil {
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	response, err := a.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	a.updateRateLimit(response.Header)
+
+	if response.StatusCode == http.StatusUnauthorized {
+		a.mutex.Lock()
+		a.accessToken = ""
+		a.mutex.Unlock()
+	}
+
+	if response.StatusCode != http.StatusOK {
+		data, _ := ioutil.ReadAll(io.LimitReader(response.Body, 512))
+		return &apiError{StatusCode: response.StatusCode, Message: string(data)}
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// waitRateLimit waits for the end of the rate limit window when no request
+// remains.
+func (a *api) waitRateLimit() {
+	a.mutex.Lock()
+	wait := time.Duration(0)
+	if a.remaining >= 0 && a.remaining < 1 {
+		wait = time.Until(a.resetAt)
+	}
+	a.mutex.Unlock()
+
+	if wait > 0 {
+		logger.Debugf("Rate limit reached, waiting %s", wait)
+		time.Sleep(wait)
+	}
+}
+
+// updateRateLimit updates the rate limit state with the X-Ratelimit headers
+// of a response.
+func (a *api) updateRateLimit(header http.Header) {
+	remaining, err := strconv.ParseFloat(header.Get("X-Ratelimit-Remaining"), 64)
+	if err != nil {
+		return
+	}
+
+	reset, err := strconv.Atoi(header.Get("X-Ratelimit-Reset"))
+	if err != nil {
+		return
+	}
+
+	a.mutex.Lock()
+	a.remaining = remaining
+	a.resetAt = time.Now().Add(time.Duration(reset) * time.Second)
+	a.mutex.Unlock()
+}
+
+// token returns the access token, requesting a new one with the password
+// grant if it is missing or about to expire.
+func (a *api) token() (string, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if len(a.accessToken) > 0 && time.Now().Before(a.expiresAt) {
+		return a.accessToken, nil
+	}
+
+	form := url.Values{
+		"grant_type": {"password"},
+		"username":   {a.username},
+		"password":   {a.password},
+	}
+
+	request, err := http.NewRequest(http.MethodPost, authURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.Annotate(err, "requesting access token")
+	}
+
+	request.SetBasicAuth(a.clientID, a.clientSecret)
+	request.Header.Set("User-Agent", userAgent)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := a.client.Do(request)
+	if err != nil {
+		return "", errors.Annotate(err, "requesting access token")
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", errors.Annotate(&apiError{StatusCode: response.StatusCode}, "requesting access token")
+	}
+
+	result := &tokenResponse{}
+	if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+		return "", errors.Annotate(err, "requesting access token")
+	}
+
+	if len(result.Error) > 0 {
+		return "", errors.Annotate(&apiError{StatusCode: response.StatusCode, Message: result.Error}, "requesting access token")
+	}
+
+	a.accessToken = result.AccessToken
+	a.expiresAt = time.Now().Add(time.Duration(result.ExpiresIn)*time.Second - tokenMargin)
+	return a.accessToken, nil
+}
+
+// Error returns the status code and the message of the error.
+func (e *apiError) Error() string {
+	return fmt.Sprintf("reddit error %d: %s", e.StatusCode, e.Message)
+}
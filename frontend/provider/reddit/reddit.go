@@ -0,0 +1,318 @@
+package reddit
+
+import (
+	"strings"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Reddit contains all variables needed to communicate with Reddit as a
+	// script application. The inbox of the bot account is polled for private
+	// messages and username mentions, which are answered with a reply. The
+	// name of an authorized user is its redditor name.
+	Reddit struct {
+		// AuthorizedUsers is a authorized users slice.
+		AuthorizedUsers []*provider.User
+
+		// AllowAllUsers disables the authorization check: anyone can talk to
+		// the bot.
+		AllowAllUsers bool
+
+		// RateLimiter limits the number of messages of each user. It is nil when
+		// the messages are not limited.
+		RateLimiter *provider.RateLimiter
+
+		// LogSampler samples the logs of the received messages. It is nil when
+		// every message is logged.
+		LogSampler *provider.LogSampler
+
+		// MinMessageLength is the minimum length of a trimmed text message.
+		MinMessageLength int
+
+		// api is the client of the Reddit API.
+		api *api
+
+		// stop is closed when the provider is stopped.
+		stop chan struct{}
+
+		// handled indexes the fullnames of the things handled but not yet
+		// marked as read, so they are not processed again if the marking
+		// failed.
+		handled map[string]bool
+
+		// pendingMessages keeps the received messages that have not been
+		// answered.
+		pendingMessages *provider.PendingMessages
+
+		// IDGenerator generates the UUIDs of the user messages.
+		IDGenerator capsule.IDGenerator
+
+		// userInput is a channel connected to the frontend manager. It is used to
+		// send user messages to that manager.
+		userInput chan<- *provider.CapsuleProvider
+	}
+
+	// message represents user messages.
+	message struct {
+		// uuid is the message uuid.
+		uuid uuid.UUID
+
+		// name is the fullname of the private message or comment to reply to.
+		name string
+	}
+)
+
+const (
+	// label is the provider label.
+	label = "reddit"
+
+	// defaultMinMessageLength is the default minimum length of a text message.
+	defaultMinMessageLength = 1
+
+	// pollInterval is the delay between two polls of the inbox.
+	pollInterval = 15 * time.Second
+
+	// privateMessageKind and commentKind are the kinds of the inbox things.
+	privateMessageKind = "t4"
+	commentKind        = "t1"
+
+	// mentionType is the type of the comments mentioning the bot.
+	mentionType = "username_mention"
+
+	// notificationSubject is the subject of the private messages sent by
+	// Notify.
+	notificationSubject = "Samantha"
+)
+
+var (
+	// logger is a global logger of the package
+	logger = provider.NewLogger(label)
+)
+
+// Initialize initiliazes a provider with the given client ID (token), client
+// secret (secret), bot account username and password, slice of authorized
+// users and user inputs write-only channel.
+func (r *Reddit) Initialize(config *provider.Config) (provider.Provider, error) {
+	logger.Debugf("Initializing %s", label)
+
+	if len(config.Token) == 0 || len(config.Secret) == 0 {
+		return nil, errors.NotValidf("empty client ID or client secret")
+	}
+
+	if len(config.Username) == 0 || len(config.Password) == 0 {
+		return nil, errors.NotValidf("empty username or password")
+	}
+
+	minMessageLength := config.MinMessageLength
+	if minMessageLength <= 0 {
+		minMessageLength = defaultMinMessageLength
+	}
+
+	return &Reddit{
+		AuthorizedUsers:  config.AuthorizedUsers,
+		AllowAllUsers:    config.AllowAllUsers,
+		RateLimiter:      provider.NewRateLimiter(config.RateLimit, provider.RateLimitWindow),
+		LogSampler:       provider.NewLogSampler(config.LogSampling),
+		MinMessageLength: minMessageLength,
+		api:              newAPI(config.Token, config.Secret, config.Username, config.Password),
+		stop:             make(chan struct{}),
+		handled:          map[string]bool{},
+		pendingMessages:  provider.NewPendingMessages(),
+		IDGenerator:      capsule.RandomGenerator{},
+		userInput:        config.UserInput,
+	}, nil
+}
+
+// Start polls the inbox until the provider is stopped.
+func (r *Reddit) Start() {
+	logger.Debugf("Starting %s", label)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.poll(); err != nil {
+			logger.WithError(err).Warn("Cannot poll inbox")
+		}
+
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Message replies to the private message or comment of the user. The
+// responses are joined in a single reply so the thread is not flooded.
+func (r *Reddit) Message(capsule *capsule.Capsule) error {
+	pending, err := r.pendingMessages.Take(capsule.OriginalMessage)
+	if err != nil {
+		return err
+	}
+	pendingMessage := pending.(*message)
+
+	if capsule.Error != nil && len(capsule.Error.Error()) > 0 {
+		return r.api.reply(pendingMessage.name, provider.SystemLog(capsule.Error.Error(), provider.ErrorStatus))
+	}
+
+	if len(capsule.Responses) == 0 {
+		return nil
+	}
+
+	return r.api.reply(pendingMessage.name, strings.Join(capsule.Responses, "\n\n"))
+}
+
+// Notify sends the text in a private message to the given redditor.
+func (r *Reddit) Notify(chat string, text string) error {
+	return r.api.compose(chat, notificationSubject, text)
+}
+
+// Capabilities returns the capabilities of the provider. Replies are
+// markdown text without buttons.
+func (r *Reddit) Capabilities() *capsule.Capabilities {
+	return &capsule.Capabilities{Buttons: false}
+}
+
+// GetLabel returns the label of the provider
+func (r *Reddit) GetLabel() string {
+	return label
+}
+
+// Stop stops the polling of the inbox.
+func (r *Reddit) Stop() error {
+	close(r.stop)
+	return nil
+}
+
+// poll fetches the unread private messages and mentions, handles them and
+// marks them as read so they are not processed again. The other things of the
+// inbox, such as comment replies, are marked as read too.
+func (r *Reddit) poll() error {
+	things, err := r.api.unread()
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for _, t := range things {
+		names = append(names, t.Data.Name)
+		if r.handled[t.Data.Name] {
+			continue
+		}
+
+		r.handled[t.Data.Name] = true
+		if t.Kind == privateMessageKind || (t.Kind == commentKind && t.Data.Type == mentionType) {
+			r.handleThing(t)
+		}
+	}
+
+	if err := r.api.markRead(names); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		delete(r.handled, name)
+	}
+
+	return nil
+}
+
+// handleThing handles a private message or a mention sent by a user.
+func (r *Reddit) handleThing(t *thing) {
+	localLogger := logger.WithField("action", "receiving user message")
+
+	from := t.Data.Author
+	if !r.AllowAllUsers && r.authorizedUser(from) == nil {
+		localLogger.WithFields(log.Fields{
+			"from":    from,
+			"message": t.Data.Body,
+		}).Debug("User message received from unauthorized user")
+		return
+	}
+
+	if r.LogSampler.Sample() {
+		localLogger.WithFields(log.Fields{
+			"from":    from,
+			"message": t.Data.Body,
+		}).Debug("User message received")
+	}
+
+	if !r.RateLimiter.Allow(from) {
+		localLogger.WithField("from", from).Debug("User rate limit exceeded")
+		if err := r.api.reply(t.Data.Name, provider.SystemLog(provider.RateLimitMessage, provider.Info)); err != nil {
+			localLogger.WithError(err).Error("Cannot send rate limit message")
+		}
+		return
+	}
+
+	if err := r.processUserMessage(t); err != nil {
+		// If an error occurred, it generates a system log message and sends it to
+		// the user.
+		if err := r.api.reply(t.Data.Name, provider.SystemLog(err.Error(), provider.ErrorStatus)); err != nil {
+			localLogger.WithError(err).Error("Cannot send error message")
+		}
+	}
+}
+
+// processUserMessage processes a user message by adding it to the pending
+// messages, converting it to a provider capsule and sending it to the
+// frontend manager.
+func (r *Reddit) processUserMessage(t *thing) error {
+	// Empty messages are not forwarded since they would be answered with a
+	// useless response.
+	if len([]rune(strings.TrimSpace(t.Data.Body))) < r.MinMessageLength {
+		return r.api.reply(t.Data.Name, provider.SystemLog("Please send a message", provider.Info))
+	}
+
+	// Generates a new UUID.
+	uuid, err := r.IDGenerator.New()
+	if err != nil {
+		return errors.Annotate(err, "processing user message")
+	}
+
+	message := &message{
+		uuid: uuid,
+		name: t.Data.Name,
+	}
+
+	capsuleProvider := &provider.CapsuleProvider{
+		OriginalMessage: message.uuid,
+		ProviderLabel:   label,
+		Content:         t.Data.Body,
+		User:            t.Data.Author,
+		Chat:            t.Data.Author,
+	}
+
+	if user := r.authorizedUser(t.Data.Author); user != nil {
+		capsuleProvider.Locale = user.Locale
+		capsuleProvider.Timezone = user.Timezone
+	}
+
+	// Sends the provider capsule-formatted message to the frontend manager,
+	// and keeps the message until it is answered. The user is asked to retry
+	// when the frontend manager is overloaded.
+	if !r.pendingMessages.Forward(r.userInput, capsuleProvider, message) {
+		return r.api.reply(t.Data.Name, provider.SystemLog(provider.BusyMessage, provider.Info))
+	}
+
+	return nil
+}
+
+// authorizedUser returns the authorized user matching the given redditor name
+// or nil if the user is not authorized. Redditor names are case insensitive.
+func (r *Reddit) authorizedUser(name string) *provider.User {
+	for _, user := range r.AuthorizedUsers {
+		if strings.EqualFold(user.Name, name) {
+			return user
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package provider
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type (
+	// SpellCorrector corrects the typos of the user messages before they are
+	// sent to the backend, so the NLU recognizes their intent.
+	SpellCorrector interface {
+		// Correct returns the corrected text.
+		Correct(text string) string
+	}
+
+	// DictionaryCorrector is a spell corrector replacing the unknown words by
+	// the closest word of a domain dictionary, by edit distance.
+	DictionaryCorrector struct {
+		// words indexes the lowercased words of the dictionary.
+		words map[string]bool
+	}
+)
+
+const (
+	// minCorrectedLength is the length under which the words are not
+	// corrected: short words have too many close words.
+	minCorrectedLength = 4
+
+	// longWordLength is the length from which a word can have two typos.
+	longWordLength = 8
+)
+
+var (
+	// wordPattern matches the words of a text.
+	wordPattern = regexp.MustCompile(`\p{L}+`)
+)
+
+// NewDictionaryCorrector returns a spell corrector whose dictionary contains
+// the given words.
+func NewDictionaryCorrector(words []string) *DictionaryCorrector {
+	d := &DictionaryCorrector{words: map[string]bool{}}
+	for _, word := range words {
+		if word = strings.ToLower(strings.TrimSpace(word)); len(word) > 0 {
+			d.words[word] = true
+		}
+	}
+
+	return d
+}
+
+// Correct replaces each word of the text missing from the dictionary by the
+// closest dictionary word: at most one edit away, or two for long words. The
+// words with several closest words are left unchanged, as well as the short
+// words. The case of the first letter of a corrected word is kept.
+func (d *DictionaryCorrector) Correct(text string) string {
+	return wordPattern.ReplaceAllStringFunc(text, func(word string) string {
+		lower := strings.ToLower(word)
+		if utf8.RuneCountInString(lower) < minCorrectedLength || d.words[lower] {
+			return word
+		}
+
+		maxDistance := 1
+		if utf8.RuneCountInString(lower) >= longWordLength {
+			maxDistance = 2
+		}
+
+		best, bestDistance, ambiguous := "", maxDistance+1, false
+		for candidate := range d.words {
+			distance := editDistance(lower, candidate)
+			switch {
+			case distance < bestDistance:
+				best, bestDistance, ambiguous = candidate, distance, false
+			case distance == bestDistance:
+				ambiguous = true
+			}
+		}
+
+		if len(best) == 0 || ambiguous {
+			return word
+		}
+
+		if first, _ := utf8.DecodeRuneInString(word); unicode.IsUpper(first) {
+			runes := []rune(best)
+			runes[0] = unicode.ToUpper(runes[0])
+			return string(runes)
+		}
+
+		return best
+	})
+}
+
+// editDistance returns the Levenshtein distance between the two words.
+func editDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			current[j] = min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(rb)]
+}
+
+// min3 returns the smallest of the three integers.
+func min3(a int, b int, c int) int {
+	if b < a {
+		a = b
+	}
+
+	if c < a {
+		a = c
+	}
+
+	return a
+}
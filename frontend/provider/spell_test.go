@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"testing"
+)
+
+func TestDictionaryCorrector(t *testing.T) {
+	corrector := NewDictionaryCorrector([]string{"weather", "Forecast", "tomorrow", "card", "cart", " "})
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"typos", "wether tomorow?", "weather tomorrow?"},
+		{"known words", "weather forecast", "weather forecast"},
+		{"capitalized word", "Wether", "Weather"},
+		{"two typos in a long word", "forecsat", "forecast"},
+		{"two typos in a short word", "whetr", "whetr"},
+		{"short word", "hte", "hte"},
+		{"ambiguous word", "carx", "carx"},
+		{"unknown word", "hello", "hello"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := corrector.Correct(tt.text); got != tt.want {
+				t.Errorf("Correct(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"météo", "meteo", 2},
+	}
+
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package telegram
+
+import (
+	"strings"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/juju/errors"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	// cardPrefix prefixes the callback data of the card buttons. The data is
+	// the prefix and the button value, separated by feedbackSeparator.
+	cardPrefix = "card"
+
+	// maxCallbackData is the maximum size in bytes of the callback data of an
+	// inline button.
+	maxCallbackData = 64
+)
+
+// sendCard sends the card as a photo with its title and subtitle as caption,
+// or as a text message if it has no image. The buttons are displayed as inline
+// buttons under the card.
+func (t *Telegram) sendCard(recipient tb.Recipient, card *capsule.Card) error {
+	caption := card.Title
+	if len(card.Subtitle) > 0 {
+		caption += "\n" + card.Subtitle
+	}
+
+	var what interface{} = caption
+	if len(card.ImageURL) > 0 {
+		what = &tb.Photo{File: tb.FromURL(card.ImageURL), Caption: caption}
+	}
+
+	options := []interface{}{}
+	if len(card.Buttons) > 0 {
+		options = append(options, cardKeyboard(card.Buttons))
+	}
+
+	if _, err := t.api.Send(recipient, what, options...); err != nil {
+		return errors.Annotatef(err, "sending card %s", card.Title)
+	}
+
+	return nil
+}
+
+// cardKeyboard returns the inline buttons of a card, one per row. The buttons
+// with a URL open it, the others send their value back as a callback.
+func cardKeyboard(buttons []*capsule.CardButton) *tb.ReplyMarkup {
+	keyboard := make([][]tb.InlineButton, 0, len(buttons))
+	for _, button := range buttons {
+		if len(button.URL) > 0 {
+			keyboard = append(keyboard, []tb.InlineButton{{Text: button.Label, URL: button.URL}})
+			continue
+		}
+
+		value := button.Value
+		if len(value) == 0 {
+			value = button.Label
+		}
+
+		keyboard = append(keyboard, []tb.InlineButton{{Text: button.Label, Data: cardData(value)}})
+	}
+
+	return &tb.ReplyMarkup{InlineKeyboard: keyboard}
+}
+
+// cardData returns the callback data of a card button, truncated to the size
+// allowed by Telegram without splitting a character.
+func cardData(value string) string {
+	data := cardPrefix + feedbackSeparator + value
+	if len(data) <= maxCallbackData {
+		return data
+	}
+
+	runes := []rune(data)
+	for len(string(runes)) > maxCallbackData {
+		runes = runes[:len(runes)-1]
+	}
+
+	return string(runes)
+}
+
+// cardCallback handles the callback of a card button: its value is processed
+// as a text message of the user who pressed it.
+func (t *Telegram) cardCallback(callback *tb.Callback, value string) {
+	localLogger := logger.WithField("action", "receiving card callback")
+
+	if err := t.api.Respond(callback, &tb.CallbackResponse{}); err != nil {
+		localLogger.WithError(err).Debug("Cannot acknowledge card callback")
+	}
+
+	if callback.Message == nil || len(strings.TrimSpace(value)) == 0 {
+		return
+	}
+
+	message := &tb.Message{
+		Sender: callback.Sender,
+		Chat:   callback.Message.Chat,
+		Text:   value,
+	}
+
+	if !t.accept(message, localLogger) {
+		return
+	}
+
+	if err := t.processUserMessage(message, provider.Text); err != nil {
+		t.api.Send(t.recipientOf(message), provider.SystemLog(err.Error(), provider.ErrorStatus))
+	}
+}
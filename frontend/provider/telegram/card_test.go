@@ -0,0 +1,75 @@
+package telegram
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/fberrez/samantha/capsule"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+func TestSendCard(t *testing.T) {
+	telegram, bot, _ := newTestTelegram()
+	card := &capsule.Card{
+		Title:    "Blue shirt",
+		Subtitle: "20 EUR",
+		ImageURL: "https://example.com/shirt.png",
+		Buttons: []*capsule.CardButton{
+			{Label: "Buy", URL: "https://example.com/buy"},
+			{Label: "More", Value: "more shirts"},
+		},
+	}
+
+	if err := telegram.sendCard(&tb.Chat{ID: 42}, card); err != nil {
+		t.Fatalf("sendCard() error = %v", err)
+	}
+
+	bot.mutex.Lock()
+	defer bot.mutex.Unlock()
+
+	if len(bot.sent) != 1 {
+		t.Fatalf("sent messages = %d, want the card", len(bot.sent))
+	}
+
+	photo, ok := bot.sent[0].what.(*tb.Photo)
+	if !ok || photo.Caption != "Blue shirt\n20 EUR" {
+		t.Fatalf("card = %+v, want a photo with the title and subtitle", bot.sent[0].what)
+	}
+
+	keyboard, ok := bot.sent[0].options[0].(*tb.ReplyMarkup)
+	if !ok || len(keyboard.InlineKeyboard) != 2 {
+		t.Fatalf("options = %+v, want a button per row", bot.sent[0].options)
+	}
+
+	if button := keyboard.InlineKeyboard[0][0]; button.URL != "https://example.com/buy" {
+		t.Errorf("first button = %+v, want the URL", button)
+	}
+
+	if button := keyboard.InlineKeyboard[1][0]; button.Data != cardData("more shirts") {
+		t.Errorf("second button = %+v, want the value as callback", button)
+	}
+}
+
+func TestSendCardWithoutImage(t *testing.T) {
+	telegram, bot, _ := newTestTelegram()
+
+	if err := telegram.sendCard(&tb.Chat{ID: 42}, &capsule.Card{Title: "Blue shirt"}); err != nil {
+		t.Fatalf("sendCard() error = %v", err)
+	}
+
+	if texts := bot.texts(); len(texts) != 1 || texts[0] != "Blue shirt" {
+		t.Errorf("texts = %q, want the card as text", texts)
+	}
+}
+
+func TestCardData(t *testing.T) {
+	if data := cardData("more"); data != cardPrefix+feedbackSeparator+"more" {
+		t.Errorf("cardData() = %q, want the prefixed value", data)
+	}
+
+	data := cardData(strings.Repeat("é", 40))
+	if len(data) > maxCallbackData || !utf8.ValidString(data) {
+		t.Errorf("cardData() = %q, want at most %d bytes of valid UTF-8", data, maxCallbackData)
+	}
+}
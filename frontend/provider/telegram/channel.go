@@ -0,0 +1,68 @@
+package telegram
+
+import (
+	"strings"
+
+	"github.com/fberrez/samantha/frontend/provider"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// channelPostHandler handles the posts of the channels. Telegram only sends
+// them to the bots administering the channel, so the channel posts are not
+// checked against the authorized users. A post is processed when it starts
+// with the channel trigger, on behalf of the channel: the channel is the user
+// of the capsule and the responses are posted in the channel.
+func (t *Telegram) channelPostHandler() func(*tb.Message) {
+	return func(post *tb.Message) {
+		localLogger := logger.WithField("action", "receiving channel post")
+
+		text, ok := t.triggered(post.Text)
+		if !ok || post.Chat == nil {
+			return
+		}
+
+		if !t.allowedChat(post.Chat) {
+			localLogger.WithField("chat_id", post.Chat.ID).Debug("Channel post received in a disallowed channel")
+			return
+		}
+
+		post.Text = text
+		post.Sender = channelUser(post.Chat)
+
+		if err := t.processUserMessage(post, provider.Text); err != nil {
+			localLogger.WithError(err).Error("Cannot process channel post")
+			t.api.Send(post.Chat, provider.SystemLog(err.Error(), provider.ErrorStatus))
+		}
+	}
+}
+
+// triggered verifies if the given post starts with the channel trigger, and
+// returns the post without it.
+func (t *Telegram) triggered(text string) (string, bool) {
+	trigger := t.ChannelTrigger
+	if len(trigger) == 0 {
+		if t.Bot.Me == nil {
+			return "", false
+		}
+
+		trigger = "@" + t.Bot.Me.Username
+	}
+
+	text = strings.TrimSpace(text)
+	if len(text) < len(trigger) || !strings.EqualFold(text[:len(trigger)], trigger) {
+		return "", false
+	}
+
+	return strings.TrimSpace(text[len(trigger):]), true
+}
+
+// channelUser returns the user representing the given channel. Its ID is the
+// channel ID, which is negative so it never matches a Telegram user.
+func channelUser(chat *tb.Chat) *tb.User {
+	name := chat.Username
+	if len(name) == 0 {
+		name = chat.Title
+	}
+
+	return &tb.User{ID: int(chat.ID), Username: name}
+}
@@ -0,0 +1,74 @@
+package telegram
+
+import (
+	"testing"
+
+	"github.com/fberrez/samantha/capsule"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// channelPost returns a post of the news channel.
+func channelPost(text string) *tb.Message {
+	return &tb.Message{
+		ID:   7,
+		Chat: &tb.Chat{ID: -1001, Type: tb.ChatChannel, Username: "news"},
+		Text: text,
+	}
+}
+
+func TestChannelPost(t *testing.T) {
+	telegram, bot, userInput := newTestTelegram()
+	telegram.AllowAllUsers = false
+
+	telegram.channelPostHandler()(channelPost("@samantha what's new?"))
+	inputs := forwarded(userInput)
+	if len(inputs) != 1 || inputs[0].Content != "what's new?" || inputs[0].User != "news" {
+		t.Fatalf("forwarded inputs = %+v, want the post of the channel without trigger", inputs)
+	}
+
+	// The response is posted in the channel.
+	if err := telegram.sendTextMessage(&capsule.Capsule{OriginalMessage: inputs[0].OriginalMessage, Responses: []string{"Nothing new"}}); err != nil {
+		t.Fatalf("sendTextMessage() error = %v", err)
+	}
+
+	bot.mutex.Lock()
+	defer bot.mutex.Unlock()
+	if len(bot.sent) != 1 || bot.sent[0].to.Recipient() != "-1001" {
+		t.Errorf("sent messages = %+v, want the response in the channel", bot.sent)
+	}
+}
+
+func TestChannelPostIgnored(t *testing.T) {
+	tests := []struct {
+		name    string
+		trigger string
+		post    *tb.Message
+	}{
+		{"no trigger", "", channelPost("what's new?")},
+		{"trigger not at the start", "", channelPost("what's new @samantha?")},
+		{"other trigger", "!bot", channelPost("@samantha what's new?")},
+		{"no chat", "", &tb.Message{Text: "@samantha what's new?"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telegram, _, userInput := newTestTelegram()
+			telegram.ChannelTrigger = tt.trigger
+
+			telegram.channelPostHandler()(tt.post)
+			if inputs := forwarded(userInput); len(inputs) != 0 {
+				t.Errorf("forwarded inputs = %+v, want none", inputs)
+			}
+		})
+	}
+}
+
+func TestChannelTrigger(t *testing.T) {
+	telegram, _, userInput := newTestTelegram()
+	telegram.ChannelTrigger = "!bot"
+
+	telegram.channelPostHandler()(channelPost("!BOT weather"))
+	if inputs := forwarded(userInput); len(inputs) != 1 || inputs[0].Content != "weather" {
+		t.Errorf("forwarded inputs = %+v, want the post without the configured trigger", inputs)
+	}
+}
@@ -0,0 +1,71 @@
+package telegram
+
+import (
+	"testing"
+
+	"github.com/fberrez/samantha/frontend/provider"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+func TestAllowedChat(t *testing.T) {
+	tests := []struct {
+		name      string
+		chatTypes []string
+		chatIDs   []int64
+		chat      *tb.Chat
+		forwarded bool
+	}{
+		{"no restriction", nil, nil, &tb.Chat{ID: -100, Type: tb.ChatGroup}, true},
+		{"allowed type", []string{"private"}, nil, &tb.Chat{ID: 42, Type: tb.ChatPrivate}, true},
+		{"disallowed type", []string{"private"}, nil, &tb.Chat{ID: -100, Type: tb.ChatGroup}, false},
+		{"disallowed supergroup", []string{"group"}, nil, &tb.Chat{ID: -100, Type: tb.ChatSuperGroup}, false},
+		{"allowed ID", []string{"private"}, []int64{-100}, &tb.Chat{ID: -100, Type: tb.ChatGroup}, true},
+		{"disallowed ID", nil, []int64{-100}, &tb.Chat{ID: -200, Type: tb.ChatGroup}, false},
+		{"no chat", []string{"private"}, nil, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telegram, _, userInput := newTestTelegram()
+			telegram.AllowedChatTypes = tt.chatTypes
+			telegram.AllowedChatIDs = tt.chatIDs
+
+			message := textMessage("hello")
+			message.Chat = tt.chat
+			telegram.textMessageHandler()(message)
+
+			if forwarded := len(forwarded(userInput)) == 1; forwarded != tt.forwarded {
+				t.Errorf("message forwarded: %t, want %t", forwarded, tt.forwarded)
+			}
+		})
+	}
+}
+
+func TestAllowedChatChannelPost(t *testing.T) {
+	tests := []struct {
+		name      string
+		chatTypes []string
+		forwarded bool
+	}{
+		{"allowed channel", []string{"channel"}, true},
+		{"disallowed channel", []string{"private", "group"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telegram, _, userInput := newTestTelegram()
+			telegram.AllowedChatTypes = tt.chatTypes
+
+			telegram.channelPostHandler()(channelPost("@samantha what's new?"))
+			if forwarded := len(forwarded(userInput)) == 1; forwarded != tt.forwarded {
+				t.Errorf("post forwarded: %t, want %t", forwarded, tt.forwarded)
+			}
+		})
+	}
+}
+
+func TestInitializeInvalidChatType(t *testing.T) {
+	if _, err := (&Telegram{}).Initialize(&provider.Config{AllowedChatTypes: []string{"private", "forum"}}); err == nil {
+		t.Error("expected an error")
+	}
+}
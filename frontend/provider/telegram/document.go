@@ -0,0 +1,45 @@
+package telegram
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/juju/errors"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// download downloads the given document. The documents larger than the
+// maximum file size are rejected.
+func (t *Telegram) download(document *tb.Document) (*capsule.Attachment, error) {
+	if document == nil {
+		return nil, errors.NotFoundf("document")
+	}
+
+	if document.FileSize > t.MaxFileSize {
+		return nil, errors.NotSupportedf("files larger than %d bytes", t.MaxFileSize)
+	}
+
+	reader, err := t.api.GetFile(&document.File)
+	if err != nil {
+		return nil, errors.Annotatef(err, "downloading file %s", document.FileName)
+	}
+	defer reader.Close()
+
+	// The size announced by Telegram may be missing, so the download is
+	// limited too.
+	data, err := ioutil.ReadAll(io.LimitReader(reader, int64(t.MaxFileSize)+1))
+	if err != nil {
+		return nil, errors.Annotatef(err, "downloading file %s", document.FileName)
+	}
+
+	if len(data) > t.MaxFileSize {
+		return nil, errors.NotSupportedf("files larger than %d bytes", t.MaxFileSize)
+	}
+
+	return &capsule.Attachment{
+		Name: document.FileName,
+		MIME: document.MIME,
+		Data: data,
+	}, nil
+}
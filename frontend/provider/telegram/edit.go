@@ -0,0 +1,92 @@
+package telegram
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/google/uuid"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+type (
+	// supersededMessages keeps the messages superseded by their correction,
+	// so their responses are dropped instead of being sent.
+	supersededMessages struct {
+		// mutex protects the messages.
+		mutex sync.Mutex
+
+		// messages is a set of the UUIDs of the superseded messages.
+		messages map[uuid.UUID]bool
+	}
+)
+
+// newSupersededMessages initializes an empty set of superseded messages.
+func newSupersededMessages() *supersededMessages {
+	return &supersededMessages{messages: map[uuid.UUID]bool{}}
+}
+
+// add marks the message as superseded.
+func (s *supersededMessages) add(id uuid.UUID) {
+	s.mutex.Lock()
+	s.messages[id] = true
+	s.mutex.Unlock()
+}
+
+// take verifies if the message is superseded and forgets it, since a message
+// has a single response.
+func (s *supersededMessages) take(id uuid.UUID) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.messages[id] {
+		return false
+	}
+
+	delete(s.messages, id)
+	return true
+}
+
+// editedMessageHandler handles the text messages edited by users. The edits
+// are ignored unless they are handled as corrections: the edited message is
+// then processed as a new text message, and supersedes the original message
+// if it has not been answered yet.
+func (t *Telegram) editedMessageHandler() func(*tb.Message) {
+	handleText := t.textMessageHandler()
+
+	return func(message *tb.Message) {
+		localLogger := logger.WithField("action", "receiving edited message")
+
+		if !t.CorrectEditedMessages || len(message.Text) == 0 {
+			localLogger.Debug("Edited message ignored")
+			return
+		}
+
+		if id, ok := t.supersede(message); ok {
+			localLogger.WithField("uuid", id).Debug("Pending message superseded by its correction")
+		}
+
+		handleText(message)
+	}
+}
+
+// supersede removes the pending message corresponding to the edited message,
+// so the correction replaces it instead of being answered in addition to it.
+// It returns false if the original message has already been answered.
+func (t *Telegram) supersede(edited *tb.Message) (uuid.UUID, bool) {
+	id := strconv.Itoa(edited.ID)
+
+	t.pendingMutex.Lock()
+	defer t.pendingMutex.Unlock()
+
+	for i, m := range t.pendingMessages {
+		if m.user.ID != edited.Sender.ID || m.metadata[messageIDMetadata] != id {
+			continue
+		}
+
+		t.pendingMessages = append(t.pendingMessages[:i], t.pendingMessages[i+1:]...)
+		t.superseded.add(m.uuid)
+		return m.uuid, true
+	}
+
+	return uuid.Nil, false
+}
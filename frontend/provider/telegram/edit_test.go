@@ -0,0 +1,76 @@
+package telegram
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/google/uuid"
+)
+
+// respond sends the response to the message with the given UUID.
+func respond(t *testing.T, telegram *Telegram, id uuid.UUID, response string) {
+	t.Helper()
+
+	if err := telegram.Message(&capsule.Capsule{OriginalMessage: id, Responses: []string{response}}); err != nil {
+		t.Fatalf("Message() error = %v", err)
+	}
+}
+
+func TestEditedMessageIgnored(t *testing.T) {
+	telegram, _, userInput := newTestTelegram()
+	receive(t, telegram, userInput, "helo")
+
+	telegram.editedMessageHandler()(textMessage("hello"))
+	if inputs := forwarded(userInput); len(inputs) != 0 {
+		t.Errorf("forwarded inputs = %+v, want none", inputs)
+	}
+
+	if len(telegram.pendingMessages) != 1 {
+		t.Errorf("pending messages = %d, want the original message", len(telegram.pendingMessages))
+	}
+}
+
+func TestEditedMessageCorrection(t *testing.T) {
+	telegram, bot, userInput := newTestTelegram()
+	telegram.CorrectEditedMessages = true
+	original := receive(t, telegram, userInput, "helo")
+
+	telegram.editedMessageHandler()(textMessage("hello"))
+	inputs := forwarded(userInput)
+	if len(inputs) != 1 || inputs[0].Content != "hello" {
+		t.Fatalf("forwarded inputs = %+v, want the correction", inputs)
+	}
+
+	// The correction replaces the pending original message.
+	if len(telegram.pendingMessages) != 1 || telegram.pendingMessages[0].uuid != inputs[0].OriginalMessage {
+		t.Fatalf("pending messages = %+v, want only the correction", telegram.pendingMessages)
+	}
+
+	respond(t, telegram, original, "Sorry?")
+	respond(t, telegram, inputs[0].OriginalMessage, "Hello alice")
+
+	if texts := bot.texts(); !reflect.DeepEqual(texts, []string{"Hello alice"}) {
+		t.Errorf("texts = %q, want only the response to the correction", texts)
+	}
+}
+
+func TestEditedMessageAnswered(t *testing.T) {
+	telegram, bot, userInput := newTestTelegram()
+	telegram.CorrectEditedMessages = true
+	original := receive(t, telegram, userInput, "helo")
+	respond(t, telegram, original, "Sorry?")
+
+	// The answered message cannot be superseded: the correction is answered
+	// in addition to it.
+	telegram.editedMessageHandler()(textMessage("hello"))
+	inputs := forwarded(userInput)
+	if len(inputs) != 1 {
+		t.Fatalf("forwarded inputs = %+v, want the correction", inputs)
+	}
+
+	respond(t, telegram, inputs[0].OriginalMessage, "Hello alice")
+	if texts := bot.texts(); !reflect.DeepEqual(texts, []string{"Sorry?", "Hello alice"}) {
+		t.Errorf("texts = %q, want both responses", texts)
+	}
+}
@@ -0,0 +1,159 @@
+package telegram
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+type (
+	// feedbacks keeps the answers which can be rated until they are rated.
+	feedbacks struct {
+		// mutex protects the answers.
+		mutex sync.Mutex
+
+		// answers indexes the rateable answers by original message.
+		answers map[uuid.UUID]*ratedAnswer
+
+		// order is a slice containing the original messages of the answers in
+		// sending order, so the oldest answers are forgotten first.
+		order []uuid.UUID
+	}
+
+	// ratedAnswer is an answer which can be rated.
+	ratedAnswer struct {
+		// user is the name of the user who received the answer.
+		user string
+
+		// intent is the intent of the answer.
+		intent string
+	}
+)
+
+const (
+	// feedbackPrefix prefixes the callback data of the feedback buttons. The
+	// data is the prefix, the rating and the original message, separated by
+	// feedbackSeparator.
+	feedbackPrefix    = "feedback"
+	feedbackSeparator = "|"
+
+	// feedbackUp and feedbackDown are the ratings of the buttons.
+	feedbackUp   = "up"
+	feedbackDown = "down"
+
+	// maxRateableAnswers is the number of answers which can be rated at once.
+	// The oldest answers cannot be rated anymore.
+	maxRateableAnswers = 1000
+
+	// feedbackAcknowledgement is displayed when a rating is recorded.
+	feedbackAcknowledgement = "Thanks for your feedback!"
+)
+
+// newFeedbacks initializes an empty set of rateable answers.
+func newFeedbacks() *feedbacks {
+	return &feedbacks{answers: map[uuid.UUID]*ratedAnswer{}}
+}
+
+// add makes the answer of the given capsule rateable.
+func (f *feedbacks) add(c *capsule.Capsule) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if len(f.order) == maxRateableAnswers {
+		delete(f.answers, f.order[0])
+		f.order = f.order[1:]
+	}
+
+	f.answers[c.OriginalMessage] = &ratedAnswer{user: c.User, intent: c.Intent}
+	f.order = append(f.order, c.OriginalMessage)
+}
+
+// take returns the rateable answer of the given original message and removes
+// it, so an answer is rated once. It returns nil if there is none.
+func (f *feedbacks) take(originalMessage uuid.UUID) *ratedAnswer {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	answer, ok := f.answers[originalMessage]
+	if !ok {
+		return nil
+	}
+
+	delete(f.answers, originalMessage)
+	for i, id := range f.order {
+		if id == originalMessage {
+			f.order = append(f.order[:i], f.order[i+1:]...)
+			break
+		}
+	}
+
+	return answer
+}
+
+// feedbackKeyboard returns the inline buttons rating the answer of the given
+// original message.
+func feedbackKeyboard(originalMessage uuid.UUID) *tb.ReplyMarkup {
+	data := func(rating string) string {
+		return strings.Join([]string{feedbackPrefix, rating, originalMessage.String()}, feedbackSeparator)
+	}
+
+	return &tb.ReplyMarkup{
+		InlineKeyboard: [][]tb.InlineButton{{
+			{Text: "👍", Data: data(feedbackUp)},
+			{Text: "👎", Data: data(feedbackDown)},
+		}},
+	}
+}
+
+// callbackHandler handles the inline button callbacks. The feedback buttons
+// record the rating of the answer and acknowledge it. The card buttons send
+// their value as a user message.
+func (t *Telegram) callbackHandler() func(*tb.Callback) {
+	return func(callback *tb.Callback) {
+		localLogger := logger.WithField("action", "receiving callback")
+
+		data := strings.TrimPrefix(callback.Data, "\f")
+		if strings.HasPrefix(data, cardPrefix+feedbackSeparator) {
+			t.cardCallback(callback, strings.TrimPrefix(data, cardPrefix+feedbackSeparator))
+			return
+		}
+
+		fields := strings.Split(data, feedbackSeparator)
+		if len(fields) != 3 || fields[0] != feedbackPrefix {
+			return
+		}
+
+		originalMessage, err := uuid.Parse(fields[2])
+		if err != nil {
+			localLogger.WithError(err).Debug("Invalid feedback callback")
+			return
+		}
+
+		response := &tb.CallbackResponse{Text: feedbackAcknowledgement}
+		if answer := t.feedbacks.take(originalMessage); answer != nil {
+			err := provider.RecordFeedback(t.feedbackSink, &provider.Feedback{
+				OriginalMessage: originalMessage,
+				ProviderLabel:   label,
+				User:            answer.user,
+				Intent:          answer.intent,
+				Positive:        fields[1] == feedbackUp,
+				Time:            time.Now(),
+			})
+			if err != nil {
+				localLogger.WithError(err).Error("Cannot record feedback")
+			}
+		}
+
+		if err := t.api.Respond(callback, response); err != nil {
+			localLogger.WithFields(log.Fields{
+				"uuid": originalMessage,
+			}).WithError(err).Debug("Cannot acknowledge feedback")
+		}
+	}
+}
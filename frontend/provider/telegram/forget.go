@@ -0,0 +1,45 @@
+package telegram
+
+import (
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+)
+
+// Forget deletes the data kept about the user of the given message: its
+// answer history, its delivery failures and its other pending messages,
+// which will not be answered. The given message stays pending so the deletion
+// can be confirmed.
+func (t *Telegram) Forget(originalMessage uuid.UUID) error {
+	t.pendingMutex.Lock()
+	userID := 0
+	found := false
+	for _, m := range t.pendingMessages {
+		if m.uuid == originalMessage {
+			userID = m.user.ID
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		t.pendingMutex.Unlock()
+		return errors.NotFoundf("message (uuid: %s)", originalMessage)
+	}
+
+	pendingMessages := []*message{}
+	for _, m := range t.pendingMessages {
+		if m.uuid == originalMessage || m.user.ID != userID {
+			pendingMessages = append(pendingMessages, m)
+		}
+	}
+	t.pendingMessages = pendingMessages
+	t.pendingMutex.Unlock()
+
+	t.history.forget(userID)
+
+	t.usersMutex.Lock()
+	delete(t.unreachable, userID)
+	t.usersMutex.Unlock()
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package telegram
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+func TestForget(t *testing.T) {
+	telegram, _, userInput := newTestTelegram()
+
+	older := receive(t, telegram, userInput, "hello")
+	telegram.textMessageHandler()(&tb.Message{
+		ID:     2,
+		Sender: &tb.User{ID: 43, Username: "bob"},
+		Chat:   &tb.Chat{ID: 43, Type: tb.ChatPrivate},
+		Text:   "hello",
+	})
+	bob := forwarded(userInput)[0].OriginalMessage
+	forget := receive(t, telegram, userInput, "/forgetme")
+
+	telegram.history.record(42, []string{"Hello alice"})
+	telegram.history.record(43, []string{"Hello bob"})
+	telegram.unreachable[42] = 1
+
+	if err := telegram.Forget(forget); err != nil {
+		t.Fatalf("Forget() error = %v", err)
+	}
+
+	// The command stays pending so the deletion can be confirmed.
+	if _, ok := telegram.pendingMessage(forget); !ok {
+		t.Error("the command is not pending anymore")
+	}
+
+	if _, ok := telegram.pendingMessage(older); ok {
+		t.Error("the other message of the user is still pending")
+	}
+
+	if _, ok := telegram.pendingMessage(bob); !ok {
+		t.Error("the message of another user was deleted")
+	}
+
+	if answers := telegram.history.last(42); len(answers) != 0 {
+		t.Errorf("answers of alice = %v, want none", answers)
+	}
+
+	if answers := telegram.history.last(43); !reflect.DeepEqual(answers, []string{"Hello bob"}) {
+		t.Errorf("answers of bob = %v, want them kept", answers)
+	}
+
+	if _, ok := telegram.unreachable[42]; ok {
+		t.Error("the delivery failures of alice were kept")
+	}
+
+	if err := telegram.Forget(uuid.New()); err == nil {
+		t.Error("expected an error for a message which is not pending")
+	}
+}
@@ -0,0 +1,124 @@
+package telegram
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/fberrez/samantha/frontend/provider"
+)
+
+const (
+	// maxMessageLength is the maximum length of a Telegram message.
+	maxMessageLength = 4096
+
+	// codeFence delimits Markdown code blocks.
+	codeFence = "```"
+
+	// truncationNote ends a response truncated to the maximum length of a
+	// message.
+	truncationNote = "\n…"
+)
+
+// looksLikeCode verifies if the given text looks like code: either a JSON
+// document or a multiline text whose indented lines contain code symbols.
+func looksLikeCode(text string) bool {
+	// A text containing a code fence cannot be wrapped in a code block.
+	if strings.Contains(text, codeFence) {
+		return false
+	}
+
+	trimmed := strings.TrimSpace(text)
+	if (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)) {
+		return true
+	}
+
+	lines := strings.Split(trimmed, "\n")
+	if len(lines) < 2 {
+		return false
+	}
+
+	for _, line := range lines {
+		indented := strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "  ")
+		if indented && strings.ContainsAny(line, "{}();=") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Format formats the output in Markdown: code is wrapped in a code block, which
+// must be sent in Markdown mode. The other texts are sent unchanged.
+func (t *Telegram) Format(output *provider.Output) string {
+	if output.Code {
+		return codeFence + "\n" + output.Text + "\n" + codeFence
+	}
+
+	return output.Text
+}
+
+// splitCode splits the given code on line boundaries so each part fits in
+// limit characters once wrapped in a code block. The lengths are counted in
+// characters, so a multibyte character is never cut. The blank blocks are
+// skipped.
+func splitCode(code string, limit int) []string {
+	// maxCodeLength is the maximum length of the code of a block.
+	maxCodeLength := limit - 2*len(codeFence) - 2
+
+	blocks := []string{}
+	current := []rune{}
+	flush := func() {
+		if len(strings.TrimSpace(string(current))) > 0 {
+			blocks = append(blocks, string(current))
+		}
+		current = []rune{}
+	}
+
+	for _, text := range strings.Split(code, "\n") {
+		line := []rune(text)
+
+		// A line longer than a block is cut.
+		for len(line) > maxCodeLength {
+			flush()
+			current = append(current, line[:maxCodeLength]...)
+			flush()
+			line = line[maxCodeLength:]
+		}
+
+		if len(current)+len(line)+1 > maxCodeLength {
+			flush()
+		}
+
+		if len(current) > 0 {
+			current = append(current, '\n')
+		}
+		current = append(current, line...)
+	}
+
+	flush()
+	return blocks
+}
+
+// capBubbles limits the responses to max bubbles by joining the overflowing
+// responses in the last bubble. The last bubble is truncated with an ellipsis
+// when it is longer than limit. The responses are not limited when max is
+// zero.
+func capBubbles(responses []string, max int, limit int) []string {
+	if max <= 0 || len(responses) <= max {
+		return responses
+	}
+
+	capped := append([]string{}, responses[:max-1]...)
+	return append(capped, truncate(strings.Join(responses[max-1:], "\n"), limit))
+}
+
+// truncate truncates the text with an ellipsis when it is longer than limit
+// characters.
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+
+	return string(append(runes[:limit-len([]rune(truncationNote))], []rune(truncationNote)...))
+}
@@ -0,0 +1,166 @@
+package telegram
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/fberrez/samantha/frontend/provider"
+)
+
+func TestSplitCode(t *testing.T) {
+	const limit = 20
+	maxCodeLength := limit - 2*len(codeFence) - 2
+
+	tests := []struct {
+		name string
+		code string
+		want int
+	}{
+		{"short", "a := 1", 1},
+		{"several lines", "a := 1\nb := 2\nc := 3", 3},
+		{"lines sharing a block", "a=1\nb=2\nc=3\nd=4", 2},
+		{"long line", strings.Repeat("x", 30), 3},
+		{"multibyte characters", strings.Repeat("é", 30), 3},
+		{"blank", "\n  \n\t\n", 0},
+		{"blank lines between blocks", "a := 1\n\n\n\n\n\n\n\n\n\n\n\nb := 2", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks := splitCode(tt.code, limit)
+			if len(blocks) != tt.want {
+				t.Fatalf("splitCode() = %q, want %d blocks", blocks, tt.want)
+			}
+
+			for _, block := range blocks {
+				if !utf8.ValidString(block) {
+					t.Errorf("block %q is not valid UTF-8", block)
+				}
+
+				if utf8.RuneCountInString(block) > maxCodeLength {
+					t.Errorf("block %q is longer than %d characters", block, maxCodeLength)
+				}
+
+				if len(strings.TrimSpace(block)) == 0 {
+					t.Errorf("blank block in %q", blocks)
+				}
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		output *provider.Output
+		want   string
+	}{
+		{"text", &provider.Output{Text: "Hello alice"}, "Hello alice"},
+		{"code", &provider.Output{Text: "a := 1", Code: true}, codeFence + "\na := 1\n" + codeFence},
+	}
+
+	telegram := &Telegram{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := telegram.Format(tt.output); got != tt.want {
+				t.Errorf("Format() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLooksLikeCode(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want bool
+	}{
+		{"sentence", "Hello, how are you?", false},
+		{"JSON", `{"key": "value"}`, true},
+		{"indented code", "func main() {\n\tfmt.Println(1)\n}", true},
+		{"fenced", "```\ncode\n```", false},
+		{"multiline text", "first line\nsecond line", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := looksLikeCode(tt.text); got != tt.want {
+				t.Errorf("looksLikeCode(%q) = %t, want %t", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCapBubbles(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []string
+		max       int
+		want      []string
+	}{
+		{"unlimited", []string{"a", "b", "c"}, 0, []string{"a", "b", "c"}},
+		{"under the cap", []string{"a", "b"}, 3, []string{"a", "b"}},
+		{"at the cap", []string{"a", "b", "c"}, 3, []string{"a", "b", "c"}},
+		{"overflow", []string{"a", "b", "c", "d"}, 2, []string{"a", "b\nc\nd"}},
+		{"single bubble", []string{"a", "b", "c"}, 1, []string{"a\nb\nc"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := capBubbles(tt.responses, tt.max, maxMessageLength); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("capBubbles() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCapBubblesTruncation(t *testing.T) {
+	responses := []string{"first", strings.Repeat("a", maxMessageLength), "overflow"}
+	got := capBubbles(responses, 2, maxMessageLength)
+
+	if len(got) != 2 || got[0] != "first" {
+		t.Fatalf("capBubbles() = %d bubbles, want the first response and the joined overflow", len(got))
+	}
+
+	last := []rune(got[1])
+	if len(last) != maxMessageLength || !strings.HasSuffix(got[1], truncationNote) {
+		t.Errorf("last bubble of %d runes, want %d runes ending with the truncation note", len(last), maxMessageLength)
+	}
+}
+
+func TestResponsePrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+	}{
+		{"prefix", "Sam: "},
+		{"no prefix", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telegram, bot, _ := newTestTelegram()
+			telegram.ResponsePrefix = tt.prefix
+
+			answer(t, telegram, provider.Text, "Hello", strings.Repeat("a", maxMessageLength))
+
+			texts := bot.texts()
+			if len(texts) != 2 || texts[0] != tt.prefix+"Hello" {
+				t.Fatalf("texts = %q, want each bubble prefixed with %q", texts, tt.prefix)
+			}
+
+			// The prefix is counted in the length of the message: the long
+			// response is truncated to make room for it.
+			long := texts[1]
+			if utf8.RuneCountInString(long) != maxMessageLength || !strings.HasPrefix(long, tt.prefix) {
+				t.Errorf("long bubble of %d runes, want %d runes with the prefix", utf8.RuneCountInString(long), maxMessageLength)
+			}
+
+			if truncated := strings.HasSuffix(long, truncationNote); truncated != (len(tt.prefix) > 0) {
+				t.Errorf("long bubble truncated: %t, want %t", truncated, len(tt.prefix) > 0)
+			}
+		})
+	}
+}
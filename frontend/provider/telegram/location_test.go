@@ -0,0 +1,66 @@
+package telegram
+
+import (
+	"testing"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/frontend/provider"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// locationMessage returns a location shared by alice in a private chat.
+func locationMessage(location *tb.Location) *tb.Message {
+	message := textMessage("")
+	message.Location = location
+	return message
+}
+
+func TestLocationMessage(t *testing.T) {
+	telegram, _, userInput := newTestTelegram()
+
+	telegram.locationMessageHandler()(locationMessage(&tb.Location{Lat: 48.5, Lng: 2.25}))
+
+	inputs := forwarded(userInput)
+	if len(inputs) != 1 {
+		t.Fatalf("forwarded inputs = %v, want one input", inputs)
+	}
+
+	want := &capsule.Location{Latitude: 48.5, Longitude: 2.25}
+	if location := inputs[0].Location; location == nil || *location != *want {
+		t.Errorf("location = %+v, want %+v", location, want)
+	}
+
+	if inputs[0].Content != "48.500000,2.250000" {
+		t.Errorf("content = %q, want the coordinates", inputs[0].Content)
+	}
+}
+
+func TestLocationMessageUnauthorized(t *testing.T) {
+	telegram, bot, userInput := newTestTelegram()
+	telegram.AllowAllUsers = false
+	telegram.AuthorizedUsers = []*provider.User{{Name: "bob", ID: 7}}
+
+	telegram.locationMessageHandler()(locationMessage(&tb.Location{Lat: 48.5, Lng: 2.25}))
+
+	if inputs := forwarded(userInput); len(inputs) != 0 {
+		t.Errorf("forwarded inputs = %v, want none", inputs)
+	}
+
+	if texts := bot.texts(); len(texts) != 0 {
+		t.Errorf("sent messages = %v, want none", texts)
+	}
+}
+
+func TestLocationMessageWithoutLocation(t *testing.T) {
+	telegram, bot, userInput := newTestTelegram()
+
+	telegram.locationMessageHandler()(locationMessage(nil))
+
+	if inputs := forwarded(userInput); len(inputs) != 0 {
+		t.Errorf("forwarded inputs = %v, want none", inputs)
+	}
+
+	if texts := bot.texts(); len(texts) != 1 {
+		t.Errorf("sent messages = %v, want an error message", texts)
+	}
+}
@@ -0,0 +1,78 @@
+package telegram
+
+import (
+	"sync"
+)
+
+type (
+	// pacedDeliveries delivers the responses with pauses in the background, so
+	// the pauses do not hold the frontend. The deliveries of a chat are made in
+	// order, one at a time.
+	pacedDeliveries struct {
+		// mutex protects the queues.
+		mutex sync.Mutex
+
+		// queues indexes by chat the deliveries in progress and waiting. The
+		// first delivery of a queue is in progress.
+		queues map[string][]func()
+
+		// wg waits for the deliveries in progress.
+		wg sync.WaitGroup
+	}
+)
+
+// newPacedDeliveries initializes an empty set of paced deliveries.
+func newPacedDeliveries() *pacedDeliveries {
+	return &pacedDeliveries{queues: map[string][]func(){}}
+}
+
+// schedule queues the delivery behind the deliveries of the chat. A delivery
+// is queued when it is paced or when a previous delivery of the chat is in
+// progress, so the responses keep their order. It returns false when the
+// delivery is not queued, in which case it must be made by the caller.
+func (p *pacedDeliveries) schedule(chat string, paced bool, delivery func()) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	queue, busy := p.queues[chat]
+	if !busy && !paced {
+		return false
+	}
+
+	p.queues[chat] = append(queue, delivery)
+	if !busy {
+		p.wg.Add(1)
+		go p.deliver(chat)
+	}
+
+	return true
+}
+
+// deliver makes the deliveries of the chat until its queue is empty.
+func (p *pacedDeliveries) deliver(chat string) {
+	defer p.wg.Done()
+
+	for {
+		p.mutex.Lock()
+		delivery := p.queues[chat][0]
+		p.mutex.Unlock()
+
+		delivery()
+
+		p.mutex.Lock()
+		queue := p.queues[chat][1:]
+		if len(queue) == 0 {
+			delete(p.queues, chat)
+			p.mutex.Unlock()
+			return
+		}
+
+		p.queues[chat] = queue
+		p.mutex.Unlock()
+	}
+}
+
+// wait waits until every queued delivery is made.
+func (p *pacedDeliveries) wait() {
+	p.wg.Wait()
+}
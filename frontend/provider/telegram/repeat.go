@@ -0,0 +1,119 @@
+package telegram
+
+import (
+	"sync"
+
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// history keeps the last answers sent to each user in a ring buffer, so
+	// they can be sent again with the repeat command.
+	history struct {
+		// mutex protects the answers map.
+		mutex sync.Mutex
+
+		// answers indexes by user ID the ring buffer of the last answers. Each
+		// answer is the slice of responses of a capsule.
+		answers map[int]*ring
+	}
+
+	// ring is a fixed-size ring buffer of answers.
+	ring struct {
+		// answers are the buffered answers.
+		answers [historySize][]string
+
+		// next is the index of the next answer to write.
+		next int
+
+		// count is the number of buffered answers.
+		count int
+	}
+)
+
+const (
+	// historySize is the number of answers kept per user.
+	historySize = 3
+
+	// nothingToRepeat is the message sent when no answer has been sent to the
+	// user yet.
+	nothingToRepeat = "Nothing to repeat"
+)
+
+// newHistory initializes an empty history.
+func newHistory() *history {
+	return &history{answers: map[int]*ring{}}
+}
+
+// record adds an answer sent to the given user, overwriting its oldest answer
+// once the buffer is full.
+func (h *history) record(userID int, responses []string) {
+	if len(responses) == 0 {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	r, ok := h.answers[userID]
+	if !ok {
+		r = &ring{}
+		h.answers[userID] = r
+	}
+
+	r.answers[r.next] = append([]string{}, responses...)
+	r.next = (r.next + 1) % historySize
+	if r.count < historySize {
+		r.count++
+	}
+}
+
+// last returns the last answer sent to the given user, or nil if there is
+// none.
+func (h *history) last(userID int) []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	r, ok := h.answers[userID]
+	if !ok || r.count == 0 {
+		return nil
+	}
+
+	return r.answers[(r.next+historySize-1)%historySize]
+}
+
+// forget deletes the answers sent to the given user.
+func (h *history) forget(userID int) {
+	h.mutex.Lock()
+	delete(h.answers, userID)
+	h.mutex.Unlock()
+}
+
+// Repeat sends again the last answer to the user of the given message. An
+// Info system log is sent when there is nothing to repeat.
+func (t *Telegram) Repeat(originalMessage uuid.UUID) error {
+	pendingMessage, err := t.findPendingMessage(originalMessage)
+	if err != nil {
+		return err
+	}
+
+	responses := t.history.last(pendingMessage.user.ID)
+	if len(responses) == 0 {
+		responses = []string{provider.SystemLog(nothingToRepeat, provider.Info)}
+	}
+
+	for _, response := range responses {
+		if _, err := t.api.Send(t.recipient(pendingMessage), response); err != nil {
+			logger.WithFields(log.Fields{
+				"user": pendingMessage.user.Username,
+				"uuid": originalMessage,
+			}).WithError(err).Error("Cannot repeat response to user")
+			return errors.Annotate(err, "repeating responses")
+		}
+	}
+
+	return nil
+}
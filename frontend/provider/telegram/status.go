@@ -0,0 +1,98 @@
+package telegram
+
+import (
+	"sync"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+type (
+	// statusMessages keeps the transient messages displaying the statuses of
+	// the pending messages, so a status replaces the previous one and they
+	// are deleted once the answer arrives.
+	statusMessages struct {
+		// mutex protects the messages.
+		mutex sync.Mutex
+
+		// messages indexes the status messages by original message.
+		messages map[uuid.UUID]*tb.Message
+	}
+)
+
+// newStatusMessages initializes an empty set of status messages.
+func newStatusMessages() *statusMessages {
+	return &statusMessages{messages: map[uuid.UUID]*tb.Message{}}
+}
+
+// get returns the status message of the given original message.
+func (s *statusMessages) get(id uuid.UUID) (*tb.Message, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sent, ok := s.messages[id]
+	return sent, ok
+}
+
+// set sets the status message of the given original message.
+func (s *statusMessages) set(id uuid.UUID, sent *tb.Message) {
+	s.mutex.Lock()
+	s.messages[id] = sent
+	s.mutex.Unlock()
+}
+
+// take returns the status message of the given original message and forgets
+// it.
+func (s *statusMessages) take(id uuid.UUID) (*tb.Message, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sent, ok := s.messages[id]
+	delete(s.messages, id)
+	return sent, ok
+}
+
+// Status displays the status of the given pending message. The typing status
+// is displayed as a typing indicator, the other statuses as a transient
+// message edited by the next status and deleted when the answer is sent.
+func (t *Telegram) Status(originalMessage uuid.UUID, status string) error {
+	pendingMessage, ok := t.pendingMessage(originalMessage)
+	if !ok {
+		return errors.NotFoundf("message (uuid: %s)", originalMessage)
+	}
+
+	if status == capsule.StatusTyping {
+		t.clearStatus(originalMessage)
+		return errors.Annotate(t.api.Notify(t.recipient(pendingMessage), tb.Typing), "displaying typing indicator")
+	}
+
+	if sent, ok := t.statuses.get(originalMessage); ok {
+		if _, err := t.api.Edit(sent, status); err != nil {
+			return errors.Annotate(err, "editing status message")
+		}
+		return nil
+	}
+
+	sent, err := t.api.Send(t.recipient(pendingMessage), status)
+	if err != nil {
+		return errors.Annotate(err, "sending status message")
+	}
+
+	t.statuses.set(originalMessage, sent)
+	return nil
+}
+
+// clearStatus deletes the status message of the given original message, if
+// any.
+func (t *Telegram) clearStatus(originalMessage uuid.UUID) {
+	sent, ok := t.statuses.take(originalMessage)
+	if !ok {
+		return
+	}
+
+	if err := t.api.Delete(sent); err != nil {
+		logger.WithError(err).Debug("Cannot delete status message")
+	}
+}
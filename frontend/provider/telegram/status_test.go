@@ -0,0 +1,60 @@
+package telegram
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fberrez/samantha/capsule"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+func TestStatus(t *testing.T) {
+	telegram, bot, userInput := newTestTelegram()
+	id := receive(t, telegram, userInput, "search")
+
+	// The statuses replace each other in a single message.
+	for _, status := range []string{capsule.StatusTyping, "Searching the database", "Still searching"} {
+		if err := telegram.Status(id, status); err != nil {
+			t.Fatalf("Status(%q) error = %v", status, err)
+		}
+	}
+
+	respond(t, telegram, id, "Found it")
+
+	bot.mutex.Lock()
+	defer bot.mutex.Unlock()
+
+	if !reflect.DeepEqual(bot.notified, []tb.ChatAction{tb.Typing}) {
+		t.Errorf("chat actions = %v, want the typing indicator", bot.notified)
+	}
+
+	if len(bot.edited) != 1 || bot.edited[0].what != "Still searching" {
+		t.Errorf("edits = %+v, want the status message edited once", bot.edited)
+	}
+
+	if bot.deleted != 1 {
+		t.Errorf("deleted messages = %d, want the status message deleted", bot.deleted)
+	}
+
+	texts := []interface{}{}
+	for _, m := range bot.sent {
+		texts = append(texts, m.what)
+	}
+	if !reflect.DeepEqual(texts, []interface{}{"Searching the database", "Found it"}) {
+		t.Errorf("sent messages = %v, want a status message then the answer", texts)
+	}
+}
+
+func TestStatusNotPending(t *testing.T) {
+	telegram, bot, userInput := newTestTelegram()
+	id := receive(t, telegram, userInput, "search")
+	respond(t, telegram, id, "Found it")
+
+	if err := telegram.Status(id, "Searching the database"); err == nil {
+		t.Error("expected an error for an answered message")
+	}
+
+	if texts := bot.texts(); len(texts) != 1 {
+		t.Errorf("texts = %q, want only the answer", texts)
+	}
+}
@@ -0,0 +1,113 @@
+package telegram
+
+import (
+	"strings"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/juju/errors"
+)
+
+const (
+	// streamPlaceholder is the text of the message sent before the first
+	// chunk of a streamed response.
+	streamPlaceholder = "…"
+
+	// streamEditInterval is the minimum duration between two edits of a
+	// streamed message, to respect the Telegram rate limits.
+	streamEditInterval = time.Second
+)
+
+// MessageStream responds to a user with a streamed response. A placeholder
+// message is sent, then periodically edited with the text received so far.
+// A new message is started when the text exceeds the maximum message length.
+// The stream is drained on every exit, so its producer never blocks, and a
+// placeholder left without text is deleted.
+func (t *Telegram) MessageStream(capsule *capsule.Capsule) error {
+	defer drain(capsule.Stream)
+
+	t.clearStatus(capsule.OriginalMessage)
+	pendingMessage, err := t.findPendingMessage(capsule.OriginalMessage)
+	if err != nil {
+		return err
+	}
+
+	recipient := t.recipient(pendingMessage)
+	sent, err := t.api.Send(recipient, streamPlaceholder)
+	if err != nil {
+		return errors.Annotate(err, "sending streamed response")
+	}
+
+	ticker := time.NewTicker(streamEditInterval)
+	defer ticker.Stop()
+
+	text, edited, full := "", "", ""
+	edit := func() error {
+		if text == edited || len(strings.TrimSpace(text)) == 0 {
+			return nil
+		}
+
+		if _, err := t.api.Edit(sent, text); err != nil {
+			return errors.Annotate(err, "editing streamed response")
+		}
+
+		edited = text
+		return nil
+	}
+
+	// abort deletes the current message when it is still the placeholder.
+	abort := func(err error) error {
+		if len(edited) == 0 {
+			if deleteErr := t.api.Delete(sent); deleteErr != nil {
+				logger.WithError(deleteErr).Debug("Cannot delete stream placeholder")
+			}
+		}
+
+		return err
+	}
+
+	for {
+		select {
+		case chunk, ok := <-capsule.Stream:
+			if !ok {
+				if len(strings.TrimSpace(full)) > 0 {
+					t.history.record(pendingMessage.user.ID, []string{full})
+				}
+
+				return abort(edit())
+			}
+
+			text += chunk
+			full += chunk
+			if runes := []rune(text); len(runes) > maxMessageLength {
+				// Completes the current message and continues in a new one.
+				text = string(runes[:maxMessageLength])
+				if err := edit(); err != nil {
+					return abort(err)
+				}
+
+				text, edited = string(runes[maxMessageLength:]), ""
+				if sent, err = t.api.Send(recipient, streamPlaceholder); err != nil {
+					return errors.Annotate(err, "sending streamed response")
+				}
+			}
+		case <-ticker.C:
+			if err := edit(); err != nil {
+				return abort(err)
+			}
+		}
+	}
+}
+
+// drain consumes the rest of the stream in the background, so its producer
+// can complete.
+func drain(stream <-chan string) {
+	if stream == nil {
+		return
+	}
+
+	go func() {
+		for range stream {
+		}
+	}()
+}
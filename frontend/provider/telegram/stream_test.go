@@ -0,0 +1,137 @@
+package telegram
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/google/uuid"
+)
+
+// stream returns a stream sending the chunks, and a channel closed once every
+// chunk has been consumed.
+func stream(chunks ...string) (<-chan string, <-chan struct{}) {
+	s := make(chan string)
+	consumed := make(chan struct{})
+	go func() {
+		defer close(consumed)
+		defer close(s)
+
+		for _, chunk := range chunks {
+			s <- chunk
+		}
+	}()
+
+	return s, consumed
+}
+
+// waitConsumed fails the test if the stream is not consumed.
+func waitConsumed(t *testing.T, consumed <-chan struct{}) {
+	t.Helper()
+
+	select {
+	case <-consumed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stream producer is blocked")
+	}
+}
+
+func TestMessageStream(t *testing.T) {
+	telegram, bot, userInput := newTestTelegram()
+	id := receive(t, telegram, userInput, "hello")
+
+	s, consumed := stream("Hello ", "there", "!")
+	if err := telegram.MessageStream(&capsule.Capsule{OriginalMessage: id, Stream: s}); err != nil {
+		t.Fatalf("MessageStream() error = %v", err)
+	}
+	waitConsumed(t, consumed)
+
+	if texts := bot.texts(); len(texts) != 1 || texts[0] != streamPlaceholder {
+		t.Errorf("sent messages = %v, want the placeholder", texts)
+	}
+
+	if n := len(bot.edited); n == 0 || bot.edited[n-1].what != "Hello there!" {
+		t.Errorf("edits = %v, want the whole response last", bot.edited)
+	}
+
+	if bot.deleted != 0 {
+		t.Errorf("%d messages deleted, want none", bot.deleted)
+	}
+}
+
+func TestMessageStreamSplit(t *testing.T) {
+	telegram, bot, userInput := newTestTelegram()
+	id := receive(t, telegram, userInput, "hello")
+
+	s, consumed := stream(strings.Repeat("a", maxMessageLength), "b")
+	if err := telegram.MessageStream(&capsule.Capsule{OriginalMessage: id, Stream: s}); err != nil {
+		t.Fatalf("MessageStream() error = %v", err)
+	}
+	waitConsumed(t, consumed)
+
+	if texts := bot.texts(); len(texts) != 2 {
+		t.Errorf("sent messages = %v, want two placeholders", texts)
+	}
+
+	if n := len(bot.edited); n != 2 || bot.edited[1].what != "b" {
+		t.Errorf("edits = %v, want the overflow in the second message", bot.edited)
+	}
+}
+
+func TestMessageStreamEmpty(t *testing.T) {
+	telegram, bot, userInput := newTestTelegram()
+	id := receive(t, telegram, userInput, "hello")
+
+	s, consumed := stream(" ", "")
+	if err := telegram.MessageStream(&capsule.Capsule{OriginalMessage: id, Stream: s}); err != nil {
+		t.Fatalf("MessageStream() error = %v", err)
+	}
+	waitConsumed(t, consumed)
+
+	if bot.deleted != 1 {
+		t.Errorf("%d messages deleted, want the placeholder deleted", bot.deleted)
+	}
+}
+
+func TestMessageStreamFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(bot *fakeBot)
+		pending bool
+		deleted int
+	}{
+		{"unknown message", func(bot *fakeBot) {}, false, 0},
+		{"placeholder not sent", func(bot *fakeBot) {
+			bot.fail = func(call int) error { return errors.New("network failure") }
+		}, true, 0},
+		{"edit failure", func(bot *fakeBot) { bot.editErr = errors.New("network failure") }, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telegram, bot, userInput := newTestTelegram()
+			id := uuid.New()
+			if tt.pending {
+				id = receive(t, telegram, userInput, "hello")
+			}
+			tt.setup(bot)
+
+			chunks := make([]string, 100)
+			for i := range chunks {
+				chunks[i] = strings.Repeat("x", 100)
+			}
+
+			s, consumed := stream(chunks...)
+			if err := telegram.MessageStream(&capsule.Capsule{OriginalMessage: id, Stream: s}); err == nil {
+				t.Error("expected an error")
+			}
+			waitConsumed(t, consumed)
+
+			if bot.deleted != tt.deleted {
+				t.Errorf("%d messages deleted, want %d", bot.deleted, tt.deleted)
+			}
+		})
+	}
+}
@@ -1,10 +1,18 @@
 package telegram
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/fberrez/samantha/capsule"
 	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/fberrez/samantha/frontend/provider/webhook"
 	"github.com/google/uuid"
 	"github.com/juju/errors"
 	log "github.com/sirupsen/logrus"
@@ -18,18 +26,203 @@ type (
 		// Bot is the handler which handles the message sent by users
 		Bot *tb.Bot
 
+		// api sends, edits and downloads the messages. It is the bot, unless
+		// it is replaced in the tests.
+		api botAPI
+
+		// Mode is the way the updates are received: longpoll or webhook.
+		Mode string
+
+		// server receives the updates in webhook mode. It is nil in long
+		// polling mode.
+		server *webhook.Server
+
+		// processUpdate dispatches the updates received by the webhook server
+		// to the handlers. It is the bot, unless it is replaced in the tests.
+		processUpdate func(update tb.Update)
+
+		// webhookURL is the public URL of the webhook server in webhook mode.
+		webhookURL string
+
+		// webhookPath is the path of the webhook URL, the only path on which
+		// the server accepts updates.
+		webhookPath string
+
+		// webhookCert is the path of the certificate uploaded to Telegram with
+		// the webhook, so it accepts a self-signed certificate. It is empty
+		// when the certificate is trusted.
+		webhookCert string
+
+		// webhookSecret is the secret token Telegram sends with each update,
+		// in the X-Telegram-Bot-Api-Secret-Token header.
+		webhookSecret string
+
 		// AuthorizedUsers is a authorized users slice.
 		AuthorizedUsers []*provider.User
 
+		// UserStore persists the removal of the unreachable users. They are
+		// only removed from AuthorizedUsers when it is nil.
+		UserStore provider.UserStore
+
+		// AllowAllUsers disables the authorization check: anyone can talk to
+		// the bot.
+		AllowAllUsers bool
+
+		// UnauthorizedMessage is sent once to each unauthorized user. The
+		// unauthorized users are silently ignored when it is empty.
+		UnauthorizedMessage string
+
+		// greeted indexes by ID the unauthorized users who already received the
+		// unauthorized message. It is protected by usersMutex.
+		greeted map[int]bool
+
+		// RemoveUnreachableUsers is the number of consecutive delivery failures
+		// after which a user who blocked the bot is removed from the authorized
+		// users. Users are never removed when it is zero.
+		RemoveUnreachableUsers int
+
+		// usersMutex protects the authorized users and the unreachable map.
+		usersMutex sync.RWMutex
+
+		// unreachable indexes by user ID the number of consecutive delivery
+		// failures of the users who blocked the bot.
+		unreachable map[int]int
+
+		// RateLimiter limits the number of messages of each user. It is nil when
+		// the messages are not limited.
+		RateLimiter *provider.RateLimiter
+
+		// LogSampler samples the logs of the received messages. It is nil when
+		// every message is logged.
+		LogSampler *provider.LogSampler
+
+		// AckReaction is the emoji set as a reaction on user messages to
+		// acknowledge their receipt. No reaction is set when it is empty.
+		AckReaction string
+
+		// MinMessageLength is the minimum length of a text message, once
+		// trimmed. Shorter messages are not forwarded.
+		MinMessageLength int
+
+		// MaxInputLength is the maximum length of a text message. Longer
+		// messages are truncated, or rejected when RejectLongInput is true. The
+		// messages are not limited when it is zero.
+		MaxInputLength int
+
+		// RejectLongInput rejects the messages longer than MaxInputLength
+		// instead of truncating them.
+		RejectLongInput bool
+
+		// AllowedChatTypes is a slice containing the types of the chats in
+		// which the bot answers (private, group, supergroup or channel).
+		AllowedChatTypes []string
+
+		// AllowedChatIDs is a slice containing the IDs of the chats in which
+		// the bot answers whatever their type. The bot answers in every chat
+		// when both AllowedChatTypes and AllowedChatIDs are empty.
+		AllowedChatIDs []int64
+
+		// GroupMode enables the mention-gating in group chats: only the messages
+		// mentioning the bot or replying to it are processed, and they are
+		// answered in the chat. Otherwise, the users are answered privately.
+		GroupMode bool
+
+		// mention is the pattern matching the mentions of the bot. It is nil
+		// when the bot username is unknown.
+		mention *regexp.Regexp
+
+		// HandleChannelPosts enables the processing of the posts of the
+		// channels administered by the bot.
+		HandleChannelPosts bool
+
+		// ChannelTrigger is the prefix of the processed channel posts. It
+		// defaults to the mention of the bot.
+		ChannelTrigger string
+
+		// CorrectEditedMessages handles the edited messages as corrections:
+		// they are processed again and supersede the unanswered original
+		// messages. The edits are ignored otherwise.
+		CorrectEditedMessages bool
+
+		// FormatCode enables the formatting of the responses looking like code
+		// as Markdown code blocks.
+		FormatCode bool
+
+		// MaxFileSize is the maximum size in bytes of the documents sent by
+		// users.
+		MaxFileSize int
+
+		// ResponsePrefix is prepended to each response bubble (ex: the persona
+		// name of the bot). The responses are not prefixed when it is empty.
+		ResponsePrefix string
+
+		// MaxResponseBubbles is the maximum number of responses sent for a
+		// message. The overflowing responses are joined in the last one. The
+		// responses are not limited when it is zero.
+		MaxResponseBubbles int
+
+		// CollectFeedback appends thumbs up and down buttons to the answers so
+		// the users can rate them.
+		CollectFeedback bool
+
+		// feedbackSink stores the ratings of the answers. The ratings are only
+		// counted when it is nil.
+		feedbackSink provider.FeedbackSink
+
+		// Synthesizer converts the responses to voice messages. They are only
+		// sent as text when it is nil.
+		Synthesizer provider.Synthesizer
+
+		// VoiceResponses sends the voice messages to every user. Otherwise,
+		// they are only sent in reply to audio messages.
+		VoiceResponses bool
+
+		// feedbacks keeps the answers which can be rated.
+		feedbacks *feedbacks
+
+		// IDGenerator generates the UUIDs of the user messages.
+		IDGenerator capsule.IDGenerator
+
 		// pendingMessages is a slice containing received messages that have not
-		// been answered.
+		// been answered. It is protected by pendingMutex.
 		pendingMessages []*message
 
+		// pendingMutex protects the pending messages, which are accessed by the
+		// handlers and the deliveries.
+		pendingMutex sync.Mutex
+
+		// superseded keeps the messages superseded by their correction, whose
+		// responses are dropped.
+		superseded *supersededMessages
+
+		// statuses keeps the messages displaying the interim statuses of the
+		// pending messages.
+		statuses *statusMessages
+
+		// history keeps the last answers sent to each user for the repeat
+		// command.
+		history *history
+
+		// paced delivers the responses with pauses in the background.
+		paced *pacedDeliveries
+
 		// userInput is a channel connected to the frontend manager. It is used to
 		// send user messages to that manager.
 		userInput chan<- *provider.CapsuleProvider
 	}
 
+	// botAPI is the part of the Telegram bot API used to send, edit and
+	// download the messages. It is implemented by *tb.Bot.
+	botAPI interface {
+		Send(to tb.Recipient, what interface{}, options ...interface{}) (*tb.Message, error)
+		Edit(message tb.Editable, what interface{}, options ...interface{}) (*tb.Message, error)
+		Delete(message tb.Editable) error
+		Notify(recipient tb.Recipient, action tb.ChatAction) error
+		Respond(callback *tb.Callback, responseOptional ...*tb.CallbackResponse) error
+		GetFile(file *tb.File) (io.ReadCloser, error)
+		Raw(method string, payload interface{}) ([]byte, error)
+	}
+
 	// message represents user messages.
 	message struct {
 		// uuid is the message uuid.
@@ -43,6 +236,37 @@ type (
 
 		// user is the user who sent the message.
 		user *tb.User
+
+		// chat is the chat in which the message has been sent.
+		chat *tb.Chat
+
+		// threadID is the ID of the message in a group chat, to which the
+		// answer replies. It is empty in the private chats.
+		threadID string
+
+		// locale is the locale of the user.
+		locale string
+
+		// timezone is the timezone of the user.
+		timezone string
+
+		// attachments are the files sent with the message.
+		attachments []*capsule.Attachment
+
+		// location is the location shared by the user.
+		location *capsule.Location
+
+		// metadata contains the raw data of the message sent to the backend.
+		metadata map[string]string
+	}
+
+	// apiResponse is the generic response of the Telegram Bot API.
+	apiResponse struct {
+		// Ok is false when the request failed.
+		Ok bool `json:"ok"`
+
+		// Description is the description of the error.
+		Description string `json:"description"`
 	}
 )
 
@@ -53,14 +277,27 @@ const (
 
 	// label is the provider label.
 	label = "telegram"
+
+	// defaultMinMessageLength is the default minimum length of a text message.
+	defaultMinMessageLength = 1
+
+	// defaultMaxFileSize is the default maximum size of a document. It is the
+	// download limit of the Bot API.
+	defaultMaxFileSize = 20 * 1000 * 1000
+
+	// maxPause is the maximum duration of a pause between two responses.
+	maxPause = 5 * time.Second
+
+	// The keys of the capsule metadata.
+	chatIDMetadata    = "chat_id"
+	chatTypeMetadata  = "chat_type"
+	messageIDMetadata = "message_id"
+	languageMetadata  = "language"
 )
 
 var (
 	// logger is a global logger of the package
-	logger = log.WithFields(log.Fields{
-		"package":  "frontend",
-		"provider": label,
-	})
+	logger = provider.NewLogger(label)
 )
 
 // Initialize initiliazes a provider with the given label, api token, slice
@@ -68,6 +305,23 @@ var (
 func (t *Telegram) Initialize(config *provider.Config) (provider.Provider, error) {
 	logger.Debugf("Initializing %s", label)
 
+	mode := strings.ToLower(config.Mode)
+	if len(mode) == 0 {
+		mode = longPollMode
+	}
+
+	if mode != longPollMode && mode != webhookMode {
+		return nil, errors.NotValidf("mode %q", config.Mode)
+	}
+
+	for _, chatType := range config.AllowedChatTypes {
+		switch tb.ChatType(chatType) {
+		case tb.ChatPrivate, tb.ChatGroup, tb.ChatSuperGroup, tb.ChatChannel:
+		default:
+			return nil, errors.NotValidf("chat type %q", chatType)
+		}
+	}
+
 	bot, err := tb.NewBot(tb.Settings{
 		Token:  config.Token,
 		Poller: &tb.LongPoller{Timeout: pollerTimeout},
@@ -76,15 +330,70 @@ func (t *Telegram) Initialize(config *provider.Config) (provider.Provider, error
 		return nil, errors.Annotate(err, "initializing telegram")
 	}
 
-	return &Telegram{
-		Bot:             bot,
-		AuthorizedUsers: config.AuthorizedUsers,
-		pendingMessages: []*message{},
-		userInput:       config.UserInput,
-	}, nil
+	minMessageLength := config.MinMessageLength
+	if minMessageLength <= 0 {
+		minMessageLength = defaultMinMessageLength
+	}
+
+	maxFileSize := config.MaxFileSize
+	if maxFileSize <= 0 {
+		maxFileSize = defaultMaxFileSize
+	}
+
+	client := &Telegram{
+		Bot:                    bot,
+		api:                    bot,
+		processUpdate:          bot.ProcessUpdate,
+		mention:                mentionPattern(bot.Me),
+		Mode:                   mode,
+		AuthorizedUsers:        config.AuthorizedUsers,
+		UserStore:              config.UserStore,
+		AllowAllUsers:          config.AllowAllUsers,
+		UnauthorizedMessage:    config.UnauthorizedMessage,
+		greeted:                map[int]bool{},
+		RemoveUnreachableUsers: config.RemoveUnreachableUsers,
+		unreachable:            map[int]int{},
+		RateLimiter:            provider.NewRateLimiter(config.RateLimit, provider.RateLimitWindow),
+		LogSampler:             provider.NewLogSampler(config.LogSampling),
+		AckReaction:            config.AckReaction,
+		MinMessageLength:       minMessageLength,
+		MaxInputLength:         config.MaxInputLength,
+		RejectLongInput:        config.RejectLongInput,
+		FormatCode:             config.FormatCode,
+		AllowedChatTypes:       config.AllowedChatTypes,
+		AllowedChatIDs:         config.AllowedChatIDs,
+		GroupMode:              config.GroupMode,
+		HandleChannelPosts:     config.HandleChannelPosts,
+		ChannelTrigger:         config.ChannelTrigger,
+		CorrectEditedMessages:  config.CorrectEditedMessages,
+		MaxFileSize:            maxFileSize,
+		MaxResponseBubbles:     config.MaxResponseBubbles,
+		ResponsePrefix:         config.ResponsePrefix,
+		CollectFeedback:        config.CollectFeedback,
+		feedbackSink:           config.FeedbackSink,
+		Synthesizer:            config.Synthesizer,
+		VoiceResponses:         config.VoiceResponses,
+		feedbacks:              newFeedbacks(),
+		IDGenerator:            capsule.RandomGenerator{},
+		pendingMessages:        []*message{},
+		superseded:             newSupersededMessages(),
+		statuses:               newStatusMessages(),
+		history:                newHistory(),
+		paced:                  newPacedDeliveries(),
+		userInput:              config.UserInput,
+	}
+
+	if mode == webhookMode {
+		if err := client.newWebhookServer(config); err != nil {
+			return nil, errors.Annotate(err, "initializing telegram")
+		}
+	}
+
+	return client, nil
 }
 
-// Start starts the provider handlers.
+// Start starts the provider handlers. The updates are received by long
+// polling or by the webhook server, depending on the mode.
 func (t *Telegram) Start() {
 	localLogger := log.WithField("ui", label)
 	localLogger.Debugf("Starting %s", label)
@@ -93,17 +402,76 @@ func (t *Telegram) Start() {
 	t.Bot.Handle(tb.OnText, t.textMessageHandler())
 	t.Bot.Handle(tb.OnPhoto, t.photoMessageHandler())
 	t.Bot.Handle(tb.OnAudio, t.audioMessageHandler())
+	t.Bot.Handle(tb.OnDocument, t.documentMessageHandler())
+	t.Bot.Handle(tb.OnLocation, t.locationMessageHandler())
+	t.Bot.Handle(tb.OnCallback, t.callbackHandler())
+	t.Bot.Handle(tb.OnEdited, t.editedMessageHandler())
+	if t.HandleChannelPosts {
+		t.Bot.Handle(tb.OnChannelPost, t.channelPostHandler())
+	}
+
+	if t.Mode == webhookMode {
+		if err := t.startWebhook(); err != nil {
+			localLogger.WithError(err).Error("Webhook server stopped")
+		}
+		return
+	}
 
 	t.Bot.Start()
 }
 
-// Message sends the text message to the user.
+// Message sends the text message to the user, replacing the status message.
+// The responses to the messages superseded by their correction are dropped.
 func (t *Telegram) Message(capsule *capsule.Capsule) error {
-	if capsule.Error != nil && len(capsule.Error.Error()) > 0 {
-		return t.sendErrorMessage(capsule.OriginalMessage, capsule.Error)
+	t.clearStatus(capsule.OriginalMessage)
+	if t.superseded.take(capsule.OriginalMessage) {
+		return nil
 	}
 
-	return t.sendTextMessage(capsule.OriginalMessage, capsule.Responses)
+	deliver := func() error {
+		if capsule.Error != nil && len(capsule.Error.Error()) > 0 {
+			return t.sendErrorMessage(capsule.OriginalMessage, capsule.Error)
+		}
+
+		return t.sendTextMessage(capsule)
+	}
+
+	// The responses with pauses are delivered in the background so the pauses
+	// do not hold the frontend. The next responses of the chat wait for them.
+	scheduled := t.paced.schedule(capsule.Chat, len(capsule.Pauses) > 0, func() {
+		if err := deliver(); err != nil {
+			logger.WithFields(log.Fields{
+				"user": capsule.User,
+				"uuid": capsule.OriginalMessage,
+			}).WithError(err).Error("Cannot deliver paced responses")
+		}
+	})
+	if scheduled {
+		return nil
+	}
+
+	return deliver()
+}
+
+// Notify sends the text to the chat whose ID is given.
+func (t *Telegram) Notify(chat string, text string) error {
+	id, err := strconv.ParseInt(chat, 10, 64)
+	if err != nil {
+		return errors.Annotatef(err, "parsing chat ID %s", chat)
+	}
+
+	if _, err := t.api.Send(tb.ChatID(id), text); err != nil {
+		return errors.Annotatef(err, "notifying chat %s", chat)
+	}
+
+	return nil
+}
+
+// Capabilities returns the capabilities of the provider. The suggestions
+// are displayed as keyboard buttons and the cards as photos with inline
+// buttons.
+func (t *Telegram) Capabilities() *capsule.Capabilities {
+	return &capsule.Capabilities{Buttons: true, Cards: true}
 }
 
 // GetLabel returns the label of the provider
@@ -111,10 +479,20 @@ func (t *Telegram) GetLabel() string {
 	return label
 }
 
-// Stop closes the user inputs channel and the telegram listener.
-func (t *Telegram) Stop() {
-	close(t.userInput)
+// Stop closes the telegram listener. The webhook is kept, so Telegram holds
+// the updates until the provider restarts. The user inputs channel is shared
+// with the other providers: it is closed by the frontend.
+func (t *Telegram) Stop() error {
+	t.paced.wait()
+	if t.Mode == webhookMode {
+		if err := t.server.Stop(); err != nil {
+			return errors.Annotate(err, "closing webhook server")
+		}
+		return nil
+	}
+
 	t.Bot.Stop()
+	return nil
 }
 
 // textMessageHandler handles text messages sent by users.
@@ -122,36 +500,103 @@ func (t *Telegram) textMessageHandler() func(*tb.Message) {
 	return func(message *tb.Message) {
 		localLogger := logger.WithField("action", "receiving user message")
 
-		// Verifies if the user is an authorized user.
-		userIsValid := false
-		for _, user := range t.AuthorizedUsers {
-			if user.Name == message.Sender.Username && user.ID == message.Sender.ID {
-				userIsValid = true
-				break
+		if !t.accept(message, localLogger) {
+			return
+		}
+
+		// In group mode, a group message is processed only if it is addressed
+		// to the bot. The mention is removed from the content.
+		if t.GroupMode && isGroup(message.Chat) {
+			if !t.isAddressed(message) {
+				localLogger.Debug("Group message not addressed to the bot")
+				return
 			}
+
+			message.Text = t.stripMention(message.Text)
 		}
 
-		if !userIsValid {
-			localLogger.WithFields(log.Fields{
-				"from":      message.Sender.Username,
-				"sender_id": message.Sender.ID,
-				"message":   message.Text,
-			}).Debug("User message received from unauthorized user")
-			return
+		// Acknowledges the receipt of the message. A chat which does not support
+		// reactions must not prevent the message from being processed.
+		if len(t.AckReaction) > 0 {
+			if err := t.acknowledge(message); err != nil {
+				localLogger.WithError(err).Warn("Cannot acknowledge user message")
+			}
+		}
+
+		// Sends the user input to the frontend manager.
+		if err := t.processUserMessage(message, provider.Text); err != nil {
+			// If an error occurred, it generates a system log message and sends it to
+			// the user.
+			systemlog := provider.SystemLog(err.Error(), provider.ErrorStatus)
+			t.api.Send(t.recipientOf(message), systemlog)
 		}
+	}
+}
 
+// accept verifies that the message has been sent in an allowed chat and that
+// its sender is authorized and has not exceeded its rate limit.
+func (t *Telegram) accept(message *tb.Message, localLogger *log.Entry) bool {
+	if !t.allowedChat(message.Chat) {
+		localLogger.WithField("from", message.Sender.Username).Debug("User message received in a disallowed chat")
+		return false
+	}
+
+	// Verifies if the user is an authorized user.
+	if !t.AllowAllUsers && t.authorizedUser(message.Sender) == nil {
+		localLogger.WithFields(log.Fields{
+			"from":      message.Sender.Username,
+			"sender_id": message.Sender.ID,
+			"message":   message.Text,
+		}).Debug("User message received from unauthorized user")
+		t.greetUnauthorized(message)
+		return false
+	}
+
+	if t.LogSampler.Sample() {
 		localLogger.WithFields(log.Fields{
 			"from":      message.Sender.Username,
 			"sender_id": message.Sender.ID,
 			"message":   message.Text,
 		}).Debug("User message received")
+	}
 
-		// Sends the user input to the frontend manager.
-		if err := t.processUserMessage(message, provider.Text); err != nil {
-			// If an error occurred, it generates a system log message and sends it to
-			// the user.
-			systemlog := provider.SystemLog(err.Error(), provider.ErrorStatus)
-			t.Bot.Send(message.Sender, systemlog)
+	if !t.RateLimiter.Allow(strconv.Itoa(message.Sender.ID)) {
+		localLogger.WithField("from", message.Sender.Username).Debug("User rate limit exceeded")
+		t.api.Send(t.recipientOf(message), provider.SystemLog(provider.RateLimitMessage, provider.Info))
+		return false
+	}
+
+	return true
+}
+
+// documentMessageHandler handles the documents sent by users. The document is
+// downloaded and forwarded as an attachment, with its caption as content.
+func (t *Telegram) documentMessageHandler() func(*tb.Message) {
+	return func(message *tb.Message) {
+		localLogger := logger.WithField("action", "receiving user document")
+
+		if !t.accept(message, localLogger) {
+			return
+		}
+
+		if err := t.processUserMessage(message, provider.File); err != nil {
+			t.api.Send(t.recipientOf(message), provider.SystemLog(err.Error(), provider.ErrorStatus))
+		}
+	}
+}
+
+// locationMessageHandler handles the locations shared by users. The
+// coordinates are forwarded as the location of the capsule.
+func (t *Telegram) locationMessageHandler() func(*tb.Message) {
+	return func(message *tb.Message) {
+		localLogger := logger.WithField("action", "receiving user location")
+
+		if !t.accept(message, localLogger) {
+			return
+		}
+
+		if err := t.processUserMessage(message, provider.Location); err != nil {
+			t.api.Send(t.recipientOf(message), provider.SystemLog(err.Error(), provider.ErrorStatus))
 		}
 	}
 }
@@ -159,37 +604,126 @@ func (t *Telegram) textMessageHandler() func(*tb.Message) {
 // photoMessageHandler handles photo message sent by user.
 func (t *Telegram) photoMessageHandler() func(*tb.Message) {
 	return func(message *tb.Message) {
-		t.Bot.Send(message.Sender, provider.SystemLog("Photo message handling is not implemented", provider.ErrorStatus))
+		t.api.Send(t.recipientOf(message), provider.SystemLog("Photo message handling is not implemented", provider.ErrorStatus))
 	}
 }
 
 // audioMessageHandler handles audio message sent by user.
 func (t *Telegram) audioMessageHandler() func(*tb.Message) {
 	return func(message *tb.Message) {
-		t.Bot.Send(message.Sender, provider.SystemLog("Audio message handling is not implemented", provider.ErrorStatus))
+		t.api.Send(t.recipientOf(message), provider.SystemLog("Audio message handling is not implemented", provider.ErrorStatus))
 	}
 }
 
+// acknowledge sets the acknowledgement reaction on the given message.
+func (t *Telegram) acknowledge(message *tb.Message) error {
+	payload := map[string]interface{}{
+		"chat_id":    message.Chat.ID,
+		"message_id": message.ID,
+		"reaction": []map[string]string{
+			{"type": "emoji", "emoji": t.AckReaction},
+		},
+	}
+
+	data, err := t.api.Raw("setMessageReaction", payload)
+	if err != nil {
+		return errors.Annotate(err, "setting message reaction")
+	}
+
+	response := apiResponse{}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return errors.Annotate(err, "setting message reaction")
+	}
+
+	if !response.Ok {
+		return errors.Errorf("setting message reaction: %s", response.Description)
+	}
+
+	return nil
+}
+
 // processUserMessage processes a user message by adding it to the pending messages
 // slice, converting it to a provider capsule and sending it to the frontend manager.
 func (t *Telegram) processUserMessage(userMessage *tb.Message, contentType provider.ContentType) error {
-	// Generates a new version 4 UUID.
-	uuid, err := uuid.NewRandom()
+	// Generates a new UUID.
+	uuid, err := t.IDGenerator.New()
 	if err != nil {
 		return errors.Annotate(err, "processing user message")
 	}
 
-	// Initializes a message.
+	// Initializes a message. The locale configured for the user takes
+	// precedence over the language of its Telegram client.
 	message := &message{
-		uuid: uuid,
-		user: userMessage.Sender,
+		uuid:     uuid,
+		user:     userMessage.Sender,
+		chat:     userMessage.Chat,
+		locale:   userMessage.Sender.LanguageCode,
+		metadata: metadataOf(userMessage),
+	}
+
+	// In group chats, the answer replies to the message so the conversations
+	// of the members are not mixed up. The answers sent privately cannot
+	// reply to it.
+	if t.GroupMode && isGroup(userMessage.Chat) {
+		message.threadID = strconv.Itoa(userMessage.ID)
+	}
+
+	if user := t.authorizedUser(userMessage.Sender); user != nil {
+		if len(user.Locale) > 0 {
+			message.locale = user.Locale
+		}
+
+		message.timezone = user.Timezone
 	}
 
 	// Defines the input type and converts the input content to an array of byte
 	switch contentType {
 	case provider.Text:
+		// Empty messages are not forwarded since they would be answered with a
+		// useless response.
+		if len([]rune(strings.TrimSpace(userMessage.Text))) < t.MinMessageLength {
+			t.api.Send(t.recipientOf(userMessage), provider.SystemLog("Please send a message", provider.Info))
+			return nil
+		}
+
 		message.contentType = provider.Text
 		message.content = []byte(userMessage.Text)
+
+		// Oversized messages are truncated or rejected, so they do not waste
+		// the quota of the backend provider.
+		if text := []rune(string(message.content)); t.MaxInputLength > 0 && len(text) > t.MaxInputLength {
+			if t.RejectLongInput {
+				notice := fmt.Sprintf("Your message is too long, please send at most %d characters", t.MaxInputLength)
+				t.api.Send(t.recipientOf(userMessage), provider.SystemLog(notice, provider.Info))
+				return nil
+			}
+
+			logger.WithFields(log.Fields{
+				"user":   userMessage.Sender.Username,
+				"length": len(text),
+			}).Info("Truncating oversized user message")
+			message.content = []byte(string(text[:t.MaxInputLength]))
+		}
+	case provider.File:
+		attachment, err := t.download(userMessage.Document)
+		if err != nil {
+			return err
+		}
+
+		message.contentType = provider.File
+		message.content = []byte(userMessage.Document.Caption)
+		message.attachments = []*capsule.Attachment{attachment}
+	case provider.Location:
+		if userMessage.Location == nil {
+			return errors.NotFoundf("location of message")
+		}
+
+		message.contentType = provider.Location
+		message.location = &capsule.Location{
+			Latitude:  float64(userMessage.Location.Lat),
+			Longitude: float64(userMessage.Location.Lng),
+		}
+		message.content = []byte(fmt.Sprintf("%.6f,%.6f", message.location.Latitude, message.location.Longitude))
 	case provider.Audio:
 		return errors.NotImplementedf("%s message handling", contentType)
 	case provider.Image:
@@ -199,9 +733,16 @@ func (t *Telegram) processUserMessage(userMessage *tb.Message, contentType provi
 	}
 
 	// Adds the current message to the slice containing pending messages.
-	t.pendingMessages = append(t.pendingMessages, message)
+	t.addPendingMessage(message)
 	// Sends the provider capsule-formatted message to the frontend manager.
-	t.userInput <- messageToCapsuleProvider(message)
+	// The user is asked to retry when the frontend manager is overloaded.
+	if !provider.Forward(t.userInput, messageToCapsuleProvider(message)) {
+		t.findPendingMessage(message.uuid)
+		if _, err := t.api.Send(t.recipient(message), provider.SystemLog(provider.BusyMessage, provider.Info)); err != nil {
+			return errors.Annotate(err, "sending busy message")
+		}
+	}
+
 	return nil
 }
 
@@ -212,12 +753,197 @@ func messageToCapsuleProvider(msg *message) *provider.CapsuleProvider {
 		ProviderLabel:   label,
 		Content:         string(msg.content),
 		User:            msg.user.Username,
+		Chat:            strconv.FormatInt(msg.chat.ID, 10),
+		ThreadID:        msg.threadID,
+		Locale:          msg.locale,
+		Timezone:        msg.timezone,
+		Attachments:     msg.attachments,
+		Location:        msg.location,
+		Metadata:        msg.metadata,
 	}
 }
 
-// findPendingMessage returns the pending message corresponding to the given
-// uuid.
+// metadataOf returns the metadata of the given message: its ID, the ID and
+// the type of its chat and the language of its sender.
+func metadataOf(m *tb.Message) map[string]string {
+	metadata := map[string]string{
+		messageIDMetadata: strconv.Itoa(m.ID),
+	}
+
+	if m.Chat != nil {
+		metadata[chatIDMetadata] = strconv.FormatInt(m.Chat.ID, 10)
+		metadata[chatTypeMetadata] = string(m.Chat.Type)
+	}
+
+	if m.Sender != nil && len(m.Sender.LanguageCode) > 0 {
+		metadata[languageMetadata] = m.Sender.LanguageCode
+	}
+
+	return metadata
+}
+
+// recipient returns the recipient of the answers to the pending message.
+func (t *Telegram) recipient(m *message) tb.Recipient {
+	return t.answerRecipient(m.user, m.chat)
+}
+
+// recipientOf returns the recipient of the answers to the given message.
+func (t *Telegram) recipientOf(m *tb.Message) tb.Recipient {
+	return t.answerRecipient(m.Sender, m.Chat)
+}
+
+// answerRecipient returns the recipient of the answers to a message sent by
+// the user in the chat: the chat in group mode, otherwise the user, so the
+// bot answers privately. The chat is used when the user is unknown.
+func (t *Telegram) answerRecipient(user *tb.User, chat *tb.Chat) tb.Recipient {
+	if chat != nil && (t.GroupMode || user == nil) {
+		return chat
+	}
+
+	return user
+}
+
+// allowedChat verifies if the bot answers in the given chat: either its type
+// or its ID is allowed, or no chat is restricted.
+func (t *Telegram) allowedChat(chat *tb.Chat) bool {
+	if len(t.AllowedChatTypes) == 0 && len(t.AllowedChatIDs) == 0 {
+		return true
+	}
+
+	if chat == nil {
+		return false
+	}
+
+	chatType := chat.Type
+	if chatType == tb.ChatChannelPrivate {
+		chatType = tb.ChatChannel
+	}
+
+	for _, allowed := range t.AllowedChatTypes {
+		if tb.ChatType(allowed) == chatType {
+			return true
+		}
+	}
+
+	for _, id := range t.AllowedChatIDs {
+		if id == chat.ID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isGroup verifies if the given chat is a group chat.
+func isGroup(chat *tb.Chat) bool {
+	return chat != nil && (chat.Type == tb.ChatGroup || chat.Type == tb.ChatSuperGroup)
+}
+
+// isAddressed verifies if the given message mentions the bot or replies to one
+// of its messages.
+func (t *Telegram) isAddressed(m *tb.Message) bool {
+	if t.Bot.Me == nil || t.mention == nil {
+		return false
+	}
+
+	if m.ReplyTo != nil && m.ReplyTo.Sender != nil && m.ReplyTo.Sender.ID == t.Bot.Me.ID {
+		return true
+	}
+
+	return t.mention.MatchString(m.Text)
+}
+
+// stripMention removes the mentions of the bot from the given text.
+func (t *Telegram) stripMention(text string) string {
+	if t.mention == nil {
+		return text
+	}
+
+	return strings.TrimSpace(t.mention.ReplaceAllString(text, ""))
+}
+
+// mentionPattern returns the pattern matching the mentions of the given bot,
+// or nil if the bot is unknown.
+func mentionPattern(me *tb.User) *regexp.Regexp {
+	if me == nil || len(me.Username) == 0 {
+		return nil
+	}
+
+	return regexp.MustCompile(`(?i)@` + regexp.QuoteMeta(me.Username) + `\b`)
+}
+
+// SetAuthorizedUsers replaces the authorized users, once they changed in the
+// user store.
+func (t *Telegram) SetAuthorizedUsers(users []*provider.User) {
+	t.usersMutex.Lock()
+	t.AuthorizedUsers = users
+	t.usersMutex.Unlock()
+}
+
+// authorizedUser returns the authorized user corresponding to the given
+// Telegram user, or nil if the user is not authorized.
+func (t *Telegram) authorizedUser(sender *tb.User) *provider.User {
+	t.usersMutex.RLock()
+	defer t.usersMutex.RUnlock()
+
+	for _, user := range t.AuthorizedUsers {
+		if user.Name == sender.Username && user.ID == sender.ID {
+			return user
+		}
+	}
+
+	return nil
+}
+
+// greetUnauthorized sends the unauthorized message to the sender of the given
+// message, unless it has already received it.
+func (t *Telegram) greetUnauthorized(message *tb.Message) {
+	if len(t.UnauthorizedMessage) == 0 {
+		return
+	}
+
+	t.usersMutex.Lock()
+	greeted := t.greeted[message.Sender.ID]
+	t.greeted[message.Sender.ID] = true
+	t.usersMutex.Unlock()
+
+	if greeted {
+		return
+	}
+
+	if _, err := t.api.Send(t.recipientOf(message), t.UnauthorizedMessage); err != nil {
+		logger.WithField("sender_id", message.Sender.ID).WithError(err).Warn("Cannot send unauthorized message")
+	}
+}
+
+// addPendingMessage adds the message to the pending messages.
+func (t *Telegram) addPendingMessage(m *message) {
+	t.pendingMutex.Lock()
+	t.pendingMessages = append(t.pendingMessages, m)
+	t.pendingMutex.Unlock()
+}
+
+// pendingMessage returns the pending message corresponding to the given uuid,
+// without removing it from the pending messages.
+func (t *Telegram) pendingMessage(uuid uuid.UUID) (*message, bool) {
+	t.pendingMutex.Lock()
+	defer t.pendingMutex.Unlock()
+
+	for _, m := range t.pendingMessages {
+		if m.uuid == uuid {
+			return m, true
+		}
+	}
+
+	return nil, false
+}
+
+// findPendingMessage removes and returns the pending message corresponding to
+// the given uuid.
 func (t *Telegram) findPendingMessage(uuid uuid.UUID) (*message, error) {
+	t.pendingMutex.Lock()
+	defer t.pendingMutex.Unlock()
+
 	if len(t.pendingMessages) == 0 {
 		return nil, errors.NotProvisionedf("pending messages")
 	}
@@ -233,20 +959,156 @@ func (t *Telegram) findPendingMessage(uuid uuid.UUID) (*message, error) {
 	return nil, errors.NotFoundf("message (uuid: %s)", uuid)
 }
 
-// sendTextMessage responds to a user with a text message.
-func (t *Telegram) sendTextMessage(respondTo uuid.UUID, responses []string) error {
-	pendingMessage, err := t.findPendingMessage(respondTo)
+// sendTextMessage responds to a user with the capsule responses. The pauses
+// are made before their responses and the suggestions are displayed as buttons
+// under the last response.
+func (t *Telegram) sendTextMessage(capsule *capsule.Capsule) error {
+	pendingMessage, err := t.findPendingMessage(capsule.OriginalMessage)
 	if err != nil {
 		return err
 	}
 
-	for _, response := range responses {
-		t.Bot.Send(pendingMessage.user, response)
+	// Every response is sent even if a previous one failed. The failures are
+	// aggregated in the returned error.
+	failures := []string{}
+	total := 0
+	// The response prefix is counted in the length of the bubbles.
+	limit := maxMessageLength - len([]rune(t.ResponsePrefix))
+	responses := capBubbles(capsule.Responses, t.MaxResponseBubbles, limit)
+	for i, response := range responses {
+		t.pause(t.recipient(pendingMessage), capsule.Pauses, i)
+
+		// Code is sent in code blocks, split in several bubbles if needed.
+		outputs, options := []*provider.Output{{Text: response}}, []interface{}{}
+		if t.FormatCode && looksLikeCode(response) {
+			outputs = []*provider.Output{}
+			for _, code := range splitCode(response, limit) {
+				outputs = append(outputs, &provider.Output{Text: code, Code: true})
+			}
+			options = append(options, tb.ModeMarkdown)
+		}
+
+		bubbles := make([]string, 0, len(outputs))
+		for _, output := range outputs {
+			bubbles = append(bubbles, t.ResponsePrefix+truncate(t.Format(output), limit))
+		}
+
+		for j, bubble := range bubbles {
+			// The suggestions or the feedback buttons are displayed under the
+			// last bubble. A message cannot have both keyboards: the answers
+			// with suggestions cannot be rated. The first bubble replies to the
+			// thread of the message.
+			bubbleOptions := options
+			if i == 0 && j == 0 {
+				bubbleOptions = append(threadOptions(capsule.ThreadID), options...)
+			}
+
+			if i == len(responses)-1 && j == len(bubbles)-1 {
+				if len(capsule.Suggestions) > 0 {
+					bubbleOptions = append(append([]interface{}{}, bubbleOptions...), suggestionsKeyboard(capsule.Suggestions))
+				} else if t.CollectFeedback {
+					bubbleOptions = append(append([]interface{}{}, bubbleOptions...), feedbackKeyboard(capsule.OriginalMessage))
+					t.feedbacks.add(capsule)
+				}
+			}
+
+			total++
+			if _, err := t.api.Send(t.recipient(pendingMessage), bubble, bubbleOptions...); err != nil {
+				// A user who blocked the bot cannot receive the next responses.
+				if isUnreachable(err) {
+					t.markUnreachable(pendingMessage.user)
+					return errors.Annotatef(err, "user %s unreachable", pendingMessage.user.Username)
+				}
+
+				logger.WithFields(log.Fields{
+					"user": pendingMessage.user.Username,
+					"uuid": capsule.OriginalMessage,
+				}).WithError(err).Error("Cannot send response to user")
+				failures = append(failures, err.Error())
+			}
+		}
+	}
+
+	// The cards are sent after the responses.
+	for _, card := range capsule.Cards {
+		total++
+		if err := t.sendCard(t.recipient(pendingMessage), card); err != nil {
+			logger.WithFields(log.Fields{
+				"user": pendingMessage.user.Username,
+				"uuid": capsule.OriginalMessage,
+			}).WithError(err).Error("Cannot send card to user")
+			failures = append(failures, err.Error())
+		}
+	}
+
+	// When nothing was delivered, the message stays pending so the delivery
+	// can be retried without duplicating the responses.
+	if total > 0 && len(failures) == total {
+		t.addPendingMessage(pendingMessage)
+		return errors.Errorf("sending responses: %s", strings.Join(failures, "; "))
+	}
+
+	t.markReachable(pendingMessage.user)
+	t.history.record(pendingMessage.user.ID, responses)
+	t.sendVoice(pendingMessage, responses)
+	if len(failures) > 0 {
+		return errors.Errorf("sending %d of %d responses: %s", len(failures), total, strings.Join(failures, "; "))
 	}
 
 	return nil
 }
 
+// threadOptions returns the options replying to the message of the given
+// thread. The reply options come first since they replace the previous
+// options. There is no option when the thread is unknown.
+func threadOptions(threadID string) []interface{} {
+	id, err := strconv.Atoi(threadID)
+	if err != nil {
+		return []interface{}{}
+	}
+
+	return []interface{}{&tb.SendOptions{ReplyTo: &tb.Message{ID: id}}}
+}
+
+// pause makes the pauses preceding the response at the given index. The
+// typing indicator is displayed during the pause when requested. Pauses are
+// capped to maxPause since they hold the next responses of the chat.
+func (t *Telegram) pause(recipient tb.Recipient, pauses []*capsule.Pause, index int) {
+	for _, pause := range pauses {
+		if pause.Index != index {
+			continue
+		}
+
+		if pause.Typing {
+			if err := t.api.Notify(recipient, tb.Typing); err != nil {
+				logger.WithError(err).Debug("Cannot display typing indicator")
+			}
+		}
+
+		duration := pause.Duration
+		if duration > maxPause {
+			duration = maxPause
+		}
+
+		time.Sleep(duration)
+	}
+}
+
+// suggestionsKeyboard returns a one-time keyboard containing a button per
+// suggestion. Pressing a button sends its suggestion as a user message.
+func suggestionsKeyboard(suggestions []string) *tb.ReplyMarkup {
+	keyboard := [][]tb.ReplyButton{}
+	for _, suggestion := range suggestions {
+		keyboard = append(keyboard, []tb.ReplyButton{{Text: suggestion}})
+	}
+
+	return &tb.ReplyMarkup{
+		ReplyKeyboard:       keyboard,
+		OneTimeKeyboard:     true,
+		ResizeReplyKeyboard: true,
+	}
+}
+
 // sendErrorMessage responds to a user with a system log message containing the
 // error message.
 func (t *Telegram) sendErrorMessage(respondTo uuid.UUID, error error) error {
@@ -256,6 +1118,16 @@ func (t *Telegram) sendErrorMessage(respondTo uuid.UUID, error error) error {
 	}
 
 	systemLogMessage := provider.SystemLog(error.Error(), provider.ErrorStatus)
-	t.Bot.Send(pendingMessage.user, systemLogMessage)
+	if _, err := t.api.Send(t.recipient(pendingMessage), systemLogMessage); err != nil {
+		logger.WithFields(log.Fields{
+			"user": pendingMessage.user.Username,
+			"uuid": respondTo,
+		}).WithError(err).Error("Cannot send error message to user")
+
+		// The message stays pending so the delivery can be retried.
+		t.addPendingMessage(pendingMessage)
+		return errors.Annotate(err, "sending error message")
+	}
+
 	return nil
 }
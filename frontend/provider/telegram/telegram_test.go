@@ -0,0 +1,732 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/google/uuid"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+type (
+	// fakeBot is a bot API recording the messages instead of sending them.
+	fakeBot struct {
+		// mutex protects the recorded calls.
+		mutex sync.Mutex
+
+		// sent is a slice containing the messages sent.
+		sent []*sentMessage
+
+		// edited is a slice containing the edits of the messages.
+		edited []*sentMessage
+
+		// deleted is the number of deleted messages.
+		deleted int
+
+		// notified is a slice containing the chat actions sent.
+		notified []tb.ChatAction
+
+		// raw is a slice containing the methods called with Raw.
+		raw []string
+
+		// payloads is a slice containing the payloads given to Raw.
+		payloads []interface{}
+
+		// rawResponse is the response of Raw.
+		rawResponse string
+
+		// fail returns the error of the given call to Send, counted from zero.
+		// The messages are sent when it is nil or returns nil.
+		fail func(call int) error
+
+		// calls is the number of calls to Send.
+		calls int
+
+		// editErr is the error returned by Edit. The messages are edited when
+		// it is nil.
+		editErr error
+	}
+
+	// sequenceGenerator is an ID generator returning the given UUIDs in order.
+	sequenceGenerator struct {
+		// ids is a slice containing the next UUIDs.
+		ids []uuid.UUID
+	}
+
+	// sentMessage is a message sent or edited through the fake bot.
+	sentMessage struct {
+		// to is the recipient of the message.
+		to tb.Recipient
+
+		// what is the content of the message.
+		what interface{}
+
+		// options is a slice containing the send options.
+		options []interface{}
+	}
+)
+
+func (b *fakeBot) Send(to tb.Recipient, what interface{}, options ...interface{}) (*tb.Message, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	call := b.calls
+	b.calls++
+	if b.fail != nil {
+		if err := b.fail(call); err != nil {
+			return nil, err
+		}
+	}
+
+	b.sent = append(b.sent, &sentMessage{to: to, what: what, options: options})
+	message := &tb.Message{ID: 1000 + call}
+	if chat, ok := to.(*tb.Chat); ok {
+		message.Chat = chat
+	}
+
+	return message, nil
+}
+
+func (b *fakeBot) Edit(message tb.Editable, what interface{}, options ...interface{}) (*tb.Message, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.editErr != nil {
+		return nil, b.editErr
+	}
+
+	b.edited = append(b.edited, &sentMessage{what: what, options: options})
+	if m, ok := message.(*tb.Message); ok {
+		return m, nil
+	}
+
+	return &tb.Message{}, nil
+}
+
+func (b *fakeBot) Delete(message tb.Editable) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.deleted++
+	return nil
+}
+
+func (b *fakeBot) Notify(recipient tb.Recipient, action tb.ChatAction) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.notified = append(b.notified, action)
+	return nil
+}
+
+func (b *fakeBot) Respond(callback *tb.Callback, responseOptional ...*tb.CallbackResponse) error {
+	return nil
+}
+
+func (b *fakeBot) GetFile(file *tb.File) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader("file content")), nil
+}
+
+func (b *fakeBot) Raw(method string, payload interface{}) ([]byte, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.raw = append(b.raw, method)
+	b.payloads = append(b.payloads, payload)
+	return []byte(b.rawResponse), nil
+}
+
+func (g *sequenceGenerator) New() (uuid.UUID, error) {
+	if len(g.ids) == 0 {
+		return uuid.Nil, errors.New("no more UUIDs")
+	}
+
+	id := g.ids[0]
+	g.ids = g.ids[1:]
+	return id, nil
+}
+
+// texts returns the texts of the messages sent.
+func (b *fakeBot) texts() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	texts := []string{}
+	for _, m := range b.sent {
+		if text, ok := m.what.(string); ok {
+			texts = append(texts, text)
+		}
+	}
+
+	return texts
+}
+
+// newTestTelegram returns a Telegram provider sending its messages through a
+// fake bot, and the channel receiving its user inputs.
+func newTestTelegram() (*Telegram, *fakeBot, chan *provider.CapsuleProvider) {
+	bot := &fakeBot{rawResponse: `{"ok":true}`}
+	me := &tb.User{ID: 1, Username: "samantha", IsBot: true}
+	userInput := make(chan *provider.CapsuleProvider, 10)
+
+	return &Telegram{
+		Bot:              &tb.Bot{Me: me},
+		mention:          mentionPattern(me),
+		api:              bot,
+		Mode:             longPollMode,
+		AllowAllUsers:    true,
+		greeted:          map[int]bool{},
+		unreachable:      map[int]int{},
+		MinMessageLength: defaultMinMessageLength,
+		MaxFileSize:      defaultMaxFileSize,
+		feedbacks:        newFeedbacks(),
+		IDGenerator:      capsule.RandomGenerator{},
+		pendingMessages:  []*message{},
+		superseded:       newSupersededMessages(),
+		statuses:         newStatusMessages(),
+		history:          newHistory(),
+		paced:            newPacedDeliveries(),
+		userInput:        userInput,
+	}, bot, userInput
+}
+
+// textMessage returns a text message sent by alice in a private chat.
+func textMessage(text string) *tb.Message {
+	return &tb.Message{
+		ID:     1,
+		Sender: &tb.User{ID: 42, Username: "alice", LanguageCode: "en"},
+		Chat:   &tb.Chat{ID: 42, Type: tb.ChatPrivate},
+		Text:   text,
+	}
+}
+
+// forwarded returns the user inputs forwarded to the frontend manager.
+func forwarded(userInput chan *provider.CapsuleProvider) []*provider.CapsuleProvider {
+	inputs := []*provider.CapsuleProvider{}
+	for {
+		select {
+		case input := <-userInput:
+			inputs = append(inputs, input)
+		default:
+			return inputs
+		}
+	}
+}
+
+// receive handles the given text message and returns the UUID of the pending
+// message forwarded to the frontend manager.
+func receive(t *testing.T, telegram *Telegram, userInput chan *provider.CapsuleProvider, text string) uuid.UUID {
+	t.Helper()
+
+	telegram.textMessageHandler()(textMessage(text))
+	inputs := forwarded(userInput)
+	if len(inputs) != 1 {
+		t.Fatalf("forwarded inputs = %v, want one input", inputs)
+	}
+
+	return inputs[0].OriginalMessage
+}
+
+func TestMetadata(t *testing.T) {
+	telegram, _, userInput := newTestTelegram()
+
+	telegram.textMessageHandler()(textMessage("hello"))
+	inputs := forwarded(userInput)
+	if len(inputs) != 1 {
+		t.Fatalf("forwarded inputs = %v, want one input", inputs)
+	}
+
+	want := map[string]string{
+		chatIDMetadata:    "42",
+		chatTypeMetadata:  "private",
+		messageIDMetadata: "1",
+		languageMetadata:  "en",
+	}
+
+	if !reflect.DeepEqual(inputs[0].Metadata, want) {
+		t.Errorf("metadata = %v, want %v", inputs[0].Metadata, want)
+	}
+}
+
+func TestMaxInputLength(t *testing.T) {
+	long := strings.Repeat("é", 30)
+
+	t.Run("truncated", func(t *testing.T) {
+		telegram, _, userInput := newTestTelegram()
+		telegram.MaxInputLength = 10
+
+		telegram.textMessageHandler()(textMessage(long))
+		inputs := forwarded(userInput)
+		if len(inputs) != 1 || inputs[0].Content != strings.Repeat("é", 10) {
+			t.Errorf("forwarded inputs = %v, want the first 10 characters", inputs)
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		telegram, bot, userInput := newTestTelegram()
+		telegram.MaxInputLength = 10
+		telegram.RejectLongInput = true
+
+		telegram.textMessageHandler()(textMessage(long))
+		if inputs := forwarded(userInput); len(inputs) != 0 {
+			t.Errorf("forwarded inputs = %v, want none", inputs)
+		}
+
+		if texts := bot.texts(); len(texts) != 1 || !strings.Contains(texts[0], "at most 10 characters") {
+			t.Errorf("texts = %q, want the rejection notice", texts)
+		}
+	})
+
+	t.Run("under the limit", func(t *testing.T) {
+		telegram, _, userInput := newTestTelegram()
+		telegram.MaxInputLength = 30
+		telegram.RejectLongInput = true
+
+		telegram.textMessageHandler()(textMessage(long))
+		if inputs := forwarded(userInput); len(inputs) != 1 || inputs[0].Content != long {
+			t.Errorf("forwarded inputs = %v, want the whole message", inputs)
+		}
+	})
+}
+
+func TestEmptyMessage(t *testing.T) {
+	tests := []struct {
+		name             string
+		text             string
+		minMessageLength int
+		forwarded        bool
+	}{
+		{"empty", "", defaultMinMessageLength, false},
+		{"whitespace only", " \t\n  ", defaultMinMessageLength, false},
+		{"text", "hello", defaultMinMessageLength, true},
+		{"shorter than the minimum", " hi ", 3, false},
+		{"minimum length", "hey", 3, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telegram, bot, userInput := newTestTelegram()
+			telegram.MinMessageLength = tt.minMessageLength
+
+			telegram.textMessageHandler()(textMessage(tt.text))
+
+			inputs := forwarded(userInput)
+			if tt.forwarded {
+				if len(inputs) != 1 || inputs[0].Content != tt.text {
+					t.Errorf("forwarded inputs = %v, want the message", inputs)
+				}
+				return
+			}
+
+			if len(inputs) != 0 {
+				t.Errorf("forwarded inputs = %v, want none", inputs)
+			}
+
+			want := provider.SystemLog("Please send a message", provider.Info)
+			if texts := bot.texts(); len(texts) != 1 || texts[0] != want {
+				t.Errorf("sent messages = %v, want %q", texts, want)
+			}
+		})
+	}
+}
+
+func TestSendFailure(t *testing.T) {
+	telegram, bot, userInput := newTestTelegram()
+	bot.fail = func(call int) error {
+		if call == 1 {
+			return errors.New("network failure")
+		}
+		return nil
+	}
+
+	uuid := receive(t, telegram, userInput, "hello")
+	err := telegram.sendTextMessage(&capsule.Capsule{
+		OriginalMessage: uuid,
+		Responses:       []string{"first", "second", "third"},
+	})
+	if err == nil {
+		t.Fatal("expected an error when a bubble cannot be sent")
+	}
+
+	if !strings.Contains(err.Error(), "network failure") {
+		t.Errorf("error %q does not contain the send failure", err)
+	}
+
+	texts := bot.texts()
+	if len(texts) != 2 || texts[0] != "first" || texts[1] != "third" {
+		t.Errorf("sent messages = %v, want the first and third bubbles", texts)
+	}
+}
+
+func TestSendFailureEveryBubble(t *testing.T) {
+	telegram, bot, userInput := newTestTelegram()
+	bot.fail = func(call int) error {
+		return errors.New("network failure")
+	}
+
+	uuid := receive(t, telegram, userInput, "hello")
+	if err := telegram.sendTextMessage(&capsule.Capsule{
+		OriginalMessage: uuid,
+		Responses:       []string{"first", "second"},
+	}); err == nil {
+		t.Fatal("expected an error when no bubble can be sent")
+	}
+
+	// The message stays pending so the delivery can be retried.
+	if _, err := telegram.findPendingMessage(uuid); err != nil {
+		t.Errorf("message is not pending anymore: %v", err)
+	}
+}
+
+func TestBlockedUser(t *testing.T) {
+	telegram, bot, userInput := newTestTelegram()
+	telegram.AllowAllUsers = false
+	telegram.AuthorizedUsers = []*provider.User{{Name: "alice", ID: 42}}
+	telegram.RemoveUnreachableUsers = 2
+	bot.fail = func(call int) error {
+		return errors.New("telegram: Forbidden: bot was blocked by the user (403)")
+	}
+
+	for i := 1; i <= telegram.RemoveUnreachableUsers; i++ {
+		uuid := receive(t, telegram, userInput, "hello")
+		if err := telegram.sendTextMessage(&capsule.Capsule{
+			OriginalMessage: uuid,
+			Responses:       []string{"first", "second"},
+		}); err == nil {
+			t.Fatal("expected an error when the user blocked the bot")
+		}
+
+		// The delivery stops at the first bubble and is not retried.
+		if bot.calls != i {
+			t.Errorf("send calls = %d, want %d", bot.calls, i)
+		}
+
+		if _, err := telegram.findPendingMessage(uuid); err == nil {
+			t.Error("the message of the unreachable user is still pending")
+		}
+	}
+
+	if len(telegram.AuthorizedUsers) != 0 {
+		t.Errorf("authorized users = %v, want the unreachable user removed", telegram.AuthorizedUsers)
+	}
+
+	if len(telegram.unreachable) != 0 {
+		t.Errorf("unreachable = %v, want the failures of the removed user forgotten", telegram.unreachable)
+	}
+}
+
+func TestReachableAgain(t *testing.T) {
+	telegram, bot, userInput := newTestTelegram()
+	blocked := true
+	bot.fail = func(call int) error {
+		if blocked {
+			return errors.New("telegram: Bad Request: chat not found (400)")
+		}
+		return nil
+	}
+
+	uuid := receive(t, telegram, userInput, "hello")
+	telegram.sendTextMessage(&capsule.Capsule{OriginalMessage: uuid, Responses: []string{"hi"}})
+	if telegram.unreachable[42] != 1 {
+		t.Fatalf("failures = %d, want 1", telegram.unreachable[42])
+	}
+
+	blocked = false
+	uuid = receive(t, telegram, userInput, "hello")
+	if err := telegram.sendTextMessage(&capsule.Capsule{OriginalMessage: uuid, Responses: []string{"hi"}}); err != nil {
+		t.Fatalf("sendTextMessage() error = %v", err)
+	}
+
+	if _, ok := telegram.unreachable[42]; ok {
+		t.Error("the failures were not reset by a successful delivery")
+	}
+}
+
+func TestMaxResponseBubbles(t *testing.T) {
+	telegram, bot, userInput := newTestTelegram()
+	telegram.MaxResponseBubbles = 5
+
+	lines := make([]string, 50)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i+1)
+	}
+
+	uuid := receive(t, telegram, userInput, "hello")
+	if err := telegram.sendTextMessage(&capsule.Capsule{
+		OriginalMessage: uuid,
+		Responses:       lines,
+		Suggestions:     []string{"more"},
+	}); err != nil {
+		t.Fatalf("sendTextMessage() error = %v", err)
+	}
+
+	texts := bot.texts()
+	if len(texts) != telegram.MaxResponseBubbles {
+		t.Fatalf("sent %d bubbles, want %d", len(texts), telegram.MaxResponseBubbles)
+	}
+
+	if want := strings.Join(lines[4:], "\n"); texts[4] != want {
+		t.Errorf("last bubble = %q, want the overflowing lines", texts[4])
+	}
+
+	// The suggestions stay under the last bubble.
+	bot.mutex.Lock()
+	options := bot.sent[4].options
+	bot.mutex.Unlock()
+	if len(options) == 0 {
+		t.Error("the suggestions are not displayed under the last bubble")
+	}
+}
+
+func TestIDGenerator(t *testing.T) {
+	telegram, _, userInput := newTestTelegram()
+	ids := []uuid.UUID{uuid.MustParse("00000000-0000-0000-0000-000000000001"), uuid.MustParse("00000000-0000-0000-0000-000000000002")}
+	telegram.IDGenerator = &sequenceGenerator{ids: append([]uuid.UUID{}, ids...)}
+
+	for _, id := range ids {
+		if got := receive(t, telegram, userInput, "hello"); got != id {
+			t.Errorf("message UUID = %s, want %s", got, id)
+		}
+	}
+
+	// A message is not forwarded when its UUID cannot be generated.
+	telegram.textMessageHandler()(textMessage("hello"))
+	if inputs := forwarded(userInput); len(inputs) != 0 {
+		t.Errorf("forwarded inputs = %v, want none", inputs)
+	}
+}
+
+func TestPausedResponses(t *testing.T) {
+	telegram, bot, userInput := newTestTelegram()
+	paused := receive(t, telegram, userInput, "hello")
+	next := receive(t, telegram, userInput, "again")
+
+	const pause = 200 * time.Millisecond
+	begin := time.Now()
+	if err := telegram.Message(&capsule.Capsule{
+		OriginalMessage: paused,
+		Chat:            "42",
+		Responses:       []string{"first", "second"},
+		Pauses:          []*capsule.Pause{{Index: 1, Duration: pause}},
+	}); err != nil {
+		t.Fatalf("Message() error = %v", err)
+	}
+
+	if elapsed := time.Since(begin); elapsed >= pause {
+		t.Errorf("Message() held the frontend for %s", elapsed)
+	}
+
+	// The responses of the chat wait for the paused responses.
+	if err := telegram.Message(&capsule.Capsule{
+		OriginalMessage: next,
+		Chat:            "42",
+		Responses:       []string{"third"},
+	}); err != nil {
+		t.Fatalf("Message() error = %v", err)
+	}
+
+	telegram.paced.wait()
+	want := []string{"first", "second", "third"}
+	if texts := bot.texts(); !reflect.DeepEqual(texts, want) {
+		t.Errorf("sent messages = %v, want %v", texts, want)
+	}
+
+	if elapsed := time.Since(begin); elapsed < pause {
+		t.Errorf("responses delivered in %s, want a pause of %s", elapsed, pause)
+	}
+}
+
+func TestGroupMode(t *testing.T) {
+	tests := []struct {
+		name      string
+		groupMode bool
+		text      string
+		forwarded string
+	}{
+		{"mention", true, "@samantha hello", "hello"},
+		{"mention in another case", true, "hi @SAMANTHA", "hi"},
+		{"no mention", true, "hello everyone", ""},
+		{"other bot", true, "@samanthabot hello", ""},
+		{"without group mode", false, "hello everyone", "hello everyone"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telegram, _, userInput := newTestTelegram()
+			telegram.GroupMode = tt.groupMode
+
+			message := textMessage(tt.text)
+			message.Chat = &tb.Chat{ID: -100, Type: tb.ChatGroup}
+			telegram.textMessageHandler()(message)
+
+			inputs := forwarded(userInput)
+			if len(tt.forwarded) == 0 {
+				if len(inputs) != 0 {
+					t.Errorf("forwarded inputs = %v, want none", inputs)
+				}
+				return
+			}
+
+			if len(inputs) != 1 || inputs[0].Content != tt.forwarded {
+				t.Errorf("forwarded inputs = %v, want %q", inputs, tt.forwarded)
+			}
+		})
+	}
+}
+
+func TestGroupRecipient(t *testing.T) {
+	tests := []struct {
+		name      string
+		groupMode bool
+		recipient string
+	}{
+		{"group mode", true, "-100"},
+		{"private answers", false, "42"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telegram, bot, userInput := newTestTelegram()
+			telegram.GroupMode = tt.groupMode
+
+			message := textMessage("@samantha hello")
+			message.Chat = &tb.Chat{ID: -100, Type: tb.ChatGroup}
+			telegram.textMessageHandler()(message)
+
+			inputs := forwarded(userInput)
+			if len(inputs) != 1 {
+				t.Fatalf("forwarded inputs = %v, want one input", inputs)
+			}
+
+			if err := telegram.sendTextMessage(&capsule.Capsule{
+				OriginalMessage: inputs[0].OriginalMessage,
+				Responses:       []string{"hi"},
+			}); err != nil {
+				t.Fatalf("sendTextMessage() error = %v", err)
+			}
+
+			if len(bot.sent) != 1 || bot.sent[0].to.Recipient() != tt.recipient {
+				t.Errorf("answer sent to %v, want %s", bot.sent, tt.recipient)
+			}
+		})
+	}
+}
+
+func TestBusyReply(t *testing.T) {
+	telegram, bot, _ := newTestTelegram()
+	userInput := make(chan *provider.CapsuleProvider, 1)
+	telegram.userInput = userInput
+
+	telegram.textMessageHandler()(textMessage("first"))
+	telegram.textMessageHandler()(textMessage("second"))
+
+	if inputs := forwarded(userInput); len(inputs) != 1 || inputs[0].Content != "first" {
+		t.Errorf("forwarded inputs = %v, want the first message", inputs)
+	}
+
+	want := provider.SystemLog(provider.BusyMessage, provider.Info)
+	if texts := bot.texts(); len(texts) != 1 || texts[0] != want {
+		t.Errorf("sent messages = %v, want %q", texts, want)
+	}
+
+	// The rejected message is not pending.
+	if pending := len(telegram.pendingMessages); pending != 1 {
+		t.Errorf("%d pending messages, want 1", pending)
+	}
+}
+
+func TestAllowAllUsers(t *testing.T) {
+	tests := []struct {
+		name          string
+		allowAllUsers bool
+		authorized    bool
+		forwarded     bool
+	}{
+		{"locked, unknown user", false, false, false},
+		{"locked, authorized user", false, true, true},
+		{"open, unknown user", true, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telegram, _, userInput := newTestTelegram()
+			telegram.AllowAllUsers = tt.allowAllUsers
+			if tt.authorized {
+				telegram.AuthorizedUsers = []*provider.User{{Name: "alice", ID: 42}}
+			}
+
+			telegram.textMessageHandler()(textMessage("hello"))
+			if inputs := forwarded(userInput); (len(inputs) == 1) != tt.forwarded {
+				t.Errorf("forwarded inputs = %v, want forwarded %t", inputs, tt.forwarded)
+			}
+		})
+	}
+}
+
+func TestUnauthorizedMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    []string
+	}{
+		{"silent", "", []string{}},
+		{"message", "You're not authorized.", []string{"You're not authorized."}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telegram, bot, userInput := newTestTelegram()
+			telegram.AllowAllUsers = false
+			telegram.AuthorizedUsers = []*provider.User{{Name: "bob", ID: 7}}
+			telegram.UnauthorizedMessage = tt.message
+
+			// The message is sent only once to each unauthorized user.
+			for i := 0; i < 3; i++ {
+				telegram.textMessageHandler()(textMessage("hello"))
+			}
+
+			if inputs := forwarded(userInput); len(inputs) != 0 {
+				t.Errorf("forwarded inputs = %v, want none", inputs)
+			}
+
+			if texts := bot.texts(); !reflect.DeepEqual(texts, tt.want) {
+				t.Errorf("sent messages = %v, want %v", texts, tt.want)
+			}
+
+			// Another unauthorized user receives it too.
+			message := textMessage("hello")
+			message.Sender = &tb.User{ID: 43, Username: "carol"}
+			message.Chat = &tb.Chat{ID: 43, Type: tb.ChatPrivate}
+			telegram.textMessageHandler()(message)
+
+			if texts := bot.texts(); len(texts) != 2*len(tt.want) {
+				t.Errorf("sent messages = %v, want the message sent to each user", texts)
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	telegram, bot, userInput := newTestTelegram()
+	telegram.RateLimiter = provider.NewRateLimiter(1, provider.RateLimitWindow)
+
+	telegram.textMessageHandler()(textMessage("first"))
+	telegram.textMessageHandler()(textMessage("second"))
+
+	if inputs := forwarded(userInput); len(inputs) != 1 {
+		t.Errorf("forwarded inputs = %v, want the first message", inputs)
+	}
+
+	want := provider.SystemLog(provider.RateLimitMessage, provider.Info)
+	if texts := bot.texts(); len(texts) != 1 || texts[0] != want {
+		t.Errorf("sent messages = %v, want %q", texts, want)
+	}
+}
@@ -0,0 +1,85 @@
+package telegram
+
+import (
+	"testing"
+
+	"github.com/fberrez/samantha/capsule"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// replyTo returns the ID of the message the sent message replies to, or zero.
+func replyTo(m *sentMessage) int {
+	for _, option := range m.options {
+		if options, ok := option.(*tb.SendOptions); ok && options.ReplyTo != nil {
+			return options.ReplyTo.ID
+		}
+	}
+
+	return 0
+}
+
+func TestThreadID(t *testing.T) {
+	tests := []struct {
+		name      string
+		chat      *tb.Chat
+		groupMode bool
+		threadID  string
+	}{
+		{"group chat", &tb.Chat{ID: -100, Type: tb.ChatGroup}, true, "7"},
+		{"private answers", &tb.Chat{ID: -100, Type: tb.ChatGroup}, false, ""},
+		{"private chat", &tb.Chat{ID: 42, Type: tb.ChatPrivate}, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telegram, bot, userInput := newTestTelegram()
+			telegram.GroupMode = tt.groupMode
+
+			message := textMessage("@samantha hello")
+			message.ID = 7
+			message.Chat = tt.chat
+			telegram.textMessageHandler()(message)
+
+			inputs := forwarded(userInput)
+			if len(inputs) != 1 || inputs[0].ThreadID != tt.threadID {
+				t.Fatalf("forwarded inputs = %+v, want the thread %q", inputs, tt.threadID)
+			}
+
+			// The backend passes the thread unchanged to the answer.
+			if err := telegram.sendTextMessage(&capsule.Capsule{
+				OriginalMessage: inputs[0].OriginalMessage,
+				ThreadID:        inputs[0].ThreadID,
+				Responses:       []string{"Hello", "How are you?"},
+			}); err != nil {
+				t.Fatalf("sendTextMessage() error = %v", err)
+			}
+
+			bot.mutex.Lock()
+			defer bot.mutex.Unlock()
+			if len(bot.sent) != 2 {
+				t.Fatalf("sent messages = %+v, want two bubbles", bot.sent)
+			}
+
+			want := 0
+			if len(tt.threadID) > 0 {
+				want = 7
+			}
+
+			if id := replyTo(bot.sent[0]); id != want {
+				t.Errorf("first bubble replies to %d, want %d", id, want)
+			}
+
+			if id := replyTo(bot.sent[1]); id != 0 {
+				t.Errorf("second bubble replies to %d, want no reply", id)
+			}
+		})
+	}
+}
+
+func TestThreadOptionsInvalid(t *testing.T) {
+	for _, threadID := range []string{"", "not a message"} {
+		if options := threadOptions(threadID); len(options) != 0 {
+			t.Errorf("threadOptions(%q) = %v, want none", threadID, options)
+		}
+	}
+}
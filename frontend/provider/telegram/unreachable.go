@@ -0,0 +1,82 @@
+package telegram
+
+import (
+	"strings"
+
+	"github.com/fberrez/samantha/frontend/provider"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+var (
+	// unreachableErrors are the descriptions of the Telegram errors returned
+	// when a user cannot receive messages anymore.
+	unreachableErrors = []string{
+		"bot was blocked by the user",
+		"chat not found",
+		"user is deactivated",
+		"bot was kicked",
+	}
+)
+
+// isUnreachable verifies if the error means that the user cannot receive
+// messages anymore.
+func isUnreachable(err error) bool {
+	description := strings.ToLower(err.Error())
+	for _, e := range unreachableErrors {
+		if strings.Contains(description, e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// markUnreachable counts a delivery failure of the user. When the removal of
+// unreachable users is enabled, the user is removed from the authorized users
+// once its failures reach the threshold. The removal is persisted in the user
+// store.
+func (t *Telegram) markUnreachable(user *tb.User) {
+	removed := t.removeUnreachable(user)
+	if removed == nil || t.UserStore == nil {
+		return
+	}
+
+	if err := t.UserStore.Remove(removed); err != nil {
+		logger.WithField("user", user.Username).WithError(err).Error("Cannot remove unreachable user from user store")
+	}
+}
+
+// removeUnreachable counts a delivery failure of the user and removes it from
+// the authorized users once its failures reach the threshold. It returns the
+// removed user, or nil if the user has not been removed.
+func (t *Telegram) removeUnreachable(user *tb.User) *provider.User {
+	t.usersMutex.Lock()
+	defer t.usersMutex.Unlock()
+
+	t.unreachable[user.ID]++
+	failures := t.unreachable[user.ID]
+	logger.WithField("user", user.Username).Warnf("User unreachable (%d failures)", failures)
+
+	if t.RemoveUnreachableUsers <= 0 || failures < t.RemoveUnreachableUsers {
+		return nil
+	}
+
+	for i, authorized := range t.AuthorizedUsers {
+		if authorized.Name == user.Username && authorized.ID == user.ID {
+			t.AuthorizedUsers = append(t.AuthorizedUsers[:i], t.AuthorizedUsers[i+1:]...)
+			delete(t.unreachable, user.ID)
+			logger.WithField("user", user.Username).Warn("Unreachable user removed from authorized users")
+			return authorized
+		}
+	}
+
+	return nil
+}
+
+// markReachable resets the delivery failures of the user.
+func (t *Telegram) markReachable(user *tb.User) {
+	t.usersMutex.Lock()
+	defer t.usersMutex.Unlock()
+
+	delete(t.unreachable, user.ID)
+}
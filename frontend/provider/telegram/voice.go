@@ -0,0 +1,34 @@
+package telegram
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/fberrez/samantha/frontend/provider"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// sendVoice sends the responses as a voice message, after their text, when
+// a synthesizer is configured and the user sent an audio message or the voice
+// responses are enabled for every user. The text responses stand alone when
+// the synthesis fails.
+func (t *Telegram) sendVoice(pendingMessage *message, responses []string) {
+	if t.Synthesizer == nil || len(responses) == 0 {
+		return
+	}
+
+	if !t.VoiceResponses && pendingMessage.contentType != provider.Audio {
+		return
+	}
+
+	audio, err := t.Synthesizer.Synthesize(strings.Join(responses, "\n"))
+	if err != nil {
+		logger.WithError(err).Warn("Cannot synthesize voice response, sending text only")
+		return
+	}
+
+	voice := &tb.Voice{File: tb.FromReader(bytes.NewReader(audio))}
+	if _, err := t.api.Send(t.recipient(pendingMessage), voice); err != nil {
+		logger.WithError(err).Warn("Cannot send voice response")
+	}
+}
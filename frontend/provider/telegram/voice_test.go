@@ -0,0 +1,127 @@
+package telegram
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/google/uuid"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+type (
+	// fakeSynthesizer is a synthesizer recording the synthesized texts.
+	fakeSynthesizer struct {
+		// err is the error returned by Synthesize. The texts are synthesized
+		// when it is nil.
+		err error
+
+		// texts is a slice containing the texts to synthesize.
+		texts []string
+	}
+)
+
+func (s *fakeSynthesizer) Synthesize(text string) ([]byte, error) {
+	s.texts = append(s.texts, text)
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	return []byte("OggS"), nil
+}
+
+// voices returns the number of voice messages sent.
+func (b *fakeBot) voices() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	voices := 0
+	for _, m := range b.sent {
+		if _, ok := m.what.(*tb.Voice); ok {
+			voices++
+		}
+	}
+
+	return voices
+}
+
+// answer sends the responses to the message of alice with the given content
+// type.
+func answer(t *testing.T, telegram *Telegram, contentType provider.ContentType, responses ...string) {
+	t.Helper()
+
+	received := textMessage("")
+	id := uuid.New()
+	telegram.addPendingMessage(&message{
+		uuid:        id,
+		user:        received.Sender,
+		chat:        received.Chat,
+		contentType: contentType,
+	})
+
+	if err := telegram.sendTextMessage(&capsule.Capsule{OriginalMessage: id, Responses: responses}); err != nil {
+		t.Fatalf("sendTextMessage() error = %v", err)
+	}
+}
+
+func TestVoiceResponse(t *testing.T) {
+	tests := []struct {
+		name           string
+		contentType    provider.ContentType
+		voiceResponses bool
+		voices         int
+	}{
+		{"audio message", provider.Audio, false, 1},
+		{"text message", provider.Text, false, 0},
+		{"text message with voice responses", provider.Text, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telegram, bot, _ := newTestTelegram()
+			synthesizer := &fakeSynthesizer{}
+			telegram.Synthesizer = synthesizer
+			telegram.VoiceResponses = tt.voiceResponses
+
+			answer(t, telegram, tt.contentType, "Hello", "How are you?")
+
+			if voices := bot.voices(); voices != tt.voices {
+				t.Errorf("voice messages = %d, want %d", voices, tt.voices)
+			}
+
+			if texts := bot.texts(); len(texts) != 2 {
+				t.Errorf("texts = %q, want the text responses too", texts)
+			}
+
+			if tt.voices > 0 && (len(synthesizer.texts) != 1 || synthesizer.texts[0] != "Hello\nHow are you?") {
+				t.Errorf("synthesized texts = %q, want the joined responses", synthesizer.texts)
+			}
+		})
+	}
+}
+
+func TestVoiceResponseFailure(t *testing.T) {
+	telegram, bot, _ := newTestTelegram()
+	telegram.Synthesizer = &fakeSynthesizer{err: errors.New("synthesis unavailable")}
+
+	answer(t, telegram, provider.Audio, "Hello")
+
+	if voices := bot.voices(); voices != 0 {
+		t.Errorf("voice messages = %d, want none", voices)
+	}
+
+	if texts := bot.texts(); len(texts) != 1 || texts[0] != "Hello" {
+		t.Errorf("texts = %q, want the text fallback", texts)
+	}
+}
+
+func TestNoSynthesizer(t *testing.T) {
+	telegram, bot, _ := newTestTelegram()
+
+	answer(t, telegram, provider.Audio, "Hello")
+
+	if voices := bot.voices(); voices != 0 {
+		t.Errorf("voice messages = %d, want none without synthesizer", voices)
+	}
+}
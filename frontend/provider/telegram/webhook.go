@@ -0,0 +1,194 @@
+package telegram
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/fberrez/samantha/frontend/provider/webhook"
+	"github.com/juju/errors"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	// longPollMode is the mode in which the updates are fetched by long
+	// polling.
+	longPollMode = "longpoll"
+
+	// webhookMode is the mode in which the updates are pushed by Telegram to
+	// the webhook server of the provider.
+	webhookMode = "webhook"
+
+	// secretTokenHeader is the header in which Telegram sends the secret
+	// token of the webhook.
+	secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+	// uploadTimeout is the timeout of the upload of the webhook certificate.
+	uploadTimeout = 30 * time.Second
+)
+
+var (
+	// secretTokenPattern matches the secret tokens accepted by Telegram.
+	secretTokenPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+)
+
+// newWebhookServer initializes the server receiving the updates pushed by
+// Telegram to the public webhook URL of the configuration. The webhook secret
+// is set as the secret token of the webhook: the server rejects the requests
+// which do not carry it.
+func (t *Telegram) newWebhookServer(config *provider.Config) error {
+	if len(config.WebhookURL) == 0 {
+		return errors.NotValidf("webhook mode without webhook URL")
+	}
+
+	if !secretTokenPattern.MatchString(config.WebhookSecret) {
+		return errors.NotValidf("webhook secret (1 to 256 letters, digits, _ or -)")
+	}
+
+	publicURL, err := url.Parse(config.WebhookURL)
+	if err != nil {
+		return errors.Annotate(err, "parsing webhook URL")
+	}
+
+	t.webhookPath = publicURL.Path
+	if len(t.webhookPath) == 0 {
+		t.webhookPath = "/"
+	}
+
+	t.server, err = webhook.New(&webhook.Config{
+		Listen:      config.Listen,
+		TLSCertFile: config.TLSCertFile,
+		TLSKeyFile:  config.TLSKeyFile,
+	}, http.HandlerFunc(t.webhookHandler))
+	if err != nil {
+		return errors.Annotate(err, "initializing webhook server")
+	}
+
+	t.webhookURL = config.WebhookURL
+	t.webhookCert = config.TLSCertFile
+	t.webhookSecret = config.WebhookSecret
+	return nil
+}
+
+// startWebhook sets the webhook of the bot and serves it. It blocks until the
+// server is stopped.
+func (t *Telegram) startWebhook() error {
+	if err := t.setWebhook(); err != nil {
+		return errors.Annotate(err, "setting webhook")
+	}
+
+	logger.Debugf("Receiving updates on %s", t.server.Addr())
+	return t.server.Start()
+}
+
+// setWebhook sets the webhook of the bot with its secret token. The telebot
+// webhook cannot carry the secret token, so the method is called directly.
+func (t *Telegram) setWebhook() error {
+	params := map[string]string{
+		"url":          t.webhookURL,
+		"secret_token": t.webhookSecret,
+	}
+
+	var data []byte
+	var err error
+	if len(t.webhookCert) == 0 {
+		data, err = t.api.Raw("setWebhook", params)
+	} else {
+		data, err = t.uploadWebhook(params)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	response := apiResponse{}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return errors.Annotate(err, "unmarshaling response")
+	}
+
+	if !response.Ok {
+		return errors.New(response.Description)
+	}
+
+	return nil
+}
+
+// uploadWebhook calls setWebhook with the certificate of the webhook, which
+// must be uploaded as a file.
+func (t *Telegram) uploadWebhook(params map[string]string) ([]byte, error) {
+	cert, err := os.Open(t.webhookCert)
+	if err != nil {
+		return nil, errors.Annotate(err, "opening certificate")
+	}
+	defer cert.Close()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for name, value := range params {
+		if err := writer.WriteField(name, value); err != nil {
+			return nil, errors.Annotate(err, "writing request")
+		}
+	}
+
+	part, err := writer.CreateFormFile("certificate", filepath.Base(t.webhookCert))
+	if err != nil {
+		return nil, errors.Annotate(err, "writing request")
+	}
+
+	if _, err := io.Copy(part, cert); err != nil {
+		return nil, errors.Annotate(err, "writing request")
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, errors.Annotate(err, "writing request")
+	}
+
+	client := &http.Client{Timeout: uploadTimeout}
+	response, err := client.Post(t.Bot.URL+"/bot"+t.Bot.Token+"/setWebhook", writer.FormDataContentType(), body)
+	if err != nil {
+		return nil, errors.Annotate(err, "uploading certificate")
+	}
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, errors.Annotate(err, "reading response")
+	}
+
+	return data, nil
+}
+
+// webhookHandler handles the updates pushed by Telegram. They are processed
+// by the handlers of the bot, like the updates fetched by long polling. The
+// requests without the secret token of the webhook are rejected.
+func (t *Telegram) webhookHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != t.webhookPath {
+		http.NotFound(w, r)
+		return
+	}
+
+	token := r.Header.Get(secretTokenHeader)
+	if len(t.webhookSecret) == 0 || subtle.ConstantTimeCompare([]byte(token), []byte(t.webhookSecret)) != 1 {
+		logger.WithField("remote", r.RemoteAddr).Warn("Rejecting webhook request without secret token")
+		http.Error(w, "invalid secret token", http.StatusUnauthorized)
+		return
+	}
+
+	update := tb.Update{}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "cannot unmarshal body", http.StatusBadRequest)
+		return
+	}
+
+	t.processUpdate(update)
+}
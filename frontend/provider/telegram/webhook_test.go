@@ -0,0 +1,136 @@
+package telegram
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fberrez/samantha/frontend/provider"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// syntheticUpdate is an update pushed by Telegram with a text message of
+// alice.
+const syntheticUpdate = `{
+	"update_id": 1,
+	"message": {
+		"message_id": 1,
+		"from": {"id": 42, "username": "alice", "language_code": "en"},
+		"chat": {"id": 42, "type": "private"},
+		"text": "hello"
+	}
+}`
+
+// newWebhookTelegram returns a Telegram provider in webhook mode whose updates
+// are handled as text messages.
+func newWebhookTelegram(t *testing.T) (*Telegram, *fakeBot, chan *provider.CapsuleProvider) {
+	t.Helper()
+
+	telegram, bot, userInput := newTestTelegram()
+	err := telegram.newWebhookServer(&provider.Config{
+		WebhookURL:    "https://bot.example.com/telegram",
+		WebhookSecret: "secret-token",
+		Listen:        "127.0.0.1:0",
+	})
+	if err != nil {
+		t.Fatalf("newWebhookServer() error = %v", err)
+	}
+
+	handleText := telegram.textMessageHandler()
+	telegram.processUpdate = func(update tb.Update) {
+		if update.Message != nil {
+			handleText(update.Message)
+		}
+	}
+
+	return telegram, bot, userInput
+}
+
+// push sends the update to the webhook handler with the given secret token
+// and returns the status of the response.
+func push(telegram *Telegram, path string, token string, update string) int {
+	request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(update))
+	if len(token) > 0 {
+		request.Header.Set(secretTokenHeader, token)
+	}
+
+	w := httptest.NewRecorder()
+	telegram.webhookHandler(w, request)
+	return w.Code
+}
+
+func TestWebhookHandler(t *testing.T) {
+	telegram, _, userInput := newWebhookTelegram(t)
+
+	if status := push(telegram, "/telegram", "secret-token", syntheticUpdate); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+
+	inputs := forwarded(userInput)
+	if len(inputs) != 1 || inputs[0].Content != "hello" || inputs[0].User != "alice" {
+		t.Errorf("forwarded inputs = %+v, want the message of the update", inputs)
+	}
+}
+
+func TestWebhookHandlerRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		update string
+		status int
+	}{
+		{"missing secret token", "/telegram", "", syntheticUpdate, http.StatusUnauthorized},
+		{"wrong secret token", "/telegram", "guess", syntheticUpdate, http.StatusUnauthorized},
+		{"other path", "/other", "secret-token", syntheticUpdate, http.StatusNotFound},
+		{"invalid update", "/telegram", "secret-token", "{", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telegram, _, userInput := newWebhookTelegram(t)
+
+			if status := push(telegram, tt.path, tt.token, tt.update); status != tt.status {
+				t.Errorf("status = %d, want %d", status, tt.status)
+			}
+
+			if inputs := forwarded(userInput); len(inputs) != 0 {
+				t.Errorf("forwarded inputs = %+v, want none", inputs)
+			}
+		})
+	}
+}
+
+func TestSetWebhook(t *testing.T) {
+	telegram, bot, _ := newWebhookTelegram(t)
+
+	if err := telegram.setWebhook(); err != nil {
+		t.Fatalf("setWebhook() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(bot.raw, []string{"setWebhook"}) {
+		t.Fatalf("raw calls = %v, want setWebhook", bot.raw)
+	}
+
+	want := map[string]string{"url": "https://bot.example.com/telegram", "secret_token": "secret-token"}
+	if !reflect.DeepEqual(bot.payloads[0], want) {
+		t.Errorf("payload = %v, want %v", bot.payloads[0], want)
+	}
+
+	bot.rawResponse = `{"ok":false,"description":"bad webhook"}`
+	if err := telegram.setWebhook(); err == nil || !strings.Contains(err.Error(), "bad webhook") {
+		t.Errorf("setWebhook() error = %v, want the description of the failure", err)
+	}
+}
+
+func TestWebhookSecretRequired(t *testing.T) {
+	for _, secret := range []string{"", "not a token"} {
+		telegram, _, _ := newTestTelegram()
+		err := telegram.newWebhookServer(&provider.Config{WebhookURL: "https://bot.example.com/telegram", WebhookSecret: secret})
+		if err == nil {
+			t.Errorf("newWebhookServer() with the secret %q expected an error", secret)
+		}
+	}
+}
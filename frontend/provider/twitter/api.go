@@ -0,0 +1,150 @@
+package twitter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+type (
+	// api is a client of the direct messages API authenticated with an OAuth
+	// 2.0 user access token. It waits for the rate limit window to reset when
+	// the remaining requests are exhausted.
+	api struct {
+		// token is the user access token of the bot account.
+		token string
+
+		// client is the http client calling the API.
+		client *http.Client
+
+		// mutex protects the rate limit state.
+		mutex sync.Mutex
+
+		// remaining is the number of requests remaining in the current rate
+		// limit window. It is negative until the first response is received.
+		remaining int
+
+		// resetAt is the end of the current rate limit window.
+		resetAt time.Time
+	}
+
+	// dmRequest is the body of a direct message request.
+	dmRequest struct {
+		// Text is the message text.
+		Text string `json:"text"`
+	}
+
+	// apiError is an error returned by the API.
+	apiError struct {
+		// StatusCode is the HTTP status code of the response.
+		StatusCode int
+
+		// Message is the body of the response.
+		Message string
+	}
+)
+
+const (
+	// dmURL is the URL format of the direct message endpoint. The parameter
+	// is the ID of the recipient.
+	dmURL = "https://api.twitter.com/2/dm_conversations/with/%s/messages"
+)
+
+// newAPI initializes a client of the API with the given user access token.
+func newAPI(token string) *api {
+	return &api{
+		token:     token,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		remaining: -1,
+	}
+}
+
+// Error returns the error message.
+func (e *apiError) Error() string {
+	return fmt.Sprintf("twitter api: %d: %s", e.StatusCode, e.Message)
+}
+
+// sendDM sends a direct message to the user whose ID is given.
+func (a *api) sendDM(recipientID, text string) error {
+	a.waitRateLimit()
+
+	data, err := json.Marshal(&dmRequest{Text: text})
+	if err != nil {
+		return errors.Annotate(err, "sending direct message")
+	}
+
+	request, err := http.NewRequest(http.MethodPost, fmt.Sprintf(dmURL, recipientID), bytes.NewReader(data))
+	if err != nil {
+		return errors.Annotate(err, "sending direct message")
+	}
+
+	request.Header.Set("Authorization", "Bearer "+a.token)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := a.client.Do(request)
+	if err != nil {
+		return errors.Annotate(err, "sending direct message")
+	}
+	defer response.Body.Close()
+
+	a.updateRateLimit(response.Header)
+
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusCreated {
+		data, _ := ioutil.ReadAll(io.LimitReader(response.Body, 512))
+		return &apiError{StatusCode: response.StatusCode, Message: string(data)}
+	}
+
+	return nil
+}
+
+// waitRateLimit waits for the end of the rate limit window when no request
+// remains.
+func (a *api) waitRateLimit() {
+	a.mutex.Lock()
+	wait := time.Duration(0)
+	if a.remaining == 0 {
+		wait = time.Until(a.resetAt)
+	}
+	a.mutex.Unlock()
+
+	if wait > 0 {
+		logger.Debugf("Rate limit reached, waiting %s", wait)
+		time.Sleep(wait)
+	}
+}
+
+// exhausted verifies if no request remains in the current rate limit window,
+// so the next request waits for its end.
+func (a *api) exhausted() bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.remaining == 0
+}
+
+// updateRateLimit updates the rate limit state with the x-rate-limit headers
+// of a response. The reset header is a Unix timestamp.
+func (a *api) updateRateLimit(header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-Rate-Limit-Remaining"))
+	if err != nil {
+		return
+	}
+
+	reset, err := strconv.ParseInt(header.Get("X-Rate-Limit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	a.mutex.Lock()
+	a.remaining = remaining
+	a.resetAt = time.Unix(reset, 0)
+	a.mutex.Unlock()
+}
@@ -0,0 +1,497 @@
+package twitter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/fberrez/samantha/frontend/provider/webhook"
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Twitter contains all variables needed to communicate with Twitter (X)
+	// users by direct messages. The messages are received on an Account
+	// Activity webhook and sent with the direct messages API.
+	Twitter struct {
+		// AuthorizedUsers is a authorized users slice. The ID of an authorized
+		// user is its Twitter user ID.
+		AuthorizedUsers []*provider.User
+
+		// AllowAllUsers disables the authorization check: anyone can talk to
+		// the bot.
+		AllowAllUsers bool
+
+		// RateLimiter limits the number of messages of each user. It is nil when
+		// the messages are not limited.
+		RateLimiter *provider.RateLimiter
+
+		// LogSampler samples the logs of the received messages. It is nil when
+		// every message is logged.
+		LogSampler *provider.LogSampler
+
+		// secret is the consumer secret used to answer the CRC challenges and
+		// to validate the webhook signatures.
+		secret string
+
+		// api is the client of the direct messages API.
+		api *api
+
+		// server is the webhook server.
+		server *webhook.Server
+
+		// outbox queues the direct messages to send, so the API rate limits
+		// are respected without blocking the frontend manager.
+		outbox chan *outboundMessage
+
+		// stop is closed when the provider is stopped.
+		stop chan struct{}
+
+		// pendingMessages keeps the received messages that have not been
+		// answered.
+		pendingMessages *provider.PendingMessages
+
+		// IDGenerator generates the UUIDs of the user messages.
+		IDGenerator capsule.IDGenerator
+
+		// userInput is a channel connected to the frontend manager. It is used to
+		// send user messages to that manager.
+		userInput chan<- *provider.CapsuleProvider
+	}
+
+	// message represents user messages.
+	message struct {
+		// uuid is the message uuid.
+		uuid uuid.UUID
+
+		// senderID is the ID of the user who sent the message.
+		senderID string
+	}
+
+	// outboundMessage is a direct message waiting to be sent.
+	outboundMessage struct {
+		// recipientID is the ID of the user receiving the message.
+		recipientID string
+
+		// text is the message text.
+		text string
+	}
+
+	// webhookRequest is the body of an Account Activity webhook request.
+	webhookRequest struct {
+		// ForUserID is the ID of the bot account.
+		ForUserID string `json:"for_user_id"`
+
+		// DirectMessageEvents are the direct message events.
+		DirectMessageEvents []*directMessageEvent `json:"direct_message_events"`
+
+		// Users indexes by ID the users of the events.
+		Users map[string]*twitterUser `json:"users"`
+	}
+
+	// directMessageEvent is a direct message event.
+	directMessageEvent struct {
+		// Type is the event type (ex: message_create).
+		Type string `json:"type"`
+
+		// MessageCreate is the created message.
+		MessageCreate *struct {
+			// SenderID is the ID of the user who sent the message.
+			SenderID string `json:"sender_id"`
+
+			// MessageData is the content of the message.
+			MessageData *struct {
+				// Text is the message text.
+				Text string `json:"text"`
+			} `json:"message_data"`
+		} `json:"message_create"`
+	}
+
+	// twitterUser is a user of the webhook events.
+	twitterUser struct {
+		// ScreenName is the handle of the user.
+		ScreenName string `json:"screen_name"`
+	}
+
+	// crcResponse is the response to a CRC challenge.
+	crcResponse struct {
+		// ResponseToken is the signed challenge.
+		ResponseToken string `json:"response_token"`
+	}
+)
+
+const (
+	// label is the provider label.
+	label = "twitter"
+
+	// messageCreateType is the type of the direct message events.
+	messageCreateType = "message_create"
+
+	// signatureHeader is the header containing the webhook request signature.
+	signatureHeader = "X-Twitter-Webhooks-Signature"
+
+	// signaturePrefix prefixes the base64-encoded signatures.
+	signaturePrefix = "sha256="
+
+	// outboxSize is the number of direct messages which can be queued.
+	outboxSize = 100
+
+	// maxSendAttempts is the number of attempts made to send a direct message
+	// limited by the API.
+	maxSendAttempts = 3
+
+	// rateLimitDelay is the delay before sending again a direct message
+	// limited by the API, when it does not give the end of the rate limit
+	// window.
+	rateLimitDelay = time.Minute
+)
+
+var (
+	// logger is a global logger of the package
+	logger = provider.NewLogger(label)
+)
+
+// Initialize initiliazes a provider with the given user access token,
+// consumer secret, slice of authorized users and user inputs write-only
+// channel.
+func (t *Twitter) Initialize(config *provider.Config) (provider.Provider, error) {
+	logger.Debugf("Initializing %s", label)
+
+	if len(config.Token) == 0 {
+		return nil, errors.NotValidf("empty user access token")
+	}
+
+	if len(config.Secret) == 0 {
+		return nil, errors.NotValidf("empty consumer secret")
+	}
+
+	client := &Twitter{
+		AuthorizedUsers: config.AuthorizedUsers,
+		AllowAllUsers:   config.AllowAllUsers,
+		RateLimiter:     provider.NewRateLimiter(config.RateLimit, provider.RateLimitWindow),
+		LogSampler:      provider.NewLogSampler(config.LogSampling),
+		secret:          config.Secret,
+		api:             newAPI(config.Token),
+		outbox:          make(chan *outboundMessage, outboxSize),
+		stop:            make(chan struct{}),
+		pendingMessages: provider.NewPendingMessages(),
+		IDGenerator:     capsule.RandomGenerator{},
+		userInput:       config.UserInput,
+	}
+
+	// Twitter cannot send the shared secret header: the requests are
+	// authenticated by their signature instead.
+	server, err := webhook.New(&webhook.Config{
+		Listen:      config.Listen,
+		TLSCertFile: config.TLSCertFile,
+		TLSKeyFile:  config.TLSKeyFile,
+	}, http.HandlerFunc(client.webhookHandler))
+	if err != nil {
+		return nil, errors.Annotate(err, "initializing twitter")
+	}
+
+	client.server = server
+	return client, nil
+}
+
+// Start starts sending the queued direct messages and the webhook server.
+// The server answers the CRC challenges and receives the user messages.
+func (t *Twitter) Start() {
+	logger.Debugf("Starting %s on %s", label, t.server.Addr())
+
+	go t.sendQueued()
+
+	if err := t.server.Start(); err != nil {
+		logger.WithError(err).Error("Webhook server stopped")
+	}
+}
+
+// Message queues the responses sent to the user.
+func (t *Twitter) Message(capsule *capsule.Capsule) error {
+	pending, err := t.pendingMessages.Take(capsule.OriginalMessage)
+	if err != nil {
+		return err
+	}
+	pendingMessage := pending.(*message)
+
+	if capsule.Error != nil && len(capsule.Error.Error()) > 0 {
+		return t.queue(pendingMessage.senderID, provider.SystemLog(capsule.Error.Error(), provider.ErrorStatus))
+	}
+
+	for _, response := range capsule.Responses {
+		if err := t.queue(pendingMessage.senderID, t.Format(&provider.Output{Text: response})); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Format formats the output as plain text, since direct messages have no
+// markup.
+func (t *Twitter) Format(output *provider.Output) string {
+	return provider.PlainFormatter{}.Format(output)
+}
+
+// Notify queues the text sent to the user whose ID is given.
+func (t *Twitter) Notify(chat string, text string) error {
+	return t.queue(chat, text)
+}
+
+// Capabilities returns the capabilities of the provider. Direct messages
+// are plain text.
+func (t *Twitter) Capabilities() *capsule.Capabilities {
+	return &capsule.Capabilities{Buttons: false}
+}
+
+// GetLabel returns the label of the provider
+func (t *Twitter) GetLabel() string {
+	return label
+}
+
+// Stop closes the webhook server and stops sending the queued direct
+// messages.
+func (t *Twitter) Stop() error {
+	close(t.stop)
+
+	if err := t.server.Stop(); err != nil {
+		return errors.Annotate(err, "closing webhook server")
+	}
+
+	return nil
+}
+
+// webhookHandler handles the webhook requests sent by Twitter. A GET request
+// is a CRC challenge, a POST request contains account activity events.
+func (t *Twitter) webhookHandler(w http.ResponseWriter, r *http.Request) {
+	localLogger := logger.WithField("action", "receiving user message")
+
+	if r.Method == http.MethodGet {
+		t.answerChallenge(w, r)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "cannot read body", http.StatusBadRequest)
+		return
+	}
+
+	if !t.validSignature(body, r.Header.Get(signatureHeader)) {
+		localLogger.Debug("Webhook request received with an invalid signature")
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	request := webhookRequest{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		http.Error(w, "cannot unmarshal body", http.StatusBadRequest)
+		return
+	}
+
+	for _, event := range request.DirectMessageEvents {
+		if event.Type != messageCreateType || event.MessageCreate == nil || event.MessageCreate.MessageData == nil {
+			continue
+		}
+
+		// The messages sent by the bot are also received.
+		senderID := event.MessageCreate.SenderID
+		text := event.MessageCreate.MessageData.Text
+		if senderID == request.ForUserID || len(text) == 0 {
+			continue
+		}
+
+		if !t.AllowAllUsers && t.authorizedUser(senderID) == nil {
+			localLogger.WithFields(log.Fields{
+				"from":    senderID,
+				"message": text,
+			}).Debug("User message received from unauthorized user")
+			continue
+		}
+
+		if t.LogSampler.Sample() {
+			localLogger.WithFields(log.Fields{
+				"from":    senderID,
+				"message": text,
+			}).Debug("User message received")
+		}
+
+		if !t.RateLimiter.Allow(senderID) {
+			localLogger.WithField("from", senderID).Debug("User rate limit exceeded")
+			if err := t.queue(senderID, provider.SystemLog(provider.RateLimitMessage, provider.Info)); err != nil {
+				localLogger.WithError(err).Error("Cannot reply to rate-limited user")
+			}
+			continue
+		}
+
+		// The handle of the user is its name. The ID is used when the user
+		// is not given.
+		handle := senderID
+		if user, ok := request.Users[senderID]; ok && len(user.ScreenName) > 0 {
+			handle = user.ScreenName
+		}
+
+		if err := t.processUserMessage(senderID, handle, text); err != nil {
+			localLogger.WithError(err).Error("Cannot process user message")
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// answerChallenge answers a CRC challenge with the base64-encoded
+// HMAC-SHA256 of the CRC token computed with the consumer secret.
+func (t *Twitter) answerChallenge(w http.ResponseWriter, r *http.Request) {
+	crcToken := r.URL.Query().Get("crc_token")
+	if len(crcToken) == 0 {
+		http.Error(w, "missing crc_token", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&crcResponse{ResponseToken: signaturePrefix + t.sign([]byte(crcToken))}); err != nil {
+		logger.WithError(err).Error("Cannot answer CRC challenge")
+	}
+}
+
+// validSignature verifies that the given signature is the base64-encoded
+// HMAC-SHA256 of the body computed with the consumer secret.
+func (t *Twitter) validSignature(body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return false
+	}
+
+	return hmac.Equal([]byte(strings.TrimPrefix(signature, signaturePrefix)), []byte(t.sign(body)))
+}
+
+// sign returns the base64-encoded HMAC-SHA256 of the data computed with the
+// consumer secret.
+func (t *Twitter) sign(data []byte) string {
+	mac := hmac.New(sha256.New, []byte(t.secret))
+	mac.Write(data)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// authorizedUser returns the authorized user whose Twitter ID is given, or
+// nil if the user is not authorized.
+func (t *Twitter) authorizedUser(userID string) *provider.User {
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	for _, user := range t.AuthorizedUsers {
+		if int64(user.ID) == id {
+			return user
+		}
+	}
+
+	return nil
+}
+
+// processUserMessage processes a user message by adding it to the pending
+// messages, converting it to a provider capsule and sending it to the
+// frontend manager.
+func (t *Twitter) processUserMessage(senderID, handle, text string) error {
+	// Generates a new UUID.
+	uuid, err := t.IDGenerator.New()
+	if err != nil {
+		return errors.Annotate(err, "processing user message")
+	}
+
+	message := &message{
+		uuid:     uuid,
+		senderID: senderID,
+	}
+
+	capsuleProvider := &provider.CapsuleProvider{
+		OriginalMessage: message.uuid,
+		ProviderLabel:   label,
+		Content:         text,
+		User:            handle,
+		Chat:            senderID,
+	}
+
+	if user := t.authorizedUser(senderID); user != nil {
+		capsuleProvider.Locale = user.Locale
+		capsuleProvider.Timezone = user.Timezone
+	}
+
+	// Sends the provider capsule-formatted message to the frontend manager,
+	// and keeps the message until it is answered. The user is asked to retry
+	// when the frontend manager is overloaded.
+	if !t.pendingMessages.Forward(t.userInput, capsuleProvider, message) {
+		return t.queue(senderID, provider.SystemLog(provider.BusyMessage, provider.Info))
+	}
+
+	return nil
+}
+
+// queue adds a direct message to the outbox. It fails when the outbox is
+// full.
+func (t *Twitter) queue(recipientID, text string) error {
+	select {
+	case t.outbox <- &outboundMessage{recipientID: recipientID, text: text}:
+		return nil
+	default:
+		return errors.Errorf("outbox full, cannot send direct message to %s", recipientID)
+	}
+}
+
+// sendQueued sends the queued direct messages in order until the provider is
+// stopped. A message limited by the API is sent again once the rate limit
+// window is over.
+func (t *Twitter) sendQueued() {
+	for {
+		select {
+		case <-t.stop:
+			return
+		case m := <-t.outbox:
+			t.send(m)
+		}
+	}
+}
+
+// send sends a queued direct message, making up to maxSendAttempts attempts
+// while it is rate limited.
+func (t *Twitter) send(m *outboundMessage) {
+	localLogger := logger.WithField("recipient", m.recipientID)
+
+	for attempt := 1; ; attempt++ {
+		err := t.api.sendDM(m.recipientID, m.text)
+		if err == nil {
+			return
+		}
+
+		apiErr, ok := err.(*apiError)
+		if !ok || apiErr.StatusCode != http.StatusTooManyRequests || attempt == maxSendAttempts {
+			localLogger.WithError(err).Error("Cannot send direct message")
+			return
+		}
+
+		// The next attempt waits for the rate limit window given by the
+		// response headers, or for rateLimitDelay without them.
+		wait := time.Duration(0)
+		if !t.api.exhausted() {
+			wait = rateLimitDelay
+		}
+
+		localLogger.Debugf("Direct message rate limited (attempt %d)", attempt)
+
+		select {
+		case <-t.stop:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
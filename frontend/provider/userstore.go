@@ -0,0 +1,200 @@
+package provider
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/juju/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type (
+	// UserStore persists the authorized users of a provider. The providers
+	// load their authorized users from it at startup.
+	UserStore interface {
+		// List returns the authorized users.
+		List() ([]*User, error)
+
+		// Add authorizes the user.
+		Add(user *User) error
+
+		// Remove revokes the authorization of the user.
+		Remove(user *User) error
+	}
+
+	// UserWatcher is implemented by the user stores notifying the changes of
+	// the authorized users.
+	UserWatcher interface {
+		// Watch registers the listener called with the authorized users each
+		// time they change.
+		Watch(listener func(users []*User))
+	}
+
+	// UserReloader is implemented by the providers able to replace their
+	// authorized users while running.
+	UserReloader interface {
+		// SetAuthorizedUsers replaces the authorized users.
+		SetAuthorizedUsers(users []*User)
+	}
+
+	// MemoryUserStore keeps the authorized users in memory. The changes are
+	// lost on restart.
+	MemoryUserStore struct {
+		// mutex protects the users and the listeners.
+		mutex sync.Mutex
+
+		// users is a slice containing the authorized users.
+		users []*User
+
+		// listeners is a slice containing the listeners registered with Watch.
+		listeners []func(users []*User)
+	}
+
+	// FileUserStore keeps the authorized users in a YAML file, as a list of
+	// users.
+	FileUserStore struct {
+		// MemoryUserStore holds the users read from the file.
+		*MemoryUserStore
+
+		// path is the path of the file.
+		path string
+	}
+)
+
+// NewMemoryUserStore initializes a store with the given users.
+func NewMemoryUserStore(users []*User) *MemoryUserStore {
+	return &MemoryUserStore{users: append([]*User{}, users...)}
+}
+
+// List returns a copy of the authorized users.
+func (s *MemoryUserStore) List() ([]*User, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]*User{}, s.users...), nil
+}
+
+// Add authorizes the user. It fails if the user is already authorized.
+func (s *MemoryUserStore) Add(user *User) error {
+	return s.update(func(users []*User) ([]*User, error) {
+		if indexOf(users, user) >= 0 {
+			return nil, errors.AlreadyExistsf("user %s", user.Name)
+		}
+
+		return append(users, user), nil
+	})
+}
+
+// Remove revokes the authorization of the user. It fails if the user is not
+// authorized.
+func (s *MemoryUserStore) Remove(user *User) error {
+	return s.update(func(users []*User) ([]*User, error) {
+		i := indexOf(users, user)
+		if i < 0 {
+			return nil, errors.NotFoundf("user %s", user.Name)
+		}
+
+		return append(users[:i], users[i+1:]...), nil
+	})
+}
+
+// Watch registers the listener called with the authorized users after each
+// change.
+func (s *MemoryUserStore) Watch(listener func(users []*User)) {
+	s.mutex.Lock()
+	s.listeners = append(s.listeners, listener)
+	s.mutex.Unlock()
+}
+
+// update replaces the users by the result of the given function, then calls
+// the listeners. The listeners are called outside of the lock, so they can
+// read the store.
+func (s *MemoryUserStore) update(change func(users []*User) ([]*User, error)) error {
+	s.mutex.Lock()
+	users, err := change(append([]*User{}, s.users...))
+	if err != nil {
+		s.mutex.Unlock()
+		return err
+	}
+
+	s.users = users
+	listeners := append([]func(users []*User){}, s.listeners...)
+	s.mutex.Unlock()
+
+	for _, listener := range listeners {
+		listener(append([]*User{}, users...))
+	}
+
+	return nil
+}
+
+// indexOf returns the index of the user with the same ID and name as the
+// given user, or -1 if there is none.
+func indexOf(users []*User, user *User) int {
+	for i, u := range users {
+		if u.ID == user.ID && u.Name == user.Name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// NewFileUserStore initializes a store reading the users from the YAML file
+// at the given path. A missing file is an empty list of users: it is created
+// on the first change.
+func NewFileUserStore(path string) (*FileUserStore, error) {
+	users := []*User{}
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Annotate(err, "reading users file")
+	}
+
+	if err == nil {
+		if err := yaml.Unmarshal(data, &users); err != nil {
+			return nil, errors.Annotate(err, "reading users file")
+		}
+	}
+
+	return &FileUserStore{MemoryUserStore: NewMemoryUserStore(users), path: path}, nil
+}
+
+// Add authorizes the user and saves the file.
+func (s *FileUserStore) Add(user *User) error {
+	if err := s.MemoryUserStore.Add(user); err != nil {
+		return err
+	}
+
+	return s.save()
+}
+
+// Remove revokes the authorization of the user and saves the file.
+func (s *FileUserStore) Remove(user *User) error {
+	if err := s.MemoryUserStore.Remove(user); err != nil {
+		return err
+	}
+
+	return s.save()
+}
+
+// save writes the users to the file. The file is replaced atomically so a
+// crash does not leave it truncated.
+func (s *FileUserStore) save() error {
+	users, _ := s.List()
+	data, err := yaml.Marshal(users)
+	if err != nil {
+		return errors.Annotate(err, "saving users file")
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return errors.Annotate(err, "saving users file")
+	}
+
+	if err := os.Rename(tmp, s.path); err != nil {
+		return errors.Annotate(err, "saving users file")
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/juju/errors"
+)
+
+var (
+	// alice and bob are the users of the store tests.
+	alice = &User{ID: 42, Name: "alice", Locale: "en_US"}
+	bob   = &User{ID: 43, Name: "bob"}
+)
+
+func TestFileUserStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.yaml")
+	store, err := NewFileUserStore(path)
+	if err != nil {
+		t.Fatalf("NewFileUserStore() error = %v", err)
+	}
+
+	if users, _ := store.List(); len(users) != 0 {
+		t.Fatalf("users = %v, want none from a missing file", users)
+	}
+
+	for _, user := range []*User{alice, bob} {
+		if err := store.Add(user); err != nil {
+			t.Fatalf("Add(%s) error = %v", user.Name, err)
+		}
+	}
+
+	if err := store.Remove(bob); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+
+	// The changes are saved in the file.
+	reloaded, err := NewFileUserStore(path)
+	if err != nil {
+		t.Fatalf("NewFileUserStore() error = %v", err)
+	}
+
+	if users, _ := reloaded.List(); !reflect.DeepEqual(users, []*User{alice}) {
+		t.Errorf("reloaded users = %v, want alice", users)
+	}
+}
+
+func TestFileUserStoreInvalidChanges(t *testing.T) {
+	store, err := NewFileUserStore(filepath.Join(t.TempDir(), "users.yaml"))
+	if err != nil {
+		t.Fatalf("NewFileUserStore() error = %v", err)
+	}
+
+	if err := store.Add(alice); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	if err := store.Add(alice); !errors.IsAlreadyExists(err) {
+		t.Errorf("Add() error = %v, want the user already authorized", err)
+	}
+
+	if err := store.Remove(bob); !errors.IsNotFound(err) {
+		t.Errorf("Remove() error = %v, want the user not found", err)
+	}
+}
+
+func TestFileUserStoreInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.yaml")
+	if err := ioutil.WriteFile(path, []byte("- id: [\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFileUserStore(path); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestUserStoreWatch(t *testing.T) {
+	store, err := NewFileUserStore(filepath.Join(t.TempDir(), "users.yaml"))
+	if err != nil {
+		t.Fatalf("NewFileUserStore() error = %v", err)
+	}
+
+	notified := [][]*User{}
+	store.Watch(func(users []*User) {
+		notified = append(notified, users)
+	})
+
+	store.Add(alice)
+	store.Add(alice)
+	store.Remove(alice)
+
+	if want := [][]*User{{alice}, {}}; !reflect.DeepEqual(notified, want) {
+		t.Errorf("notified users = %v, want %v", notified, want)
+	}
+}
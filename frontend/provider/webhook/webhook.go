@@ -0,0 +1,146 @@
+package webhook
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Config is the configuration of a webhook server.
+	Config struct {
+		// Listen is the address on which the server listens.
+		Listen string
+
+		// TLSCertFile is the path of the TLS certificate. The server serves
+		// HTTPS when it is given with TLSKeyFile.
+		TLSCertFile string
+
+		// TLSKeyFile is the path of the TLS private key.
+		TLSKeyFile string
+
+		// Secret is the shared secret which must be given in the SecretHeader of
+		// every request. Requests are not verified when it is empty.
+		Secret string
+	}
+
+	// Server is a webhook server shared by the webhook-based providers. It
+	// serves over TLS when configured and rejects the requests without the
+	// shared secret.
+	Server struct {
+		// server is the underlying http server.
+		server *http.Server
+
+		// config is the server configuration.
+		config *Config
+	}
+)
+
+const (
+	// SecretHeader is the header containing the shared secret.
+	SecretHeader = "X-Webhook-Secret"
+
+	// defaultListen is the default address of the server.
+	defaultListen = ":8080"
+
+	// shutdownTimeout is the maximum duration of the requests being handled
+	// when the server stops.
+	shutdownTimeout = 5 * time.Second
+)
+
+var (
+	// logger is a global logger of the package
+	logger = log.WithFields(log.Fields{
+		"package": "frontend",
+		"helper":  "webhook",
+	})
+)
+
+// New initializes a new webhook server serving the given handler.
+func New(config *Config, handler http.Handler) (*Server, error) {
+	if (len(config.TLSCertFile) == 0) != (len(config.TLSKeyFile) == 0) {
+		return nil, errors.NotValidf("TLS configuration without both certificate and key")
+	}
+
+	listen := config.Listen
+	if len(listen) == 0 {
+		listen = defaultListen
+	}
+
+	s := &Server{
+		config: config,
+	}
+
+	s.server = &http.Server{
+		Addr:    listen,
+		Handler: s.authorize(handler),
+	}
+
+	return s, nil
+}
+
+// Start starts listening. It blocks until the server is stopped.
+func (s *Server) Start() error {
+	logger.Debugf("Starting webhook server on %s (TLS: %t)", s.server.Addr, s.isTLS())
+
+	var err error
+	if s.isTLS() {
+		err = s.server.ListenAndServeTLS(s.config.TLSCertFile, s.config.TLSKeyFile)
+	} else {
+		err = s.server.ListenAndServe()
+	}
+
+	if err != nil && err != http.ErrServerClosed {
+		return errors.Annotate(err, "serving webhook")
+	}
+
+	return nil
+}
+
+// Stop stops the server once the requests being handled are done, so their
+// handlers do not forward the user inputs after the provider stopped. The
+// connections are closed if the requests last more than shutdownTimeout.
+func (s *Server) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.server.Close()
+		return errors.Annotate(err, "stopping webhook server")
+	}
+
+	return nil
+}
+
+// Addr returns the address on which the server listens.
+func (s *Server) Addr() string {
+	return s.server.Addr
+}
+
+// isTLS verifies if the server serves HTTPS.
+func (s *Server) isTLS() bool {
+	return len(s.config.TLSCertFile) > 0
+}
+
+// authorize wraps the handler so it rejects the requests without the shared
+// secret.
+func (s *Server) authorize(handler http.Handler) http.Handler {
+	if len(s.config.Secret) == 0 {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := r.Header.Get(SecretHeader)
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(s.config.Secret)) != 1 {
+			logger.WithField("remote", r.RemoteAddr).Debug("Webhook request received without a valid secret")
+			http.Error(w, "invalid secret", http.StatusUnauthorized)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
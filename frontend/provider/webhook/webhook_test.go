@@ -0,0 +1,135 @@
+package webhook
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		name   string
+		config *Config
+		addr   string
+		valid  bool
+	}{
+		{"default listen", &Config{}, defaultListen, true},
+		{"listen", &Config{Listen: ":9000"}, ":9000", true},
+		{"TLS", &Config{TLSCertFile: "cert.pem", TLSKeyFile: "key.pem"}, defaultListen, true},
+		{"certificate only", &Config{TLSCertFile: "cert.pem"}, "", false},
+		{"key only", &Config{TLSKeyFile: "key.pem"}, "", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, err := New(c.config, http.NotFoundHandler())
+			if !c.valid {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if s.Addr() != c.addr {
+				t.Errorf("expected address %q, got %q", c.addr, s.Addr())
+			}
+		})
+	}
+}
+
+func TestSecretRejection(t *testing.T) {
+	const secret = "s3cr3t"
+
+	cases := []struct {
+		name   string
+		secret string
+		header string
+		status int
+	}{
+		{"valid secret", secret, secret, http.StatusOK},
+		{"missing secret", secret, "", http.StatusUnauthorized},
+		{"wrong secret", secret, "wrong", http.StatusUnauthorized},
+		{"secret prefix", secret, "s3cr", http.StatusUnauthorized},
+		{"no secret configured", "", "", http.StatusOK},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			served := false
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served = true
+			})
+
+			s, err := New(&Config{Secret: c.secret}, handler)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if len(c.header) > 0 {
+				req.Header.Set(SecretHeader, c.header)
+			}
+
+			w := httptest.NewRecorder()
+			s.server.Handler.ServeHTTP(w, req)
+
+			if w.Code != c.status {
+				t.Errorf("expected status %d, got %d", c.status, w.Code)
+			}
+
+			if served != (c.status == http.StatusOK) {
+				t.Errorf("expected the handler to be served: %t", c.status == http.StatusOK)
+			}
+		})
+	}
+}
+
+func TestStopWaitsForHandlers(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	s, err := New(&Config{Listen: "127.0.0.1:0"}, handler)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.server.Serve(listener)
+
+	go http.Post("http://"+listener.Addr().String(), "text/plain", nil)
+	<-started
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- s.Stop()
+	}()
+
+	select {
+	case err := <-stopped:
+		t.Fatalf("Stop() returned %v while a handler was running", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server not stopped")
+	}
+}
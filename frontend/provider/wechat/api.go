@@ -0,0 +1,190 @@
+package wechat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+type (
+	// api is a client of the WeChat API. It caches the access token until it
+	// expires.
+	api struct {
+		// appID is the AppID of the Official Account.
+		appID string
+
+		// appSecret is the AppSecret of the Official Account.
+		appSecret string
+
+		// client is the http client calling the API.
+		client *http.Client
+
+		// mutex protects the access token.
+		mutex sync.Mutex
+
+		// accessToken is the current access token.
+		accessToken string
+
+		// expiresAt is the expiration time of the access token.
+		expiresAt time.Time
+	}
+
+	// tokenResponse is the response of the access token request.
+	tokenResponse struct {
+		apiError
+
+		// AccessToken is the access token.
+		AccessToken string `json:"access_token"`
+
+		// ExpiresIn is the lifetime of the access token in seconds.
+		ExpiresIn int `json:"expires_in"`
+	}
+
+	// apiError is the error returned by the API.
+	apiError struct {
+		// ErrCode is the error code. It is zero on success.
+		ErrCode int `json:"errcode"`
+
+		// ErrMsg is the error message.
+		ErrMsg string `json:"errmsg"`
+	}
+
+	// customMessage is a text message sent with the customer service API.
+	customMessage struct {
+		// ToUser is the OpenID of the user.
+		ToUser string `json:"touser"`
+
+		// MsgType is the message type.
+		MsgType string `json:"msgtype"`
+
+		// Text is the text of the message.
+		Text customText `json:"text"`
+	}
+
+	// customText is the text of a customer service message.
+	customText struct {
+		// Content is the message text.
+		Content string `json:"content"`
+	}
+)
+
+const (
+	// apiURL is the URL of the WeChat API.
+	apiURL = "https://api.weixin.qq.com/cgi-bin"
+
+	// tokenMargin is the duration before its expiration after which an access
+	// token is renewed.
+	tokenMargin = time.Minute
+
+	// invalidTokenCode and expiredTokenCode are the error codes of an invalid
+	// or expired access token.
+	invalidTokenCode = 40001
+	expiredTokenCode = 42001
+)
+
+// newAPI initializes a client of the WeChat API.
+func newAPI(appID, appSecret string) *api {
+	return &api{
+		appID:     appID,
+		appSecret: appSecret,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// sendText sends a text message to the given user with the customer service
+// API. The access token is renewed once if it has been invalidated.
+func (a *api) sendText(openID, text string) error {
+	message := &customMessage{
+		ToUser:  openID,
+		MsgType: "text",
+		Text:    customText{Content: text},
+	}
+
+	err := a.sendCustom(message)
+	if e, ok := errors.Cause(err).(*apiError); ok && (e.ErrCode == invalidTokenCode || e.ErrCode == expiredTokenCode) {
+		a.mutex.Lock()
+		a.accessToken = ""
+		a.mutex.Unlock()
+
+		err = a.sendCustom(message)
+	}
+
+	return err
+}
+
+// sendCustom sends a customer service message.
+func (a *api) sendCustom(message *customMessage) error {
+	token, err := a.token()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return errors.Annotate(err, "sending customer service message")
+	}
+
+	response, err := a.client.Post(apiURL+"/message/custom/send?access_token="+url.QueryEscape(token), "application/json", bytes.NewReader(data))
+	if err != nil {
+		return errors.Annotate(err, "sending customer service message")
+	}
+	defer response.Body.Close()
+
+	result := &apiError{}
+	if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+		return errors.Annotate(err, "sending customer service message")
+	}
+
+	if result.ErrCode != 0 {
+		return errors.Annotate(result, "sending customer service message")
+	}
+
+	return nil
+}
+
+// token returns the access token, requesting a new one if it is missing or
+// about to expire.
+func (a *api) token() (string, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if len(a.accessToken) > 0 && time.Now().Before(a.expiresAt) {
+		return a.accessToken, nil
+	}
+
+	query := url.Values{
+		"grant_type": {"client_credential"},
+		"appid":      {a.appID},
+		"secret":     {a.appSecret},
+	}
+
+	response, err := a.client.Get(apiURL + "/token?" + query.Encode())
+	if err != nil {
+		return "", errors.Annotate(err, "requesting access token")
+	}
+	defer response.Body.Close()
+
+	result := &tokenResponse{}
+	if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+		return "", errors.Annotate(err, "requesting access token")
+	}
+
+	if result.ErrCode != 0 {
+		return "", errors.Annotate(&result.apiError, "requesting access token")
+	}
+
+	a.accessToken = result.AccessToken
+	a.expiresAt = time.Now().Add(time.Duration(result.ExpiresIn)*time.Second - tokenMargin)
+	return a.accessToken, nil
+}
+
+// Error returns the error message.
+func (e *apiError) Error() string {
+	return fmt.Sprintf("wechat error %d: %s", e.ErrCode, e.ErrMsg)
+}
@@ -0,0 +1,421 @@
+package wechat
+
+import (
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/fberrez/samantha/frontend/provider/webhook"
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// WeChat contains all variables needed to communicate with a WeChat
+	// Official Account. User messages are received on a webhook in plain text
+	// mode. The responses are sent in the passive reply of the webhook request
+	// when the backend answers in time, with the customer service API
+	// otherwise.
+	WeChat struct {
+		// AuthorizedUsers is a authorized users slice. The OpenID of an
+		// authorized user is its name.
+		AuthorizedUsers []*provider.User
+
+		// AllowAllUsers disables the authorization check: anyone can talk to
+		// the bot.
+		AllowAllUsers bool
+
+		// RateLimiter limits the number of messages of each user. It is nil when
+		// the messages are not limited.
+		RateLimiter *provider.RateLimiter
+
+		// LogSampler samples the logs of the received messages. It is nil when
+		// every message is logged.
+		LogSampler *provider.LogSampler
+
+		// token is the token of the server configuration, used to verify the
+		// signatures of the webhook requests.
+		token string
+
+		// api is the client of the WeChat API.
+		api *api
+
+		// server is the webhook server.
+		server *webhook.Server
+
+		// mutex protects the delivery mode of the pending messages.
+		mutex sync.Mutex
+
+		// pendingMessages keeps the received messages that have not been
+		// answered.
+		pendingMessages *provider.PendingMessages
+
+		// IDGenerator generates the UUIDs of the user messages.
+		IDGenerator capsule.IDGenerator
+
+		// userInput is a channel connected to the frontend manager. It is used to
+		// send user messages to that manager.
+		userInput chan<- *provider.CapsuleProvider
+	}
+
+	// message represents user messages.
+	message struct {
+		// uuid is the message uuid.
+		uuid uuid.UUID
+
+		// openID is the OpenID of the user who sent the message.
+		openID string
+
+		// replies receives the responses while the webhook request waits for
+		// them.
+		replies chan []string
+
+		// async is true once the webhook request stopped waiting. The
+		// responses are then sent with the customer service API.
+		async bool
+	}
+
+	// cdata is a XML text written in a CDATA section.
+	cdata struct {
+		Value string `xml:",cdata"`
+	}
+
+	// inboundMessage is the body of a webhook request.
+	inboundMessage struct {
+		XMLName      xml.Name `xml:"xml"`
+		ToUserName   string   `xml:"ToUserName"`
+		FromUserName string   `xml:"FromUserName"`
+		CreateTime   int64    `xml:"CreateTime"`
+		MsgType      string   `xml:"MsgType"`
+		Content      string   `xml:"Content"`
+		MsgID        int64    `xml:"MsgId"`
+	}
+
+	// passiveReply is the text message sent in the response of a webhook
+	// request.
+	passiveReply struct {
+		XMLName      xml.Name `xml:"xml"`
+		ToUserName   cdata    `xml:"ToUserName"`
+		FromUserName cdata    `xml:"FromUserName"`
+		CreateTime   int64    `xml:"CreateTime"`
+		MsgType      cdata    `xml:"MsgType"`
+		Content      cdata    `xml:"Content"`
+	}
+)
+
+const (
+	// label is the provider label.
+	label = "wechat"
+
+	// passiveReplyTimeout is the duration the webhook request waits for the
+	// responses. WeChat retries the requests which are not answered within 5
+	// seconds.
+	passiveReplyTimeout = 4500 * time.Millisecond
+
+	// emptyReply is the response of a webhook request which is answered
+	// asynchronously.
+	emptyReply = "success"
+)
+
+var (
+	// logger is a global logger of the package
+	logger = provider.NewLogger(label)
+)
+
+// Initialize initiliazes a provider with the given server token, AppID
+// (username), AppSecret (secret), slice of authorized users and user inputs
+// write-only channel.
+func (w *WeChat) Initialize(config *provider.Config) (provider.Provider, error) {
+	logger.Debugf("Initializing %s", label)
+
+	if len(config.Token) == 0 {
+		return nil, errors.NotValidf("empty server token")
+	}
+
+	if len(config.Username) == 0 || len(config.Secret) == 0 {
+		return nil, errors.NotValidf("empty AppID or AppSecret")
+	}
+
+	client := &WeChat{
+		AuthorizedUsers: config.AuthorizedUsers,
+		AllowAllUsers:   config.AllowAllUsers,
+		RateLimiter:     provider.NewRateLimiter(config.RateLimit, provider.RateLimitWindow),
+		LogSampler:      provider.NewLogSampler(config.LogSampling),
+		token:           config.Token,
+		api:             newAPI(config.Username, config.Secret),
+		pendingMessages: provider.NewPendingMessages(),
+		IDGenerator:     capsule.RandomGenerator{},
+		userInput:       config.UserInput,
+	}
+
+	server, err := webhook.New(&webhook.Config{
+		Listen:      config.Listen,
+		TLSCertFile: config.TLSCertFile,
+		TLSKeyFile:  config.TLSKeyFile,
+		Secret:      config.WebhookSecret,
+	}, http.HandlerFunc(client.webhookHandler))
+	if err != nil {
+		return nil, errors.Annotate(err, "initializing wechat")
+	}
+
+	client.server = server
+	return client, nil
+}
+
+// Start starts the webhook server. The server answers the verification
+// handshake of the WeChat server configuration and receives the user
+// messages.
+func (w *WeChat) Start() {
+	logger.Debugf("Starting %s on %s", label, w.server.Addr())
+
+	if err := w.server.Start(); err != nil {
+		logger.WithError(err).Error("Webhook server stopped")
+	}
+}
+
+// Message sends the text message to the user. The responses are handed to
+// the waiting webhook request, or sent with the customer service API if the
+// request stopped waiting.
+func (w *WeChat) Message(capsule *capsule.Capsule) error {
+	pending, err := w.pendingMessages.Take(capsule.OriginalMessage)
+	if err != nil {
+		return err
+	}
+	pendingMessage := pending.(*message)
+
+	texts := capsule.Responses
+	if capsule.Error != nil && len(capsule.Error.Error()) > 0 {
+		texts = []string{provider.SystemLog(capsule.Error.Error(), provider.ErrorStatus)}
+	}
+
+	w.mutex.Lock()
+	if !pendingMessage.async {
+		pendingMessage.replies <- texts
+		w.mutex.Unlock()
+		return nil
+	}
+	w.mutex.Unlock()
+
+	for _, text := range texts {
+		if err := w.api.sendText(pendingMessage.openID, text); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Notify sends the text to the user whose OpenID is given with the customer
+// service API.
+func (w *WeChat) Notify(chat string, text string) error {
+	return w.api.sendText(chat, text)
+}
+
+// Capabilities returns the capabilities of the provider. The passive
+// replies are plain text.
+func (w *WeChat) Capabilities() *capsule.Capabilities {
+	return &capsule.Capabilities{Buttons: false}
+}
+
+// GetLabel returns the label of the provider
+func (w *WeChat) GetLabel() string {
+	return label
+}
+
+// Stop closes the webhook server.
+func (w *WeChat) Stop() error {
+	if err := w.server.Stop(); err != nil {
+		return errors.Annotate(err, "closing webhook server")
+	}
+
+	return nil
+}
+
+// webhookHandler handles the webhook requests sent by WeChat. A GET request is
+// the verification handshake, a POST request contains a user message.
+func (w *WeChat) webhookHandler(rw http.ResponseWriter, r *http.Request) {
+	localLogger := logger.WithField("action", "receiving user message")
+
+	query := r.URL.Query()
+	if !w.validSignature(query.Get("signature"), query.Get("timestamp"), query.Get("nonce")) {
+		localLogger.Debug("Webhook request received with an invalid signature")
+		http.Error(rw, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		rw.Write([]byte(query.Get("echostr")))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(rw, "cannot read body", http.StatusBadRequest)
+		return
+	}
+
+	inbound := inboundMessage{}
+	if err := xml.Unmarshal(body, &inbound); err != nil {
+		http.Error(rw, "cannot unmarshal body", http.StatusBadRequest)
+		return
+	}
+
+	// Only the text messages are processed, the events are acknowledged.
+	if inbound.MsgType != "text" {
+		rw.Write([]byte(emptyReply))
+		return
+	}
+
+	if !w.AllowAllUsers && w.authorizedUser(inbound.FromUserName) == nil {
+		localLogger.WithFields(log.Fields{
+			"from":    inbound.FromUserName,
+			"message": inbound.Content,
+		}).Debug("User message received from unauthorized user")
+		rw.Write([]byte(emptyReply))
+		return
+	}
+
+	if w.LogSampler.Sample() {
+		localLogger.WithFields(log.Fields{
+			"from":    inbound.FromUserName,
+			"message": inbound.Content,
+		}).Debug("User message received")
+	}
+
+	if !w.RateLimiter.Allow(inbound.FromUserName) {
+		localLogger.WithField("from", inbound.FromUserName).Debug("User rate limit exceeded")
+		w.reply(rw, &inbound, []string{provider.SystemLog(provider.RateLimitMessage, provider.Info)})
+		return
+	}
+
+	pendingMessage, err := w.processUserMessage(&inbound)
+	if err != nil {
+		localLogger.WithError(err).Error("Cannot process user message")
+		w.reply(rw, &inbound, []string{provider.SystemLog(err.Error(), provider.ErrorStatus)})
+		return
+	}
+
+	// The user is asked to retry when the frontend manager is overloaded.
+	if pendingMessage == nil {
+		w.reply(rw, &inbound, []string{provider.SystemLog(provider.BusyMessage, provider.Info)})
+		return
+	}
+
+	select {
+	case texts := <-pendingMessage.replies:
+		w.reply(rw, &inbound, texts)
+		return
+	case <-time.After(passiveReplyTimeout):
+	}
+
+	// The responses may have been handed over while the timeout expired.
+	w.mutex.Lock()
+	pendingMessage.async = true
+	select {
+	case texts := <-pendingMessage.replies:
+		w.mutex.Unlock()
+		w.reply(rw, &inbound, texts)
+		return
+	default:
+	}
+	w.mutex.Unlock()
+
+	localLogger.WithField("from", inbound.FromUserName).Debug("Backend too slow, falling back to the customer service API")
+	rw.Write([]byte(emptyReply))
+}
+
+// validSignature verifies that the given signature is the hex-encoded SHA1 of
+// the sorted concatenation of the server token, the timestamp and the nonce.
+func (w *WeChat) validSignature(signature, timestamp, nonce string) bool {
+	parts := []string{w.token, timestamp, nonce}
+	sort.Strings(parts)
+
+	sum := sha1.Sum([]byte(strings.Join(parts, "")))
+	expected := hex.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) == 1
+}
+
+// authorizedUser returns the authorized user whose OpenID is given, or nil if
+// the user is not authorized.
+func (w *WeChat) authorizedUser(openID string) *provider.User {
+	for _, user := range w.AuthorizedUsers {
+		if user.Name == openID {
+			return user
+		}
+	}
+
+	return nil
+}
+
+// processUserMessage processes a message by adding it to the pending
+// messages, converting it to a provider capsule and sending it to the frontend
+// manager. It returns a nil message when the frontend manager is overloaded.
+func (w *WeChat) processUserMessage(inbound *inboundMessage) (*message, error) {
+	// Generates a new UUID.
+	uuid, err := w.IDGenerator.New()
+	if err != nil {
+		return nil, errors.Annotate(err, "processing user message")
+	}
+
+	message := &message{
+		uuid:    uuid,
+		openID:  inbound.FromUserName,
+		replies: make(chan []string, 1),
+	}
+
+	capsuleProvider := &provider.CapsuleProvider{
+		OriginalMessage: message.uuid,
+		ProviderLabel:   label,
+		Content:         inbound.Content,
+		User:            message.openID,
+		Chat:            message.openID,
+	}
+
+	if user := w.authorizedUser(message.openID); user != nil {
+		capsuleProvider.Locale = user.Locale
+		capsuleProvider.Timezone = user.Timezone
+	}
+
+	// Sends the provider capsule-formatted message to the frontend manager,
+	// and keeps the message until it is answered.
+	if !w.pendingMessages.Forward(w.userInput, capsuleProvider, message) {
+		return nil, nil
+	}
+
+	return message, nil
+}
+
+// reply writes the passive reply of the webhook request. A passive reply
+// contains a single message, so the texts are joined.
+func (w *WeChat) reply(rw http.ResponseWriter, inbound *inboundMessage, texts []string) {
+	if len(texts) == 0 {
+		rw.Write([]byte(emptyReply))
+		return
+	}
+
+	data, err := xml.Marshal(&passiveReply{
+		ToUserName:   cdata{inbound.FromUserName},
+		FromUserName: cdata{inbound.ToUserName},
+		CreateTime:   time.Now().Unix(),
+		MsgType:      cdata{"text"},
+		Content:      cdata{strings.Join(texts, "\n\n")},
+	})
+	if err != nil {
+		logger.WithError(err).Error("Cannot marshal passive reply")
+		rw.Write([]byte(emptyReply))
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/xml")
+	rw.Write(data)
+}
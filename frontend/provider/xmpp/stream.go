@@ -0,0 +1,339 @@
+package xmpp
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+type (
+	// stream is an authenticated XML stream with the XMPP server.
+	stream struct {
+		// conn is the connection to the server.
+		conn net.Conn
+
+		// decoder reads the stanzas sent by the server.
+		decoder *xml.Decoder
+
+		// mutex protects the writes, which are done concurrently by the
+		// listening loop and the frontend manager.
+		mutex sync.Mutex
+
+		// jid is the full JID bound by the server.
+		jid string
+	}
+
+	// features are the stream features announced by the server.
+	features struct {
+		XMLName xml.Name `xml:"http://etherx.jabber.org/streams features"`
+
+		// StartTLS is not nil when the server supports STARTTLS.
+		StartTLS *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-tls starttls"`
+
+		// Mechanisms is a slice containing the supported SASL mechanisms.
+		Mechanisms []string `xml:"urn:ietf:params:xml:ns:xmpp-sasl mechanisms>mechanism"`
+
+		// Bind is not nil when the server expects a resource binding.
+		Bind *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-bind bind"`
+	}
+
+	// bindResult is the result of a resource binding.
+	bindResult struct {
+		// Type is the IQ type (result or error).
+		Type string `xml:"type,attr"`
+
+		// JID is the full JID bound by the server.
+		JID string `xml:"urn:ietf:params:xml:ns:xmpp-bind bind>jid"`
+	}
+
+	// stanza is a message or presence stanza received from the server.
+	stanza struct {
+		XMLName xml.Name
+
+		// From is the full JID of the sender.
+		From string `xml:"from,attr"`
+
+		// Type is the stanza type (ex: chat, subscribe).
+		Type string `xml:"type,attr"`
+
+		// Body is the text of a message.
+		Body string `xml:"body"`
+	}
+)
+
+const (
+	// defaultPort is the default client-to-server port.
+	defaultPort = "5222"
+
+	// resource is the resource bound by the client.
+	resource = "samantha"
+
+	// dialTimeout is the timeout of the connection to the server.
+	dialTimeout = 10 * time.Second
+)
+
+// dial connects to the XMPP server, negotiates TLS, authenticates the user
+// with SASL PLAIN and binds a resource. The server address defaults to the
+// domain of the JID.
+func dial(server, jid, password string) (*stream, error) {
+	user, domain := splitJID(jid)
+	if len(user) == 0 || len(domain) == 0 {
+		return nil, errors.NotValidf("JID %q", jid)
+	}
+
+	if len(server) == 0 {
+		server = domain
+	}
+
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, defaultPort)
+	}
+
+	conn, err := net.DialTimeout("tcp", server, dialTimeout)
+	if err != nil {
+		return nil, errors.Annotatef(err, "connecting to %s", server)
+	}
+
+	s := &stream{conn: conn}
+	if err := s.negotiate(user, domain, password); err != nil {
+		conn.Close()
+		return nil, errors.Annotatef(err, "negotiating stream with %s", server)
+	}
+
+	return s, nil
+}
+
+// negotiate negotiates the stream features.
+func (s *stream) negotiate(user, domain, password string) error {
+	f, err := s.open(domain)
+	if err != nil {
+		return err
+	}
+
+	if f.StartTLS == nil {
+		return errors.NotSupportedf("STARTTLS by the server")
+	}
+
+	if err := s.write("<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>"); err != nil {
+		return err
+	}
+
+	if _, err := s.expect("proceed"); err != nil {
+		return err
+	}
+
+	tlsConn := tls.Client(s.conn, &tls.Config{ServerName: domain})
+	if err := tlsConn.Handshake(); err != nil {
+		return errors.Annotate(err, "TLS handshake")
+	}
+	s.conn = tlsConn
+
+	if f, err = s.open(domain); err != nil {
+		return err
+	}
+
+	if !contains(f.Mechanisms, "PLAIN") {
+		return errors.NotSupportedf("SASL PLAIN by the server")
+	}
+
+	credentials := base64.StdEncoding.EncodeToString([]byte("\x00" + user + "\x00" + password))
+	if err := s.write("<auth xmlns='urn:ietf:params:xml:ns:xmpp-sasl' mechanism='PLAIN'>%s</auth>", credentials); err != nil {
+		return err
+	}
+
+	if _, err := s.expect("success"); err != nil {
+		return errors.Annotate(err, "authenticating")
+	}
+
+	if f, err = s.open(domain); err != nil {
+		return err
+	}
+
+	if f.Bind == nil {
+		return errors.NotSupportedf("resource binding by the server")
+	}
+
+	if err := s.write("<iq type='set' id='bind'><bind xmlns='urn:ietf:params:xml:ns:xmpp-bind'><resource>%s</resource></bind></iq>", resource); err != nil {
+		return err
+	}
+
+	start, err := s.expect("iq")
+	if err != nil {
+		return err
+	}
+
+	result := bindResult{}
+	if err := s.decoder.DecodeElement(&result, start); err != nil {
+		return errors.Annotate(err, "decoding resource binding")
+	}
+
+	if result.Type != "result" {
+		return errors.Errorf("cannot bind resource %s", resource)
+	}
+
+	s.jid = result.JID
+	return nil
+}
+
+// open opens a new stream and returns the features announced by the server.
+func (s *stream) open(domain string) (*features, error) {
+	s.decoder = xml.NewDecoder(s.conn)
+
+	if err := s.write("<?xml version='1.0'?><stream:stream to='%s' xmlns='jabber:client' xmlns:stream='http://etherx.jabber.org/streams' version='1.0'>", domain); err != nil {
+		return nil, err
+	}
+
+	start, err := s.expect("features")
+	if err != nil {
+		return nil, err
+	}
+
+	f := &features{}
+	if err := s.decoder.DecodeElement(f, start); err != nil {
+		return nil, errors.Annotate(err, "decoding stream features")
+	}
+
+	return f, nil
+}
+
+// expect reads the next element and verifies that its name is the given one.
+func (s *stream) expect(name string) (*xml.StartElement, error) {
+	start, err := s.next()
+	if err != nil {
+		return nil, err
+	}
+
+	if start.Name.Local != name {
+		return nil, errors.Errorf("unexpected element %s, expecting %s", start.Name.Local, name)
+	}
+
+	return start, nil
+}
+
+// next returns the next top-level element of the stream. The stream opening
+// is skipped.
+func (s *stream) next() (*xml.StartElement, error) {
+	for {
+		token, err := s.decoder.Token()
+		if err != nil {
+			return nil, errors.Annotate(err, "reading stream")
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "stream" {
+				continue
+			}
+
+			return &t, nil
+		case xml.EndElement:
+			if t.Name.Local == "stream" {
+				return nil, errors.Annotate(io.EOF, "stream closed by the server")
+			}
+		}
+	}
+}
+
+// read returns the next message or presence stanza. The other stanzas are
+// skipped.
+func (s *stream) read() (*stanza, error) {
+	for {
+		start, err := s.next()
+		if err != nil {
+			return nil, err
+		}
+
+		if start.Name.Local != "message" && start.Name.Local != "presence" {
+			if err := s.decoder.Skip(); err != nil {
+				return nil, errors.Annotate(err, "skipping element")
+			}
+			continue
+		}
+
+		st := &stanza{}
+		if err := s.decoder.DecodeElement(st, start); err != nil {
+			return nil, errors.Annotate(err, "decoding stanza")
+		}
+
+		return st, nil
+	}
+}
+
+// write writes a formatted string to the stream.
+func (s *stream) write(format string, args ...interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := fmt.Fprintf(s.conn, format, args...); err != nil {
+		return errors.Annotate(err, "writing stream")
+	}
+
+	return nil
+}
+
+// sendMessage sends a chat message to the given JID.
+func (s *stream) sendMessage(to, text string) error {
+	return s.write("<message to='%s' type='chat'><body>%s</body></message>", escape(to), escape(text))
+}
+
+// sendPresence sends a presence stanza. The stanza is sent to the server
+// when the recipient is empty.
+func (s *stream) sendPresence(to, presenceType string) error {
+	if len(to) == 0 {
+		return s.write("<presence/>")
+	}
+
+	return s.write("<presence to='%s' type='%s'/>", escape(to), escape(presenceType))
+}
+
+// close closes the stream and the connection.
+func (s *stream) close() error {
+	s.write("</stream:stream>")
+	return s.conn.Close()
+}
+
+// splitJID returns the local part and the domain of a JID.
+func splitJID(jid string) (string, string) {
+	parts := strings.SplitN(bareJID(jid), "@", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+
+	return parts[0], parts[1]
+}
+
+// bareJID returns the JID without its resource.
+func bareJID(jid string) string {
+	if i := strings.Index(jid, "/"); i >= 0 {
+		return jid[:i]
+	}
+
+	return jid
+}
+
+// escape escapes the XML special characters of the given text.
+func escape(text string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
+
+// contains verifies if the slice contains the given value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,392 @@
+package xmpp
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// XMPP contains all variables needed to communicate with a XMPP server such
+	// as Prosody or ejabberd. The bare JID of an authorized user is its name.
+	XMPP struct {
+		// AuthorizedUsers is a authorized users slice.
+		AuthorizedUsers []*provider.User
+
+		// AllowAllUsers disables the authorization check: anyone can talk to
+		// the bot.
+		AllowAllUsers bool
+
+		// RateLimiter limits the number of messages of each user. It is nil when
+		// the messages are not limited.
+		RateLimiter *provider.RateLimiter
+
+		// LogSampler samples the logs of the received messages. It is nil when
+		// every message is logged.
+		LogSampler *provider.LogSampler
+
+		// MinMessageLength is the minimum length of a trimmed text message.
+		MinMessageLength int
+
+		// server is the address of the XMPP server. It defaults to the domain
+		// of the JID.
+		server string
+
+		// jid is the JID of the bot.
+		jid string
+
+		// password is the password of the bot.
+		password string
+
+		// mutex protects the stream.
+		mutex sync.Mutex
+
+		// stream is the current stream. It is nil while disconnected.
+		stream *stream
+
+		// stop is closed when the provider is stopped.
+		stop chan struct{}
+
+		// pendingMessages keeps the received messages that have not been
+		// answered.
+		pendingMessages *provider.PendingMessages
+
+		// IDGenerator generates the UUIDs of the user messages.
+		IDGenerator capsule.IDGenerator
+
+		// userInput is a channel connected to the frontend manager. It is used to
+		// send user messages to that manager.
+		userInput chan<- *provider.CapsuleProvider
+	}
+
+	// message represents user messages.
+	message struct {
+		// uuid is the message uuid.
+		uuid uuid.UUID
+
+		// from is the full JID of the user who sent the message.
+		from string
+	}
+)
+
+const (
+	label = "xmpp"
+
+	// defaultMinMessageLength is the default minimum length of a text message.
+	defaultMinMessageLength = 1
+
+	// minReconnectDelay and maxReconnectDelay bound the delay between two
+	// connection attempts. The delay doubles after each failed attempt.
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+)
+
+var (
+	// logger is a global logger of the package
+	logger = provider.NewLogger(label)
+)
+
+// Initialize initiliazes a provider with the given JID, password, slice of
+// authorized users and user inputs write-only channel.
+func (x *XMPP) Initialize(config *provider.Config) (provider.Provider, error) {
+	logger.Debugf("Initializing %s", label)
+
+	if user, domain := splitJID(config.Username); len(user) == 0 || len(domain) == 0 {
+		return nil, errors.NotValidf("JID %q", config.Username)
+	}
+
+	if len(config.Secret) == 0 {
+		return nil, errors.NotValidf("empty password")
+	}
+
+	minMessageLength := config.MinMessageLength
+	if minMessageLength <= 0 {
+		minMessageLength = defaultMinMessageLength
+	}
+
+	return &XMPP{
+		AuthorizedUsers:  config.AuthorizedUsers,
+		AllowAllUsers:    config.AllowAllUsers,
+		RateLimiter:      provider.NewRateLimiter(config.RateLimit, provider.RateLimitWindow),
+		LogSampler:       provider.NewLogSampler(config.LogSampling),
+		MinMessageLength: minMessageLength,
+		server:           config.Server,
+		jid:              config.Username,
+		password:         config.Secret,
+		stop:             make(chan struct{}),
+		pendingMessages:  provider.NewPendingMessages(),
+		IDGenerator:      capsule.RandomGenerator{},
+		userInput:        config.UserInput,
+	}, nil
+}
+
+// Start connects to the XMPP server and listens to the user messages. The
+// provider reconnects when the connection is lost, until it is stopped.
+func (x *XMPP) Start() {
+	logger.Debugf("Starting %s", label)
+
+	delay := minReconnectDelay
+	for {
+		err := x.listen()
+
+		select {
+		case <-x.stop:
+			return
+		default:
+		}
+
+		if err == nil {
+			delay = minReconnectDelay
+		}
+
+		logger.WithError(err).Warnf("Disconnected, reconnecting in %s", delay)
+
+		select {
+		case <-x.stop:
+			return
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// Message sends the text message to the user.
+func (x *XMPP) Message(capsule *capsule.Capsule) error {
+	pending, err := x.pendingMessages.Take(capsule.OriginalMessage)
+	if err != nil {
+		return err
+	}
+	pendingMessage := pending.(*message)
+
+	if capsule.Error != nil && len(capsule.Error.Error()) > 0 {
+		return x.send(pendingMessage.from, provider.SystemLog(capsule.Error.Error(), provider.ErrorStatus))
+	}
+
+	for _, response := range capsule.Responses {
+		if err := x.send(pendingMessage.from, x.Format(&provider.Output{Text: response})); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Format formats the output as plain text, since chat messages have no
+// markup.
+func (x *XMPP) Format(output *provider.Output) string {
+	return provider.PlainFormatter{}.Format(output)
+}
+
+// Notify sends the text to the given JID.
+func (x *XMPP) Notify(chat string, text string) error {
+	return x.send(chat, text)
+}
+
+// Capabilities returns the capabilities of the provider. Chat messages
+// are plain text.
+func (x *XMPP) Capabilities() *capsule.Capabilities {
+	return &capsule.Capabilities{Buttons: false}
+}
+
+// GetLabel returns the label of the provider
+func (x *XMPP) GetLabel() string {
+	return label
+}
+
+// Stop closes the stream and stops the reconnections.
+func (x *XMPP) Stop() error {
+	close(x.stop)
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if x.stream != nil {
+		if err := x.stream.close(); err != nil {
+			return errors.Annotate(err, "closing stream")
+		}
+	}
+
+	return nil
+}
+
+// listen connects to the server, announces the bot presence and handles the
+// received stanzas until the connection is lost. It returns nil if the
+// connection was established.
+func (x *XMPP) listen() error {
+	s, err := dial(x.server, x.jid, x.password)
+	if err != nil {
+		return err
+	}
+
+	x.mutex.Lock()
+	x.stream = s
+	x.mutex.Unlock()
+
+	defer func() {
+		x.mutex.Lock()
+		x.stream = nil
+		x.mutex.Unlock()
+		s.conn.Close()
+	}()
+
+	logger.Debugf("Connected as %s", s.jid)
+
+	if err := s.sendPresence("", ""); err != nil {
+		logger.WithError(err).Error("Cannot announce presence")
+		return nil
+	}
+
+	for {
+		st, err := s.read()
+		if err != nil {
+			logger.WithError(err).Debug("Stream interrupted")
+			return nil
+		}
+
+		switch st.XMLName.Local {
+		case "presence":
+			x.handlePresence(s, st)
+		case "message":
+			x.handleMessage(st)
+		}
+	}
+}
+
+// handlePresence accepts the subscription requests of the authorized users so
+// they can see the bot presence.
+func (x *XMPP) handlePresence(s *stream, st *stanza) {
+	if st.Type != "subscribe" {
+		return
+	}
+
+	from := bareJID(st.From)
+	if !x.AllowAllUsers && x.authorizedUser(from) == nil {
+		logger.WithField("from", from).Debug("Subscription request received from unauthorized user")
+		return
+	}
+
+	if err := s.sendPresence(from, "subscribed"); err != nil {
+		logger.WithError(err).Error("Cannot accept subscription request")
+	}
+}
+
+// handleMessage handles a message stanza sent by a user.
+func (x *XMPP) handleMessage(st *stanza) {
+	localLogger := logger.WithField("action", "receiving user message")
+
+	// Error stanzas and chat state notifications have no body.
+	if st.Type == "error" || len(st.Body) == 0 {
+		return
+	}
+
+	from := bareJID(st.From)
+	if !x.AllowAllUsers && x.authorizedUser(from) == nil {
+		localLogger.WithFields(log.Fields{
+			"from":    from,
+			"message": st.Body,
+		}).Debug("User message received from unauthorized user")
+		return
+	}
+
+	if x.LogSampler.Sample() {
+		localLogger.WithFields(log.Fields{
+			"from":    from,
+			"message": st.Body,
+		}).Debug("User message received")
+	}
+
+	if !x.RateLimiter.Allow(from) {
+		localLogger.WithField("from", from).Debug("User rate limit exceeded")
+		if err := x.send(st.From, provider.SystemLog(provider.RateLimitMessage, provider.Info)); err != nil {
+			localLogger.WithError(err).Error("Cannot send rate limit message")
+		}
+		return
+	}
+
+	if err := x.processUserMessage(st); err != nil {
+		// If an error occurred, it generates a system log message and sends it to
+		// the user.
+		if err := x.send(st.From, provider.SystemLog(err.Error(), provider.ErrorStatus)); err != nil {
+			localLogger.WithError(err).Error("Cannot send error message")
+		}
+	}
+}
+
+// processUserMessage processes a user message by adding it to the pending
+// messages, converting it to a provider capsule and sending it to the
+// frontend manager.
+func (x *XMPP) processUserMessage(st *stanza) error {
+	// Empty messages are not forwarded since they would be answered with a
+	// useless response.
+	if len([]rune(strings.TrimSpace(st.Body))) < x.MinMessageLength {
+		return x.send(st.From, provider.SystemLog("Please send a message", provider.Info))
+	}
+
+	// Generates a new UUID.
+	uuid, err := x.IDGenerator.New()
+	if err != nil {
+		return errors.Annotate(err, "processing user message")
+	}
+
+	message := &message{
+		uuid: uuid,
+		from: st.From,
+	}
+
+	from := bareJID(st.From)
+	capsuleProvider := &provider.CapsuleProvider{
+		OriginalMessage: message.uuid,
+		ProviderLabel:   label,
+		Content:         st.Body,
+		User:            from,
+		Chat:            st.From,
+	}
+
+	if user := x.authorizedUser(from); user != nil {
+		capsuleProvider.Locale = user.Locale
+		capsuleProvider.Timezone = user.Timezone
+	}
+
+	// Sends the provider capsule-formatted message to the frontend manager,
+	// and keeps the message until it is answered. The user is asked to retry
+	// when the frontend manager is overloaded.
+	if !x.pendingMessages.Forward(x.userInput, capsuleProvider, message) {
+		return x.send(st.From, provider.SystemLog(provider.BusyMessage, provider.Info))
+	}
+
+	return nil
+}
+
+// authorizedUser returns the authorized user matching the given bare JID or
+// nil if the user is not authorized.
+func (x *XMPP) authorizedUser(jid string) *provider.User {
+	for _, user := range x.AuthorizedUsers {
+		if strings.EqualFold(user.Name, jid) {
+			return user
+		}
+	}
+
+	return nil
+}
+
+// send sends a chat message to the given JID on the current stream.
+func (x *XMPP) send(to, text string) error {
+	x.mutex.Lock()
+	s := x.stream
+	x.mutex.Unlock()
+
+	if s == nil {
+		return errors.NotProvisionedf("connection to the XMPP server")
+	}
+
+	return s.sendMessage(to, text)
+}
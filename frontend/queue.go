@@ -0,0 +1,290 @@
+package frontend
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+)
+
+type (
+	// queue is a disk-backed queue of the outbound capsules. It is an
+	// append-only log: a capsule is enqueued before being sent and marked as
+	// delivered once the provider sent it. The capsules not marked as delivered
+	// after a crash are delivered again on startup.
+	queue struct {
+		// mutex protects the file and the pending capsules.
+		mutex sync.Mutex
+
+		// file is the log file.
+		file *os.File
+
+		// pending indexes the capsules not delivered yet by original message.
+		pending map[uuid.UUID]*capsule.Capsule
+
+		// order is a slice containing the pending capsules IDs in enqueuing
+		// order.
+		order []uuid.UUID
+
+		// attempts indexes the number of failed redeliveries of the pending
+		// capsules by original message.
+		attempts map[uuid.UUID]int
+
+		// recovered indexes the pending capsules loaded from the log on
+		// startup, which must be delivered again.
+		recovered map[uuid.UUID]bool
+	}
+
+	// queueEntry is a line of the log file.
+	queueEntry struct {
+		// Operation is either enqueue or done.
+		Operation string `json:"op"`
+
+		// ID is the original message of the capsule.
+		ID uuid.UUID `json:"id"`
+
+		// Capsule is the enqueued capsule.
+		Capsule *capsule.Capsule `json:"capsule,omitempty"`
+
+		// Error is the error message of the capsules enqueued before the
+		// capsule error was serialized with the capsule. It is only read.
+		Error string `json:"error,omitempty"`
+
+		// Attempts is the number of failed redeliveries of the capsule.
+		Attempts int `json:"attempts,omitempty"`
+	}
+)
+
+const (
+	enqueueOperation = "enqueue"
+	doneOperation    = "done"
+
+	// maxRedeliveryAttempts is the maximum number of redeliveries of a
+	// recovered capsule. The capsule is then stored in the dead letter.
+	maxRedeliveryAttempts = 5
+
+	// redeliveryInterval is the interval at which the recovered capsules
+	// which could not be delivered are attempted again, since their provider
+	// may not have been ready (ex: still connecting).
+	redeliveryInterval = 10 * time.Second
+)
+
+// openQueue opens the queue stored in the given file. The log is compacted so
+// it only contains the pending capsules.
+func openQueue(path string) (*queue, error) {
+	q := &queue{
+		pending:   map[uuid.UUID]*capsule.Capsule{},
+		order:     []uuid.UUID{},
+		attempts:  map[uuid.UUID]int{},
+		recovered: map[uuid.UUID]bool{},
+	}
+
+	if err := q.load(path); err != nil {
+		return nil, errors.Annotatef(err, "loading queue %s", path)
+	}
+
+	// Rewrites the pending capsules in a new log which replaces the old one.
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.Annotatef(err, "compacting queue %s", path)
+	}
+
+	q.file = file
+	for _, id := range q.order {
+		q.recovered[id] = true
+		if err := q.append(enqueueEntry(q.pending[id], q.attempts[id])); err != nil {
+			file.Close()
+			return nil, errors.Annotatef(err, "compacting queue %s", path)
+		}
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		file.Close()
+		return nil, errors.Annotatef(err, "compacting queue %s", path)
+	}
+
+	return q, nil
+}
+
+// load reads the log file and computes the pending capsules. A missing file
+// is an empty queue. A truncated last line, written during a crash, is
+// ignored.
+func (q *queue) load(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		entry := queueEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			logger.WithError(err).Warn("Ignoring corrupted queue entry")
+			continue
+		}
+
+		switch entry.Operation {
+		case enqueueOperation:
+			if entry.Capsule == nil {
+				continue
+			}
+
+			if entry.Capsule.Error == nil && len(entry.Error) > 0 {
+				entry.Capsule.Error = errors.New(entry.Error)
+			}
+
+			if _, ok := q.pending[entry.ID]; !ok {
+				q.order = append(q.order, entry.ID)
+			}
+			q.pending[entry.ID] = entry.Capsule
+			q.attempts[entry.ID] = entry.Attempts
+		case doneOperation:
+			q.remove(entry.ID)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// enqueue persists the capsule before it is sent.
+func (q *queue) enqueue(c *capsule.Capsule) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if err := q.append(enqueueEntry(c, q.attempts[c.OriginalMessage])); err != nil {
+		return errors.Annotate(err, "enqueuing capsule")
+	}
+
+	if _, ok := q.pending[c.OriginalMessage]; !ok {
+		q.order = append(q.order, c.OriginalMessage)
+	}
+	q.pending[c.OriginalMessage] = c
+	return nil
+}
+
+// done marks the capsule as delivered.
+func (q *queue) done(c *capsule.Capsule) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if err := q.append(&queueEntry{Operation: doneOperation, ID: c.OriginalMessage}); err != nil {
+		return errors.Annotate(err, "marking capsule as delivered")
+	}
+
+	q.remove(c.OriginalMessage)
+	return nil
+}
+
+// isPending verifies if the capsule is not delivered yet.
+func (q *queue) isPending(c *capsule.Capsule) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	_, ok := q.pending[c.OriginalMessage]
+	return ok
+}
+
+// pendingCapsules returns the capsules not delivered yet, in enqueuing order.
+func (q *queue) pendingCapsules() []*capsule.Capsule {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	capsules := []*capsule.Capsule{}
+	for _, id := range q.order {
+		capsules = append(capsules, q.pending[id])
+	}
+
+	return capsules
+}
+
+// recoveredCapsules returns the capsules loaded from the log on startup and
+// not delivered yet, in enqueuing order.
+func (q *queue) recoveredCapsules() []*capsule.Capsule {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	capsules := []*capsule.Capsule{}
+	for _, id := range q.order {
+		if q.recovered[id] {
+			capsules = append(capsules, q.pending[id])
+		}
+	}
+
+	return capsules
+}
+
+// attempt records a failed redelivery of the capsule and returns the number of
+// failed redeliveries, which survives the restarts.
+func (q *queue) attempt(c *capsule.Capsule) (int, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	attempts := q.attempts[c.OriginalMessage] + 1
+	if err := q.append(enqueueEntry(c, attempts)); err != nil {
+		return attempts, errors.Annotate(err, "recording redelivery attempt")
+	}
+
+	q.attempts[c.OriginalMessage] = attempts
+	return attempts, nil
+}
+
+// close closes the log file.
+func (q *queue) close() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.file.Close()
+}
+
+// append writes an entry at the end of the log and syncs it to the disk.
+func (q *queue) append(entry *queueEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if _, err := q.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	return q.file.Sync()
+}
+
+// remove removes a capsule from the pending capsules.
+func (q *queue) remove(id uuid.UUID) {
+	if _, ok := q.pending[id]; !ok {
+		return
+	}
+
+	delete(q.pending, id)
+	delete(q.attempts, id)
+	delete(q.recovered, id)
+	for i, pendingID := range q.order {
+		if pendingID == id {
+			q.order = append(q.order[:i], q.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// enqueueEntry returns the log entry of an enqueued capsule with its number of
+// failed redeliveries.
+func enqueueEntry(c *capsule.Capsule, attempts int) *queueEntry {
+	return &queueEntry{
+		Operation: enqueueOperation,
+		ID:        c.OriginalMessage,
+		Capsule:   c,
+		Attempts:  attempts,
+	}
+}
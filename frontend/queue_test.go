@@ -0,0 +1,171 @@
+package frontend
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/deadletter"
+	"github.com/google/uuid"
+)
+
+type (
+	// memoryDeadLetter is a dead letter keeping the entries in memory.
+	memoryDeadLetter struct {
+		// mutex protects the entries.
+		mutex sync.Mutex
+
+		// entries is a slice containing the stored entries.
+		entries []*deadletter.Entry
+	}
+)
+
+func (d *memoryDeadLetter) Store(entry *deadletter.Entry) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.entries = append(d.entries, entry)
+	return nil
+}
+
+// stored returns the number of stored entries.
+func (d *memoryDeadLetter) stored() int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return len(d.entries)
+}
+
+// pendingCapsule returns a response to redeliver to the chat of the fake
+// provider.
+func pendingCapsule(response string) *capsule.Capsule {
+	return &capsule.Capsule{
+		OriginalMessage:  uuid.New(),
+		FrontendProvider: "fake",
+		User:             "alice",
+		Chat:             "42",
+		Responses:        []string{response},
+	}
+}
+
+// reopen closes the queue, as if the application crashed, and opens it again.
+func reopen(t *testing.T, q *queue, path string) *queue {
+	t.Helper()
+
+	if err := q.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := openQueue(path)
+	if err != nil {
+		t.Fatalf("openQueue() error = %v", err)
+	}
+
+	return q
+}
+
+func TestQueueCrashRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+	q, err := openQueue(path)
+	if err != nil {
+		t.Fatalf("openQueue() error = %v", err)
+	}
+
+	delivered, pending := pendingCapsule("delivered"), pendingCapsule("pending")
+	for _, c := range []*capsule.Capsule{delivered, pending} {
+		if err := q.enqueue(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := q.done(delivered); err != nil {
+		t.Fatal(err)
+	}
+
+	// The application restarts with the pending capsule.
+	q = reopen(t, q, path)
+	recovered := q.recoveredCapsules()
+	if len(recovered) != 1 || recovered[0].OriginalMessage != pending.OriginalMessage {
+		t.Fatalf("recovered capsules = %v, want the pending capsule", recovered)
+	}
+
+	p := newFakeProvider("fake")
+	f, _, _, _ := newTestFrontend(p)
+	f.queue = q
+	f.redeliver()
+
+	if want := []string{"pending"}; !reflect.DeepEqual(p.notified, want) {
+		t.Errorf("notified = %v, want %v", p.notified, want)
+	}
+
+	// The redelivered capsule is not delivered again on the next restart.
+	q = reopen(t, q, path)
+	defer q.close()
+	if pending := q.pendingCapsules(); len(pending) != 0 {
+		t.Errorf("pending capsules = %v, want none", pending)
+	}
+}
+
+func TestQueueRedeliveryAttempts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+	q, err := openQueue(path)
+	if err != nil {
+		t.Fatalf("openQueue() error = %v", err)
+	}
+
+	if err := q.enqueue(pendingCapsule("pending")); err != nil {
+		t.Fatal(err)
+	}
+	q = reopen(t, q, path)
+
+	// The provider is not ready: the capsule stays pending.
+	p := newFakeProvider("fake")
+	p.notifyErr = errors.New("not connected")
+	deadLetter := &memoryDeadLetter{}
+	f, _, _, _ := newTestFrontend(p)
+	f.queue = q
+	f.deadLetter = deadLetter
+	f.redeliver()
+
+	if pending := q.recoveredCapsules(); len(pending) != 1 {
+		t.Fatalf("recovered capsules = %v, want the pending capsule", pending)
+	}
+
+	// The attempts survive the restarts.
+	q = reopen(t, q, path)
+	defer func() { q.close() }()
+	f.queue = q
+	for i := 1; i < maxRedeliveryAttempts; i++ {
+		f.redeliver()
+	}
+
+	if pending := q.pendingCapsules(); len(pending) != 0 {
+		t.Errorf("pending capsules = %v, want none after %d attempts", pending, maxRedeliveryAttempts)
+	}
+
+	if stored := deadLetter.stored(); stored != 1 {
+		t.Errorf("%d dead letters, want 1", stored)
+	}
+}
+
+func TestQueueSkipsCapsulesOfTheRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+	q, err := openQueue(path)
+	if err != nil {
+		t.Fatalf("openQueue() error = %v", err)
+	}
+	defer q.close()
+
+	// A capsule enqueued during the run is delivered by its retries, not by
+	// the redelivery of the recovered capsules.
+	if err := q.enqueue(pendingCapsule("retrying")); err != nil {
+		t.Fatal(err)
+	}
+
+	if recovered := q.recoveredCapsules(); len(recovered) != 0 {
+		t.Errorf("recovered capsules = %v, want none", recovered)
+	}
+}
@@ -0,0 +1,169 @@
+package frontend
+
+import (
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/juju/errors"
+)
+
+type (
+	// QuietHours is a daily window during which the proactive messages of a
+	// provider (notifications, redelivered responses) are not sent. The direct
+	// replies to user messages are never held.
+	QuietHours struct {
+		// Start and End are the bounds of the window (ex: 22:00 and 07:00). The
+		// window spans midnight when End is before Start.
+		Start string `json:"start" yaml:"start"`
+		End   string `json:"end" yaml:"end"`
+
+		// Timezone is the IANA timezone of the bounds (ex: Europe/Paris). It
+		// defaults to UTC.
+		Timezone string `json:"timezone" yaml:"timezone"`
+
+		// Queue holds the proactive messages until the end of the window. They
+		// are dropped when it is false.
+		Queue bool `json:"queue" yaml:"queue"`
+	}
+
+	// quietHours is a parsed quiet hours window.
+	quietHours struct {
+		// start and end are the bounds of the window as offsets from midnight.
+		start time.Duration
+		end   time.Duration
+
+		// location is the timezone of the bounds.
+		location *time.Location
+
+		// queue is true when the messages are held until the end of the
+		// window.
+		queue bool
+	}
+)
+
+const (
+	// quietHoursLayout is the layout of the quiet hours bounds.
+	quietHoursLayout = "15:04"
+
+	// quietHoursFlushInterval is the interval at which the held proactive
+	// messages are sent once their quiet hours are over.
+	quietHoursFlushInterval = time.Minute
+)
+
+// newQuietHours parses the quiet hours configuration.
+func newQuietHours(config *QuietHours) (*quietHours, error) {
+	start, err := time.Parse(quietHoursLayout, config.Start)
+	if err != nil {
+		return nil, errors.NotValidf("quiet hours start %q", config.Start)
+	}
+
+	end, err := time.Parse(quietHoursLayout, config.End)
+	if err != nil {
+		return nil, errors.NotValidf("quiet hours end %q", config.End)
+	}
+
+	location, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		return nil, errors.NotValidf("quiet hours timezone %q", config.Timezone)
+	}
+
+	return &quietHours{
+		start:    time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute,
+		end:      time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute,
+		location: location,
+		queue:    config.Queue,
+	}, nil
+}
+
+// contains verifies if the given time is in the window. A window whose bounds
+// are equal is empty.
+func (q *quietHours) contains(t time.Time) bool {
+	local := t.In(q.location)
+	offset := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute
+
+	if q.start <= q.end {
+		return offset >= q.start && offset < q.end
+	}
+
+	return offset >= q.start || offset < q.end
+}
+
+// loadQuietHours returns the quiet hours of the activated providers, indexed
+// by provider label.
+func loadQuietHours(providerConfig []*ProviderConfig) (map[string]*quietHours, error) {
+	windows := map[string]*quietHours{}
+	for _, pc := range providerConfig {
+		if !pc.IsActivated || pc.QuietHours == nil {
+			continue
+		}
+
+		q, err := newQuietHours(pc.QuietHours)
+		if err != nil {
+			return nil, errors.Annotatef(err, "loading quiet hours of %s", pc.Label)
+		}
+
+		windows[pc.Label] = q
+	}
+
+	return windows, nil
+}
+
+// isQuiet verifies if the proactive messages of the given provider must be
+// held now. It returns the quiet hours of the provider.
+func (f *Frontend) isQuiet(providerLabel string) (*quietHours, bool) {
+	q, ok := f.quietHours[providerLabel]
+	if !ok {
+		return nil, false
+	}
+
+	return q, q.contains(time.Now())
+}
+
+// hold holds a proactive capsule during the quiet hours: it is kept in memory
+// until the end of the window, or dropped if the provider does not queue. It
+// returns true when the capsule is held.
+func (f *Frontend) hold(q *quietHours, c *capsule.Capsule) bool {
+	if !q.queue {
+		logger.WithField("provider", c.FrontendProvider).Debug("Dropping proactive message during quiet hours")
+		return false
+	}
+
+	logger.WithField("provider", c.FrontendProvider).Debug("Holding proactive message until the end of the quiet hours")
+	f.held = append(f.held, c)
+	return true
+}
+
+// isHeld verifies if the capsule is held until the end of the quiet hours.
+func (f *Frontend) isHeld(c *capsule.Capsule) bool {
+	for _, held := range f.held {
+		if held.OriginalMessage == c.OriginalMessage {
+			return true
+		}
+	}
+
+	return false
+}
+
+// flushHeld sends the held capsules whose quiet hours are over. The held
+// capsules recovered from the outbound queue are marked as delivered once
+// sent. The ones which cannot be sent stay pending, and are redelivered later.
+func (f *Frontend) flushHeld() {
+	capsules := f.held
+	f.held = nil
+
+	for _, c := range capsules {
+		held, err := f.notify(c)
+		if err != nil {
+			logger.WithError(err).Warnf("Cannot send held capsule %s", c.OriginalMessage)
+			continue
+		}
+
+		if held || f.queue == nil || !f.queue.isPending(c) {
+			continue
+		}
+
+		if err := f.queue.done(c); err != nil {
+			logger.WithError(err).Error("Cannot mark held capsule")
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package frontend
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/google/uuid"
+)
+
+// window returns quiet hours from the given offsets of the current time, in
+// UTC.
+func window(t *testing.T, from, to time.Duration, queue bool) *quietHours {
+	t.Helper()
+
+	now := time.Now().UTC()
+	q, err := newQuietHours(&QuietHours{
+		Start:    now.Add(from).Format(quietHoursLayout),
+		End:      now.Add(to).Format(quietHoursLayout),
+		Timezone: "UTC",
+		Queue:    queue,
+	})
+	if err != nil {
+		t.Fatalf("newQuietHours() error = %v", err)
+	}
+
+	return q
+}
+
+func TestQuietHoursContains(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *QuietHours
+		time   string
+		quiet  bool
+	}{
+		{"before a night window", &QuietHours{Start: "22:00", End: "07:00", Timezone: "Europe/Paris"}, "2020-01-15T20:59:00Z", false},
+		{"start of a night window", &QuietHours{Start: "22:00", End: "07:00", Timezone: "Europe/Paris"}, "2020-01-15T21:00:00Z", true},
+		{"after midnight", &QuietHours{Start: "22:00", End: "07:00", Timezone: "Europe/Paris"}, "2020-01-15T23:30:00Z", true},
+		{"before the end", &QuietHours{Start: "22:00", End: "07:00", Timezone: "Europe/Paris"}, "2020-01-16T05:59:00Z", true},
+		{"end of a night window", &QuietHours{Start: "22:00", End: "07:00", Timezone: "Europe/Paris"}, "2020-01-16T06:00:00Z", false},
+		{"daylight saving time", &QuietHours{Start: "22:00", End: "07:00", Timezone: "Europe/Paris"}, "2020-07-15T20:00:00Z", true},
+		{"in a day window", &QuietHours{Start: "12:00", End: "14:00"}, "2020-01-15T13:00:00Z", true},
+		{"after a day window", &QuietHours{Start: "12:00", End: "14:00"}, "2020-01-15T14:00:00Z", false},
+		{"empty window", &QuietHours{Start: "10:00", End: "10:00"}, "2020-01-15T10:00:00Z", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := newQuietHours(tt.config)
+			if err != nil {
+				t.Fatalf("newQuietHours() error = %v", err)
+			}
+
+			at, err := time.Parse(time.RFC3339, tt.time)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if quiet := q.contains(at); quiet != tt.quiet {
+				t.Errorf("contains(%s) = %t, want %t", tt.time, quiet, tt.quiet)
+			}
+		})
+	}
+}
+
+func TestNewQuietHoursInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *QuietHours
+	}{
+		{"start", &QuietHours{Start: "10pm", End: "07:00"}},
+		{"end", &QuietHours{Start: "22:00", End: "25:00"}},
+		{"timezone", &QuietHours{Start: "22:00", End: "07:00", Timezone: "Mars/Olympus"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newQuietHours(tt.config); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestQuietHoursQueue(t *testing.T) {
+	p := newFakeProvider("fake")
+	f, _, _, _ := newTestFrontend(p)
+	f.quietHours["fake"] = window(t, -time.Hour, time.Hour, true)
+
+	c := &capsule.Capsule{OriginalMessage: uuid.New(), FrontendProvider: "fake", Chat: "42", Responses: []string{"Reminder"}, Proactive: true}
+	if held, err := f.notify(c); err != nil || !held {
+		t.Fatalf("notify() = %t, %v, want the message held", held, err)
+	}
+
+	if notified := p.notifications(); len(notified) != 0 {
+		t.Errorf("notified = %v, want the message held", notified)
+	}
+
+	// The held message is not sent while the quiet hours last.
+	f.flushHeld()
+	if notified := p.notifications(); len(notified) != 0 {
+		t.Errorf("notified = %v, want the message still held", notified)
+	}
+
+	// The morning comes.
+	f.quietHours["fake"] = window(t, time.Hour, 2*time.Hour, true)
+	f.flushHeld()
+
+	if notified := p.notifications(); len(notified) != 1 || notified[0] != "Reminder" {
+		t.Errorf("notified = %v, want the held message", notified)
+	}
+
+	if len(f.held) != 0 {
+		t.Errorf("held = %v, want none", f.held)
+	}
+}
+
+func TestQuietHoursDrop(t *testing.T) {
+	p := newFakeProvider("fake")
+	f, _, _, _ := newTestFrontend(p)
+	f.quietHours["fake"] = window(t, -time.Hour, time.Hour, false)
+
+	c := &capsule.Capsule{OriginalMessage: uuid.New(), FrontendProvider: "fake", Chat: "42", Responses: []string{"Reminder"}, Proactive: true}
+	if held, err := f.notify(c); err != nil || held {
+		t.Fatalf("notify() = %t, %v, want the message dropped", held, err)
+	}
+
+	if len(f.held) != 0 || len(p.notifications()) != 0 {
+		t.Errorf("held = %v and notified = %v, want the message dropped", f.held, p.notifications())
+	}
+}
+
+func TestQuietHoursDirectReply(t *testing.T) {
+	p := newFakeProvider("fake")
+	f, _, _, _ := newTestFrontend(p)
+	f.quietHours["fake"] = window(t, -time.Hour, time.Hour, true)
+
+	c := &capsule.Capsule{OriginalMessage: uuid.New(), FrontendProvider: "fake", Responses: []string{"Hello"}}
+	if err := f.message(c); err != nil {
+		t.Fatalf("message() error = %v", err)
+	}
+
+	if deliveries := p.deliveries(); len(deliveries) != 1 {
+		t.Errorf("delivered capsules = %v, want the direct reply", deliveries)
+	}
+}
+
+func TestQuietHoursRedelivery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+	q, err := openQueue(path)
+	if err != nil {
+		t.Fatalf("openQueue() error = %v", err)
+	}
+
+	if err := q.enqueue(pendingCapsule("pending")); err != nil {
+		t.Fatal(err)
+	}
+	q = reopen(t, q, path)
+	defer func() { q.close() }()
+
+	p := newFakeProvider("fake")
+	f, _, _, _ := newTestFrontend(p)
+	f.queue = q
+	f.quietHours["fake"] = window(t, -time.Hour, time.Hour, true)
+
+	// The recovered capsule is held once, and stays pending until it is sent.
+	f.redeliver()
+	f.redeliver()
+	if len(f.held) != 1 || len(p.notifications()) != 0 {
+		t.Fatalf("held = %v and notified = %v, want the capsule held once", f.held, p.notifications())
+	}
+
+	if pending := q.pendingCapsules(); len(pending) != 1 {
+		t.Fatalf("pending capsules = %v, want the held capsule", pending)
+	}
+
+	// The morning comes.
+	f.quietHours["fake"] = window(t, time.Hour, 2*time.Hour, true)
+	f.flushHeld()
+
+	if notified := p.notifications(); len(notified) != 1 || notified[0] != "pending" {
+		t.Errorf("notified = %v, want the held capsule", notified)
+	}
+
+	q = reopen(t, q, path)
+	if pending := q.pendingCapsules(); len(pending) != 0 {
+		t.Errorf("pending capsules = %v, want none", pending)
+	}
+}
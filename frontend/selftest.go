@@ -0,0 +1,151 @@
+package frontend
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+)
+
+type (
+	// selfTest is a self-test waiting for the response of the backend.
+	selfTest struct {
+		// userInput is the command of the operator who ran the self-test.
+		userInput *provider.CapsuleProvider
+
+		// start is the time at which the synthetic capsule was sent.
+		start time.Time
+
+		// timer reports the failure of the self-test once selfTestTimeout is
+		// reached.
+		timer *time.Timer
+	}
+)
+
+const (
+	// selfTestMessage is the canned message sent through the backend.
+	selfTestMessage = "Hello"
+
+	// selfTestUser is the user of the synthetic capsules.
+	selfTestUser = "selftest"
+
+	// selfTestTimeout is the duration after which a self-test without
+	// response fails.
+	selfTestTimeout = 30 * time.Second
+
+	// selfTestBufferSize is the size of the buffer of the expired self-tests.
+	selfTestBufferSize = 16
+)
+
+// loadOperatorUsers returns the operator users of the activated providers,
+// indexed by provider label.
+func loadOperatorUsers(providerConfig []*ProviderConfig) map[string]map[string]bool {
+	operatorUsers := map[string]map[string]bool{}
+	for _, pc := range providerConfig {
+		if !pc.IsActivated || len(pc.OperatorUsers) == 0 {
+			continue
+		}
+
+		users := map[string]bool{}
+		for _, user := range pc.OperatorUsers {
+			users[user] = true
+		}
+
+		operatorUsers[pc.Label] = users
+	}
+
+	return operatorUsers
+}
+
+// isOperator verifies if the user of the given input is an operator of its
+// provider.
+func (f *Frontend) isOperator(userInput *provider.CapsuleProvider) bool {
+	return f.operatorUsers[userInput.ProviderLabel][userInput.User]
+}
+
+// selfTestCommand sends a canned message through the whole backend pipeline.
+// The result is reported to the operator once the backend responded, or once
+// selfTestTimeout is reached. It is restricted to the operator users.
+func selfTestCommand(f *Frontend, userInput *provider.CapsuleProvider) error {
+	if !f.isOperator(userInput) {
+		return f.reply(userInput, provider.SystemLog("This command is restricted to operators", provider.ErrorStatus))
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return errors.Annotate(err, "running self-test")
+	}
+
+	c := &capsule.Capsule{
+		OriginalMessage:  id,
+		FrontendProvider: userInput.ProviderLabel,
+		User:             selfTestUser,
+		Content:          selfTestMessage,
+	}
+	c.SetContext(f.ctx)
+
+	f.selfTests[id] = &selfTest{
+		userInput: userInput,
+		start:     time.Now(),
+		timer: time.AfterFunc(selfTestTimeout, func() {
+			select {
+			case f.expiredSelfTests <- id:
+			default:
+			}
+		}),
+	}
+
+	f.submit(c)
+	return nil
+}
+
+// finishSelfTest reports the result of the self-test of the given capsule. It
+// returns false if the capsule is not a self-test, in which case it must be
+// delivered as usual. A nil capsule reports an expired self-test.
+func (f *Frontend) finishSelfTest(id uuid.UUID, c *capsule.Capsule) (bool, error) {
+	test, ok := f.selfTests[id]
+	if !ok {
+		return false, nil
+	}
+
+	test.timer.Stop()
+	delete(f.selfTests, id)
+
+	latency := time.Since(test.start).Round(time.Millisecond)
+	var report string
+	switch {
+	case c == nil:
+		report = fmt.Sprintf("Self-test failed: no response from the backend within %s", selfTestTimeout)
+	case c.Error != nil:
+		report = fmt.Sprintf("Self-test failed after %s: %s", latency, c.Error)
+	case c.Stream != nil:
+		// The streamed response is not displayed: it is discarded.
+		go func() {
+			for range c.Stream {
+			}
+		}()
+		report = fmt.Sprintf("Self-test passed: the backend started streaming a response in %s", latency)
+	default:
+		report = fmt.Sprintf("Self-test passed: the backend sent %d responses in %s", len(c.Responses), latency)
+	}
+
+	return true, f.reply(test.userInput, provider.SystemLog(report, provider.Info))
+}
+
+// reply answers the given user input with the text.
+func (f *Frontend) reply(userInput *provider.CapsuleProvider, text string) error {
+	for _, p := range f.activatedProviders {
+		if p.GetLabel() != userInput.ProviderLabel {
+			continue
+		}
+
+		c := toCapsule(userInput)
+		c.Responses = []string{text}
+		return p.Message(c)
+	}
+
+	return errors.NotFoundf("frontend provider %s", userInput.ProviderLabel)
+}
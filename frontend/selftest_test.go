@@ -0,0 +1,79 @@
+package frontend
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	backendprovider "github.com/fberrez/samantha/backend/provider"
+	"github.com/fberrez/samantha/backend/provider/echo"
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/google/uuid"
+)
+
+// echoBackend answers the capsules sent to the backend with the echo
+// provider until toBackend is closed.
+func echoBackend(toBackend <-chan *capsule.Capsule, toFrontend chan<- *capsule.Capsule) {
+	e := &echo.Echo{}
+	for c := range toBackend {
+		response, err := e.Message(context.Background(), &backendprovider.Input{User: c.User, Text: c.Content})
+		if err != nil {
+			c.Error = err
+		} else {
+			for _, output := range response.Outputs {
+				c.Responses = append(c.Responses, output.Text)
+			}
+		}
+
+		toFrontend <- c
+	}
+}
+
+// runSelfTest runs the self-test command as the given user and returns the
+// response of the frontend.
+func runSelfTest(t *testing.T, user string) string {
+	t.Helper()
+
+	p := newFakeProvider("fake")
+	f, userInput, toBackend, toFrontend := newTestFrontend(p)
+	f.operatorUsers = loadOperatorUsers([]*ProviderConfig{{Label: "fake", IsActivated: true, OperatorUsers: []string{"alice"}}})
+	go echoBackend(toBackend, toFrontend)
+	done := startFrontend(f)
+	defer func() {
+		close(userInput)
+		<-done
+		close(toBackend)
+	}()
+
+	userInput <- &provider.CapsuleProvider{OriginalMessage: uuid.New(), ProviderLabel: "fake", User: user, Content: "/selftest"}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(p.deliveries()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("self-test not reported")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	deliveries := p.deliveries()
+	if len(deliveries) != 1 || deliveries[0].User != user || len(deliveries[0].Responses) != 1 {
+		t.Fatalf("deliveries = %+v, want a single report to %s", deliveries, user)
+	}
+
+	return deliveries[0].Responses[0]
+}
+
+func TestSelfTest(t *testing.T) {
+	if report := runSelfTest(t, "alice"); !strings.Contains(report, "Self-test passed: the backend sent 1 responses") {
+		t.Errorf("report = %q, want a success", report)
+	}
+}
+
+func TestSelfTestRestricted(t *testing.T) {
+	if report := runSelfTest(t, "bob"); !strings.Contains(report, "restricted to operators") {
+		t.Errorf("report = %q, want the command refused", report)
+	}
+}
@@ -0,0 +1,107 @@
+package frontend
+
+import (
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/google/uuid"
+	"github.com/juju/errors"
+)
+
+type (
+	// slowResponse is the interim message sent to the user when the backend
+	// is slow to answer.
+	slowResponse struct {
+		// threshold is the duration after which the interim message is sent.
+		threshold time.Duration
+
+		// message is the interim message.
+		message string
+	}
+)
+
+const (
+	// defaultSlowResponseMessage is the default interim message.
+	defaultSlowResponseMessage = "Still working on it…"
+
+	// slowBufferSize is the size of the buffer of the capsules whose response
+	// is late.
+	slowBufferSize = 16
+)
+
+// loadSlowResponses returns the interim messages of the activated providers,
+// indexed by provider label.
+func loadSlowResponses(providerConfig []*ProviderConfig) map[string]*slowResponse {
+	slowResponses := map[string]*slowResponse{}
+	for _, pc := range providerConfig {
+		if !pc.IsActivated || pc.SlowResponseThreshold <= 0 {
+			continue
+		}
+
+		message := pc.SlowResponseMessage
+		if len(message) == 0 {
+			message = defaultSlowResponseMessage
+		}
+
+		slowResponses[pc.Label] = &slowResponse{
+			threshold: pc.SlowResponseThreshold,
+			message:   message,
+		}
+	}
+
+	return slowResponses
+}
+
+// watch starts the timer of the given capsule sent to the backend. The
+// capsule is sent on the slow channel if the response has not arrived when
+// the threshold of its provider is reached.
+func (f *Frontend) watch(c *capsule.Capsule) {
+	s, ok := f.slowResponses[c.FrontendProvider]
+	if !ok {
+		return
+	}
+
+	f.waiting[c.OriginalMessage] = time.AfterFunc(s.threshold, func() {
+		// The interim message is not worth blocking the timer: it is skipped
+		// when the frontend is overloaded.
+		select {
+		case f.slow <- c:
+		default:
+		}
+	})
+}
+
+// unwatch stops the timer of the given original message once its response
+// arrived.
+func (f *Frontend) unwatch(originalMessage uuid.UUID) {
+	if timer, ok := f.waiting[originalMessage]; ok {
+		timer.Stop()
+		delete(f.waiting, originalMessage)
+	}
+}
+
+// sendInterim sends the interim message to the user of the given capsule,
+// unless its response arrived in the meantime. It is sent once per capsule.
+func (f *Frontend) sendInterim(c *capsule.Capsule) error {
+	if _, ok := f.waiting[c.OriginalMessage]; !ok {
+		return nil
+	}
+
+	delete(f.waiting, c.OriginalMessage)
+
+	for _, p := range f.activatedProviders {
+		if p.GetLabel() != c.FrontendProvider {
+			continue
+		}
+
+		notifier, ok := p.(provider.Notifier)
+		if !ok {
+			return errors.NotSupportedf("notification by frontend provider %s", c.FrontendProvider)
+		}
+
+		return notifier.Notify(c.Chat, f.slowResponses[c.FrontendProvider].message)
+	}
+
+	return errors.NotFoundf("frontend provider %s", c.FrontendProvider)
+}
@@ -0,0 +1,78 @@
+package frontend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/google/uuid"
+)
+
+func TestLoadSlowResponses(t *testing.T) {
+	slowResponses := loadSlowResponses([]*ProviderConfig{
+		{Label: "telegram", IsActivated: true, SlowResponseThreshold: time.Second},
+		{Label: "sms", IsActivated: true, SlowResponseThreshold: time.Second, SlowResponseMessage: "Hold on"},
+		{Label: "web", IsActivated: true},
+		{Label: "mail", IsActivated: false, SlowResponseThreshold: time.Second},
+	})
+
+	if len(slowResponses) != 2 {
+		t.Fatalf("slow responses = %v, want telegram and sms", slowResponses)
+	}
+
+	if s := slowResponses["telegram"]; s == nil || s.message != defaultSlowResponseMessage || s.threshold != time.Second {
+		t.Errorf("telegram = %+v, want the default message", s)
+	}
+
+	if s := slowResponses["sms"]; s == nil || s.message != "Hold on" {
+		t.Errorf("sms = %+v, want the configured message", s)
+	}
+}
+
+// exchangeSlowly sends a user input to the frontend and answers it after the
+// given delay. It returns the provider once the frontend stopped.
+func exchangeSlowly(t *testing.T, threshold, delay time.Duration) *fakeProvider {
+	p := newFakeProvider("fake")
+	f, userInput, toBackend, toFrontend := newTestFrontend(p)
+	f.slowResponses["fake"] = &slowResponse{threshold: threshold, message: defaultSlowResponseMessage}
+	done := startFrontend(f)
+
+	userInput <- &provider.CapsuleProvider{OriginalMessage: uuid.New(), ProviderLabel: "fake", User: "alice", Content: "hello"}
+
+	var sent *capsule.Capsule
+	select {
+	case sent = <-toBackend:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no capsule sent to the backend")
+	}
+
+	time.Sleep(delay)
+	sent.Responses = []string{"Hello alice"}
+	toFrontend <- sent
+	close(userInput)
+	<-done
+
+	if deliveries := p.deliveries(); len(deliveries) != 1 {
+		t.Errorf("delivered capsules = %v, want the response", deliveries)
+	}
+
+	return p
+}
+
+func TestSlowResponse(t *testing.T) {
+	p := exchangeSlowly(t, 20*time.Millisecond, 200*time.Millisecond)
+
+	// The interim message is sent once, however long the backend takes.
+	if notified := p.notifications(); len(notified) != 1 || notified[0] != defaultSlowResponseMessage {
+		t.Errorf("notifications = %q, want the interim message once", notified)
+	}
+}
+
+func TestFastResponse(t *testing.T) {
+	p := exchangeSlowly(t, time.Second, 0)
+
+	if notified := p.notifications(); len(notified) != 0 {
+		t.Errorf("notifications = %q, want none for a fast response", notified)
+	}
+}
@@ -0,0 +1,120 @@
+package frontend
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/config"
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultSpellLanguage is the key of the spelling dictionary words shared
+	// by every language.
+	defaultSpellLanguage = "default"
+)
+
+var (
+	// spellCorrectorsMutex protects the spellCorrectors map.
+	spellCorrectorsMutex sync.Mutex
+
+	// spellCorrectors indexes the spell correctors registered with
+	// RegisterSpellCorrector by provider label.
+	spellCorrectors = map[string]provider.SpellCorrector{}
+)
+
+// RegisterSpellCorrector registers the spell corrector of the messages of the
+// given provider, used for every language instead of its spelling
+// dictionary. It must be called before New.
+func RegisterSpellCorrector(providerLabel string, corrector provider.SpellCorrector) {
+	spellCorrectorsMutex.Lock()
+	defer spellCorrectorsMutex.Unlock()
+
+	spellCorrectors[strings.ToLower(providerLabel)] = corrector
+}
+
+// registeredSpellCorrector returns the spell corrector of the given provider,
+// or nil if none is registered.
+func registeredSpellCorrector(providerLabel string) provider.SpellCorrector {
+	spellCorrectorsMutex.Lock()
+	defer spellCorrectorsMutex.Unlock()
+
+	return spellCorrectors[providerLabel]
+}
+
+// loadSpellCorrectors returns the spell correctors of the activated
+// providers, indexed by provider label and language. The spelling dictionary
+// of a provider maps the languages to their words: the corrector of a
+// language knows its words and the default words. The providers without
+// registered corrector nor dictionary do not correct the messages.
+func loadSpellCorrectors(providerConfig []*ProviderConfig) (map[string]map[string]provider.SpellCorrector, error) {
+	correctors := map[string]map[string]provider.SpellCorrector{}
+	for _, pc := range providerConfig {
+		if !pc.IsActivated {
+			continue
+		}
+
+		if corrector := registeredSpellCorrector(pc.Label); corrector != nil {
+			correctors[pc.Label] = map[string]provider.SpellCorrector{defaultSpellLanguage: corrector}
+			continue
+		}
+
+		if len(pc.SpellDictionaryFile) == 0 {
+			continue
+		}
+
+		dictionary := map[string][]string{}
+		if err := config.Decode(pc.SpellDictionaryFile, &dictionary); err != nil {
+			return nil, errors.Annotatef(err, "loading spelling dictionary of %s", pc.Label)
+		}
+
+		correctors[pc.Label] = map[string]provider.SpellCorrector{}
+		for language, words := range dictionary {
+			if language != defaultSpellLanguage {
+				words = append(append([]string{}, words...), dictionary[defaultSpellLanguage]...)
+			}
+
+			correctors[pc.Label][strings.ToLower(language)] = provider.NewDictionaryCorrector(words)
+		}
+	}
+
+	return correctors, nil
+}
+
+// correctSpelling corrects the content of the capsule with the corrector of
+// its provider and the language of its locale, or the default corrector of the
+// provider. The raw content is kept in the capsule when it is corrected.
+func (f *Frontend) correctSpelling(c *capsule.Capsule) {
+	correctors, ok := f.spellCorrectors[c.FrontendProvider]
+	if !ok || len(c.Content) == 0 {
+		return
+	}
+
+	language := strings.ToLower(c.Locale)
+	if i := strings.IndexAny(language, "_-"); i >= 0 {
+		language = language[:i]
+	}
+
+	corrector, ok := correctors[language]
+	if !ok {
+		if corrector, ok = correctors[defaultSpellLanguage]; !ok {
+			return
+		}
+	}
+
+	corrected := corrector.Correct(c.Content)
+	if corrected == c.Content {
+		return
+	}
+
+	logger.WithFields(log.Fields{
+		"provider":  c.FrontendProvider,
+		"raw":       c.Content,
+		"corrected": corrected,
+	}).Debug("Message spelling corrected")
+
+	c.RawContent, c.Content = c.Content, corrected
+}
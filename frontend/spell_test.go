@@ -0,0 +1,77 @@
+package frontend
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/frontend/provider"
+	"github.com/google/uuid"
+)
+
+// newSpellingFrontend returns a frontend correcting the messages of the fake
+// provider with the sample spelling dictionary.
+func newSpellingFrontend(t *testing.T) (*Frontend, chan<- *provider.CapsuleProvider, <-chan *capsule.Capsule) {
+	t.Helper()
+
+	f, userInput, toBackend, _ := newTestFrontend(newFakeProvider("fake"))
+	correctors, err := loadSpellCorrectors([]*ProviderConfig{
+		{Label: "fake", IsActivated: true, SpellDictionaryFile: "spelling.blank.yaml"},
+		{Label: "other", IsActivated: true},
+	})
+	if err != nil {
+		t.Fatalf("loadSpellCorrectors() error = %v", err)
+	}
+
+	if _, ok := correctors["other"]; ok {
+		t.Error("corrector loaded for a provider without dictionary")
+	}
+
+	f.spellCorrectors = correctors
+	return f, userInput, toBackend
+}
+
+func TestCorrectSpelling(t *testing.T) {
+	tests := []struct {
+		name      string
+		locale    string
+		content   string
+		corrected string
+	}{
+		{"english", "en_US", "wether tomorow", "weather tomorrow"},
+		{"french", "fr-FR", "méteo demin", "météo demain"},
+		{"default words", "fr_FR", "samanta", "samantha"},
+		{"words of another language", "en_US", "demin", "demin"},
+		{"unknown language", "de_DE", "samanta wether", "samantha wether"},
+		{"correct message", "en_US", "weather", "weather"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, _, toBackend := newSpellingFrontend(t)
+
+			f.sendToBackend(&provider.CapsuleProvider{OriginalMessage: uuid.New(), ProviderLabel: "fake", User: "alice", Locale: tt.locale, Content: tt.content})
+			c := <-toBackend
+			if c.Content != tt.corrected {
+				t.Errorf("content = %q, want %q", c.Content, tt.corrected)
+			}
+
+			// The raw content is kept for the logs when it is corrected.
+			wantRaw := ""
+			if tt.corrected != tt.content {
+				wantRaw = tt.content
+			}
+
+			if c.RawContent != wantRaw {
+				t.Errorf("raw content = %q, want %q", c.RawContent, wantRaw)
+			}
+		})
+	}
+}
+
+func TestLoadSpellCorrectorsInvalid(t *testing.T) {
+	_, err := loadSpellCorrectors([]*ProviderConfig{{Label: "fake", IsActivated: true, SpellDictionaryFile: filepath.Join(t.TempDir(), "missing.yaml")}})
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,35 @@
+package frontend
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/fberrez/samantha/frontend/provider"
+)
+
+var (
+	// synthesizersMutex protects the synthesizers map.
+	synthesizersMutex sync.Mutex
+
+	// synthesizers indexes the synthesizers registered with
+	// RegisterSynthesizer by provider label.
+	synthesizers = map[string]provider.Synthesizer{}
+)
+
+// RegisterSynthesizer registers the synthesizer converting the responses of
+// the given provider to voice messages. It must be called before New.
+func RegisterSynthesizer(providerLabel string, synthesizer provider.Synthesizer) {
+	synthesizersMutex.Lock()
+	defer synthesizersMutex.Unlock()
+
+	synthesizers[strings.ToLower(providerLabel)] = synthesizer
+}
+
+// registeredSynthesizer returns the synthesizer of the given provider, or nil
+// if none is registered.
+func registeredSynthesizer(providerLabel string) provider.Synthesizer {
+	synthesizersMutex.Lock()
+	defer synthesizersMutex.Unlock()
+
+	return synthesizers[providerLabel]
+}
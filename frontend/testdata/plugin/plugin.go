@@ -0,0 +1,42 @@
+// Command plugin is a trivial frontend provider plugin loaded by the tests.
+package main
+
+import (
+	"github.com/fberrez/samantha/capsule"
+	"github.com/fberrez/samantha/frontend/provider"
+)
+
+type (
+	// Plugin is a provider doing nothing.
+	Plugin struct{}
+)
+
+// NewProvider returns a new plugin provider.
+func NewProvider() provider.Provider {
+	return &Plugin{}
+}
+
+// Initialize returns the provider.
+func (p *Plugin) Initialize(config *provider.Config) (provider.Provider, error) {
+	return p, nil
+}
+
+// Start does nothing.
+func (p *Plugin) Start() {}
+
+// Message drops the capsule.
+func (p *Plugin) Message(c *capsule.Capsule) error {
+	return nil
+}
+
+// GetLabel returns the label of the provider.
+func (p *Plugin) GetLabel() string {
+	return "Plugin"
+}
+
+// Stop does nothing.
+func (p *Plugin) Stop() error {
+	return nil
+}
+
+func main() {}
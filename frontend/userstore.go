@@ -0,0 +1,57 @@
+package frontend
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/fberrez/samantha/frontend/provider"
+)
+
+var (
+	// userStoresMutex protects the userStores map.
+	userStoresMutex sync.Mutex
+
+	// userStores indexes the user stores registered with RegisterUserStore by
+	// provider label.
+	userStores = map[string]provider.UserStore{}
+)
+
+// RegisterUserStore registers the store of the authorized users of the given
+// provider (ex: a database). It must be called before New.
+func RegisterUserStore(providerLabel string, store provider.UserStore) {
+	userStoresMutex.Lock()
+	defer userStoresMutex.Unlock()
+
+	userStores[strings.ToLower(providerLabel)] = store
+}
+
+// loadUserStore returns the store of the authorized users of the provider:
+// the registered store, the users file, or the authorized users of the
+// configuration.
+func loadUserStore(pc *ProviderConfig) (provider.UserStore, error) {
+	userStoresMutex.Lock()
+	store, ok := userStores[pc.Label]
+	userStoresMutex.Unlock()
+	if ok {
+		return store, nil
+	}
+
+	if len(pc.AuthorizedUsersFile) > 0 {
+		return provider.NewFileUserStore(pc.AuthorizedUsersFile)
+	}
+
+	return provider.NewMemoryUserStore(pc.AuthorizedUsers), nil
+}
+
+// watchUsers notifies the provider of the changes of its authorized users,
+// when both the provider and the store support it.
+func watchUsers(p provider.Provider, store provider.UserStore) {
+	reloader, ok := p.(provider.UserReloader)
+	if !ok {
+		return
+	}
+
+	if watcher, ok := store.(provider.UserWatcher); ok {
+		watcher.Watch(reloader.SetAuthorizedUsers)
+	}
+}
@@ -0,0 +1,89 @@
+package transport
+
+import (
+	"sync"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/juju/errors"
+)
+
+type (
+	// Memory is the in-process transport. The capsules are passed on a
+	// channel without being serialized.
+	Memory struct {
+		// mutex protects the closed flag.
+		mutex sync.RWMutex
+
+		// closed is true once the transport is closed.
+		closed bool
+
+		// done is closed when the transport is closed, so the pending
+		// publications return.
+		done chan struct{}
+
+		// publishing waits for the publications in progress before the
+		// capsules channel is closed.
+		publishing sync.WaitGroup
+
+		// capsules is the channel carrying the capsules.
+		capsules chan *capsule.Capsule
+	}
+)
+
+const (
+	// memoryBufferSize is the number of capsules buffered by the in-process
+	// transport, so the publisher is not held by a slow subscriber.
+	memoryBufferSize = 100
+)
+
+// NewMemory initializes a new in-process transport.
+func NewMemory() *Memory {
+	return &Memory{
+		done:     make(chan struct{}),
+		capsules: make(chan *capsule.Capsule, memoryBufferSize),
+	}
+}
+
+// Publish sends the capsule to the subscriber. It blocks only when the buffer
+// is full, until the capsule is received or the transport is closed.
+func (m *Memory) Publish(capsule *capsule.Capsule) error {
+	m.mutex.RLock()
+	if m.closed {
+		m.mutex.RUnlock()
+		return errors.NotValidf("publishing on closed transport")
+	}
+
+	m.publishing.Add(1)
+	m.mutex.RUnlock()
+	defer m.publishing.Done()
+
+	select {
+	case m.capsules <- capsule:
+		return nil
+	case <-m.done:
+		return errors.NotValidf("publishing on closed transport")
+	}
+}
+
+// Subscribe returns the channel receiving the published capsules.
+func (m *Memory) Subscribe() <-chan *capsule.Capsule {
+	return m.capsules
+}
+
+// Close closes the subscription channel once the publications in progress
+// return. The capsules already buffered are still received.
+func (m *Memory) Close() error {
+	m.mutex.Lock()
+	if m.closed {
+		m.mutex.Unlock()
+		return nil
+	}
+
+	m.closed = true
+	close(m.done)
+	m.mutex.Unlock()
+
+	m.publishing.Wait()
+	close(m.capsules)
+	return nil
+}
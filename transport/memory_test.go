@@ -0,0 +1,137 @@
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/google/uuid"
+)
+
+// testTimeout is the maximum duration to wait for a capsule in the tests.
+const testTimeout = 5 * time.Second
+
+// next returns the next capsule received on the channel.
+func next(t *testing.T, capsules <-chan *capsule.Capsule) *capsule.Capsule {
+	t.Helper()
+
+	select {
+	case c, ok := <-capsules:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return c
+	case <-time.After(testTimeout):
+		t.Fatal("no capsule received")
+		return nil
+	}
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	sent := []*capsule.Capsule{
+		{OriginalMessage: uuid.New(), Content: "first"},
+		{OriginalMessage: uuid.New(), Content: "second"},
+	}
+
+	// The publications do not wait for the subscriber.
+	for _, c := range sent {
+		if err := m.Publish(c); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+
+	for _, want := range sent {
+		if got := next(t, m.Subscribe()); got != want {
+			t.Errorf("received %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestMemoryClose(t *testing.T) {
+	m := NewMemory()
+	buffered := &capsule.Capsule{OriginalMessage: uuid.New()}
+	if err := m.Publish(buffered); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+
+	if err := m.Publish(&capsule.Capsule{}); err == nil {
+		t.Error("expected an error when publishing on a closed transport")
+	}
+
+	// The buffered capsules are received before the end of the subscription.
+	if got := next(t, m.Subscribe()); got != buffered {
+		t.Errorf("received %+v, want the buffered capsule", got)
+	}
+
+	if _, ok := <-m.Subscribe(); ok {
+		t.Error("subscription not closed")
+	}
+}
+
+func TestMemoryCloseFullBuffer(t *testing.T) {
+	m := NewMemory()
+	for i := 0; i < memoryBufferSize; i++ {
+		if err := m.Publish(&capsule.Capsule{}); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+
+	// The publication waiting for room in the buffer returns on close.
+	published := make(chan error)
+	go func() {
+		published <- m.Publish(&capsule.Capsule{})
+	}()
+
+	closed := make(chan struct{})
+	go func() {
+		m.Close()
+		close(closed)
+	}()
+
+	select {
+	case err := <-published:
+		if err == nil {
+			t.Error("expected an error when the transport is closed")
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("publication still blocked after close")
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(testTimeout):
+		t.Fatal("Close() did not return")
+	}
+}
+
+func TestPump(t *testing.T) {
+	m := NewMemory()
+	capsules := make(chan *capsule.Capsule)
+	done := make(chan struct{})
+	go func() {
+		Pump(capsules, m)
+		close(done)
+	}()
+
+	sent := &capsule.Capsule{OriginalMessage: uuid.New()}
+	capsules <- sent
+	if got := next(t, m.Subscribe()); got != sent {
+		t.Errorf("received %+v, want %+v", got, sent)
+	}
+
+	close(capsules)
+	select {
+	case <-done:
+	case <-time.After(testTimeout):
+		t.Fatal("Pump() did not return once the channel was closed")
+	}
+}
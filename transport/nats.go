@@ -0,0 +1,169 @@
+package transport
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+)
+
+type (
+	// NATS is a transport publishing the capsules on a NATS subject, so the
+	// frontend and the backend can run in separate processes. The client
+	// reconnects to the server until the transport is closed, and uses TLS
+	// when the server requires it.
+	NATS struct {
+		// subject is the subject on which the capsules are published.
+		subject string
+
+		// queue is the queue group of the subscription. Each capsule is
+		// received by a single subscriber of the group. The capsules are
+		// received by every subscriber when it is empty.
+		queue string
+
+		// conn is the connection to the NATS server.
+		conn *nats.Conn
+
+		// messages is the channel receiving the messages of the subscription.
+		// The client reads the connection in its own routine: it drops the
+		// messages when the channel is full instead of blocking the pings.
+		messages chan *nats.Msg
+
+		// capsules is the channel receiving the capsules of the subscription.
+		capsules chan *capsule.Capsule
+
+		// closed is closed by Close, so the delivery routine stops.
+		closed chan struct{}
+
+		// subscribe subscribes to the subject once.
+		subscribe sync.Once
+
+		// close closes the transport once.
+		close sync.Once
+	}
+)
+
+const (
+	// natsDialTimeout is the timeout of the connection to the server.
+	natsDialTimeout = 10 * time.Second
+
+	// natsReconnectWait is the delay between two reconnection attempts.
+	natsReconnectWait = 2 * time.Second
+
+	// natsPendingSize is the number of received messages waiting for their
+	// delivery on the subscription channel.
+	natsPendingSize = 1024
+)
+
+// NewNATS connects to the NATS server. The subject is subscribed on the first
+// call to Subscribe, in the given queue group if any.
+func NewNATS(serverURL, subject, queue string) (*NATS, error) {
+	n := &NATS{
+		subject:  subject,
+		queue:    queue,
+		messages: make(chan *nats.Msg, natsPendingSize),
+		capsules: make(chan *capsule.Capsule),
+		closed:   make(chan struct{}),
+	}
+
+	conn, err := nats.Connect(serverURL,
+		nats.Name("samantha"),
+		nats.Timeout(natsDialTimeout),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(natsReconnectWait),
+		nats.DisconnectErrHandler(func(conn *nats.Conn, err error) {
+			logger.WithError(err).Warnf("Disconnected from NATS, reconnecting to subject %s", subject)
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			logger.Infof("Reconnected to NATS server %s", conn.ConnectedUrl())
+		}),
+		nats.ErrorHandler(func(conn *nats.Conn, sub *nats.Subscription, err error) {
+			logger.WithError(err).Errorf("NATS error on subject %s", subject)
+		}),
+	)
+	if err != nil {
+		return nil, errors.Annotatef(err, "connecting to %s", serverURL)
+	}
+
+	n.conn = conn
+	go n.deliver()
+	return n, nil
+}
+
+// Publish publishes the capsule on the subject. A streamed response cannot
+// cross the processes: it is collected into the responses before the capsule
+// is published. The capsules published while the client reconnects are
+// buffered and sent once reconnected.
+func (n *NATS) Publish(capsule *capsule.Capsule) error {
+	capsule.CollectStream()
+
+	data, err := marshal(capsule)
+	if err != nil {
+		return errors.Annotate(err, "marshaling capsule")
+	}
+
+	if err := n.conn.Publish(n.subject, data); err != nil {
+		return errors.Annotate(err, "publishing capsule")
+	}
+
+	return nil
+}
+
+// Subscribe subscribes to the subject and returns the channel receiving the
+// capsules published on it. The process only publishing on a subject never
+// subscribes to it, so it does not receive its own capsules. The subscription
+// is restored by the client after a reconnection.
+func (n *NATS) Subscribe() <-chan *capsule.Capsule {
+	n.subscribe.Do(func() {
+		var err error
+		if len(n.queue) > 0 {
+			_, err = n.conn.ChanQueueSubscribe(n.subject, n.queue, n.messages)
+		} else {
+			_, err = n.conn.ChanSubscribe(n.subject, n.messages)
+		}
+
+		if err != nil {
+			logger.WithError(err).Error("Cannot subscribe to NATS subject")
+		}
+	})
+
+	return n.capsules
+}
+
+// Close closes the connection. The subscription channel is closed once the
+// delivery routine returns.
+func (n *NATS) Close() error {
+	n.close.Do(func() {
+		n.conn.Close()
+		close(n.closed)
+	})
+
+	return nil
+}
+
+// deliver unmarshals the received messages and sends them on the subscription
+// channel until the transport is closed.
+func (n *NATS) deliver() {
+	defer close(n.capsules)
+
+	for {
+		select {
+		case msg := <-n.messages:
+			c, err := unmarshal(msg.Data)
+			if err != nil {
+				logger.WithError(err).Warn("Cannot unmarshal published capsule")
+				continue
+			}
+
+			select {
+			case n.capsules <- c:
+			case <-n.closed:
+				return
+			}
+		case <-n.closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package transport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/google/uuid"
+)
+
+type (
+	// fakeNATS is a NATS server sending the published messages to the
+	// subscriptions, once per queue group.
+	fakeNATS struct {
+		// listener is the listener of the server.
+		listener net.Listener
+
+		// mutex protects the connections and the subscriptions.
+		mutex sync.Mutex
+
+		// conns is a slice containing the open connections.
+		conns []net.Conn
+
+		// subscriptions is a slice containing the subscriptions.
+		subscriptions []*fakeSubscription
+
+		// pongs receives the answers to the pings of the server.
+		pongs chan struct{}
+	}
+
+	// fakeSubscription is a subscription to the fake NATS server.
+	fakeSubscription struct {
+		// conn is the connection of the subscriber.
+		conn net.Conn
+
+		// subject is the subscribed subject.
+		subject string
+
+		// queue is the queue group of the subscription.
+		queue string
+
+		// sid is the ID of the subscription.
+		sid string
+	}
+)
+
+// serveNATS runs a fake NATS server until the end of the test.
+func serveNATS(t *testing.T) *fakeNATS {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeNATS{listener: listener, pongs: make(chan struct{}, 10)}
+	t.Cleanup(func() {
+		listener.Close()
+		s.disconnect()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			s.mutex.Lock()
+			s.conns = append(s.conns, conn)
+			s.mutex.Unlock()
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+// url returns the URL of the server.
+func (s *fakeNATS) url() string {
+	return "nats://" + s.listener.Addr().String()
+}
+
+// serve reads the commands of a client until it disconnects.
+func (s *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+
+	fmt.Fprint(conn, "INFO {\"server_id\":\"fake\",\"max_payload\":1048576}\r\n")
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		fields := strings.Fields(line)
+		switch {
+		case strings.HasPrefix(line, "PING"):
+			fmt.Fprint(conn, "PONG\r\n")
+		case strings.HasPrefix(line, "PONG"):
+			s.pongs <- struct{}{}
+		case strings.HasPrefix(line, "SUB "):
+			sub := &fakeSubscription{conn: conn, subject: fields[1], sid: fields[len(fields)-1]}
+			if len(fields) == 4 {
+				sub.queue = fields[2]
+			}
+
+			s.mutex.Lock()
+			s.subscriptions = append(s.subscriptions, sub)
+			s.mutex.Unlock()
+		case strings.HasPrefix(line, "PUB "):
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+
+			s.publish(fields[1], payload[:size])
+		}
+	}
+}
+
+// publish sends the payload to the subscriptions of the subject: to each
+// subscription without queue group and to the first subscription of each
+// queue group.
+func (s *fakeNATS) publish(subject string, payload []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	queues := map[string]bool{}
+	for _, sub := range s.subscriptions {
+		if sub.subject != subject || queues[sub.queue] {
+			continue
+		}
+
+		if len(sub.queue) > 0 {
+			queues[sub.queue] = true
+		}
+
+		fmt.Fprintf(sub.conn, "MSG %s %s %d\r\n%s\r\n", subject, sub.sid, len(payload), payload)
+	}
+}
+
+// ping pings every client.
+func (s *fakeNATS) ping() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, conn := range s.conns {
+		fmt.Fprint(conn, "PING\r\n")
+	}
+}
+
+// disconnect closes the connections of the clients, and forgets their
+// subscriptions.
+func (s *fakeNATS) disconnect() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+
+	s.conns = nil
+	s.subscriptions = nil
+}
+
+// subscribed waits until the server has the given number of subscriptions.
+func (s *fakeNATS) subscribed(t *testing.T, count int) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		s.mutex.Lock()
+		subscriptions := len(s.subscriptions)
+		s.mutex.Unlock()
+
+		if subscriptions >= count {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("%d subscriptions, want %d", subscriptions, count)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// newTestNATS connects a NATS transport to the fake server.
+func newTestNATS(t *testing.T, s *fakeNATS, subject, queue string) *NATS {
+	t.Helper()
+
+	n, err := NewNATS(s.url(), subject, queue)
+	if err != nil {
+		t.Fatalf("NewNATS() error = %v", err)
+	}
+	t.Cleanup(func() { n.Close() })
+
+	return n
+}
+
+func TestNATS(t *testing.T) {
+	s := serveNATS(t)
+	n := newTestNATS(t, s, ToFrontend, "")
+	capsules := n.Subscribe()
+	s.subscribed(t, 1)
+
+	stream := make(chan string, 2)
+	stream <- "Hello "
+	stream <- "world"
+	close(stream)
+
+	sent := &capsule.Capsule{
+		OriginalMessage:  uuid.New(),
+		FrontendProvider: "test",
+		Responses:        []string{"first"},
+		Stream:           stream,
+	}
+
+	if err := n.Publish(sent); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	// The stream is collected into the responses before the publication.
+	got := next(t, capsules)
+	if got.OriginalMessage != sent.OriginalMessage || got.Stream != nil {
+		t.Errorf("received %+v, want %+v", got, sent)
+	}
+
+	want := []string{"first", "Hello world"}
+	if !reflect.DeepEqual(got.Responses, want) {
+		t.Errorf("responses = %v, want %v", got.Responses, want)
+	}
+}
+
+func TestNATSQueueGroup(t *testing.T) {
+	s := serveNATS(t)
+	first := newTestNATS(t, s, ToBackend, backendQueue)
+	second := newTestNATS(t, s, ToBackend, backendQueue)
+	publisher := newTestNATS(t, s, ToBackend, "")
+
+	received := make(chan *capsule.Capsule, 10)
+	for _, n := range []*NATS{first, second} {
+		go func(capsules <-chan *capsule.Capsule) {
+			for c := range capsules {
+				received <- c
+			}
+		}(n.Subscribe())
+	}
+	s.subscribed(t, 2)
+
+	if err := publisher.Publish(&capsule.Capsule{OriginalMessage: uuid.New()}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	// The capsule is processed by a single backend of the group.
+	next(t, received)
+	select {
+	case c := <-received:
+		t.Errorf("capsule %+v received twice", c)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNATSReconnect(t *testing.T) {
+	s := serveNATS(t)
+	n := newTestNATS(t, s, ToBackend, backendQueue)
+	capsules := n.Subscribe()
+	s.subscribed(t, 1)
+
+	// The subscription is restored once the client reconnected.
+	s.disconnect()
+	s.subscribed(t, 1)
+
+	sent := &capsule.Capsule{OriginalMessage: uuid.New()}
+	if err := n.Publish(sent); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	if got := next(t, capsules); got.OriginalMessage != sent.OriginalMessage {
+		t.Errorf("received %+v, want %+v", got, sent)
+	}
+}
+
+func TestNATSSlowConsumer(t *testing.T) {
+	s := serveNATS(t)
+	n := newTestNATS(t, s, ToBackend, "")
+	capsules := n.Subscribe()
+	s.subscribed(t, 1)
+
+	// The pings are answered while the capsules are not consumed.
+	for i := 0; i < 3; i++ {
+		if err := n.Publish(&capsule.Capsule{OriginalMessage: uuid.New()}); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+
+	s.ping()
+	select {
+	case <-s.pongs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ping not answered")
+	}
+
+	for i := 0; i < 3; i++ {
+		next(t, capsules)
+	}
+}
+
+func TestNATSClose(t *testing.T) {
+	s := serveNATS(t)
+	n := newTestNATS(t, s, ToBackend, "")
+
+	capsules := n.Subscribe()
+	if err := n.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	for range capsules {
+	}
+}
@@ -0,0 +1,105 @@
+package transport
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/fberrez/samantha/capsule"
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Transport carries the capsules between the frontend and the backend.
+	// There is a transport per direction.
+	Transport interface {
+		// Publish sends the capsule to the subscriber.
+		Publish(capsule *capsule.Capsule) error
+
+		// Subscribe returns the channel receiving the published capsules. It is
+		// closed when the transport is closed.
+		Subscribe() <-chan *capsule.Capsule
+
+		// Close closes the transport.
+		Close() error
+	}
+)
+
+const (
+	// transportEnv is the name of the environment variable containing the
+	// transport kind: memory (default) or nats.
+	transportEnv = "SAMANTHA_TRANSPORT"
+
+	// natsURLEnv is the name of the environment variable containing the NATS
+	// server URL.
+	natsURLEnv = "NATS_URL"
+
+	// defaultNATSURL is the default NATS server URL.
+	defaultNATSURL = "nats://localhost:4222"
+
+	// ToBackend and ToFrontend are the subjects of the two directions.
+	ToBackend  = "samantha.backend"
+	ToFrontend = "samantha.frontend"
+
+	// backendQueue is the queue group of the backends, so each capsule is
+	// processed by a single backend when several of them run. The responses
+	// are received by every frontend.
+	backendQueue = "samantha.backends"
+)
+
+var (
+	// logger is a global logger of the package
+	logger = log.WithField("package", "transport")
+)
+
+// New initializes the transport of the given subject according to the
+// transport kind defined in a environment variable.
+func New(subject string) (Transport, error) {
+	switch kind := os.Getenv(transportEnv); kind {
+	case "", "memory":
+		return NewMemory(), nil
+	case "nats":
+		url := os.Getenv(natsURLEnv)
+		if url == "" {
+			url = defaultNATSURL
+		}
+
+		queue := ""
+		if subject == ToBackend {
+			queue = backendQueue
+		}
+
+		t, err := NewNATS(url, subject, queue)
+		if err != nil {
+			return nil, errors.Annotatef(err, "initializing transport %s", subject)
+		}
+
+		return t, nil
+	default:
+		return nil, errors.NotSupportedf("transport %s", kind)
+	}
+}
+
+// Pump publishes the capsules received from the channel until it is closed.
+func Pump(capsules <-chan *capsule.Capsule, t Transport) {
+	for c := range capsules {
+		if err := t.Publish(c); err != nil {
+			logger.WithError(err).Error("Cannot publish capsule")
+		}
+	}
+}
+
+// marshal serializes a capsule.
+func marshal(c *capsule.Capsule) ([]byte, error) {
+	return json.Marshal(c)
+}
+
+// unmarshal deserializes a capsule.
+func unmarshal(data []byte) (*capsule.Capsule, error) {
+	c := &capsule.Capsule{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}